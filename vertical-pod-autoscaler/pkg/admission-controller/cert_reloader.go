@@ -0,0 +1,112 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// certReloader serves the current server certificate, reloading it
+// periodically so that rotated certificates are picked up without a restart.
+type certReloader struct {
+	load func() (certsContainer, error)
+	// onCAChange is called with the new CA bundle, merged with the current one,
+	// before certificates signed by the new CA are served. If it fails, the
+	// current certificates are kept and the change is retried on the next
+	// reload. Optional.
+	onCAChange func(caBundle []byte) error
+
+	mutex sync.RWMutex
+	certs certsContainer
+	cert  *tls.Certificate
+}
+
+func newCertReloader(load func() (certsContainer, error), onCAChange func(caBundle []byte) error) (*certReloader, error) {
+	certs, err := load()
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.X509KeyPair(certs.serverCert, certs.serverKey)
+	if err != nil {
+		return nil, err
+	}
+	return &certReloader{
+		load:       load,
+		onCAChange: onCAChange,
+		certs:      certs,
+		cert:       &cert,
+	}, nil
+}
+
+// reload loads the certificates and starts serving them if they changed.
+func (r *certReloader) reload() error {
+	certs, err := r.load()
+	if err != nil {
+		return err
+	}
+	current := r.currentCerts()
+	if bytes.Equal(certs.caCert, current.caCert) && bytes.Equal(certs.serverCert, current.serverCert) && bytes.Equal(certs.serverKey, current.serverKey) {
+		return nil
+	}
+	cert, err := tls.X509KeyPair(certs.serverCert, certs.serverKey)
+	if err != nil {
+		return err
+	}
+	if len(certs.caCert) == 0 {
+		return fmt.Errorf("loaded certificates have no CA")
+	}
+	if !bytes.Equal(certs.caCert, current.caCert) && r.onCAChange != nil {
+		if err := r.onCAChange(mergeCABundles(certs.caCert, current.caCert)); err != nil {
+			return fmt.Errorf("cannot update the CA bundle, keeping the current certificates: %v", err)
+		}
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.certs = certs
+	r.cert = &cert
+	klog.V(1).Infof("Reloaded server certificate")
+	return nil
+}
+
+// run reloads the certificates every interval until stopCh is closed.
+func (r *certReloader) run(interval time.Duration, stopCh <-chan struct{}) {
+	wait.Until(func() {
+		if err := r.reload(); err != nil {
+			klog.Errorf("Cannot reload certificates: %v", err)
+		}
+	}, interval, stopCh)
+}
+
+// GetCertificate returns the current server certificate, as tls.Config.GetCertificate.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.cert, nil
+}
+
+func (r *certReloader) currentCerts() certsContainer {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.certs
+}
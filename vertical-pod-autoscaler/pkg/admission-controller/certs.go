@@ -17,8 +17,21 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
 	"io/ioutil"
+	"math/big"
+	"time"
 
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
 )
 
@@ -30,21 +43,226 @@ type certsConfig struct {
 	clientCaFile, tlsCertFile, tlsPrivateKey *string
 }
 
-func readFile(filePath string) []byte {
+func readFile(filePath string) ([]byte, error) {
 	res, err := ioutil.ReadFile(filePath)
 	if err != nil {
-		klog.Errorf("Error reading certificate file at %s: %v", filePath, err)
-		return nil
+		return nil, fmt.Errorf("error reading certificate file at %s: %v", filePath, err)
+	}
+	if len(res) == 0 {
+		return nil, fmt.Errorf("certificate file at %s is empty", filePath)
 	}
 
 	klog.V(3).Infof("Successfully read %d bytes from %v", len(res), filePath)
-	return res
+	return res, nil
 }
 
-func initCerts(config certsConfig) certsContainer {
+// initCerts reads the certificates from the configured files. It fails if any
+// of them can't be read, so that a file being replaced, e.g. by the kubelet
+// updating a mounted secret, doesn't drop the current CA from the bundle.
+func initCerts(config certsConfig) (certsContainer, error) {
 	res := certsContainer{}
-	res.caCert = readFile(*config.clientCaFile)
-	res.serverCert = readFile(*config.tlsCertFile)
-	res.serverKey = readFile(*config.tlsPrivateKey)
-	return res
+	var err error
+	if res.caCert, err = readFile(*config.clientCaFile); err != nil {
+		return certsContainer{}, err
+	}
+	if res.serverCert, err = readFile(*config.tlsCertFile); err != nil {
+		return certsContainer{}, err
+	}
+	if res.serverKey, err = readFile(*config.tlsPrivateKey); err != nil {
+		return certsContainer{}, err
+	}
+	return res, nil
+}
+
+const (
+	caCertSecretKey         = "caCert.pem"
+	caKeySecretKey          = "caKey.pem"
+	serverCertSecretKey     = "serverCert.pem"
+	serverKeySecretKey      = "serverKey.pem"
+	previousCaCertSecretKey = "previousCaCert.pem"
+
+	// Fraction of the validity of certificates after which they are rotated.
+	certRotationFraction = 0.8
+)
+
+// loadOrCreateCertsSecret reads certificates from the secret, laid out as by
+// gencerts.sh. If the secret doesn't exist, certificates for the webhook
+// service are generated and stored in it. Replicas starting at the same time
+// race to create the secret, and all of them use the certificates of the one
+// which won, so they serve the same CA bundle.
+// Certificates signed by a CA whose key is in the secret are rotated once past
+// certRotationFraction of their validity. The CA bundle keeps the previous CA
+// until the next rotation, so that replicas which didn't reload the rotated
+// certificates yet are still trusted.
+func loadOrCreateCertsSecret(client kubernetes.Interface, namespace, secretName, serviceName string, validity time.Duration) (certsContainer, error) {
+	secrets := client.CoreV1().Secrets(namespace)
+	secret, err := secrets.Get(context.TODO(), secretName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		secret, err = newCertsSecret(namespace, secretName, serviceName, validity)
+		if err != nil {
+			return certsContainer{}, fmt.Errorf("cannot generate certificates: %v", err)
+		}
+		var created *apiv1.Secret
+		created, err = secrets.Create(context.TODO(), secret, metav1.CreateOptions{})
+		if err == nil {
+			klog.V(1).Infof("Stored generated certificates in secret %s/%s", namespace, secretName)
+			secret = created
+		} else if apierrors.IsAlreadyExists(err) {
+			klog.V(1).Infof("Secret %s/%s was created by another replica, using its certificates", namespace, secretName)
+			secret, err = secrets.Get(context.TODO(), secretName, metav1.GetOptions{})
+		}
+	}
+	if err != nil {
+		return certsContainer{}, fmt.Errorf("cannot get certificates secret %s/%s: %v", namespace, secretName, err)
+	}
+	if len(secret.Data[caKeySecretKey]) > 0 && needsRotation(secret.Data[serverCertSecretKey], time.Now()) {
+		secret, err = rotateCertsSecret(client, secret, serviceName, validity)
+		if err != nil {
+			return certsContainer{}, fmt.Errorf("cannot rotate certificates in secret %s/%s: %v", namespace, secretName, err)
+		}
+	}
+	res := certsContainer{
+		caCert:     caBundle(secret),
+		serverCert: secret.Data[serverCertSecretKey],
+		serverKey:  secret.Data[serverKeySecretKey],
+	}
+	if len(res.caCert) == 0 || len(res.serverCert) == 0 || len(res.serverKey) == 0 {
+		return certsContainer{}, fmt.Errorf("secret %s/%s must contain %s, %s and %s", namespace, secretName, caCertSecretKey, serverCertSecretKey, serverKeySecretKey)
+	}
+	return res, nil
+}
+
+// needsRotation returns true if the PEM encoded certificate is past
+// certRotationFraction of its validity, or can't be parsed.
+func needsRotation(certPEM []byte, now time.Time) bool {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		klog.Errorf("Cannot decode server certificate, rotating it")
+		return true
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		klog.Errorf("Cannot parse server certificate, rotating it: %v", err)
+		return true
+	}
+	validity := cert.NotAfter.Sub(cert.NotBefore)
+	return now.After(cert.NotBefore.Add(time.Duration(float64(validity) * certRotationFraction)))
+}
+
+// rotateCertsSecret replaces the certificates in the secret with new ones,
+// keeping its current CA as the previous one. If another replica rotated them
+// first, the secret it updated is returned.
+func rotateCertsSecret(client kubernetes.Interface, secret *apiv1.Secret, serviceName string, validity time.Duration) (*apiv1.Secret, error) {
+	generated, err := newCertsSecret(secret.Namespace, secret.Name, serviceName, validity)
+	if err != nil {
+		return nil, err
+	}
+	rotated := secret.DeepCopy()
+	rotated.Data = generated.Data
+	rotated.Data[previousCaCertSecretKey] = secret.Data[caCertSecretKey]
+	secrets := client.CoreV1().Secrets(secret.Namespace)
+	updated, err := secrets.Update(context.TODO(), rotated, metav1.UpdateOptions{})
+	if apierrors.IsConflict(err) {
+		klog.V(1).Infof("Certificates in secret %s/%s were rotated by another replica", secret.Namespace, secret.Name)
+		return secrets.Get(context.TODO(), secret.Name, metav1.GetOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	klog.V(1).Infof("Rotated certificates in secret %s/%s", secret.Namespace, secret.Name)
+	return updated, nil
+}
+
+// caBundle returns the CA certificates of the secret, including the previous
+// CA if any.
+func caBundle(secret *apiv1.Secret) []byte {
+	bundle := append([]byte{}, secret.Data[caCertSecretKey]...)
+	return append(bundle, secret.Data[previousCaCertSecretKey]...)
+}
+
+// mergeCABundles returns the PEM blocks of the new CA bundle followed by the
+// blocks of the old bundle missing from it, so that certificates signed by
+// either CA are trusted.
+func mergeCABundles(newBundle, oldBundle []byte) []byte {
+	merged := append([]byte{}, newBundle...)
+	present := make(map[string]bool)
+	for rest := newBundle; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		present[string(block.Bytes)] = true
+	}
+	for rest := oldBundle; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if !present[string(block.Bytes)] {
+			present[string(block.Bytes)] = true
+			merged = append(merged, pem.EncodeToMemory(block)...)
+		}
+	}
+	return merged
+}
+
+// newCertsSecret generates a CA and a server certificate signed by it for the
+// webhook service, valid for the given duration.
+func newCertsSecret(namespace, secretName, serviceName string, validity time.Duration) (*apiv1.Secret, error) {
+	now := time.Now()
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "vpa_webhook_ca"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, err
+	}
+
+	serverKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	serverName := fmt.Sprintf("%s.%s.svc", serviceName, namespace)
+	serverTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: serverName},
+		DNSNames:     []string{serviceName, fmt.Sprintf("%s.%s", serviceName, namespace), serverName},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	serverDER, err := x509.CreateCertificate(rand.Reader, serverTemplate, caCert, &serverKey.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      secretName,
+		},
+		Data: map[string][]byte{
+			caCertSecretKey:     pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}),
+			caKeySecretKey:      pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(caKey)}),
+			serverCertSecretKey: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: serverDER}),
+			serverKeySecretKey:  pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(serverKey)}),
+		},
+	}, nil
 }
@@ -0,0 +1,202 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
+)
+
+const testCertValidity = 365 * 24 * time.Hour
+
+func TestLoadOrCreateCertsSecret(t *testing.T) {
+	client := fake.NewSimpleClientset()
+
+	first, err := loadOrCreateCertsSecret(client, "kube-system", "vpa-tls-certs", "vpa-webhook", testCertValidity)
+	assert.NoError(t, err)
+	second, err := loadOrCreateCertsSecret(client, "kube-system", "vpa-tls-certs", "vpa-webhook", testCertValidity)
+	assert.NoError(t, err)
+	assert.Equal(t, first, second)
+
+	roots := x509.NewCertPool()
+	assert.True(t, roots.AppendCertsFromPEM(first.caCert))
+	serverCert, err := tls.X509KeyPair(first.serverCert, first.serverKey)
+	assert.NoError(t, err)
+	leaf, err := x509.ParseCertificate(serverCert.Certificate[0])
+	assert.NoError(t, err)
+	_, err = leaf.Verify(x509.VerifyOptions{DNSName: "vpa-webhook.kube-system.svc", Roots: roots})
+	assert.NoError(t, err)
+}
+
+func TestLoadOrCreateCertsSecretCreatedByAnotherReplica(t *testing.T) {
+	existing, err := newCertsSecret("kube-system", "vpa-tls-certs", "vpa-webhook", testCertValidity)
+	assert.NoError(t, err)
+	client := fake.NewSimpleClientset()
+	// The secret doesn't exist when this replica checks, but another replica
+	// creates it before this one does.
+	client.PrependReactor("create", "secrets", func(action core.Action) (bool, runtime.Object, error) {
+		assert.NoError(t, client.Tracker().Add(existing))
+		return true, nil, apierrors.NewAlreadyExists(apiv1.Resource("secrets"), "vpa-tls-certs")
+	})
+
+	certs, err := loadOrCreateCertsSecret(client, "kube-system", "vpa-tls-certs", "vpa-webhook", testCertValidity)
+	assert.NoError(t, err)
+	assert.Equal(t, existing.Data[caCertSecretKey], certs.caCert)
+	assert.Equal(t, existing.Data[serverCertSecretKey], certs.serverCert)
+}
+
+func TestLoadCertsSecretMissingKeys(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	secret, err := newCertsSecret("kube-system", "vpa-tls-certs", "vpa-webhook", testCertValidity)
+	assert.NoError(t, err)
+	delete(secret.Data, serverKeySecretKey)
+	assert.NoError(t, client.Tracker().Add(secret))
+
+	_, err = loadOrCreateCertsSecret(client, "kube-system", "vpa-tls-certs", "vpa-webhook", testCertValidity)
+	assert.Error(t, err)
+}
+
+func TestNeedsRotation(t *testing.T) {
+	secret, err := newCertsSecret("kube-system", "vpa-tls-certs", "vpa-webhook", testCertValidity)
+	assert.NoError(t, err)
+	assert.False(t, needsRotation(secret.Data[serverCertSecretKey], time.Now()))
+	assert.False(t, needsRotation(secret.Data[serverCertSecretKey], time.Now().Add(250*24*time.Hour)))
+	assert.True(t, needsRotation(secret.Data[serverCertSecretKey], time.Now().Add(300*24*time.Hour)))
+	assert.True(t, needsRotation([]byte("invalid"), time.Now()))
+}
+
+func TestLoadCertsSecretRotation(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	expired, err := newCertsSecret("kube-system", "vpa-tls-certs", "vpa-webhook", time.Minute)
+	assert.NoError(t, err)
+	assert.NoError(t, client.Tracker().Add(expired))
+
+	certs, err := loadOrCreateCertsSecret(client, "kube-system", "vpa-tls-certs", "vpa-webhook", testCertValidity)
+	assert.NoError(t, err)
+	assert.NotEqual(t, expired.Data[serverCertSecretKey], certs.serverCert)
+	assert.False(t, needsRotation(certs.serverCert, time.Now()))
+
+	// The CA bundle trusts both the new and the previous CA.
+	for _, signed := range []*apiv1.Secret{expired, {Data: map[string][]byte{serverCertSecretKey: certs.serverCert, serverKeySecretKey: certs.serverKey}}} {
+		roots := x509.NewCertPool()
+		assert.True(t, roots.AppendCertsFromPEM(certs.caCert))
+		serverCert, err := tls.X509KeyPair(signed.Data[serverCertSecretKey], signed.Data[serverKeySecretKey])
+		assert.NoError(t, err)
+		leaf, err := x509.ParseCertificate(serverCert.Certificate[0])
+		assert.NoError(t, err)
+		_, err = leaf.Verify(x509.VerifyOptions{DNSName: "vpa-webhook.kube-system.svc", Roots: roots})
+		assert.NoError(t, err)
+	}
+
+	// Certificates aren't rotated again.
+	again, err := loadOrCreateCertsSecret(client, "kube-system", "vpa-tls-certs", "vpa-webhook", testCertValidity)
+	assert.NoError(t, err)
+	assert.Equal(t, certs, again)
+}
+
+func TestCertReloader(t *testing.T) {
+	first, err := newCertsSecret("kube-system", "vpa-tls-certs", "vpa-webhook", testCertValidity)
+	assert.NoError(t, err)
+	second, err := newCertsSecret("kube-system", "vpa-tls-certs", "vpa-webhook", testCertValidity)
+	assert.NoError(t, err)
+	current := first
+	load := func() (certsContainer, error) {
+		return certsContainer{
+			caCert:     current.Data[caCertSecretKey],
+			serverCert: current.Data[serverCertSecretKey],
+			serverKey:  current.Data[serverKeySecretKey],
+		}, nil
+	}
+	var caChanges [][]byte
+	var caChangeErr error
+	reloader, err := newCertReloader(load, func(caBundle []byte) error {
+		if caChangeErr != nil {
+			return caChangeErr
+		}
+		caChanges = append(caChanges, caBundle)
+		return nil
+	})
+	assert.NoError(t, err)
+	initial, err := reloader.GetCertificate(nil)
+	assert.NoError(t, err)
+
+	assert.NoError(t, reloader.reload())
+	assert.Empty(t, caChanges)
+	unchanged, _ := reloader.GetCertificate(nil)
+	assert.Same(t, initial, unchanged)
+
+	current = second
+	caChangeErr = fmt.Errorf("update failed")
+	assert.Error(t, reloader.reload())
+	assert.Empty(t, caChanges)
+	notSwitched, _ := reloader.GetCertificate(nil)
+	assert.Same(t, initial, notSwitched)
+
+	caChangeErr = nil
+	assert.NoError(t, reloader.reload())
+	expectedBundle := append(append([]byte{}, second.Data[caCertSecretKey]...), first.Data[caCertSecretKey]...)
+	assert.Equal(t, [][]byte{expectedBundle}, caChanges)
+	reloaded, _ := reloader.GetCertificate(nil)
+	assert.NotEqual(t, initial.Certificate, reloaded.Certificate)
+
+	current = &apiv1.Secret{Data: map[string][]byte{
+		serverCertSecretKey: second.Data[serverCertSecretKey],
+		serverKeySecretKey:  second.Data[serverKeySecretKey],
+	}}
+	assert.Error(t, reloader.reload())
+	assert.Len(t, caChanges, 1)
+}
+
+func TestMergeCABundles(t *testing.T) {
+	first, err := newCertsSecret("kube-system", "vpa-tls-certs", "vpa-webhook", testCertValidity)
+	assert.NoError(t, err)
+	second, err := newCertsSecret("kube-system", "vpa-tls-certs", "vpa-webhook", testCertValidity)
+	assert.NoError(t, err)
+	firstCA, secondCA := first.Data[caCertSecretKey], second.Data[caCertSecretKey]
+
+	assert.Equal(t, append(append([]byte{}, secondCA...), firstCA...), mergeCABundles(secondCA, firstCA))
+	assert.Equal(t, append(append([]byte{}, secondCA...), firstCA...), mergeCABundles(append(append([]byte{}, secondCA...), firstCA...), firstCA))
+	assert.Equal(t, firstCA, mergeCABundles(firstCA, nil))
+}
+
+func TestInitCertsMissingFile(t *testing.T) {
+	dir := t.TempDir()
+	caFile, certFile, keyFile := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	assert.NoError(t, ioutil.WriteFile(certFile, []byte("cert"), 0600))
+	assert.NoError(t, ioutil.WriteFile(keyFile, []byte("key"), 0600))
+	config := certsConfig{clientCaFile: &caFile, tlsCertFile: &certFile, tlsPrivateKey: &keyFile}
+
+	_, err := initCerts(config)
+	assert.Error(t, err)
+
+	assert.NoError(t, ioutil.WriteFile(caFile, []byte("ca"), 0600))
+	certs, err := initCerts(config)
+	assert.NoError(t, err)
+	assert.Equal(t, certsContainer{caCert: []byte("ca"), serverCert: []byte("cert"), serverKey: []byte("key")}, certs)
+}
@@ -22,36 +22,33 @@ import (
 	"time"
 
 	admissionregistration "k8s.io/api/admissionregistration/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
 	"k8s.io/klog/v2"
 )
 
 const (
-	webhookConfigName = "vpa-webhook-config"
+	webhookConfigName           = "vpa-webhook-config"
+	validatingWebhookConfigName = "vpa-validating-webhook-config"
 )
 
-func configTLS(serverCert, serverKey []byte) *tls.Config {
-	sCert, err := tls.X509KeyPair(serverCert, serverKey)
-	if err != nil {
-		klog.Fatal(err)
-	}
+func configTLS(reloader *certReloader) *tls.Config {
 	return &tls.Config{
-		Certificates: []tls.Certificate{sCert},
+		GetCertificate: reloader.GetCertificate,
 	}
 }
 
 // register this webhook admission controller with the kube-apiserver
-// by creating MutatingWebhookConfiguration.
-func selfRegistration(clientset *kubernetes.Clientset, caCert []byte, namespace, serviceName, url string, registerByURL bool, timeoutSeconds int32) {
+// by creating MutatingWebhookConfiguration. The configuration is created or
+// updated in place, so that replicas registering concurrently don't remove
+// each other's registration. If validateWorkloads is true, Deployments and
+// StatefulSets are sent to the webhook by a ValidatingWebhookConfiguration
+// registered next to it.
+func selfRegistration(clientset kubernetes.Interface, caCert []byte, namespace, serviceName, url string, registerByURL bool, timeoutSeconds int32, validateWorkloads bool) {
 	time.Sleep(10 * time.Second)
 	client := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations()
-	_, err := client.Get(context.TODO(), webhookConfigName, metav1.GetOptions{})
-	if err == nil {
-		if err2 := client.Delete(context.TODO(), webhookConfigName, metav1.DeleteOptions{}); err2 != nil {
-			klog.Fatal(err2)
-		}
-	}
 	RegisterClientConfig := admissionregistration.WebhookClientConfig{}
 	if !registerByURL {
 		RegisterClientConfig.Service = &admissionregistration.ServiceReference{
@@ -64,6 +61,24 @@ func selfRegistration(clientset *kubernetes.Clientset, caCert []byte, namespace,
 	sideEffects := admissionregistration.SideEffectClassNone
 	failurePolicy := admissionregistration.Ignore
 	RegisterClientConfig.CABundle = caCert
+	rules := []admissionregistration.RuleWithOperations{
+		{
+			Operations: []admissionregistration.OperationType{admissionregistration.Create},
+			Rule: admissionregistration.Rule{
+				APIGroups:   []string{""},
+				APIVersions: []string{"v1"},
+				Resources:   []string{"pods"},
+			},
+		},
+		{
+			Operations: []admissionregistration.OperationType{admissionregistration.Create, admissionregistration.Update},
+			Rule: admissionregistration.Rule{
+				APIGroups:   []string{"autoscaling.k8s.io"},
+				APIVersions: []string{"*"},
+				Resources:   []string{"verticalpodautoscalers"},
+			},
+		},
+	}
 	webhookConfig := &admissionregistration.MutatingWebhookConfiguration{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: webhookConfigName,
@@ -72,34 +87,137 @@ func selfRegistration(clientset *kubernetes.Clientset, caCert []byte, namespace,
 			{
 				Name:                    "vpa.k8s.io",
 				AdmissionReviewVersions: []string{"v1"},
+				Rules:                   rules,
+				FailurePolicy:           &failurePolicy,
+				ClientConfig:            RegisterClientConfig,
+				SideEffects:             &sideEffects,
+				TimeoutSeconds:          &timeoutSeconds,
+			},
+		},
+	}
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		existing, err := client.Get(context.TODO(), webhookConfigName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			_, err = client.Create(context.TODO(), webhookConfig, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				// Created by another replica in the meantime, update it instead.
+				return apierrors.NewConflict(admissionregistration.Resource("mutatingwebhookconfigurations"), webhookConfigName, err)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		webhookConfig.ResourceVersion = existing.ResourceVersion
+		_, err = client.Update(context.TODO(), webhookConfig, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		klog.Fatal(err)
+	} else {
+		klog.V(3).Info("Self registration as MutatingWebhook succeeded.")
+	}
+	if err := registerWorkloadValidation(clientset, RegisterClientConfig, timeoutSeconds, validateWorkloads); err != nil {
+		klog.Fatal(err)
+	}
+}
+
+// registerWorkloadValidation creates or updates the ValidatingWebhookConfiguration
+// sending Deployments and StatefulSets to the webhook if validateWorkloads is
+// true, and deletes it otherwise. Workloads are validated, never mutated, so
+// they're sent after mutating webhooks ran, and UPDATEs only changing other
+// fields than the pod template, e.g. scaling, are skipped by the handler.
+func registerWorkloadValidation(clientset kubernetes.Interface, clientConfig admissionregistration.WebhookClientConfig, timeoutSeconds int32, validateWorkloads bool) error {
+	client := clientset.AdmissionregistrationV1().ValidatingWebhookConfigurations()
+	if !validateWorkloads {
+		err := client.Delete(context.TODO(), validatingWebhookConfigName, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+	sideEffects := admissionregistration.SideEffectClassNone
+	failurePolicy := admissionregistration.Ignore
+	webhookConfig := &admissionregistration.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: validatingWebhookConfigName,
+		},
+		Webhooks: []admissionregistration.ValidatingWebhook{
+			{
+				Name:                    "workloads.vpa.k8s.io",
+				AdmissionReviewVersions: []string{"v1"},
 				Rules: []admissionregistration.RuleWithOperations{
-					{
-						Operations: []admissionregistration.OperationType{admissionregistration.Create},
-						Rule: admissionregistration.Rule{
-							APIGroups:   []string{""},
-							APIVersions: []string{"v1"},
-							Resources:   []string{"pods"},
-						},
-					},
 					{
 						Operations: []admissionregistration.OperationType{admissionregistration.Create, admissionregistration.Update},
 						Rule: admissionregistration.Rule{
-							APIGroups:   []string{"autoscaling.k8s.io"},
-							APIVersions: []string{"*"},
-							Resources:   []string{"verticalpodautoscalers"},
+							APIGroups:   []string{"apps"},
+							APIVersions: []string{"v1"},
+							Resources:   []string{"deployments", "statefulsets"},
 						},
 					},
 				},
 				FailurePolicy:  &failurePolicy,
-				ClientConfig:   RegisterClientConfig,
+				ClientConfig:   clientConfig,
 				SideEffects:    &sideEffects,
 				TimeoutSeconds: &timeoutSeconds,
 			},
 		},
 	}
-	if _, err := client.Create(context.TODO(), webhookConfig, metav1.CreateOptions{}); err != nil {
-		klog.Fatal(err)
-	} else {
-		klog.V(3).Info("Self registration as MutatingWebhook succeeded.")
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		existing, err := client.Get(context.TODO(), validatingWebhookConfigName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			_, err = client.Create(context.TODO(), webhookConfig, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				// Created by another replica in the meantime, update it instead.
+				return apierrors.NewConflict(admissionregistration.Resource("validatingwebhookconfigurations"), validatingWebhookConfigName, err)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		webhookConfig.ResourceVersion = existing.ResourceVersion
+		_, err = client.Update(context.TODO(), webhookConfig, metav1.UpdateOptions{})
+		return err
+	})
+	if err == nil {
+		klog.V(3).Info("Self registration as ValidatingWebhook succeeded.")
 	}
+	return err
+}
+
+// updateCABundle sets the CA bundle of the webhooks registered by
+// selfRegistration, e.g. after certificates were rotated.
+func updateCABundle(clientset kubernetes.Interface, caCert []byte) error {
+	client := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations()
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		webhookConfig, err := client.Get(context.TODO(), webhookConfigName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		for i := range webhookConfig.Webhooks {
+			webhookConfig.Webhooks[i].ClientConfig.CABundle = caCert
+		}
+		_, err = client.Update(context.TODO(), webhookConfig, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	validatingClient := clientset.AdmissionregistrationV1().ValidatingWebhookConfigurations()
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		webhookConfig, err := validatingClient.Get(context.TODO(), validatingWebhookConfigName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			// Workloads aren't validated.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for i := range webhookConfig.Webhooks {
+			webhookConfig.Webhooks[i].ClientConfig.CABundle = caCert
+		}
+		_, err = validatingClient.Update(context.TODO(), webhookConfig, metav1.UpdateOptions{})
+		return err
+	})
 }
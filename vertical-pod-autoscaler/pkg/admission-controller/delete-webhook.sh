@@ -20,4 +20,5 @@ set -e
 echo "Unregistering VPA admission controller webhook"
 
 kubectl delete -n kube-system mutatingwebhookconfiguration.v1.admissionregistration.k8s.io vpa-webhook-config
+kubectl delete --ignore-not-found validatingwebhookconfiguration.v1.admissionregistration.k8s.io vpa-validating-webhook-config
 
@@ -70,6 +70,7 @@ func (s *AdmissionServer) admit(data []byte) (*v1.AdmissionResponse, metrics_adm
 	response.UID = ar.Request.UID
 
 	var patches []resource.PatchRecord
+	var warnings []string
 	var err error
 	resource := metrics_admission.Unknown
 
@@ -80,7 +81,7 @@ func (s *AdmissionServer) admit(data []byte) (*v1.AdmissionResponse, metrics_adm
 
 	handler, ok := s.resourceHandlers[admittedGroupResource]
 	if ok {
-		patches, err = handler.GetPatches(ar.Request)
+		patches, warnings, err = getPatchesAndWarnings(handler, ar.Request)
 		resource = handler.AdmissionResource()
 
 		if handler.DisallowIncorrectObjects() && err != nil {
@@ -111,6 +112,7 @@ func (s *AdmissionServer) admit(data []byte) (*v1.AdmissionResponse, metrics_adm
 		response.Patch = patch
 		klog.V(4).Infof("Sending patches: %v", patches)
 	}
+	response.Warnings = warnings
 
 	var status metrics_admission.AdmissionStatus
 	if len(patches) > 0 {
@@ -125,6 +127,16 @@ func (s *AdmissionServer) admit(data []byte) (*v1.AdmissionResponse, metrics_adm
 	return &response, status, resource
 }
 
+// getPatchesAndWarnings gets patches from the handler, and warnings if it
+// returns any.
+func getPatchesAndWarnings(handler resource.Handler, request *v1.AdmissionRequest) ([]resource.PatchRecord, []string, error) {
+	if warningHandler, ok := handler.(resource.WarningHandler); ok {
+		return warningHandler.GetPatchesAndWarnings(request)
+	}
+	patches, err := handler.GetPatches(request)
+	return patches, nil, err
+}
+
 // Serve is a handler function of AdmissionServer
 func (s *AdmissionServer) Serve(w http.ResponseWriter, r *http.Request) {
 	executionTimer := metrics_admission.NewExecutionTimer()
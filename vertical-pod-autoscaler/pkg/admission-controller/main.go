@@ -19,8 +19,11 @@ package main
 import (
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	apiv1 "k8s.io/api/core/v1"
@@ -30,6 +33,7 @@ import (
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/admission-controller/resource/pod/patch"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/admission-controller/resource/pod/recommendation"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/admission-controller/resource/vpa"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/admission-controller/resource/workload"
 	vpa_clientset "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/client/clientset/versioned"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/target"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/limitrange"
@@ -67,7 +71,21 @@ var (
 	webhookTimeout     = flag.Int("webhook-timeout-seconds", 30, "Timeout in seconds that the API server should wait for this webhook to respond before failing.")
 	registerWebhook    = flag.Bool("register-webhook", true, "If set to true, admission webhook object will be created on start up to register with the API server.")
 	registerByURL      = flag.Bool("register-by-url", false, "If set to true, admission webhook will be registered by URL (webhookAddress:webhookPort) instead of by service name")
-	vpaObjectNamespace = flag.String("vpa-object-namespace", apiv1.NamespaceAll, "Namespace to search for VPA objects. Empty means all namespaces will be used.")
+	vpaObjectNamespace = flag.String("vpa-object-namespace", apiv1.NamespaceAll, "Comma separated list of namespaces to search for VPA objects. Empty means all namespaces will be used.")
+	tlsSecretName      = flag.String("tls-secret-name", "", "Name of the secret in the admission controller's namespace holding the certificates, laid out as by gencerts.sh. If it doesn't exist, certificates are generated and stored in it, shared by all replicas. Empty reads the certificates from --client-ca-file, --tls-cert-file and --tls-private-key.")
+	tlsCertValidity    = flag.Duration("tls-cert-validity", 365*24*time.Hour, "Validity of the certificates generated in --tls-secret-name. They are rotated once 80% of it has passed.")
+	tlsReloadInterval  = flag.Duration("tls-reload-interval", time.Minute, "How often certificates are reloaded from --tls-secret-name or the certificate files, to pick up rotated certificates. The webhook CA bundle is updated when the CA changes.")
+	validateWorkloads  = flag.String("validate-workloads", "", "If set, Deployments and StatefulSets targeted by a VPA are validated against it when applied, e.g. for containers without requests or limits conflicting with the VPA resource policy: warn returns the problems as warnings, shown by kubectl, deny rejects the workload. Empty disables validation.")
+
+	shutdownDelay   = flag.Duration("shutdown-delay", 5*time.Second, "How long the admission controller keeps serving after receiving SIGTERM while reporting not ready, so that it's removed from the endpoints of the webhook service before it stops accepting connections.")
+	shutdownTimeout = flag.Duration("shutdown-timeout", 15*time.Second, "How long the admission controller waits for requests in flight to finish after it stopped accepting connections. Together with --shutdown-delay, it must fit in the terminationGracePeriodSeconds of the admission controller pod.")
+
+	ignoredVpaObjectNamespaces = flag.String("ignored-vpa-object-namespaces", "", "Comma separated list of namespaces whose VPA objects are ignored.")
+	vpaObjectLabels            = flag.String("vpa-object-labels", "", "Label selector of the VPA objects to process, e.g. tenant=a. Empty means all VPA objects will be processed.")
+)
+
+var (
+	aggregationLabel = flag.String("aggregation-container-name-label", "", `Pod label holding the stable container name under which the recommender aggregates usage of containers whose names start with the label value, see --aggregation-container-name-label of the recommender. Recommendations published under the label value are applied to these containers. Empty matches recommendations by container name`)
 )
 
 func main() {
@@ -76,26 +94,59 @@ func main() {
 	klog.V(1).Infof("Vertical Pod Autoscaler %s Admission Controller", common.VerticalPodAutoscalerVersion)
 
 	healthCheck := metrics.NewHealthCheck(time.Minute, false)
-	metrics.Initialize(*address, healthCheck)
+	readinessCheck := metrics.NewReadinessCheck()
+	metrics.Serve(metrics.ServerConfig{Address: *address}, healthCheck, readinessCheck)
 	metrics_admission.Register()
 
-	certs := initCerts(*certsConfiguration)
 	config := common.CreateKubeConfigOrDie(*kubeconfig, float32(*kubeApiQps), int(*kubeApiBurst))
+	kubeClient := kube_client.NewForConfigOrDie(config)
+
+	loadCerts := func() (certsContainer, error) {
+		return initCerts(*certsConfiguration)
+	}
+	if *tlsSecretName != "" {
+		loadCerts = func() (certsContainer, error) {
+			return loadOrCreateCertsSecret(kubeClient, namespace, *tlsSecretName, *serviceName, *tlsCertValidity)
+		}
+	}
+	var onCAChange func(caBundle []byte) error
+	if *registerWebhook {
+		onCAChange = func(caBundle []byte) error {
+			if err := updateCABundle(kubeClient, caBundle); err != nil {
+				return fmt.Errorf("unable to update the CA bundle of webhook %s: %v", webhookConfigName, err)
+			}
+			return nil
+		}
+	} else if *tlsSecretName != "" {
+		klog.Warningf("Certificates rotated in --tls-secret-name are served without updating the CA bundle of the webhook, as --register-webhook is false. The webhook must be registered with the CA bundle of the secret before the rotation")
+	}
+	certReloader, err := newCertReloader(loadCerts, onCAChange)
+	if err != nil {
+		klog.Fatalf("Unable to load certificates: %v", err)
+	}
 
 	vpaClient := vpa_clientset.NewForConfigOrDie(config)
-	vpaLister := vpa_api_util.NewVpasLister(vpaClient, make(chan struct{}), *vpaObjectNamespace)
-	kubeClient := kube_client.NewForConfigOrDie(config)
+	vpaObjectFilter, err := vpa_api_util.NewVpaObjectFilter(*vpaObjectNamespace, *ignoredVpaObjectNamespaces, *vpaObjectLabels)
+	if err != nil {
+		klog.Fatalf("Invalid --vpa-object-labels: %v", err)
+	}
+	vpaLister := vpa_api_util.NewFilteredVpasLister(vpaClient, make(chan struct{}), vpaObjectFilter)
 	factory := informers.NewSharedInformerFactory(kubeClient, defaultResyncPeriod)
 	targetSelectorFetcher := target.NewVpaTargetSelectorFetcher(config, kubeClient, factory)
 	podPreprocessor := pod.NewDefaultPreProcessor()
 	vpaPreprocessor := vpa.NewDefaultPreProcessor()
 	var limitRangeCalculator limitrange.LimitRangeCalculator
-	limitRangeCalculator, err := limitrange.NewLimitsRangeCalculator(factory)
+	limitRangeCalculator, err = limitrange.NewLimitsRangeCalculator(factory)
 	if err != nil {
 		klog.Errorf("Failed to create limitRangeCalculator, falling back to not checking limits. Error message: %s", err)
 		limitRangeCalculator = limitrange.NewNoopLimitsCalculator()
 	}
-	recommendationProvider := recommendation.NewProvider(limitRangeCalculator, vpa_api_util.NewCappingRecommendationProcessor(limitRangeCalculator))
+	recommendationProcessor := vpa_api_util.NewCappingRecommendationProcessor(limitRangeCalculator)
+	if *aggregationLabel != "" {
+		recommendationProcessor = vpa_api_util.NewSequentialProcessor([]vpa_api_util.RecommendationProcessor{
+			vpa_api_util.NewAggregatedContainerProcessor(*aggregationLabel), recommendationProcessor})
+	}
+	recommendationProvider := recommendation.NewProvider(limitRangeCalculator, recommendationProcessor)
 	vpaMatcher := vpa.NewMatcher(vpaLister, targetSelectorFetcher)
 
 	hostname, err := os.Hostname()
@@ -119,24 +170,54 @@ func main() {
 
 	calculators := []patch.Calculator{patch.NewResourceUpdatesCalculator(recommendationProvider), patch.NewObservedContainersCalculator()}
 	as := logic.NewAdmissionServer(podPreprocessor, vpaPreprocessor, limitRangeCalculator, vpaMatcher, calculators)
+	switch *validateWorkloads {
+	case "":
+	case "warn", "deny":
+		for _, handler := range workload.NewResourceHandlers(vpaLister, *validateWorkloads == "deny") {
+			as.RegisterResourceHandler(handler)
+		}
+	default:
+		klog.Fatalf("Unknown --validate-workloads %q, supported values are warn and deny", *validateWorkloads)
+	}
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		as.Serve(w, r)
 		healthCheck.UpdateLastActivity()
 	})
 	server := &http.Server{
 		Addr:      fmt.Sprintf(":%d", *port),
-		TLSConfig: configTLS(certs.serverCert, certs.serverKey),
+		TLSConfig: configTLS(certReloader),
 	}
 	url := fmt.Sprintf("%v:%v", *webhookAddress, *webhookPort)
 	go func() {
 		if *registerWebhook {
-			selfRegistration(kubeClient, certs.caCert, namespace, *serviceName, url, *registerByURL, int32(*webhookTimeout))
+			selfRegistration(kubeClient, certReloader.currentCerts().caCert, namespace, *serviceName, url, *registerByURL, int32(*webhookTimeout), *validateWorkloads != "")
 		}
 		// Start status updates after the webhook is initialized.
 		statusUpdater.Run(stopCh)
 	}()
 
-	if err = server.ListenAndServeTLS("", ""); err != nil {
+	go certReloader.run(*tlsReloadInterval, stopCh)
+
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		klog.Fatalf("Unable to listen on %s: %v", server.Addr, err)
+	}
+	// Informers registered after the factory was started, e.g. by handlers,
+	// are started and synced too.
+	factory.Start(stopCh)
+	for informerType, synced := range factory.WaitForCacheSync(stopCh) {
+		if !synced {
+			klog.Fatalf("Unable to sync the informer of %v", informerType)
+		}
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	stopped := shutdownOnSignal(server, readinessCheck, *shutdownDelay, *shutdownTimeout, signals)
+	// All listers are synced by now, so every replica computes the same
+	// patches from the start.
+	readinessCheck.MarkReady()
+	if err = server.ServeTLS(listener, "", ""); err != http.ErrServerClosed {
 		klog.Fatalf("HTTPS Error: %s", err)
 	}
+	<-stopped
 }
@@ -40,3 +40,11 @@ type Handler interface {
 	// GetPatches returns patches for given AdmissionRequest
 	GetPatches(*v1.AdmissionRequest) ([]PatchRecord, error)
 }
+
+// WarningHandler is a Handler which also returns warnings for the user
+// submitting the resource, e.g. shown by kubectl.
+type WarningHandler interface {
+	Handler
+	// GetPatchesAndWarnings returns patches and warnings for given AdmissionRequest
+	GetPatchesAndWarnings(*v1.AdmissionRequest) ([]PatchRecord, []string, error)
+}
@@ -64,13 +64,20 @@ func (h *resourceHandler) DisallowIncorrectObjects() bool {
 
 // GetPatches builds patches for Pod in given admission request.
 func (h *resourceHandler) GetPatches(ar *admissionv1.AdmissionRequest) ([]resource_admission.PatchRecord, error) {
+	patches, _, err := h.GetPatchesAndWarnings(ar)
+	return patches, err
+}
+
+// GetPatchesAndWarnings builds patches for Pod in given admission request,
+// and warnings about resources which weren't updated as recommended.
+func (h *resourceHandler) GetPatchesAndWarnings(ar *admissionv1.AdmissionRequest) ([]resource_admission.PatchRecord, []string, error) {
 	if ar.Resource.Version != "v1" {
-		return nil, fmt.Errorf("only v1 Pods are supported")
+		return nil, nil, fmt.Errorf("only v1 Pods are supported")
 	}
 	raw, namespace := ar.Object.Raw, ar.Namespace
 	pod := v1.Pod{}
 	if err := json.Unmarshal(raw, &pod); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if len(pod.Name) == 0 {
 		pod.Name = pod.GenerateName + "%"
@@ -80,24 +87,32 @@ func (h *resourceHandler) GetPatches(ar *admissionv1.AdmissionRequest) ([]resour
 	controllingVpa := h.vpaMatcher.GetMatchingVPA(&pod)
 	if controllingVpa == nil {
 		klog.V(4).Infof("No matching VPA found for pod %s/%s", pod.Namespace, pod.Name)
-		return []resource_admission.PatchRecord{}, nil
+		return []resource_admission.PatchRecord{}, nil, nil
 	}
 	pod, err := h.preProcessor.Process(pod)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	patches := []resource_admission.PatchRecord{}
+	var warnings []string
 	if pod.Annotations == nil {
 		patches = append(patches, patch.GetAddEmptyAnnotationsPatch())
 	}
 	for _, c := range h.patchCalculators {
-		partialPatches, err := c.CalculatePatches(&pod, controllingVpa)
+		var partialPatches []resource_admission.PatchRecord
+		var partialWarnings []string
+		if warningCalculator, ok := c.(patch.WarningCalculator); ok {
+			partialPatches, partialWarnings, err = warningCalculator.CalculatePatchesAndWarnings(&pod, controllingVpa)
+		} else {
+			partialPatches, err = c.CalculatePatches(&pod, controllingVpa)
+		}
 		if err != nil {
-			return []resource_admission.PatchRecord{}, err
+			return []resource_admission.PatchRecord{}, nil, err
 		}
 		patches = append(patches, partialPatches...)
+		warnings = append(warnings, partialWarnings...)
 	}
 
-	return patches, nil
+	return patches, warnings, nil
 }
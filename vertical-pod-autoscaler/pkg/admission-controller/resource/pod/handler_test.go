@@ -57,6 +57,16 @@ func (c *fakePatchCalculator) CalculatePatches(_ *apiv1.Pod, _ *vpa_types.Vertic
 	return c.patches, c.err
 }
 
+type fakeWarningCalculator struct {
+	fakePatchCalculator
+	warnings []string
+}
+
+func (c *fakeWarningCalculator) CalculatePatchesAndWarnings(_ *apiv1.Pod, _ *vpa_types.VerticalPodAutoscaler) (
+	[]resource_admission.PatchRecord, []string, error) {
+	return c.patches, c.warnings, c.err
+}
+
 func TestGetPatches(t *testing.T) {
 	testVpa := test.VerticalPodAutoscaler().WithName("name").WithContainer("testy-container").Get()
 	testPatchRecord := resource_admission.PatchRecord{
@@ -202,3 +212,24 @@ func TestGetPatches(t *testing.T) {
 		})
 	}
 }
+
+func TestGetPatchesAndWarnings(t *testing.T) {
+	testVpa := test.VerticalPodAutoscaler().WithName("name").WithContainer("testy-container").Get()
+	calculators := []patch.Calculator{
+		&fakePatchCalculator{},
+		&fakeWarningCalculator{warnings: []string{"cpu capped"}},
+		&fakeWarningCalculator{warnings: []string{"memory capped"}},
+	}
+	h := NewResourceHandler(&fakePodPreProcessor{}, &fakeVpaMatcher{vpa: testVpa}, calculators).(resource_admission.WarningHandler)
+	_, warnings, err := h.GetPatchesAndWarnings(&admissionv1.AdmissionRequest{
+		Resource: v1.GroupVersionResource{
+			Version: "v1",
+		},
+		Namespace: "test",
+		Object: runtime.RawExtension{
+			Raw: []byte("{}"),
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"cpu capped", "memory capped"}, warnings)
+}
@@ -26,3 +26,10 @@ import (
 type Calculator interface {
 	CalculatePatches(pod *core.Pod, vpa *vpa_types.VerticalPodAutoscaler) ([]resource.PatchRecord, error)
 }
+
+// WarningCalculator is a Calculator which also returns warnings about the
+// patches, e.g. resources which weren't updated as recommended.
+type WarningCalculator interface {
+	Calculator
+	CalculatePatchesAndWarnings(pod *core.Pod, vpa *vpa_types.VerticalPodAutoscaler) ([]resource.PatchRecord, []string, error)
+}
@@ -19,6 +19,7 @@ package patch
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	core "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -47,11 +48,23 @@ func NewResourceUpdatesCalculator(recommendationProvider recommendation.Provider
 }
 
 func (c *resourcesUpdatesPatchCalculator) CalculatePatches(pod *core.Pod, vpa *vpa_types.VerticalPodAutoscaler) ([]resource_admission.PatchRecord, error) {
+	result, _, err := c.CalculatePatchesAndWarnings(pod, vpa)
+	return result, err
+}
+
+// CalculatePatchesAndWarnings also returns warnings for containers whose
+// recommendation was capped or is missing.
+func (c *resourcesUpdatesPatchCalculator) CalculatePatchesAndWarnings(pod *core.Pod, vpa *vpa_types.VerticalPodAutoscaler) ([]resource_admission.PatchRecord, []string, error) {
 	result := []resource_admission.PatchRecord{}
 
+	if vpa_api_util.InObservationGracePeriod(vpa, time.Now()) {
+		end := vpa_api_util.GetObservationGracePeriodEnd(vpa)
+		return result, []string{fmt.Sprintf("VPA %s is in its observation grace period until %s, resources of the pod were not changed", vpa.Name, end.Format(time.RFC3339))}, nil
+	}
+
 	containersResources, annotationsPerContainer, err := c.recommendationProvider.GetContainersResourcesForPod(pod, vpa)
 	if err != nil {
-		return []resource_admission.PatchRecord{}, fmt.Errorf("Failed to calculate resource patch for pod %v/%v: %v", pod.Namespace, pod.Name, err)
+		return []resource_admission.PatchRecord{}, nil, fmt.Errorf("Failed to calculate resource patch for pod %v/%v: %v", pod.Namespace, pod.Name, err)
 	}
 
 	if annotationsPerContainer == nil {
@@ -69,7 +82,28 @@ func (c *resourcesUpdatesPatchCalculator) CalculatePatches(pod *core.Pod, vpa *v
 		vpaAnnotationValue := fmt.Sprintf("Pod resources updated by %s: %s", vpa.Name, strings.Join(updatesAnnotation, "; "))
 		result = append(result, GetAddAnnotationPatch(ResourceUpdatesAnnotation, vpaAnnotationValue))
 	}
-	return result, nil
+	return result, getWarnings(pod, vpa, containersResources, annotationsPerContainer), nil
+}
+
+func getWarnings(pod *core.Pod, vpa *vpa_types.VerticalPodAutoscaler, containersResources []vpa_api_util.ContainerResources, annotationsPerContainer vpa_api_util.ContainerToAnnotationsMap) []string {
+	if vpa.Status.Recommendation == nil {
+		return []string{fmt.Sprintf("VPA %s has no recommendation yet, resources of the pod were not changed", vpa.Name)}
+	}
+	var warnings []string
+	for i, container := range pod.Spec.Containers {
+		policy := vpa_api_util.GetContainerResourcePolicy(container.Name, vpa.Spec.ResourcePolicy)
+		if policy != nil && policy.Mode != nil && *policy.Mode == vpa_types.ContainerScalingModeOff {
+			continue
+		}
+		if i < len(containersResources) && len(containersResources[i].Requests) == 0 {
+			warnings = append(warnings, fmt.Sprintf("VPA %s has no recommendation for container %s, its resources were not changed", vpa.Name, container.Name))
+			continue
+		}
+		for _, annotation := range annotationsPerContainer[container.Name] {
+			warnings = append(warnings, fmt.Sprintf("VPA %s: container %s: %s", vpa.Name, container.Name, annotation))
+		}
+	}
+	return warnings
 }
 
 func getContainerPatch(pod *core.Pod, i int, annotationsPerContainer vpa_api_util.ContainerToAnnotationsMap, containerResources vpa_api_util.ContainerResources) ([]resource_admission.PatchRecord, string) {
@@ -97,7 +131,8 @@ func appendPatchesAndAnnotations(patches []resource_admission.PatchRecord, annot
 	if current == nil && len(resources) > 0 {
 		patches = append(patches, getPatchInitializingEmptyResourcesSubfield(containerIndex, fieldName))
 	}
-	for resource, request := range resources {
+	for _, resource := range vpa_api_util.SortedResourceNames(resources) {
+		request := resources[resource]
 		patches = append(patches, getAddResourceRequirementValuePatch(containerIndex, fieldName, resource, request))
 		annotations = append(annotations, fmt.Sprintf("%s %s", resource, resourceName))
 	}
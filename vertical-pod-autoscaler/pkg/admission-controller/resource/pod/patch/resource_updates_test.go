@@ -20,9 +20,11 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	core "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	resource_admission "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/admission-controller/resource"
 	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/test"
@@ -297,15 +299,68 @@ func TestGetPatches_TwoReplacementResources(t *testing.T) {
 	c := NewResourceUpdatesCalculator(&frp)
 	patches, err := c.CalculatePatches(pod, test.VerticalPodAutoscaler().WithName("name").WithContainer("test").Get())
 	assert.NoError(t, err)
-	// Order of updates for cpu and unobtanium depends on order of iterating a map, both possible results are valid.
+	// Resources are patched in sorted order, so that all replicas of the admission controller produce the same patch.
 	if assert.Len(t, patches, 3, "unexpected number of patches") {
-		cpuUpdate := addResourceRequestPatch(0, cpu, "1")
-		unobtaniumUpdate := addResourceRequestPatch(0, unobtanium, "2")
-		AssertPatchOneOf(t, patches[0], []resource_admission.PatchRecord{cpuUpdate, unobtaniumUpdate})
-		AssertPatchOneOf(t, patches[1], []resource_admission.PatchRecord{cpuUpdate, unobtaniumUpdate})
-		assert.False(t, EqPatch(patches[0], patches[1]))
-		cpuFirstUnobtaniumSecond := addAnnotationRequest([][]string{{cpu, unobtanium}}, request)
-		unobtaniumFirstCpuSecond := addAnnotationRequest([][]string{{unobtanium, cpu}}, request)
-		AssertPatchOneOf(t, patches[2], []resource_admission.PatchRecord{cpuFirstUnobtaniumSecond, unobtaniumFirstCpuSecond})
+		AssertEqPatch(t, patches[0], addResourceRequestPatch(0, cpu, "1"))
+		AssertEqPatch(t, patches[1], addResourceRequestPatch(0, unobtanium, "2"))
+		AssertEqPatch(t, patches[2], addAnnotationRequest([][]string{{cpu, unobtanium}}, request))
 	}
 }
+
+func TestCalculatePatchesAndWarnings(t *testing.T) {
+	pod := &core.Pod{
+		Spec: core.PodSpec{
+			Containers: []core.Container{{Name: "capped"}, {Name: "missing"}, {Name: "off"}},
+		},
+	}
+	offMode := vpa_types.ContainerScalingModeOff
+	vpa := test.VerticalPodAutoscaler().WithName("name").WithContainer("capped").WithTarget("1", "").Get()
+	vpa.Spec.ResourcePolicy = &vpa_types.PodResourcePolicy{
+		ContainerPolicies: []vpa_types.ContainerResourcePolicy{{ContainerName: "off", Mode: &offMode}},
+	}
+	frp := fakeRecommendationProvider{
+		resources: []vpa_api_util.ContainerResources{
+			{Requests: core.ResourceList{cpu: resource.MustParse("1")}},
+			{},
+			{},
+		},
+		containerToAnnotations: vpa_api_util.ContainerToAnnotationsMap{"capped": {"cpu capped to maxAllowed"}},
+	}
+	c := NewResourceUpdatesCalculator(&frp).(WarningCalculator)
+
+	_, warnings, err := c.CalculatePatchesAndWarnings(pod, vpa)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"VPA name: container capped: cpu capped to maxAllowed",
+		"VPA name has no recommendation for container missing, its resources were not changed",
+	}, warnings)
+
+	vpa.Status.Recommendation = nil
+	_, warnings, err = c.CalculatePatchesAndWarnings(pod, vpa)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"VPA name has no recommendation yet, resources of the pod were not changed"}, warnings)
+}
+
+func TestCalculatePatchesAndWarnings_ObservationGracePeriod(t *testing.T) {
+	pod := test.Pod().WithName("pod").AddContainer(test.BuildTestContainer("container", "1", "")).Get()
+	created := time.Now().Add(-time.Hour).Truncate(time.Second)
+	vpa := test.VerticalPodAutoscaler().WithName("name").WithContainer("container").WithTarget("2", "").
+		WithCreationTimestamp(created).Get()
+	vpa.Spec.UpdatePolicy = &vpa_types.PodUpdatePolicy{ObservationGracePeriod: &metav1.Duration{Duration: 2 * time.Hour}}
+	frp := fakeRecommendationProvider{
+		resources: []vpa_api_util.ContainerResources{{Requests: core.ResourceList{cpu: resource.MustParse("2")}}},
+	}
+	c := NewResourceUpdatesCalculator(&frp).(WarningCalculator)
+
+	patches, warnings, err := c.CalculatePatchesAndWarnings(pod, vpa)
+	assert.NoError(t, err)
+	assert.Empty(t, patches)
+	assert.Equal(t, []string{fmt.Sprintf("VPA name is in its observation grace period until %s, resources of the pod were not changed",
+		created.Add(2*time.Hour).Format(time.RFC3339))}, warnings)
+
+	// The recommendation is applied once the grace period is over.
+	vpa.Spec.UpdatePolicy.ObservationGracePeriod.Duration = 30 * time.Minute
+	patches, _, err = c.CalculatePatchesAndWarnings(pod, vpa)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, patches)
+}
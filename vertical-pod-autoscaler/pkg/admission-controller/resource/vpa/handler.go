@@ -25,18 +25,21 @@ import (
 	apires "k8s.io/apimachinery/pkg/api/resource"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/admission-controller/resource"
 	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/metrics/admission"
+	vpa_api_util "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/vpa"
 	"k8s.io/klog/v2"
 )
 
 var (
 	possibleUpdateModes = map[vpa_types.UpdateMode]interface{}{
-		vpa_types.UpdateModeOff:      struct{}{},
-		vpa_types.UpdateModeInitial:  struct{}{},
-		vpa_types.UpdateModeRecreate: struct{}{},
-		vpa_types.UpdateModeAuto:     struct{}{},
+		vpa_types.UpdateModeOff:               struct{}{},
+		vpa_types.UpdateModeInitial:           struct{}{},
+		vpa_types.UpdateModeRecreate:          struct{}{},
+		vpa_types.UpdateModeAuto:              struct{}{},
+		vpa_types.UpdateModeInPlaceOrRecreate: struct{}{},
 	}
 
 	possibleScalingModes = map[vpa_types.ContainerScalingMode]interface{}{
@@ -123,6 +126,20 @@ func ValidateVPA(vpa *vpa_types.VerticalPodAutoscaler, isCreate bool) error {
 		if minReplicas := vpa.Spec.UpdatePolicy.MinReplicas; minReplicas != nil && *minReplicas <= 0 {
 			return fmt.Errorf("MinReplicas has to be positive, got %v", *minReplicas)
 		}
+
+		if maxUnavailable := vpa.Spec.UpdatePolicy.MaxUnavailable; maxUnavailable != nil {
+			value, err := intstr.GetScaledValueFromIntOrPercent(maxUnavailable, 100, false)
+			if err != nil {
+				return fmt.Errorf("invalid MaxUnavailable: %v", err)
+			}
+			if value <= 0 {
+				return fmt.Errorf("MaxUnavailable has to be positive, got %v", maxUnavailable.String())
+			}
+		}
+
+		if gracePeriod := vpa.Spec.UpdatePolicy.ObservationGracePeriod; gracePeriod != nil && gracePeriod.Duration < 0 {
+			return fmt.Errorf("ObservationGracePeriod can't be negative, got %v", gracePeriod.Duration)
+		}
 	}
 
 	if vpa.Spec.ResourcePolicy != nil {
@@ -168,6 +185,10 @@ func ValidateVPA(vpa *vpa_types.VerticalPodAutoscaler, isCreate bool) error {
 		return fmt.Errorf("The current version of VPA object shouldn't specify more than one recommenders.")
 	}
 
+	if _, err := vpa_api_util.ParseAggregationOverrides(vpa.Annotations); err != nil {
+		return fmt.Errorf("invalid aggregation overrides: %v", err)
+	}
+
 	return nil
 }
 
@@ -19,11 +19,15 @@ package vpa
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	vpa_api_util "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/vpa"
 )
 
 const (
@@ -36,6 +40,11 @@ func TestValidateVPA(t *testing.T) {
 	validUpdateMode := vpa_types.UpdateModeOff
 	badMinReplicas := int32(0)
 	validMinReplicas := int32(1)
+	badMaxUnavailable := intstr.FromString("0%")
+	malformedMaxUnavailable := intstr.FromString("ten")
+	validMaxUnavailable := intstr.FromString("10%")
+	badGracePeriod := metav1.Duration{Duration: -time.Hour}
+	validGracePeriod := metav1.Duration{Duration: 72 * time.Hour}
 	badScalingMode := vpa_types.ContainerScalingMode("bad")
 	badCPUResource := resource.MustParse("187500u")
 	validScalingMode := vpa_types.ContainerScalingModeAuto
@@ -89,6 +98,73 @@ func TestValidateVPA(t *testing.T) {
 			},
 			expectError: fmt.Errorf("MinReplicas has to be positive, got 0"),
 		},
+		{
+			name: "zero maxUnavailable",
+			vpa: vpa_types.VerticalPodAutoscaler{
+				Spec: vpa_types.VerticalPodAutoscalerSpec{
+					UpdatePolicy: &vpa_types.PodUpdatePolicy{
+						MaxUnavailable: &badMaxUnavailable,
+						UpdateMode:     &validUpdateMode,
+					},
+				},
+			},
+			expectError: fmt.Errorf("MaxUnavailable has to be positive, got 0%%"),
+		},
+		{
+			name: "malformed maxUnavailable",
+			vpa: vpa_types.VerticalPodAutoscaler{
+				Spec: vpa_types.VerticalPodAutoscalerSpec{
+					UpdatePolicy: &vpa_types.PodUpdatePolicy{
+						MaxUnavailable: &malformedMaxUnavailable,
+						UpdateMode:     &validUpdateMode,
+					},
+				},
+			},
+			expectError: fmt.Errorf("invalid MaxUnavailable: invalid value for IntOrString: invalid type: string is not a percentage"),
+		},
+		{
+			name: "valid maxUnavailable",
+			vpa: vpa_types.VerticalPodAutoscaler{
+				Spec: vpa_types.VerticalPodAutoscalerSpec{
+					UpdatePolicy: &vpa_types.PodUpdatePolicy{
+						MaxUnavailable: &validMaxUnavailable,
+						UpdateMode:     &validUpdateMode,
+					},
+				},
+			},
+		},
+		{
+			name: "negative observationGracePeriod",
+			vpa: vpa_types.VerticalPodAutoscaler{
+				Spec: vpa_types.VerticalPodAutoscalerSpec{
+					UpdatePolicy: &vpa_types.PodUpdatePolicy{
+						ObservationGracePeriod: &badGracePeriod,
+						UpdateMode:             &validUpdateMode,
+					},
+				},
+			},
+			expectError: fmt.Errorf("ObservationGracePeriod can't be negative, got -1h0m0s"),
+		},
+		{
+			name: "invalid aggregation overrides",
+			vpa: vpa_types.VerticalPodAutoscaler{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{vpa_api_util.TargetCPUPercentileAnnotation: "2"},
+				},
+			},
+			expectError: fmt.Errorf("invalid aggregation overrides: %s must be a number in (0, 1], got \"2\"", vpa_api_util.TargetCPUPercentileAnnotation),
+		},
+		{
+			name: "valid observationGracePeriod",
+			vpa: vpa_types.VerticalPodAutoscaler{
+				Spec: vpa_types.VerticalPodAutoscalerSpec{
+					UpdatePolicy: &vpa_types.PodUpdatePolicy{
+						ObservationGracePeriod: &validGracePeriod,
+						UpdateMode:             &validUpdateMode,
+					},
+				},
+			},
+		},
 		{
 			name: "no policy name",
 			vpa: vpa_types.VerticalPodAutoscaler{
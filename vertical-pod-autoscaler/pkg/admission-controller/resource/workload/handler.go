@@ -0,0 +1,190 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workload
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	core "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	resource_admission "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/admission-controller/resource"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	vpa_lister "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/client/listers/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/metrics/admission"
+	vpa_api_util "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/vpa"
+)
+
+// workload holds the fields of Deployments and StatefulSets which are
+// validated against their VPA.
+type workload struct {
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              struct {
+		Template core.PodTemplateSpec `json:"template"`
+	} `json:"spec"`
+}
+
+// resourceHandler validates the pod templates of workloads against the VPAs
+// targeting them, to catch misconfigurations before pods are created.
+type resourceHandler struct {
+	resource  string
+	kind      string
+	vpaLister vpa_lister.VerticalPodAutoscalerLister
+	deny      bool
+}
+
+// NewResourceHandlers creates handlers validating Deployments and
+// StatefulSets. Problems are returned as warnings, shown by kubectl, or, if
+// deny is true, reject the workload.
+func NewResourceHandlers(vpaLister vpa_lister.VerticalPodAutoscalerLister, deny bool) []resource_admission.Handler {
+	return []resource_admission.Handler{
+		&resourceHandler{resource: "deployments", kind: "Deployment", vpaLister: vpaLister, deny: deny},
+		&resourceHandler{resource: "statefulsets", kind: "StatefulSet", vpaLister: vpaLister, deny: deny},
+	}
+}
+
+// AdmissionResource returns resource type this handler accepts.
+func (h *resourceHandler) AdmissionResource() admission.AdmissionResource {
+	return admission.Workload
+}
+
+// GroupResource returns Group and Resource type this handler accepts.
+func (h *resourceHandler) GroupResource() metav1.GroupResource {
+	return metav1.GroupResource{Group: "apps", Resource: h.resource}
+}
+
+// DisallowIncorrectObjects decides whether incorrect objects (eg. unparsable, not passing validations) should be disallowed by Admission Server.
+func (h *resourceHandler) DisallowIncorrectObjects() bool {
+	return h.deny
+}
+
+// GetPatches validates the workload in given admission request. Workloads are
+// never patched.
+func (h *resourceHandler) GetPatches(ar *admissionv1.AdmissionRequest) ([]resource_admission.PatchRecord, error) {
+	_, _, err := h.GetPatchesAndWarnings(ar)
+	return nil, err
+}
+
+// GetPatchesAndWarnings validates the workload in given admission request and
+// returns its problems as warnings or, if denying, as an error. Workloads
+// being deleted and updates leaving the pod template unchanged, e.g. scaling
+// or removing finalizers, aren't validated, so that they're never blocked.
+func (h *resourceHandler) GetPatchesAndWarnings(ar *admissionv1.AdmissionRequest) ([]resource_admission.PatchRecord, []string, error) {
+	var w workload
+	if err := json.Unmarshal(ar.Object.Raw, &w); err != nil {
+		return nil, nil, err
+	}
+	if w.DeletionTimestamp != nil {
+		return nil, nil, nil
+	}
+	if ar.Operation == admissionv1.Update && len(ar.OldObject.Raw) > 0 {
+		var old workload
+		if err := json.Unmarshal(ar.OldObject.Raw, &old); err != nil {
+			return nil, nil, err
+		}
+		if apiequality.Semantic.DeepEqual(old.Spec.Template, w.Spec.Template) {
+			return nil, nil, nil
+		}
+	}
+	name := w.Name
+	if name == "" {
+		name = ar.Name
+	}
+	vpa, err := h.getTargetingVPA(ar.Namespace, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if vpa == nil {
+		return nil, nil, nil
+	}
+	problems := validateTemplate(&w.Spec.Template, vpa)
+	if h.deny && len(problems) > 0 {
+		return nil, nil, fmt.Errorf("%s %s/%s is incompatible with VPA %s: %s", h.kind, ar.Namespace, name, vpa.Name, strings.Join(problems, "; "))
+	}
+	var warnings []string
+	for _, problem := range problems {
+		warnings = append(warnings, fmt.Sprintf("VPA %s: %s", vpa.Name, problem))
+	}
+	return nil, warnings, nil
+}
+
+// getTargetingVPA returns the VPA targeting the workload, nil if there's none
+// or it doesn't apply recommendations.
+func (h *resourceHandler) getTargetingVPA(namespace, name string) (*vpa_types.VerticalPodAutoscaler, error) {
+	vpas, err := h.vpaLister.VerticalPodAutoscalers(namespace).List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	for _, vpa := range vpas {
+		targetRef := vpa.Spec.TargetRef
+		if targetRef == nil || targetRef.Kind != h.kind || targetRef.Name != name || !strings.HasPrefix(targetRef.APIVersion, "apps/") {
+			continue
+		}
+		if vpa_api_util.GetUpdateMode(vpa) == vpa_types.UpdateModeOff {
+			return nil, nil
+		}
+		return vpa, nil
+	}
+	return nil, nil
+}
+
+// validateTemplate returns the problems of the pod template with the VPA
+// applying recommendations to its pods.
+func validateTemplate(template *core.PodTemplateSpec, vpa *vpa_types.VerticalPodAutoscaler) []string {
+	var problems []string
+	containerNames := make(map[string]bool, len(template.Spec.Containers))
+	for _, container := range template.Spec.Containers {
+		containerNames[container.Name] = true
+		policy := vpa_api_util.GetContainerResourcePolicy(container.Name, vpa.Spec.ResourcePolicy)
+		if policy != nil && policy.Mode != nil && *policy.Mode == vpa_types.ContainerScalingModeOff {
+			continue
+		}
+		controlledValues := vpa_api_util.GetContainerControlledValues(container.Name, vpa.Spec.ResourcePolicy)
+		for _, resourceName := range controlledResources(policy) {
+			_, hasRequest := container.Resources.Requests[resourceName]
+			limit, hasLimit := container.Resources.Limits[resourceName]
+			if !hasRequest && !hasLimit {
+				problems = append(problems, fmt.Sprintf("container %s has no %s request, pods created before the VPA has a recommendation get none", container.Name, resourceName))
+			}
+			if policy == nil || !hasLimit || controlledValues != vpa_types.ContainerControlledValuesRequestsOnly {
+				continue
+			}
+			if minAllowed, found := policy.MinAllowed[resourceName]; found && minAllowed.Cmp(limit) > 0 {
+				problems = append(problems, fmt.Sprintf("container %s has a %s limit of %s, below minAllowed %s, and its requests can't be raised above the limit with controlledValues %s", container.Name, resourceName, limit.String(), minAllowed.String(), controlledValues))
+			}
+		}
+	}
+	if vpa.Spec.ResourcePolicy != nil {
+		for _, policy := range vpa.Spec.ResourcePolicy.ContainerPolicies {
+			if policy.ContainerName != vpa_types.DefaultContainerResourcePolicy && !containerNames[policy.ContainerName] {
+				problems = append(problems, fmt.Sprintf("container policy for %s matches no container", policy.ContainerName))
+			}
+		}
+	}
+	return problems
+}
+
+func controlledResources(policy *vpa_types.ContainerResourcePolicy) []core.ResourceName {
+	if policy != nil && policy.ControlledResources != nil {
+		return *policy.ControlledResources
+	}
+	return []core.ResourceName{core.ResourceCPU, core.ResourceMemory}
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workload
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	autoscaling "k8s.io/api/autoscaling/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/test"
+)
+
+func makeAdmissionRequest(t *testing.T, containers ...core.Container) *admissionv1.AdmissionRequest {
+	var w workload
+	w.Name = "hamster"
+	w.Spec.Template.Spec.Containers = containers
+	raw, err := json.Marshal(w)
+	assert.NoError(t, err)
+	return &admissionv1.AdmissionRequest{
+		Namespace: "default",
+		Operation: admissionv1.Create,
+		Object:    runtime.RawExtension{Raw: raw},
+	}
+}
+
+func makeHandler(deny bool, vpas ...*vpa_types.VerticalPodAutoscaler) *resourceHandler {
+	vpaNamespaceLister := &test.VerticalPodAutoscalerListerMock{}
+	vpaNamespaceLister.On("List").Return(vpas, nil)
+	vpaLister := &test.VerticalPodAutoscalerListerMock{}
+	vpaLister.On("VerticalPodAutoscalers", "default").Return(vpaNamespaceLister)
+	return NewResourceHandlers(vpaLister, deny)[0].(*resourceHandler)
+}
+
+func TestGetPatchesAndWarnings(t *testing.T) {
+	deploymentRef := &autoscaling.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "hamster"}
+	vpaBuilder := test.VerticalPodAutoscaler().WithName("hamster-vpa").WithContainer("hamster").WithTargetRef(deploymentRef)
+	withRequests := test.Container().WithName("hamster").WithCPURequest(resource.MustParse("1")).WithMemRequest(resource.MustParse("1Gi")).Get()
+	withoutRequests := test.Container().WithName("hamster").Get()
+	sidecar := test.Container().WithName("sidecar").WithCPURequest(resource.MustParse("1")).WithMemRequest(resource.MustParse("1Gi")).Get()
+	limited := test.Container().WithName("hamster").WithCPURequest(resource.MustParse("1")).WithMemRequest(resource.MustParse("1Gi")).Get()
+	limited.Resources.Limits = core.ResourceList{core.ResourceCPU: resource.MustParse("1")}
+
+	testCases := []struct {
+		name             string
+		vpas             []*vpa_types.VerticalPodAutoscaler
+		containers       []core.Container
+		expectedWarnings []string
+	}{
+		{
+			name:       "compatible",
+			vpas:       []*vpa_types.VerticalPodAutoscaler{vpaBuilder.Get()},
+			containers: []core.Container{withRequests},
+		},
+		{
+			name:       "no VPA",
+			containers: []core.Container{withoutRequests},
+		},
+		{
+			name:       "VPA targeting another workload",
+			vpas:       []*vpa_types.VerticalPodAutoscaler{vpaBuilder.WithTargetRef(&autoscaling.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "other"}).Get()},
+			containers: []core.Container{withoutRequests},
+		},
+		{
+			name:       "VPA off",
+			vpas:       []*vpa_types.VerticalPodAutoscaler{vpaBuilder.WithUpdateMode(vpa_types.UpdateModeOff).Get()},
+			containers: []core.Container{withoutRequests},
+		},
+		{
+			name:       "missing requests",
+			vpas:       []*vpa_types.VerticalPodAutoscaler{vpaBuilder.Get()},
+			containers: []core.Container{withoutRequests},
+			expectedWarnings: []string{
+				"VPA hamster-vpa: container hamster has no cpu request, pods created before the VPA has a recommendation get none",
+				"VPA hamster-vpa: container hamster has no memory request, pods created before the VPA has a recommendation get none",
+			},
+		},
+		{
+			name:             "container policy matching no container",
+			vpas:             []*vpa_types.VerticalPodAutoscaler{vpaBuilder.Get()},
+			containers:       []core.Container{sidecar},
+			expectedWarnings: []string{"VPA hamster-vpa: container policy for hamster matches no container"},
+		},
+		{
+			name:             "limit below minAllowed",
+			vpas:             []*vpa_types.VerticalPodAutoscaler{vpaBuilder.WithMinAllowed("2", "1Gi").WithControlledValues(vpa_types.ContainerControlledValuesRequestsOnly).Get()},
+			containers:       []core.Container{limited},
+			expectedWarnings: []string{"VPA hamster-vpa: container hamster has a cpu limit of 1, below minAllowed 2, and its requests can't be raised above the limit with controlledValues RequestsOnly"},
+		},
+		{
+			name:       "limit below minAllowed, scaled with requests",
+			vpas:       []*vpa_types.VerticalPodAutoscaler{vpaBuilder.WithMinAllowed("2", "1Gi").Get()},
+			containers: []core.Container{limited},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			patches, warnings, err := makeHandler(false, tc.vpas...).GetPatchesAndWarnings(makeAdmissionRequest(t, tc.containers...))
+			assert.NoError(t, err)
+			assert.Empty(t, patches)
+			assert.Equal(t, tc.expectedWarnings, warnings)
+		})
+	}
+}
+
+func TestGetPatchesAndWarningsDeny(t *testing.T) {
+	deploymentRef := &autoscaling.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "hamster"}
+	vpa := test.VerticalPodAutoscaler().WithName("hamster-vpa").WithContainer("hamster").WithTargetRef(deploymentRef).Get()
+	handler := makeHandler(true, vpa)
+	assert.True(t, handler.DisallowIncorrectObjects())
+
+	_, _, err := handler.GetPatchesAndWarnings(makeAdmissionRequest(t, test.Container().WithName("sidecar").Get()))
+	assert.EqualError(t, err, "Deployment default/hamster is incompatible with VPA hamster-vpa: container sidecar has no cpu request, pods created before the VPA has a recommendation get none; container sidecar has no memory request, pods created before the VPA has a recommendation get none; container policy for hamster matches no container")
+}
+
+func TestGetPatchesAndWarningsDenySkipsUnchangedAndDeleted(t *testing.T) {
+	deploymentRef := &autoscaling.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "hamster"}
+	vpa := test.VerticalPodAutoscaler().WithName("hamster-vpa").WithContainer("hamster").WithTargetRef(deploymentRef).Get()
+	handler := makeHandler(true, vpa)
+	incompatible := test.Container().WithName("sidecar").Get()
+
+	unchanged := makeAdmissionRequest(t, incompatible)
+	unchanged.Operation = admissionv1.Update
+	unchanged.OldObject = unchanged.Object
+	_, _, err := handler.GetPatchesAndWarnings(unchanged)
+	assert.NoError(t, err)
+
+	changed := makeAdmissionRequest(t, incompatible)
+	changed.Operation = admissionv1.Update
+	changed.OldObject = makeAdmissionRequest(t, test.Container().WithName("hamster").Get()).Object
+	_, _, err = handler.GetPatchesAndWarnings(changed)
+	assert.Error(t, err)
+
+	var w workload
+	w.Name = "hamster"
+	deletionTimestamp := metav1.Now()
+	w.DeletionTimestamp = &deletionTimestamp
+	w.Spec.Template.Spec.Containers = []core.Container{incompatible}
+	raw, err := json.Marshal(w)
+	assert.NoError(t, err)
+	deleted := &admissionv1.AdmissionRequest{Namespace: "default", Operation: admissionv1.Update, Object: runtime.RawExtension{Raw: raw}}
+	_, _, err = handler.GetPatchesAndWarnings(deleted)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/metrics"
+	"k8s.io/klog/v2"
+)
+
+// shutdownOnSignal stops the server once a signal is received, without failing
+// requests of the API server: the replica reports not ready and keeps serving
+// for delay, so that it's removed from the endpoints of the webhook service
+// before it stops accepting connections, then waits up to timeout for the
+// requests in flight. The returned channel is closed once the server stopped.
+func shutdownOnSignal(server *http.Server, readinessCheck *metrics.ReadinessCheck, delay, timeout time.Duration, signals <-chan os.Signal) <-chan struct{} {
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		sig := <-signals
+		klog.Infof("Received %v, shutting down in %v", sig, delay)
+		readinessCheck.MarkNotReady()
+		time.Sleep(delay)
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			klog.Errorf("Requests in flight didn't finish within %v: %v", timeout, err)
+		}
+	}()
+	return stopped
+}
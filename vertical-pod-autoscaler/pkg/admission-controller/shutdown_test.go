@@ -0,0 +1,67 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/metrics"
+)
+
+func isReady(readinessCheck *metrics.ReadinessCheck) bool {
+	recorder := httptest.NewRecorder()
+	readinessCheck.ServeHTTP(recorder, httptest.NewRequest("GET", "/readyz", nil))
+	return recorder.Code == http.StatusOK
+}
+
+func TestShutdownOnSignal(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})}
+	readinessCheck := metrics.NewReadinessCheck()
+	readinessCheck.MarkReady()
+	signals := make(chan os.Signal, 1)
+	stopped := shutdownOnSignal(server, readinessCheck, 200*time.Millisecond, time.Second, signals)
+	served := make(chan error)
+	go func() { served <- server.Serve(listener) }()
+	url := "http://" + listener.Addr().String()
+
+	signals <- syscall.SIGTERM
+	assert.Eventually(t, func() bool { return !isReady(readinessCheck) }, time.Second, 10*time.Millisecond)
+	// Requests are still served during the delay.
+	response, err := http.Get(url)
+	if assert.NoError(t, err) {
+		response.Body.Close()
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+	}
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("server wasn't shut down")
+	}
+	assert.Equal(t, http.ErrServerClosed, <-served)
+	_, err = http.Get(url)
+	assert.Error(t, err)
+}
@@ -21,6 +21,7 @@ import (
 	autoscaling "k8s.io/api/autoscaling/v1"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -117,10 +118,29 @@ type PodUpdatePolicy struct {
 	// allowed. Overrides global '--min-replicas' flag.
 	// +optional
 	MinReplicas *int32 `json:"minReplicas,omitempty" protobuf:"varint,2,opt,name=minReplicas"`
+
+	// Maximal number or percentage of replicas of a single workload which can
+	// be unavailable at the same time because of evictions by Updater. The
+	// absolute number is calculated from the configured replica count of the
+	// workload (the live pod count for Jobs) by rounding down, but is at least
+	// one. Replicas which are not ready or are terminating count against it,
+	// so no pod is evicted while that many replicas are unavailable. If set,
+	// the '--min-replicas' check is not applied. Overrides global
+	// '--eviction-max-unavailable' flag.
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty" protobuf:"bytes,3,opt,name=maxUnavailable"`
+
+	// Duration after the creation of the VPA object during which pods keep
+	// the resources requested by their users while recommendations mature.
+	// Admission doesn't apply the recommendation and Updater doesn't update
+	// pods until the period is over, then the recommendation is applied as
+	// configured by the update mode.
+	// +optional
+	ObservationGracePeriod *metav1.Duration `json:"observationGracePeriod,omitempty" protobuf:"bytes,4,opt,name=observationGracePeriod"`
 }
 
 // UpdateMode controls when autoscaler applies changes to the pod resoures.
-// +kubebuilder:validation:Enum=Off;Initial;Recreate;Auto
+// +kubebuilder:validation:Enum=Off;Initial;Recreate;Auto;InPlaceOrRecreate
 type UpdateMode string
 
 const (
@@ -140,6 +160,12 @@ const (
 	// using any available update method. Currently this is equivalent to
 	// Recreate, which is the only available update method.
 	UpdateModeAuto UpdateMode = "Auto"
+	// UpdateModeInPlaceOrRecreate means that autoscaler assigns resources on
+	// pod creation and additionally can update them during the lifetime of the
+	// pod by resizing the pod in place, if the cluster supports it. If the
+	// resize is rejected or can't be actuated on the node, the pod is deleted
+	// and recreated.
+	UpdateModeInPlaceOrRecreate UpdateMode = "InPlaceOrRecreate"
 )
 
 // PodResourcePolicy controls how autoscaler computes the recommended resources
@@ -227,6 +253,12 @@ type VerticalPodAutoscalerStatus struct {
 	// +patchMergeKey=type
 	// +patchStrategy=merge
 	Conditions []VerticalPodAutoscalerCondition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type" protobuf:"bytes,2,rep,name=conditions"`
+
+	// ConditionHistory holds the latest transitions of conditions, oldest
+	// first, each with the status, reason and message the condition
+	// transitioned to at lastTransitionTime. It's bounded in length and age.
+	// +optional
+	ConditionHistory []VerticalPodAutoscalerCondition `json:"conditionHistory,omitempty" protobuf:"bytes,3,rep,name=conditionHistory"`
 }
 
 // RecommendedPodResources is the recommendation of resources computed by
@@ -266,6 +298,25 @@ type RecommendedContainerResources struct {
 	// Used only as status indication, will not affect actual resource assignment.
 	// +optional
 	UncappedTarget v1.ResourceList `json:"uncappedTarget,omitempty" protobuf:"bytes,5,opt,name=uncappedTarget"`
+	// Factor LowerBound was scaled by to account for the confidence in the
+	// usage history of the container, e.g. "0.95". It approaches 1 as the
+	// history grows.
+	// +optional
+	LowerBoundConfidenceFactor string `json:"lowerBoundConfidenceFactor,omitempty" protobuf:"bytes,6,opt,name=lowerBoundConfidenceFactor"`
+	// Factor UpperBound was scaled by to account for the confidence in the
+	// usage history of the container, e.g. "1.14", or "+Inf" without
+	// history. It approaches 1 as the history grows.
+	// +optional
+	UpperBoundConfidenceFactor string `json:"upperBoundConfidenceFactor,omitempty" protobuf:"bytes,7,opt,name=upperBoundConfidenceFactor"`
+	// Start of the oldest usage sample the recommendation is based on. Only set
+	// if the recommender enforces a minimum recommendation data window.
+	// +optional
+	FirstSampleStart *metav1.Time `json:"firstSampleStart,omitempty" protobuf:"bytes,8,opt,name=firstSampleStart"`
+	// Start of the newest usage sample the recommendation is based on, rounded
+	// down to the hour. Only set if the recommender enforces a minimum
+	// recommendation data window.
+	// +optional
+	LastSampleStart *metav1.Time `json:"lastSampleStart,omitempty" protobuf:"bytes,9,opt,name=lastSampleStart"`
 }
 
 // VerticalPodAutoscalerConditionType are the valid conditions of
@@ -288,6 +339,21 @@ var (
 	// ConfigUnsupported indicates that this VPA configuration is unsupported
 	// and recommendations will not be provided for it.
 	ConfigUnsupported VerticalPodAutoscalerConditionType = "ConfigUnsupported"
+	// RecommendationCapped indicates that the uncapped recommendation for some
+	// of containers has exceeded maxAllowed of their resource policy for a long time.
+	RecommendationCapped VerticalPodAutoscalerConditionType = "RecommendationCapped"
+	// AggregationOverridden indicates that aggregation parameters, e.g. the
+	// histogram decay half lives, are overridden by annotations of the VPA.
+	// It is false if all these annotations are invalid.
+	AggregationOverridden VerticalPodAutoscalerConditionType = "AggregationOverridden"
+	// UsageEstimatedFromPodMetrics indicates that per-container metrics of
+	// some containers are missing, and their usage is estimated from the
+	// usage of their pods.
+	UsageEstimatedFromPodMetrics VerticalPodAutoscalerConditionType = "UsageEstimatedFromPodMetrics"
+	// InsufficientDataWindow indicates that the recommendation of some
+	// containers is withheld because the usage samples it would be based on
+	// span less than the minimum data window of the recommender.
+	InsufficientDataWindow VerticalPodAutoscalerConditionType = "InsufficientDataWindow"
 )
 
 // VerticalPodAutoscalerCondition describes the state of
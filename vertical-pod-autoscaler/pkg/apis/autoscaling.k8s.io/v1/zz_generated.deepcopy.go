@@ -24,7 +24,9 @@ package v1
 import (
 	autoscalingv1 "k8s.io/api/autoscaling/v1"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
+	intstr "k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
@@ -136,6 +138,16 @@ func (in *PodUpdatePolicy) DeepCopyInto(out *PodUpdatePolicy) {
 		*out = new(int32)
 		**out = **in
 	}
+	if in.MaxUnavailable != nil {
+		in, out := &in.MaxUnavailable, &out.MaxUnavailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.ObservationGracePeriod != nil {
+		in, out := &in.ObservationGracePeriod, &out.ObservationGracePeriod
+		*out = new(metav1.Duration)
+		**out = **in
+	}
 	return
 }
 
@@ -180,6 +192,14 @@ func (in *RecommendedContainerResources) DeepCopyInto(out *RecommendedContainerR
 			(*out)[key] = val.DeepCopy()
 		}
 	}
+	if in.FirstSampleStart != nil {
+		in, out := &in.FirstSampleStart, &out.FirstSampleStart
+		*out = (*in).DeepCopy()
+	}
+	if in.LastSampleStart != nil {
+		in, out := &in.LastSampleStart, &out.LastSampleStart
+		*out = (*in).DeepCopy()
+	}
 	return
 }
 
@@ -465,6 +485,13 @@ func (in *VerticalPodAutoscalerStatus) DeepCopyInto(out *VerticalPodAutoscalerSt
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.ConditionHistory != nil {
+		in, out := &in.ConditionHistory, &out.ConditionHistory
+		*out = make([]VerticalPodAutoscalerCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
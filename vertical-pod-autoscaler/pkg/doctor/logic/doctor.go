@@ -0,0 +1,376 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logic
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscaling "k8s.io/api/autoscaling/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/admission-controller/resource/pod/patch"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	vpa_clientset "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/client/clientset/versioned"
+	kube_client "k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+const (
+	canaryName          = "vpa-doctor-canary"
+	canaryContainerName = "canary"
+	canaryLabel         = "vpa-doctor"
+
+	// Requests of the canary are far below the minimal recommendation, so the
+	// updater always considers the canary pods for eviction.
+	canaryCPURequest    = "1m"
+	canaryMemoryRequest = "1Mi"
+)
+
+// Check names, in the order in which checks are run.
+const (
+	CheckSetup          = "setup"
+	CheckRecommendation = "recommendation"
+	CheckEviction       = "eviction"
+	CheckAdmission      = "admission"
+)
+
+// Config configures a run of the doctor.
+type Config struct {
+	// Namespace in which the canary deployment and VPA are created.
+	Namespace string
+	// Image of the canary container. It has to be pullable in the cluster.
+	Image string
+	// Replicas of the canary deployment. The updater only evicts pods of
+	// workloads with at least its --min-replicas replicas.
+	Replicas int32
+	// Timeout of a single check.
+	CheckTimeout time.Duration
+	PollInterval time.Duration
+	// KeepResources disables the deletion of the canary objects after the run.
+	KeepResources bool
+}
+
+// CheckResult is the outcome of a single check.
+type CheckResult struct {
+	Name     string
+	Passed   bool
+	Skipped  bool
+	Message  string
+	Duration time.Duration
+}
+
+// Doctor verifies that the recommender, the updater and the admission
+// controller work together on a canary workload.
+type Doctor struct {
+	kubeClient kube_client.Interface
+	vpaClient  vpa_clientset.Interface
+	config     Config
+}
+
+// NewDoctor returns a new Doctor.
+func NewDoctor(kubeClient kube_client.Interface, vpaClient vpa_clientset.Interface, config Config) *Doctor {
+	return &Doctor{
+		kubeClient: kubeClient,
+		vpaClient:  vpaClient,
+		config:     config,
+	}
+}
+
+// Passed returns true if all checks passed.
+func Passed(results []CheckResult) bool {
+	for _, result := range results {
+		if !result.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// Run runs all checks in order. Once a check fails the remaining ones are
+// reported as skipped.
+func (d *Doctor) Run(ctx context.Context) []CheckResult {
+	if !d.config.KeepResources {
+		defer d.cleanup()
+	}
+
+	var initialPods map[types.UID]bool
+	checks := []struct {
+		name string
+		run  func(context.Context) error
+	}{
+		{CheckSetup, d.setup},
+		{CheckRecommendation, func(ctx context.Context) error {
+			var err error
+			if initialPods, err = d.canaryPodUIDs(ctx); err != nil {
+				return err
+			}
+			return d.waitForRecommendation(ctx)
+		}},
+		{CheckEviction, func(ctx context.Context) error {
+			return d.waitForEviction(ctx, initialPods)
+		}},
+		{CheckAdmission, func(ctx context.Context) error {
+			return d.waitForAdmission(ctx, initialPods)
+		}},
+	}
+
+	results := make([]CheckResult, 0, len(checks))
+	failed := false
+	for _, check := range checks {
+		if failed {
+			results = append(results, CheckResult{Name: check.name, Skipped: true, Message: "skipped after a previous failure"})
+			continue
+		}
+		klog.V(1).Infof("Running check %s", check.name)
+		start := time.Now()
+		checkCtx, cancel := context.WithTimeout(ctx, d.config.CheckTimeout)
+		err := check.run(checkCtx)
+		cancel()
+		result := CheckResult{Name: check.name, Passed: err == nil, Duration: time.Since(start)}
+		if err != nil {
+			result.Message = err.Error()
+			failed = true
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func (d *Doctor) setup(ctx context.Context) error {
+	_, err := d.kubeClient.CoreV1().Namespaces().Get(ctx, d.config.Namespace, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		namespace := &apiv1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: d.config.Namespace}}
+		_, err = d.kubeClient.CoreV1().Namespaces().Create(ctx, namespace, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("cannot ensure namespace %s: %v", d.config.Namespace, err)
+	}
+	if _, err := d.kubeClient.AppsV1().Deployments(d.config.Namespace).Create(ctx, d.canaryDeployment(), metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("cannot create canary deployment: %v", err)
+	}
+	if _, err := d.vpaClient.AutoscalingV1().VerticalPodAutoscalers(d.config.Namespace).Create(ctx, d.canaryVpa(), metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("cannot create canary VPA: %v", err)
+	}
+	return wait.PollImmediateUntilWithContext(ctx, d.config.PollInterval, func(ctx context.Context) (bool, error) {
+		pods, err := d.canaryPods(ctx)
+		if err != nil {
+			return false, err
+		}
+		return countRunning(pods) >= int(d.config.Replicas), nil
+	})
+}
+
+func (d *Doctor) waitForRecommendation(ctx context.Context) error {
+	err := wait.PollImmediateUntilWithContext(ctx, d.config.PollInterval, func(ctx context.Context) (bool, error) {
+		vpa, err := d.vpaClient.AutoscalingV1().VerticalPodAutoscalers(d.config.Namespace).Get(ctx, canaryName, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return getContainerRecommendation(vpa, canaryContainerName) != nil, nil
+	})
+	if err != nil {
+		return fmt.Errorf("no recommendation for the canary VPA, is the recommender running? %v", err)
+	}
+	return nil
+}
+
+func (d *Doctor) waitForEviction(ctx context.Context, initialPods map[types.UID]bool) error {
+	err := wait.PollImmediateUntilWithContext(ctx, d.config.PollInterval, func(ctx context.Context) (bool, error) {
+		pods, err := d.canaryPods(ctx)
+		if err != nil {
+			return false, err
+		}
+		return anyEvicted(pods, initialPods), nil
+	})
+	if err != nil {
+		return fmt.Errorf("no canary pod was evicted, is the updater running? %v", err)
+	}
+	return nil
+}
+
+func (d *Doctor) waitForAdmission(ctx context.Context, initialPods map[types.UID]bool) error {
+	var lastErr error
+	err := wait.PollImmediateUntilWithContext(ctx, d.config.PollInterval, func(ctx context.Context) (bool, error) {
+		pods, err := d.canaryPods(ctx)
+		if err != nil {
+			return false, err
+		}
+		for _, pod := range pods {
+			if initialPods[pod.UID] {
+				continue
+			}
+			if lastErr = verifyPatched(pod); lastErr == nil {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		if lastErr != nil {
+			return fmt.Errorf("recreated canary pods were not patched, is the admission controller running? %v", lastErr)
+		}
+		return fmt.Errorf("no recreated canary pod: %v", err)
+	}
+	return nil
+}
+
+func (d *Doctor) cleanup() {
+	ctx := context.Background()
+	if err := d.vpaClient.AutoscalingV1().VerticalPodAutoscalers(d.config.Namespace).Delete(ctx, canaryName, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+		klog.Errorf("Cannot delete canary VPA: %v", err)
+	}
+	propagation := metav1.DeletePropagationForeground
+	if err := d.kubeClient.AppsV1().Deployments(d.config.Namespace).Delete(ctx, canaryName, metav1.DeleteOptions{PropagationPolicy: &propagation}); err != nil && !errors.IsNotFound(err) {
+		klog.Errorf("Cannot delete canary deployment: %v", err)
+	}
+}
+
+func (d *Doctor) canaryPods(ctx context.Context) ([]apiv1.Pod, error) {
+	selector := labels.SelectorFromSet(labels.Set{canaryLabel: canaryName})
+	pods, err := d.kubeClient.CoreV1().Pods(d.config.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, err
+	}
+	return pods.Items, nil
+}
+
+func (d *Doctor) canaryPodUIDs(ctx context.Context) (map[types.UID]bool, error) {
+	pods, err := d.canaryPods(ctx)
+	if err != nil {
+		return nil, err
+	}
+	uids := make(map[types.UID]bool, len(pods))
+	for _, pod := range pods {
+		uids[pod.UID] = true
+	}
+	return uids, nil
+}
+
+func (d *Doctor) canaryDeployment() *appsv1.Deployment {
+	podLabels := map[string]string{canaryLabel: canaryName}
+	replicas := d.config.Replicas
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      canaryName,
+			Namespace: d.config.Namespace,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: podLabels},
+			Template: apiv1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: podLabels},
+				Spec: apiv1.PodSpec{
+					Containers: []apiv1.Container{{
+						Name:  canaryContainerName,
+						Image: d.config.Image,
+						Resources: apiv1.ResourceRequirements{
+							Requests: apiv1.ResourceList{
+								apiv1.ResourceCPU:    resource.MustParse(canaryCPURequest),
+								apiv1.ResourceMemory: resource.MustParse(canaryMemoryRequest),
+							},
+						},
+					}},
+				},
+			},
+		},
+	}
+}
+
+func (d *Doctor) canaryVpa() *vpa_types.VerticalPodAutoscaler {
+	updateMode := vpa_types.UpdateModeAuto
+	return &vpa_types.VerticalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      canaryName,
+			Namespace: d.config.Namespace,
+		},
+		Spec: vpa_types.VerticalPodAutoscalerSpec{
+			TargetRef: &autoscaling.CrossVersionObjectReference{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Name:       canaryName,
+			},
+			UpdatePolicy: &vpa_types.PodUpdatePolicy{UpdateMode: &updateMode},
+		},
+	}
+}
+
+func getContainerRecommendation(vpa *vpa_types.VerticalPodAutoscaler, containerName string) *vpa_types.RecommendedContainerResources {
+	if vpa.Status.Recommendation == nil {
+		return nil
+	}
+	for i, recommendation := range vpa.Status.Recommendation.ContainerRecommendations {
+		if recommendation.ContainerName == containerName {
+			return &vpa.Status.Recommendation.ContainerRecommendations[i]
+		}
+	}
+	return nil
+}
+
+func countRunning(pods []apiv1.Pod) int {
+	running := 0
+	for _, pod := range pods {
+		if pod.Status.Phase == apiv1.PodRunning && pod.DeletionTimestamp == nil {
+			running++
+		}
+	}
+	return running
+}
+
+// anyEvicted returns true if any of the initial pods is gone or terminating.
+func anyEvicted(pods []apiv1.Pod, initialPods map[types.UID]bool) bool {
+	alive := 0
+	for _, pod := range pods {
+		if initialPods[pod.UID] && pod.DeletionTimestamp == nil {
+			alive++
+		}
+	}
+	return alive < len(initialPods)
+}
+
+// verifyPatched checks that the admission controller raised the requests of
+// the canary container. The recommendation may change between the checks, so
+// the requests are not compared with a particular recommendation.
+func verifyPatched(pod apiv1.Pod) error {
+	if _, found := pod.Annotations[patch.ResourceUpdatesAnnotation]; !found {
+		return fmt.Errorf("pod %s has no %s annotation", pod.Name, patch.ResourceUpdatesAnnotation)
+	}
+	canaryRequests := map[apiv1.ResourceName]resource.Quantity{
+		apiv1.ResourceCPU:    resource.MustParse(canaryCPURequest),
+		apiv1.ResourceMemory: resource.MustParse(canaryMemoryRequest),
+	}
+	for _, container := range pod.Spec.Containers {
+		if container.Name != canaryContainerName {
+			continue
+		}
+		for resourceName, canaryRequest := range canaryRequests {
+			request := container.Resources.Requests[resourceName]
+			if request.Cmp(canaryRequest) <= 0 {
+				return fmt.Errorf("pod %s has %s request %v, expected more than %v", pod.Name, resourceName, request.String(), canaryRequest.String())
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("pod %s has no %s container", pod.Name, canaryContainerName)
+}
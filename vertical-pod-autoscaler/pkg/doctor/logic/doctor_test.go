@@ -0,0 +1,115 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logic
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/admission-controller/resource/pod/patch"
+	vpa_fake "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/client/clientset/versioned/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAnyEvicted(t *testing.T) {
+	now := metav1.Now()
+	initialPods := map[types.UID]bool{"a": true, "b": true}
+	testCases := []struct {
+		name     string
+		pods     []apiv1.Pod
+		expected bool
+	}{
+		{
+			name:     "all initial pods alive",
+			pods:     []apiv1.Pod{{ObjectMeta: metav1.ObjectMeta{UID: "a"}}, {ObjectMeta: metav1.ObjectMeta{UID: "b"}}},
+			expected: false,
+		},
+		{
+			name:     "initial pod replaced",
+			pods:     []apiv1.Pod{{ObjectMeta: metav1.ObjectMeta{UID: "a"}}, {ObjectMeta: metav1.ObjectMeta{UID: "c"}}},
+			expected: true,
+		},
+		{
+			name:     "initial pod terminating",
+			pods:     []apiv1.Pod{{ObjectMeta: metav1.ObjectMeta{UID: "a"}}, {ObjectMeta: metav1.ObjectMeta{UID: "b", DeletionTimestamp: &now}}},
+			expected: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, anyEvicted(tc.pods, initialPods))
+		})
+	}
+}
+
+func TestVerifyPatched(t *testing.T) {
+	newPod := func(annotated bool, cpu, memory string) apiv1.Pod {
+		pod := apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod", Annotations: map[string]string{}},
+			Spec: apiv1.PodSpec{Containers: []apiv1.Container{{
+				Name: canaryContainerName,
+				Resources: apiv1.ResourceRequirements{Requests: apiv1.ResourceList{
+					apiv1.ResourceCPU:    resource.MustParse(cpu),
+					apiv1.ResourceMemory: resource.MustParse(memory),
+				}},
+			}}},
+		}
+		if annotated {
+			pod.Annotations[patch.ResourceUpdatesAnnotation] = "Pod resources updated by vpa-doctor-canary"
+		}
+		return pod
+	}
+	assert.NoError(t, verifyPatched(newPod(true, "25m", "250Mi")))
+	assert.Error(t, verifyPatched(newPod(false, "25m", "250Mi")))
+	assert.Error(t, verifyPatched(newPod(true, canaryCPURequest, "250Mi")))
+	assert.Error(t, verifyPatched(newPod(true, "25m", canaryMemoryRequest)))
+}
+
+func TestRunSkipsChecksAfterFailure(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset()
+	vpaClient := vpa_fake.NewSimpleClientset()
+	doctor := NewDoctor(kubeClient, vpaClient, Config{
+		Namespace:    "vpa-doctor",
+		Image:        "pause",
+		Replicas:     2,
+		CheckTimeout: 50 * time.Millisecond,
+		PollInterval: 10 * time.Millisecond,
+	})
+
+	// Fake clients never run the canary pods, so the setup check times out.
+	results := doctor.Run(context.Background())
+
+	assert.False(t, Passed(results))
+	assert.Len(t, results, 4)
+	assert.Equal(t, CheckSetup, results[0].Name)
+	assert.False(t, results[0].Passed)
+	assert.False(t, results[0].Skipped)
+	for _, result := range results[1:] {
+		assert.True(t, result.Skipped, result.Name)
+	}
+	// Canary objects are cleaned up after the run.
+	_, err := kubeClient.AppsV1().Deployments("vpa-doctor").Get(context.Background(), canaryName, metav1.GetOptions{})
+	assert.Error(t, err)
+	_, err = vpaClient.AutoscalingV1().VerticalPodAutoscalers("vpa-doctor").Get(context.Background(), canaryName, metav1.GetOptions{})
+	assert.Error(t, err)
+}
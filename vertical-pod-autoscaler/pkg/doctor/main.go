@@ -0,0 +1,74 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"k8s.io/autoscaler/vertical-pod-autoscaler/common"
+	vpa_clientset "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/client/clientset/versioned"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/doctor/logic"
+	kube_client "k8s.io/client-go/kubernetes"
+	kube_flag "k8s.io/component-base/cli/flag"
+	"k8s.io/klog/v2"
+)
+
+var (
+	namespace     = flag.String("namespace", "vpa-doctor", "Namespace in which the canary deployment and VPA are created. Created if it doesn't exist.")
+	image         = flag.String("image", "registry.k8s.io/pause:3.8", "Image of the canary container. In air-gapped clusters point it to a local registry.")
+	replicas      = flag.Int("replicas", 2, "Replicas of the canary deployment. Has to be at least the --min-replicas of the updater.")
+	checkTimeout  = flag.Duration("check-timeout", 5*time.Minute, "How long to wait for each check to pass. Has to be longer than the recommender and updater intervals.")
+	pollInterval  = flag.Duration("poll-interval", 5*time.Second, "How often the state of the canary objects is polled.")
+	keepResources = flag.Bool("keep-resources", false, "If true, the canary deployment and VPA are not deleted after the run.")
+	kubeconfig    = flag.String("kubeconfig", "", "Path to a kubeconfig. Only required if out-of-cluster.")
+	kubeApiQps    = flag.Float64("kube-api-qps", 5.0, `QPS limit when making requests to Kubernetes apiserver`)
+	kubeApiBurst  = flag.Float64("kube-api-burst", 10.0, `QPS burst limit when making requests to Kubernetes apiserver`)
+)
+
+func main() {
+	klog.InitFlags(nil)
+	kube_flag.InitFlags()
+	klog.V(1).Infof("Vertical Pod Autoscaler %s Doctor", common.VerticalPodAutoscalerVersion)
+
+	config := common.CreateKubeConfigOrDie(*kubeconfig, float32(*kubeApiQps), int(*kubeApiBurst))
+	doctor := logic.NewDoctor(kube_client.NewForConfigOrDie(config), vpa_clientset.NewForConfigOrDie(config), logic.Config{
+		Namespace:     *namespace,
+		Image:         *image,
+		Replicas:      int32(*replicas),
+		CheckTimeout:  *checkTimeout,
+		PollInterval:  *pollInterval,
+		KeepResources: *keepResources,
+	})
+
+	results := doctor.Run(context.Background())
+	for _, result := range results {
+		status := "PASS"
+		if result.Skipped {
+			status = "SKIP"
+		} else if !result.Passed {
+			status = "FAIL"
+		}
+		fmt.Printf("%-4s %-14s %8v %s\n", status, result.Name, result.Duration.Round(time.Second), result.Message)
+	}
+	if !logic.Passed(results) {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,291 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+	kube_client "k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+const (
+	remoteUserHeader        = "X-Remote-User"
+	remoteGroupHeader       = "X-Remote-Group"
+	remoteExtraHeaderPrefix = "X-Remote-Extra-"
+)
+
+var groupResource = schema.GroupResource{Group: GroupName, Resource: Resource}
+
+// UserInfo is the user a request is made by, as authenticated by the
+// kube-apiserver proxying it.
+type UserInfo struct {
+	Name   string
+	Groups []string
+	Extra  map[string][]string
+}
+
+// Authorizer decides whether a user may get or list recommendations.
+type Authorizer interface {
+	Authorize(ctx context.Context, user UserInfo, verb, namespace, name string) (bool, error)
+}
+
+type subjectAccessReviewAuthorizer struct {
+	kubeClient kube_client.Interface
+}
+
+// NewSubjectAccessReviewAuthorizer returns an Authorizer delegating decisions
+// to the kube-apiserver with SubjectAccessReviews, so that access to
+// recommendations is granted with RBAC like to any other resource.
+func NewSubjectAccessReviewAuthorizer(kubeClient kube_client.Interface) Authorizer {
+	return &subjectAccessReviewAuthorizer{kubeClient: kubeClient}
+}
+
+func (a *subjectAccessReviewAuthorizer) Authorize(ctx context.Context, user UserInfo, verb, namespace, name string) (bool, error) {
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for key, values := range user.Extra {
+		extra[key] = values
+	}
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: namespace,
+				Verb:      verb,
+				Group:     GroupName,
+				Version:   Version,
+				Resource:  Resource,
+				Name:      name,
+			},
+			User:   user.Name,
+			Groups: user.Groups,
+			Extra:  extra,
+		},
+	}
+	result, err := a.kubeClient.AuthorizationV1().SubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return false, err
+	}
+	return result.Status.Allowed, nil
+}
+
+type handler struct {
+	store        *RecommendationStore
+	authorizer   Authorizer
+	allowedNames []string
+}
+
+// NewHandler returns a handler serving the recommendations in the store as a
+// read-only API, to be registered with the kube-aggregator by an APIService.
+// Requests are only accepted with a verified client certificate, whose common
+// name is one of allowedNames unless it's empty.
+func NewHandler(store *RecommendationStore, authorizer Authorizer, allowedNames []string) http.Handler {
+	return &handler{
+		store:        store,
+		authorizer:   authorizer,
+		allowedNames: allowedNames,
+	}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, err := h.authenticate(r)
+	if err != nil {
+		klog.V(4).Infof("Rejecting recommendation API request %s: %v", r.URL.Path, err)
+		writeError(w, apierrors.NewUnauthorized(err.Error()))
+		return
+	}
+
+	groupPath := "/apis/" + GroupName
+	versionPath := groupPath + "/" + Version
+	switch {
+	case r.URL.Path == groupPath || r.URL.Path == groupPath+"/":
+		writeJSON(w, http.StatusOK, apiGroup())
+		return
+	case r.URL.Path == versionPath || r.URL.Path == versionPath+"/":
+		writeJSON(w, http.StatusOK, apiResourceList())
+		return
+	case !strings.HasPrefix(r.URL.Path, versionPath+"/"):
+		writeError(w, apierrors.NewNotFound(schema.GroupResource{}, r.URL.Path))
+		return
+	}
+
+	var namespace, name string
+	switch parts := strings.Split(strings.TrimPrefix(r.URL.Path, versionPath+"/"), "/"); {
+	case len(parts) == 1 && parts[0] == Resource:
+	case len(parts) == 3 && parts[0] == "namespaces" && parts[2] == Resource:
+		namespace = parts[1]
+	case len(parts) == 4 && parts[0] == "namespaces" && parts[2] == Resource:
+		namespace, name = parts[1], parts[3]
+	default:
+		writeError(w, apierrors.NewNotFound(schema.GroupResource{}, r.URL.Path))
+		return
+	}
+
+	verb := "list"
+	if name != "" {
+		verb = "get"
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, apierrors.NewMethodNotSupported(groupResource, strings.ToLower(r.Method)))
+		return
+	}
+	if r.URL.Query().Get("watch") == "true" {
+		writeError(w, apierrors.NewMethodNotSupported(groupResource, "watch"))
+		return
+	}
+
+	allowed, err := h.authorizer.Authorize(r.Context(), user, verb, namespace, name)
+	if err != nil {
+		klog.Errorf("Cannot authorize recommendation API request of %s: %v", user.Name, err)
+		writeError(w, apierrors.NewInternalError(err))
+		return
+	}
+	if !allowed {
+		writeError(w, apierrors.NewForbidden(groupResource, name, fmt.Errorf("user %q cannot %s %s in namespace %q", user.Name, verb, Resource, namespace)))
+		return
+	}
+
+	if name == "" {
+		writeJSON(w, http.StatusOK, &VerticalPodAutoscalerRecommendationList{
+			TypeMeta: metav1.TypeMeta{APIVersion: GroupName + "/" + Version, Kind: ListKind},
+			Items:    h.store.List(namespace),
+		})
+		return
+	}
+	recommendation, found := h.store.Get(model.VpaID{Namespace: namespace, VpaName: name})
+	if !found {
+		writeError(w, apierrors.NewNotFound(groupResource, name))
+		return
+	}
+	writeJSON(w, http.StatusOK, recommendation)
+}
+
+// authenticate returns the user the kube-apiserver proxied the request for.
+// The user headers are only trusted with a verified client certificate.
+func (h *handler) authenticate(r *http.Request) (UserInfo, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return UserInfo{}, fmt.Errorf("no verified client certificate")
+	}
+	if len(h.allowedNames) > 0 {
+		commonName := r.TLS.PeerCertificates[0].Subject.CommonName
+		allowed := false
+		for _, name := range h.allowedNames {
+			if name == commonName {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return UserInfo{}, fmt.Errorf("client certificate common name %q is not allowed", commonName)
+		}
+	}
+	user := UserInfo{
+		Name:   r.Header.Get(remoteUserHeader),
+		Groups: r.Header.Values(remoteGroupHeader),
+		Extra:  map[string][]string{},
+	}
+	if user.Name == "" {
+		return UserInfo{}, fmt.Errorf("missing %s header", remoteUserHeader)
+	}
+	for header, values := range r.Header {
+		if strings.HasPrefix(header, remoteExtraHeaderPrefix) {
+			key := strings.ToLower(strings.TrimPrefix(header, remoteExtraHeaderPrefix))
+			user.Extra[key] = append(user.Extra[key], values...)
+		}
+	}
+	return user, nil
+}
+
+func apiGroup() *metav1.APIGroup {
+	version := metav1.GroupVersionForDiscovery{GroupVersion: GroupName + "/" + Version, Version: Version}
+	return &metav1.APIGroup{
+		TypeMeta:         metav1.TypeMeta{APIVersion: "v1", Kind: "APIGroup"},
+		Name:             GroupName,
+		Versions:         []metav1.GroupVersionForDiscovery{version},
+		PreferredVersion: version,
+	}
+}
+
+func apiResourceList() *metav1.APIResourceList {
+	return &metav1.APIResourceList{
+		TypeMeta:     metav1.TypeMeta{APIVersion: "v1", Kind: "APIResourceList"},
+		GroupVersion: GroupName + "/" + Version,
+		APIResources: []metav1.APIResource{{
+			Name:       Resource,
+			Namespaced: true,
+			Kind:       Kind,
+			Verbs:      metav1.Verbs{"get", "list"},
+		}},
+	}
+}
+
+func writeError(w http.ResponseWriter, err *apierrors.StatusError) {
+	status := err.Status()
+	status.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "Status"}
+	writeJSON(w, int(status.Code), &status)
+}
+
+func writeJSON(w http.ResponseWriter, code int, object interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(object); err != nil {
+		klog.Errorf("Cannot write recommendation API response: %v", err)
+	}
+}
+
+// ServerConfig configures serving the recommendation API.
+type ServerConfig struct {
+	Address  string
+	CertFile string
+	KeyFile  string
+	// ClientCAFile verifies the client certificate the kube-apiserver proxies
+	// requests with, i.e. its --requestheader-client-ca-file.
+	ClientCAFile string
+}
+
+// ListenAndServe serves the handler over TLS. It only returns on error.
+func ListenAndServe(config ServerConfig, handler http.Handler) error {
+	clientCA, err := os.ReadFile(config.ClientCAFile)
+	if err != nil {
+		return fmt.Errorf("cannot read client CA: %v", err)
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(clientCA) {
+		return fmt.Errorf("no certificates found in %s", config.ClientCAFile)
+	}
+	server := &http.Server{
+		Addr:    config.Address,
+		Handler: handler,
+		TLSConfig: &tls.Config{
+			ClientCAs:  clientCAs,
+			ClientAuth: tls.VerifyClientCertIfGiven,
+			MinVersion: tls.VersionTLS12,
+		},
+	}
+	return server.ListenAndServeTLS(config.CertFile, config.KeyFile)
+}
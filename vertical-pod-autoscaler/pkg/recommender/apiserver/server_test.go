@@ -0,0 +1,141 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+)
+
+const basePath = "/apis/" + GroupName + "/" + Version
+
+type fakeAuthorizer struct {
+	allowedNamespace string
+	lastUser         UserInfo
+}
+
+func (a *fakeAuthorizer) Authorize(_ context.Context, user UserInfo, verb, namespace, name string) (bool, error) {
+	a.lastUser = user
+	return namespace == a.allowedNamespace, nil
+}
+
+func newTestStore() *RecommendationStore {
+	store := NewRecommendationStore()
+	store.Replace(map[model.VpaID]vpa_types.VerticalPodAutoscalerStatus{
+		{Namespace: "namespace-1", VpaName: "vpa-2"}: {Conditions: []vpa_types.VerticalPodAutoscalerCondition{{Type: vpa_types.RecommendationProvided}}},
+		{Namespace: "namespace-1", VpaName: "vpa-1"}: {},
+		{Namespace: "namespace-2", VpaName: "vpa-1"}: {},
+	})
+	return store
+}
+
+func newTestRequest(method, path string, verified bool) *http.Request {
+	request := httptest.NewRequest(method, path, nil)
+	request.Header.Set(remoteUserHeader, "user")
+	request.Header.Add(remoteGroupHeader, "group-1")
+	request.Header.Add(remoteGroupHeader, "group-2")
+	request.Header.Set(remoteExtraHeaderPrefix+"Scopes", "scope")
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "front-proxy-client"}}
+	request.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	if verified {
+		request.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+	}
+	return request
+}
+
+func serve(handler http.Handler, request *http.Request, response interface{}) int {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if response != nil {
+		json.NewDecoder(recorder.Body).Decode(response)
+	}
+	return recorder.Code
+}
+
+func TestGetRecommendation(t *testing.T) {
+	authorizer := &fakeAuthorizer{allowedNamespace: "namespace-1"}
+	handler := NewHandler(newTestStore(), authorizer, nil)
+
+	recommendation := &VerticalPodAutoscalerRecommendation{}
+	code := serve(handler, newTestRequest(http.MethodGet, basePath+"/namespaces/namespace-1/"+Resource+"/vpa-2", true), recommendation)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "vpa-2", recommendation.Name)
+	assert.Equal(t, Kind, recommendation.Kind)
+	assert.Len(t, recommendation.Status.Conditions, 1)
+	assert.Equal(t, UserInfo{Name: "user", Groups: []string{"group-1", "group-2"}, Extra: map[string][]string{"scopes": {"scope"}}}, authorizer.lastUser)
+
+	status := &metav1.Status{}
+	code = serve(handler, newTestRequest(http.MethodGet, basePath+"/namespaces/namespace-1/"+Resource+"/vpa-3", true), status)
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Equal(t, metav1.StatusReasonNotFound, status.Reason)
+}
+
+func TestListRecommendations(t *testing.T) {
+	handler := NewHandler(newTestStore(), &fakeAuthorizer{allowedNamespace: "namespace-1"}, nil)
+
+	list := &VerticalPodAutoscalerRecommendationList{}
+	code := serve(handler, newTestRequest(http.MethodGet, basePath+"/namespaces/namespace-1/"+Resource, true), list)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, ListKind, list.Kind)
+	if assert.Len(t, list.Items, 2) {
+		assert.Equal(t, "vpa-1", list.Items[0].Name)
+		assert.Equal(t, "vpa-2", list.Items[1].Name)
+	}
+
+	// Listing in all namespaces isn't allowed by the authorizer.
+	code = serve(handler, newTestRequest(http.MethodGet, basePath+"/"+Resource, true), nil)
+	assert.Equal(t, http.StatusForbidden, code)
+}
+
+func TestRecommendationAPIRejectsRequests(t *testing.T) {
+	path := basePath + "/namespaces/namespace-1/" + Resource + "/vpa-1"
+	handler := NewHandler(newTestStore(), &fakeAuthorizer{allowedNamespace: "namespace-1"}, nil)
+
+	assert.Equal(t, http.StatusUnauthorized, serve(handler, newTestRequest(http.MethodGet, path, false), nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(handler, newTestRequest(http.MethodPut, path, true), nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(handler, newTestRequest(http.MethodGet, basePath+"/"+Resource+"?watch=true", true), nil))
+	assert.Equal(t, http.StatusNotFound, serve(handler, newTestRequest(http.MethodGet, basePath+"/pods", true), nil))
+
+	handler = NewHandler(newTestStore(), &fakeAuthorizer{allowedNamespace: "namespace-1"}, []string{"aggregator"})
+	assert.Equal(t, http.StatusUnauthorized, serve(handler, newTestRequest(http.MethodGet, path, true), nil))
+}
+
+func TestRecommendationAPIDiscovery(t *testing.T) {
+	handler := NewHandler(newTestStore(), &fakeAuthorizer{}, nil)
+
+	resources := &metav1.APIResourceList{}
+	assert.Equal(t, http.StatusOK, serve(handler, newTestRequest(http.MethodGet, basePath, true), resources))
+	assert.Equal(t, GroupName+"/"+Version, resources.GroupVersion)
+	if assert.Len(t, resources.APIResources, 1) {
+		assert.Equal(t, Resource, resources.APIResources[0].Name)
+	}
+
+	group := &metav1.APIGroup{}
+	assert.Equal(t, http.StatusOK, serve(handler, newTestRequest(http.MethodGet, "/apis/"+GroupName, true), group))
+	assert.Equal(t, Version, group.PreferredVersion.Version)
+}
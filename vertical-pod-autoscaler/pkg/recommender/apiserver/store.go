@@ -0,0 +1,92 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiserver
+
+import (
+	"sort"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+)
+
+// RecommendationStore holds the latest recommendations of all VPAs. It is
+// written by the recommender loop and read by the API server.
+type RecommendationStore struct {
+	mutex           sync.RWMutex
+	recommendations map[model.VpaID]vpa_types.VerticalPodAutoscalerStatus
+}
+
+// NewRecommendationStore returns a new, empty RecommendationStore.
+func NewRecommendationStore() *RecommendationStore {
+	return &RecommendationStore{
+		recommendations: make(map[model.VpaID]vpa_types.VerticalPodAutoscalerStatus),
+	}
+}
+
+// Replace replaces all recommendations in the store.
+func (s *RecommendationStore) Replace(recommendations map[model.VpaID]vpa_types.VerticalPodAutoscalerStatus) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.recommendations = recommendations
+}
+
+// Get returns the recommendation of the given VPA, if any.
+func (s *RecommendationStore) Get(vpaID model.VpaID) (*VerticalPodAutoscalerRecommendation, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	status, found := s.recommendations[vpaID]
+	if !found {
+		return nil, false
+	}
+	return newRecommendation(vpaID, status), true
+}
+
+// List returns the recommendations of VPAs in the given namespace, or in all
+// namespaces if it's empty, ordered by namespace and name.
+func (s *RecommendationStore) List(namespace string) []VerticalPodAutoscalerRecommendation {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	result := []VerticalPodAutoscalerRecommendation{}
+	for vpaID, status := range s.recommendations {
+		if namespace == "" || vpaID.Namespace == namespace {
+			result = append(result, *newRecommendation(vpaID, status))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Namespace != result[j].Namespace {
+			return result[i].Namespace < result[j].Namespace
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+func newRecommendation(vpaID model.VpaID, status vpa_types.VerticalPodAutoscalerStatus) *VerticalPodAutoscalerRecommendation {
+	return &VerticalPodAutoscalerRecommendation{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: GroupName + "/" + Version,
+			Kind:       Kind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: vpaID.Namespace,
+			Name:      vpaID.VpaName,
+		},
+		Status: *status.DeepCopy(),
+	}
+}
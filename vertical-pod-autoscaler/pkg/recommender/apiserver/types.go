@@ -0,0 +1,52 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiserver
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+)
+
+const (
+	// GroupName is the API group recommendations are served in.
+	GroupName = "recommendations.autoscaling.k8s.io"
+	// Version is the only served version of GroupName.
+	Version = "v1"
+	// Resource is the plural resource name of recommendations.
+	Resource = "verticalpodautoscalerrecommendations"
+	// Kind is the kind of a single recommendation.
+	Kind = "VerticalPodAutoscalerRecommendation"
+	// ListKind is the kind of a list of recommendations.
+	ListKind = "VerticalPodAutoscalerRecommendationList"
+)
+
+// VerticalPodAutoscalerRecommendation is the status the recommender computed
+// for the VPA object with the same namespace and name.
+type VerticalPodAutoscalerRecommendation struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Status vpa_types.VerticalPodAutoscalerStatus `json:"status,omitempty"`
+}
+
+// VerticalPodAutoscalerRecommendationList is a list of recommendations.
+type VerticalPodAutoscalerRecommendationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []VerticalPodAutoscalerRecommendation `json:"items"`
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package audit records changes of recommendations, with the usage they are
+// based on, so that why a recommendation changed can be explained later.
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/logic"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+)
+
+// Entry is a change of the target recommendation of a container of a VPA.
+type Entry struct {
+	Time      time.Time `json:"time"`
+	Namespace string    `json:"namespace"`
+	Vpa       string    `json:"vpa"`
+	Container string    `json:"container"`
+	// OldTarget is empty for containers recommended for the first time,
+	// NewTarget for containers no longer recommended for.
+	OldTarget      apiv1.ResourceList `json:"oldTarget,omitempty"`
+	NewTarget      apiv1.ResourceList `json:"newTarget,omitempty"`
+	UncappedTarget apiv1.ResourceList `json:"uncappedTarget,omitempty"`
+	// TargetCPUPercentile and TargetMemoryPercentile are the usage
+	// percentiles the target is based on, CPUUsage, in cores, and
+	// MemoryPeak, in bytes, the usage at these percentiles.
+	TargetCPUPercentile    float64 `json:"targetCPUPercentile,omitempty"`
+	TargetMemoryPercentile float64 `json:"targetMemoryPercentile,omitempty"`
+	CPUUsage               float64 `json:"cpuUsage,omitempty"`
+	MemoryPeak             float64 `json:"memoryPeak,omitempty"`
+	// PostProcessors are the post processors applied to the recommendation,
+	// in order.
+	PostProcessors []string `json:"postProcessors,omitempty"`
+}
+
+// Logger writes an Entry for every container whose target recommendation
+// changed.
+type Logger struct {
+	encoder *json.Encoder
+}
+
+// NewJSONLogger creates a Logger writing entries to w as JSON, one per line.
+func NewJSONLogger(w io.Writer) *Logger {
+	return &Logger{encoder: json.NewEncoder(w)}
+}
+
+// Record compares the old and new recommendations of the VPA and logs the
+// changed targets, at the given time.
+func (l *Logger) Record(now time.Time, vpaID model.VpaID, oldRecommendation, newRecommendation *vpa_types.RecommendedPodResources, aggregates model.ContainerNameToAggregateStateMap, postProcessors []string) error {
+	oldRecommendations := containerRecommendations(oldRecommendation)
+	newRecommendations := containerRecommendations(newRecommendation)
+	containers := make([]string, 0, len(oldRecommendations)+len(newRecommendations))
+	for container := range newRecommendations {
+		containers = append(containers, container)
+	}
+	for container := range oldRecommendations {
+		if _, found := newRecommendations[container]; !found {
+			containers = append(containers, container)
+		}
+	}
+	sort.Strings(containers)
+
+	for _, container := range containers {
+		oldTarget := oldRecommendations[container].Target
+		newTarget := newRecommendations[container].Target
+		if apiequality.Semantic.DeepEqual(oldTarget, newTarget) {
+			continue
+		}
+		entry := Entry{
+			Time:           now,
+			Namespace:      vpaID.Namespace,
+			Vpa:            vpaID.VpaName,
+			Container:      container,
+			OldTarget:      oldTarget,
+			NewTarget:      newTarget,
+			UncappedTarget: newRecommendations[container].UncappedTarget,
+			PostProcessors: postProcessors,
+		}
+		if aggregate, found := aggregates[container]; found {
+			entry.TargetCPUPercentile, entry.TargetMemoryPercentile = logic.GetTargetPercentiles(aggregate)
+			entry.CPUUsage = aggregate.AggregateCPUUsage.Percentile(entry.TargetCPUPercentile)
+			entry.MemoryPeak = aggregate.AggregateMemoryPeaks.Percentile(entry.TargetMemoryPercentile)
+		}
+		if err := l.encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func containerRecommendations(recommendation *vpa_types.RecommendedPodResources) map[string]vpa_types.RecommendedContainerResources {
+	result := make(map[string]vpa_types.RecommendedContainerResources)
+	if recommendation == nil {
+		return result
+	}
+	for _, containerRecommendation := range recommendation.ContainerRecommendations {
+		result[containerRecommendation.ContainerName] = containerRecommendation
+	}
+	return result
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/test"
+)
+
+var testVpaID = model.VpaID{Namespace: "namespace-1", VpaName: "vpa-1"}
+
+func decodeEntries(t *testing.T, buffer *bytes.Buffer) []Entry {
+	var entries []Entry
+	decoder := json.NewDecoder(buffer)
+	for decoder.More() {
+		entry := Entry{}
+		assert.NoError(t, decoder.Decode(&entry))
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestRecord(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	state := model.NewAggregateContainerState()
+	state.AddSample(&model.ContainerUsageSample{
+		MeasureStart: now,
+		Usage:        model.CPUAmountFromCores(1.0),
+		Resource:     model.ResourceCPU,
+	})
+	aggregates := model.ContainerNameToAggregateStateMap{"container-1": state}
+	oldRecommendation := test.Recommendation().WithContainer("container-1").WithTarget("1", "1Gi").Get()
+	oldRecommendation.ContainerRecommendations = append(oldRecommendation.ContainerRecommendations,
+		test.Recommendation().WithContainer("container-2").WithTarget("1", "1Gi").GetContainerResources(),
+		test.Recommendation().WithContainer("container-3").WithTarget("1", "1Gi").GetContainerResources())
+	newRecommendation := test.Recommendation().WithContainer("container-1").WithTarget("2", "1Gi").Get()
+	newRecommendation.ContainerRecommendations = append(newRecommendation.ContainerRecommendations,
+		test.Recommendation().WithContainer("container-2").WithTarget("1000m", "1Gi").GetContainerResources())
+
+	buffer := &bytes.Buffer{}
+	logger := NewJSONLogger(buffer)
+	assert.NoError(t, logger.Record(now, testVpaID, oldRecommendation, newRecommendation, aggregates, []string{"capping"}))
+
+	// container-2 is unchanged, container-3 is no longer recommended for.
+	entries := decodeEntries(t, buffer)
+	if assert.Len(t, entries, 2) {
+		entry := entries[0]
+		assert.Equal(t, "container-1", entry.Container)
+		assert.True(t, now.Equal(entry.Time))
+		assert.Equal(t, "vpa-1", entry.Vpa)
+		assert.Equal(t, "1", entry.OldTarget.Cpu().String())
+		assert.Equal(t, "2", entry.NewTarget.Cpu().String())
+		assert.Equal(t, 0.9, entry.TargetCPUPercentile)
+		assert.InDelta(t, 1.0, entry.CPUUsage, 0.1)
+		assert.Equal(t, []string{"capping"}, entry.PostProcessors)
+
+		assert.Equal(t, "container-3", entries[1].Container)
+		assert.Empty(t, entries[1].NewTarget)
+	}
+}
+
+func TestRecordFirstRecommendation(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	logger := NewJSONLogger(buffer)
+	recommendation := test.Recommendation().WithContainer("container-1").WithTarget("1", "1Gi").Get()
+	assert.NoError(t, logger.Record(time.Now(), testVpaID, nil, recommendation, nil, nil))
+
+	entries := decodeEntries(t, buffer)
+	if assert.Len(t, entries, 1) {
+		assert.Empty(t, entries[0].OldTarget)
+		assert.Equal(t, "1Gi", entries[0].NewTarget.Memory().String())
+	}
+}
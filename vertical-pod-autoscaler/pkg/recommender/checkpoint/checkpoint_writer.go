@@ -22,12 +22,12 @@ import (
 	"sort"
 	"time"
 
+	"golang.org/x/time/rate"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
 	vpa_api "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/client/clientset/versioned/typed/autoscaling.k8s.io/v1"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
-	api_util "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/vpa"
 	"k8s.io/klog/v2"
 )
 
@@ -36,20 +36,45 @@ import (
 type CheckpointWriter interface {
 	// StoreCheckpoints writes at least minCheckpoints if there are more checkpoints to write.
 	// Checkpoints are written until ctx permits or all checkpoints are written.
+	// It returns an error if checkpoints were due but none could be stored.
 	StoreCheckpoints(ctx context.Context, now time.Time, minCheckpoints int) error
 }
 
 type checkpointWriter struct {
-	vpaCheckpointClient vpa_api.VerticalPodAutoscalerCheckpointsGetter
-	cluster             *model.ClusterState
+	storage   CheckpointStorage
+	cluster   *model.ClusterState
+	frequency FrequencyConfig
+	// Nil if the write rate is not limited.
+	limiter *rate.Limiter
+	// Recommendations of VPAs at the time their last checkpoint was written.
+	checkpointedRecommendations map[model.VpaID]*vpa_types.RecommendedPodResources
 }
 
 // NewCheckpointWriter returns new instance of a CheckpointWriter
 func NewCheckpointWriter(cluster *model.ClusterState, vpaCheckpointClient vpa_api.VerticalPodAutoscalerCheckpointsGetter) CheckpointWriter {
-	return &checkpointWriter{
-		vpaCheckpointClient: vpaCheckpointClient,
-		cluster:             cluster,
+	return NewAdaptiveCheckpointWriter(cluster, vpaCheckpointClient, FrequencyConfig{})
+}
+
+// NewAdaptiveCheckpointWriter returns new instance of a CheckpointWriter which
+// writes checkpoints of VPAs with the frequency depending on how fast their
+// recommendations change.
+func NewAdaptiveCheckpointWriter(cluster *model.ClusterState, vpaCheckpointClient vpa_api.VerticalPodAutoscalerCheckpointsGetter, frequency FrequencyConfig) CheckpointWriter {
+	return NewStorageCheckpointWriter(cluster, NewCRDStorage(nil, vpaCheckpointClient), frequency)
+}
+
+// NewStorageCheckpointWriter returns new instance of an adaptive
+// CheckpointWriter which writes checkpoints to the given storage.
+func NewStorageCheckpointWriter(cluster *model.ClusterState, storage CheckpointStorage, frequency FrequencyConfig) CheckpointWriter {
+	writer := &checkpointWriter{
+		storage:                     storage,
+		cluster:                     cluster,
+		frequency:                   frequency,
+		checkpointedRecommendations: make(map[model.VpaID]*vpa_types.RecommendedPodResources),
 	}
+	if frequency.QPS > 0 {
+		writer.limiter = rate.NewLimiter(rate.Limit(frequency.QPS), frequency.Burst)
+	}
+	return writer
 }
 
 func isFetchingHistory(vpa *model.Vpa) bool {
@@ -75,9 +100,49 @@ func getVpasToCheckpoint(clusterVpas map[model.VpaID]*model.Vpa) []*model.Vpa {
 	return vpas
 }
 
-func (writer *checkpointWriter) StoreCheckpoints(ctx context.Context, now time.Time, minCheckpoints int) error {
-	vpas := getVpasToCheckpoint(writer.cluster.Vpas)
+// getDueVpas returns VPAs from the list whose checkpoints should be written now.
+func (writer *checkpointWriter) getDueVpas(vpas []*model.Vpa, now time.Time) []*model.Vpa {
+	dueVpas := make([]*model.Vpa, 0, len(vpas))
 	for _, vpa := range vpas {
+		if writer.frequency.isCheckpointDue(vpa, writer.checkpointedRecommendations[vpa.ID], now) {
+			dueVpas = append(dueVpas, vpa)
+		}
+	}
+	return dueVpas
+}
+
+// forgetDeletedVpas drops recommendations of VPAs which no longer exist.
+func (writer *checkpointWriter) forgetDeletedVpas() {
+	for vpaID := range writer.checkpointedRecommendations {
+		if _, exists := writer.cluster.Vpas[vpaID]; !exists {
+			delete(writer.checkpointedRecommendations, vpaID)
+		}
+	}
+}
+
+// groupByNamespace splits the VPAs by namespace, keeping their order within
+// namespaces. Namespaces are ordered by their first VPA.
+func groupByNamespace(vpas []*model.Vpa) [][]*model.Vpa {
+	var groups [][]*model.Vpa
+	groupIndex := make(map[string]int)
+	for _, vpa := range vpas {
+		i, found := groupIndex[vpa.ID.Namespace]
+		if !found {
+			i = len(groups)
+			groupIndex[vpa.ID.Namespace] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], vpa)
+	}
+	return groups
+}
+
+func (writer *checkpointWriter) StoreCheckpoints(ctx context.Context, now time.Time, minCheckpoints int) error {
+	writer.forgetDeletedVpas()
+	vpas := writer.getDueVpas(getVpasToCheckpoint(writer.cluster.Vpas), now)
+	var storedBatches, failedBatches int
+	// Checkpoints of all due VPAs of a namespace are written in one batch.
+	for _, namespaceVpas := range groupByNamespace(vpas) {
 
 		// Draining ctx.Done() channel. ctx.Err() will be checked if timeout occurred, but minCheckpoints have
 		// to be written before return from this function.
@@ -89,38 +154,78 @@ func (writer *checkpointWriter) StoreCheckpoints(ctx context.Context, now time.T
 		if ctx.Err() != nil && minCheckpoints <= 0 {
 			return ctx.Err()
 		}
+		storeCtx := ctx
+		if ctx.Err() != nil {
+			// The minCheckpoints still due are written past the timeout.
+			storeCtx = context.Background()
+		}
 
-		aggregateContainerStateMap := buildAggregateContainerStateMap(vpa, writer.cluster, now)
-		for container, aggregatedContainerState := range aggregateContainerStateMap {
-			containerCheckpoint, err := aggregatedContainerState.SaveToCheckpoint()
-			if err != nil {
-				klog.Errorf("Cannot serialize checkpoint for vpa %v container %v. Reason: %+v", vpa.ID.VpaName, container, err)
-				continue
+		namespace := namespaceVpas[0].ID.Namespace
+		var checkpoints []vpa_types.VerticalPodAutoscalerCheckpoint
+		var checkpointedVpas []*model.Vpa
+		rateLimited := false
+		for i, vpa := range namespaceVpas {
+			if writer.limiter != nil && !writer.limiter.Allow() {
+				klog.V(3).Infof("Checkpoint write rate limit reached, %v VPAs of namespace %s left for the next run", len(namespaceVpas)-i, namespace)
+				rateLimited = true
+				break
 			}
-			checkpointName := fmt.Sprintf("%s-%s", vpa.ID.VpaName, container)
-			vpaCheckpoint := vpa_types.VerticalPodAutoscalerCheckpoint{
-				ObjectMeta: metav1.ObjectMeta{Name: checkpointName},
-				Spec: vpa_types.VerticalPodAutoscalerCheckpointSpec{
-					ContainerName: container,
-					VPAObjectName: vpa.ID.VpaName,
-				},
-				Status: *containerCheckpoint,
+			vpaCheckpoints := buildCheckpoints(vpa, writer.cluster, now)
+			if len(vpaCheckpoints) > 0 {
+				checkpoints = append(checkpoints, vpaCheckpoints...)
+				checkpointedVpas = append(checkpointedVpas, vpa)
 			}
-			err = api_util.CreateOrUpdateVpaCheckpoint(writer.vpaCheckpointClient.VerticalPodAutoscalerCheckpoints(vpa.ID.Namespace), &vpaCheckpoint)
-			if err != nil {
-				klog.Errorf("Cannot save VPA %s/%s checkpoint for %s. Reason: %+v",
-					vpa.ID.Namespace, vpaCheckpoint.Spec.VPAObjectName, vpaCheckpoint.Spec.ContainerName, err)
+		}
+
+		if len(checkpoints) > 0 {
+			if err := writer.storage.Store(storeCtx, namespace, checkpoints); err != nil {
+				klog.Errorf("Cannot save %d VPA checkpoints in namespace %s. Reason: %+v", len(checkpoints), namespace, err)
+				failedBatches++
 			} else {
-				klog.V(3).Infof("Saved VPA %s/%s checkpoint for %s",
-					vpa.ID.Namespace, vpaCheckpoint.Spec.VPAObjectName, vpaCheckpoint.Spec.ContainerName)
-				vpa.CheckpointWritten = now
+				storedBatches++
+				klog.V(3).Infof("Saved %d VPA checkpoints in namespace %s", len(checkpoints), namespace)
+				for _, vpa := range checkpointedVpas {
+					vpa.CheckpointWritten = now
+					writer.checkpointedRecommendations[vpa.ID] = vpa.Recommendation.DeepCopy()
+				}
 			}
-			minCheckpoints--
+			minCheckpoints -= len(checkpoints)
 		}
+		if rateLimited {
+			break
+		}
+	}
+	if failedBatches > 0 && storedBatches == 0 {
+		return fmt.Errorf("cannot save VPA checkpoints in any of %d namespaces", failedBatches)
 	}
 	return nil
 }
 
+// buildCheckpoints returns the checkpoints of all containers of the VPA.
+func buildCheckpoints(vpa *model.Vpa, cluster *model.ClusterState, now time.Time) []vpa_types.VerticalPodAutoscalerCheckpoint {
+	var checkpoints []vpa_types.VerticalPodAutoscalerCheckpoint
+	aggregateContainerStateMap := buildAggregateContainerStateMap(vpa, cluster, now)
+	for container, aggregatedContainerState := range aggregateContainerStateMap {
+		containerCheckpoint, err := aggregatedContainerState.SaveToCheckpoint()
+		if err != nil {
+			klog.Errorf("Cannot serialize checkpoint for vpa %v container %v. Reason: %+v", vpa.ID.VpaName, container, err)
+			continue
+		}
+		checkpoints = append(checkpoints, vpa_types.VerticalPodAutoscalerCheckpoint{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("%s-%s", vpa.ID.VpaName, container),
+				Namespace: vpa.ID.Namespace,
+			},
+			Spec: vpa_types.VerticalPodAutoscalerCheckpointSpec{
+				ContainerName: container,
+				VPAObjectName: vpa.ID.VpaName,
+			},
+			Status: *containerCheckpoint,
+		})
+	}
+	return checkpoints
+}
+
 // Build the AggregateContainerState for the purpose of the checkpoint. This is an aggregation of state of all
 // containers that belong to pods matched by the VPA.
 // Note however that we exclude the most recent memory peak for each container (see below).
@@ -134,7 +239,7 @@ func buildAggregateContainerStateMap(vpa *model.Vpa, cluster *model.ClusterState
 		for containerName, container := range pod.Containers {
 			aggregateKey := cluster.MakeAggregateStateKey(pod, containerName)
 			if vpa.UsesAggregation(aggregateKey) {
-				if aggregateContainerState, exists := aggregateContainerStateMap[containerName]; exists {
+				if aggregateContainerState, exists := aggregateContainerStateMap[aggregateKey.ContainerName()]; exists {
 					subtractCurrentContainerMemoryPeak(aggregateContainerState, container, now)
 				}
 			}
@@ -145,6 +250,6 @@ func buildAggregateContainerStateMap(vpa *model.Vpa, cluster *model.ClusterState
 
 func subtractCurrentContainerMemoryPeak(a *model.AggregateContainerState, container *model.ContainerState, now time.Time) {
 	if now.Before(container.WindowEnd) {
-		a.AggregateMemoryPeaks.SubtractSample(model.BytesFromMemoryAmount(container.GetMaxMemoryPeak()), 1.0, container.WindowEnd)
+		a.AggregateMemoryPeaks.SubtractSample(model.BytesFromMemoryAmount(container.GetMaxMemoryPeak()), container.GetMaxMemoryPeakWeight(), container.WindowEnd)
 	}
 }
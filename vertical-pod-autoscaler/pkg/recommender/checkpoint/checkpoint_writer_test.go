@@ -17,6 +17,7 @@ limitations under the License.
 package checkpoint
 
 import (
+	"context"
 	"fmt"
 	"testing"
 	"time"
@@ -171,3 +172,98 @@ func TestGetVpasToCheckpointSorts(t *testing.T) {
 	assert.Equal(t, genVpaID(2), result[2].ID)
 
 }
+
+func TestStoreCheckpointsBatchesNamespaces(t *testing.T) {
+	cluster := model.NewClusterState(testGcPeriod)
+	testPodID2 := model.PodID{Namespace: "namespace-2", PodName: "pod-1"}
+	for _, podID := range []model.PodID{testPodID1, testPodID2} {
+		cluster.AddOrUpdatePod(podID, testLabels, v1.PodRunning)
+		containerID := model.ContainerID{PodID: podID, ContainerName: "container-1"}
+		assert.NoError(t, cluster.AddOrUpdateContainer(containerID, testRequest))
+		cluster.GetContainer(containerID).AddSample(&model.ContainerUsageSample{
+			MeasureStart: time.Unix(1, 0),
+			Usage:        model.CPUAmountFromCores(1),
+			Request:      testRequest[model.ResourceCPU],
+			Resource:     model.ResourceCPU,
+		})
+	}
+	addVpa(t, cluster, testVpaID1, testSelectorStr)
+	addVpa(t, cluster, model.VpaID{Namespace: "namespace-1", VpaName: "vpa-2"}, testSelectorStr)
+	addVpa(t, cluster, model.VpaID{Namespace: "namespace-2", VpaName: "vpa-1"}, testSelectorStr)
+
+	store := newFakeObjectStore()
+	storage := NewObjectStoreStorage(store, "")
+	writer := NewStorageCheckpointWriter(cluster, storage, FrequencyConfig{})
+	assert.NoError(t, writer.StoreCheckpoints(context.Background(), time.Unix(2, 0), 10))
+
+	assert.Equal(t, 2, store.puts)
+	checkpoints, err := storage.List(context.Background(), "namespace-1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"vpa-1-container-1", "vpa-2-container-1"}, checkpointNames(checkpoints))
+	checkpoints, err = storage.List(context.Background(), "namespace-2")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"vpa-1-container-1"}, checkpointNames(checkpoints))
+	for _, vpa := range cluster.Vpas {
+		assert.Equal(t, time.Unix(2, 0), vpa.CheckpointWritten)
+	}
+}
+
+func TestStoreCheckpointsFails(t *testing.T) {
+	cluster := model.NewClusterState(testGcPeriod)
+	cluster.AddOrUpdatePod(testPodID1, testLabels, v1.PodRunning)
+	containerID := model.ContainerID{PodID: testPodID1, ContainerName: "container-1"}
+	assert.NoError(t, cluster.AddOrUpdateContainer(containerID, testRequest))
+	cluster.GetContainer(containerID).AddSample(&model.ContainerUsageSample{
+		MeasureStart: time.Unix(1, 0),
+		Usage:        model.CPUAmountFromCores(1),
+		Request:      testRequest[model.ResourceCPU],
+		Resource:     model.ResourceCPU,
+	})
+	addVpa(t, cluster, testVpaID1, testSelectorStr)
+
+	store := newFakeObjectStore()
+	store.putErr = fmt.Errorf("unavailable")
+	writer := NewStorageCheckpointWriter(cluster, NewObjectStoreStorage(store, ""), FrequencyConfig{})
+	assert.Error(t, writer.StoreCheckpoints(context.Background(), time.Unix(2, 0), 10))
+
+	store.putErr = nil
+	assert.NoError(t, writer.StoreCheckpoints(context.Background(), time.Unix(2, 0), 10))
+}
+
+type contextRecordingStorage struct {
+	CheckpointStorage
+	contexts []context.Context
+}
+
+func (s *contextRecordingStorage) Store(ctx context.Context, namespace string, checkpoints []vpa_types.VerticalPodAutoscalerCheckpoint) error {
+	s.contexts = append(s.contexts, ctx)
+	return s.CheckpointStorage.Store(ctx, namespace, checkpoints)
+}
+
+func TestStoreCheckpointsPassesContext(t *testing.T) {
+	cluster := model.NewClusterState(testGcPeriod)
+	cluster.AddOrUpdatePod(testPodID1, testLabels, v1.PodRunning)
+	containerID := model.ContainerID{PodID: testPodID1, ContainerName: "container-1"}
+	assert.NoError(t, cluster.AddOrUpdateContainer(containerID, testRequest))
+	cluster.GetContainer(containerID).AddSample(&model.ContainerUsageSample{
+		MeasureStart: time.Unix(1, 0),
+		Usage:        model.CPUAmountFromCores(1),
+		Request:      testRequest[model.ResourceCPU],
+		Resource:     model.ResourceCPU,
+	})
+	addVpa(t, cluster, testVpaID1, testSelectorStr)
+
+	storage := &contextRecordingStorage{CheckpointStorage: NewObjectStoreStorage(newFakeObjectStore(), "")}
+	writer := NewStorageCheckpointWriter(cluster, storage, FrequencyConfig{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.NoError(t, writer.StoreCheckpoints(ctx, time.Unix(2, 0), 10))
+	assert.Equal(t, []context.Context{ctx}, storage.contexts)
+
+	// Checkpoints owed by minCheckpoints are still written after a timeout.
+	cancel()
+	assert.NoError(t, writer.StoreCheckpoints(ctx, time.Unix(2, 0), 10))
+	if assert.Len(t, storage.contexts, 2) {
+		assert.NoError(t, storage.contexts[1].Err())
+	}
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checkpoint
+
+import (
+	"math"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+)
+
+// FrequencyConfig configures how often checkpoints of a VPA are written.
+// Checkpoints of VPAs whose recommendation changed by at least
+// VolatilityThreshold since the last checkpoint are written every MinInterval,
+// checkpoints of other VPAs every MaxInterval. A zero MaxInterval writes
+// checkpoints of all VPAs on every call.
+type FrequencyConfig struct {
+	MinInterval time.Duration
+	MaxInterval time.Duration
+	// VolatilityThreshold is the relative change of the target recommendation
+	// of any container and resource, e.g. 0.1 for 10%.
+	VolatilityThreshold float64
+	// QPS and Burst limit the rate at which VPAs are checkpointed, across all
+	// VPAs. QPS of 0 means no limit.
+	QPS   float64
+	Burst int
+}
+
+// isCheckpointDue returns true if the checkpoint of the VPA should be written
+// now, given the recommendation stored in its last checkpoint.
+func (c FrequencyConfig) isCheckpointDue(vpa *model.Vpa, lastRecommendation *vpa_types.RecommendedPodResources, now time.Time) bool {
+	if vpa.CheckpointWritten.IsZero() {
+		return true
+	}
+	sinceLastCheckpoint := now.Sub(vpa.CheckpointWritten)
+	if sinceLastCheckpoint >= c.MaxInterval {
+		return true
+	}
+	return sinceLastCheckpoint >= c.MinInterval &&
+		recommendationChange(lastRecommendation, vpa.Recommendation) >= c.VolatilityThreshold
+}
+
+// recommendationChange returns the largest relative change of the target
+// recommendation of any container and resource. Containers which appeared or
+// disappeared count as an infinite change.
+func recommendationChange(old, new *vpa_types.RecommendedPodResources) float64 {
+	oldTargets := containerTargets(old)
+	newTargets := containerTargets(new)
+	if len(oldTargets) != len(newTargets) {
+		return math.Inf(1)
+	}
+	maxChange := 0.0
+	for containerName, newTarget := range newTargets {
+		oldTarget, found := oldTargets[containerName]
+		if !found {
+			return math.Inf(1)
+		}
+		for _, resource := range []apiv1.ResourceName{apiv1.ResourceCPU, apiv1.ResourceMemory} {
+			maxChange = math.Max(maxChange, relativeChange(oldTarget[resource], newTarget[resource]))
+		}
+	}
+	return maxChange
+}
+
+func containerTargets(recommendation *vpa_types.RecommendedPodResources) map[string]apiv1.ResourceList {
+	targets := make(map[string]apiv1.ResourceList)
+	if recommendation == nil {
+		return targets
+	}
+	for _, containerRecommendation := range recommendation.ContainerRecommendations {
+		targets[containerRecommendation.ContainerName] = containerRecommendation.Target
+	}
+	return targets
+}
+
+func relativeChange(old, new resource.Quantity) float64 {
+	oldValue := old.AsApproximateFloat64()
+	newValue := new.AsApproximateFloat64()
+	if oldValue == newValue {
+		return 0
+	}
+	if oldValue == 0 {
+		return math.Inf(1)
+	}
+	return math.Abs(newValue-oldValue) / oldValue
+}
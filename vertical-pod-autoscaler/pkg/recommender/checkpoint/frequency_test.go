@@ -0,0 +1,113 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checkpoint
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+)
+
+func makeRecommendation(containerName, cpu, memory string) *vpa_types.RecommendedPodResources {
+	return &vpa_types.RecommendedPodResources{
+		ContainerRecommendations: []vpa_types.RecommendedContainerResources{{
+			ContainerName: containerName,
+			Target: v1.ResourceList{
+				v1.ResourceCPU:    resource.MustParse(cpu),
+				v1.ResourceMemory: resource.MustParse(memory),
+			},
+		}},
+	}
+}
+
+func TestIsCheckpointDue(t *testing.T) {
+	now := time.Unix(10000, 0)
+	config := FrequencyConfig{
+		MinInterval:         time.Minute,
+		MaxInterval:         10 * time.Minute,
+		VolatilityThreshold: 0.1,
+	}
+	checkpointed := makeRecommendation("container-1", "100m", "100Mi")
+
+	testCases := []struct {
+		name              string
+		checkpointWritten time.Time
+		recommendation    *vpa_types.RecommendedPodResources
+		expectedDue       bool
+	}{
+		{
+			name:           "never checkpointed",
+			recommendation: checkpointed,
+			expectedDue:    true,
+		},
+		{
+			name:              "stable before max interval",
+			checkpointWritten: now.Add(-5 * time.Minute),
+			recommendation:    makeRecommendation("container-1", "105m", "100Mi"),
+			expectedDue:       false,
+		},
+		{
+			name:              "stable after max interval",
+			checkpointWritten: now.Add(-10 * time.Minute),
+			recommendation:    makeRecommendation("container-1", "105m", "100Mi"),
+			expectedDue:       true,
+		},
+		{
+			name:              "volatile before min interval",
+			checkpointWritten: now.Add(-30 * time.Second),
+			recommendation:    makeRecommendation("container-1", "100m", "200Mi"),
+			expectedDue:       false,
+		},
+		{
+			name:              "volatile after min interval",
+			checkpointWritten: now.Add(-time.Minute),
+			recommendation:    makeRecommendation("container-1", "100m", "200Mi"),
+			expectedDue:       true,
+		},
+		{
+			name:              "new container after min interval",
+			checkpointWritten: now.Add(-time.Minute),
+			recommendation:    makeRecommendation("container-2", "100m", "100Mi"),
+			expectedDue:       true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			vpa := &model.Vpa{
+				CheckpointWritten: tc.checkpointWritten,
+				Recommendation:    tc.recommendation,
+			}
+			assert.Equal(t, tc.expectedDue, config.isCheckpointDue(vpa, checkpointed, now))
+		})
+	}
+}
+
+func TestZeroFrequencyConfigAlwaysDue(t *testing.T) {
+	now := time.Unix(10000, 0)
+	vpa := &model.Vpa{
+		CheckpointWritten: now,
+		Recommendation:    makeRecommendation("container-1", "100m", "100Mi"),
+	}
+	assert.True(t, FrequencyConfig{}.isCheckpointDue(vpa, vpa.Recommendation, now))
+	// MinInterval has no effect without MaxInterval.
+	assert.True(t, FrequencyConfig{MinInterval: time.Minute, VolatilityThreshold: 0.1}.isCheckpointDue(vpa, vpa.Recommendation, now))
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checkpoint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/objectstore"
+)
+
+const objectKeySuffix = ".json"
+
+type objectStoreStorage struct {
+	store  objectstore.ObjectStore
+	prefix string
+	// Serializes read-modify-write cycles of namespace objects.
+	mutex sync.Mutex
+}
+
+// NewObjectStoreStorage returns a CheckpointStorage keeping the checkpoints
+// of each namespace as a single VerticalPodAutoscalerCheckpointList object,
+// under the key <prefix><namespace>.json. Checkpoints of a namespace are
+// written at once, so a Store either writes all of them or none. Only a
+// single recommender may write to a prefix.
+func NewObjectStoreStorage(store objectstore.ObjectStore, prefix string) CheckpointStorage {
+	return &objectStoreStorage{store: store, prefix: prefix}
+}
+
+func (s *objectStoreStorage) key(namespace string) string {
+	return s.prefix + namespace + objectKeySuffix
+}
+
+func (s *objectStoreStorage) Namespaces(ctx context.Context) ([]string, error) {
+	keys, err := s.store.List(ctx, s.prefix)
+	if err != nil {
+		return nil, err
+	}
+	namespaces := make([]string, 0, len(keys))
+	for _, key := range keys {
+		namespace := strings.TrimPrefix(key, s.prefix)
+		if strings.Contains(namespace, "/") || !strings.HasSuffix(namespace, objectKeySuffix) {
+			continue
+		}
+		namespaces = append(namespaces, strings.TrimSuffix(namespace, objectKeySuffix))
+	}
+	return namespaces, nil
+}
+
+func (s *objectStoreStorage) List(ctx context.Context, namespace string) ([]vpa_types.VerticalPodAutoscalerCheckpoint, error) {
+	content, err := s.store.Get(ctx, s.key(namespace))
+	if errors.Is(err, objectstore.ErrObjectNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	checkpointList := &vpa_types.VerticalPodAutoscalerCheckpointList{}
+	if err := json.Unmarshal(content, checkpointList); err != nil {
+		return nil, fmt.Errorf("cannot decode checkpoints of namespace %s: %v", namespace, err)
+	}
+	return checkpointList.Items, nil
+}
+
+func (s *objectStoreStorage) Store(ctx context.Context, namespace string, checkpoints []vpa_types.VerticalPodAutoscalerCheckpoint) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	stored, err := s.load(ctx, namespace)
+	if err != nil {
+		return err
+	}
+	for _, checkpoint := range checkpoints {
+		checkpoint.Namespace = namespace
+		stored[checkpoint.Name] = checkpoint
+	}
+	return s.save(ctx, namespace, stored)
+}
+
+func (s *objectStoreStorage) Delete(ctx context.Context, namespace string, names []string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	stored, err := s.load(ctx, namespace)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		delete(stored, name)
+	}
+	if len(stored) == 0 {
+		return s.store.Delete(ctx, s.key(namespace))
+	}
+	return s.save(ctx, namespace, stored)
+}
+
+func (s *objectStoreStorage) load(ctx context.Context, namespace string) (map[string]vpa_types.VerticalPodAutoscalerCheckpoint, error) {
+	checkpoints, err := s.List(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	stored := make(map[string]vpa_types.VerticalPodAutoscalerCheckpoint, len(checkpoints))
+	for _, checkpoint := range checkpoints {
+		stored[checkpoint.Name] = checkpoint
+	}
+	return stored, nil
+}
+
+func (s *objectStoreStorage) save(ctx context.Context, namespace string, stored map[string]vpa_types.VerticalPodAutoscalerCheckpoint) error {
+	checkpointList := &vpa_types.VerticalPodAutoscalerCheckpointList{}
+	checkpointList.Kind = "VerticalPodAutoscalerCheckpointList"
+	checkpointList.APIVersion = vpa_types.SchemeGroupVersion.String()
+	for _, checkpoint := range stored {
+		checkpointList.Items = append(checkpointList.Items, checkpoint)
+	}
+	sort.Slice(checkpointList.Items, func(i, j int) bool {
+		return checkpointList.Items[i].Name < checkpointList.Items[j].Name
+	})
+	content, err := json.Marshal(checkpointList)
+	if err != nil {
+		return err
+	}
+	return s.store.Put(ctx, s.key(namespace), content)
+}
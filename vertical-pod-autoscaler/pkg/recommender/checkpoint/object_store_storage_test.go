@@ -0,0 +1,151 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checkpoint
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/objectstore"
+)
+
+type fakeObjectStore struct {
+	objects map[string][]byte
+	puts    int
+	putErr  error
+}
+
+func newFakeObjectStore() *fakeObjectStore {
+	return &fakeObjectStore{objects: make(map[string][]byte)}
+}
+
+func (s *fakeObjectStore) Get(ctx context.Context, key string) ([]byte, error) {
+	content, found := s.objects[key]
+	if !found {
+		return nil, objectstore.ErrObjectNotFound
+	}
+	return content, nil
+}
+
+func (s *fakeObjectStore) Put(ctx context.Context, key string, content []byte) error {
+	if s.putErr != nil {
+		return s.putErr
+	}
+	s.objects[key] = content
+	s.puts++
+	return nil
+}
+
+func (s *fakeObjectStore) Delete(ctx context.Context, key string) error {
+	delete(s.objects, key)
+	return nil
+}
+
+func (s *fakeObjectStore) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	for key := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func newTestCheckpoint(vpaName, containerName string) vpa_types.VerticalPodAutoscalerCheckpoint {
+	return vpa_types.VerticalPodAutoscalerCheckpoint{
+		ObjectMeta: metav1.ObjectMeta{Name: vpaName + "-" + containerName},
+		Spec: vpa_types.VerticalPodAutoscalerCheckpointSpec{
+			VPAObjectName: vpaName,
+			ContainerName: containerName,
+		},
+		Status: vpa_types.VerticalPodAutoscalerCheckpointStatus{TotalSamplesCount: 1},
+	}
+}
+
+func checkpointNames(checkpoints []vpa_types.VerticalPodAutoscalerCheckpoint) []string {
+	var names []string
+	for _, checkpoint := range checkpoints {
+		names = append(names, checkpoint.Name)
+	}
+	return names
+}
+
+func TestObjectStoreStorage(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeObjectStore()
+	store.objects["other/namespace-1.json"] = []byte("{}")
+	storage := NewObjectStoreStorage(store, "checkpoints/")
+
+	checkpoints, err := storage.List(ctx, "namespace-1")
+	assert.NoError(t, err)
+	assert.Empty(t, checkpoints)
+
+	assert.NoError(t, storage.Store(ctx, "namespace-1", []vpa_types.VerticalPodAutoscalerCheckpoint{
+		newTestCheckpoint("vpa-1", "container-1"),
+		newTestCheckpoint("vpa-1", "container-2"),
+	}))
+	assert.NoError(t, storage.Store(ctx, "namespace-2", []vpa_types.VerticalPodAutoscalerCheckpoint{
+		newTestCheckpoint("vpa-1", "container-1"),
+	}))
+	// Storing a checkpoint replaces it and keeps the other checkpoints.
+	updated := newTestCheckpoint("vpa-1", "container-2")
+	updated.Status.TotalSamplesCount = 2
+	assert.NoError(t, storage.Store(ctx, "namespace-1", []vpa_types.VerticalPodAutoscalerCheckpoint{
+		updated,
+		newTestCheckpoint("vpa-2", "container-1"),
+	}))
+	assert.Equal(t, 3, store.puts)
+
+	namespaces, err := storage.Namespaces(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"namespace-1", "namespace-2"}, namespaces)
+
+	checkpoints, err = storage.List(ctx, "namespace-1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"vpa-1-container-1", "vpa-1-container-2", "vpa-2-container-1"}, checkpointNames(checkpoints))
+	assert.Equal(t, "namespace-1", checkpoints[1].Namespace)
+	assert.Equal(t, 2, checkpoints[1].Status.TotalSamplesCount)
+
+	assert.NoError(t, storage.Delete(ctx, "namespace-1", []string{"vpa-1-container-1", "vpa-1-container-2"}))
+	checkpoints, err = storage.List(ctx, "namespace-1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"vpa-2-container-1"}, checkpointNames(checkpoints))
+
+	// Deleting the last checkpoint of a namespace deletes its object.
+	assert.NoError(t, storage.Delete(ctx, "namespace-2", []string{"vpa-1-container-1"}))
+	assert.NotContains(t, store.objects, "checkpoints/namespace-2.json")
+}
+
+func TestObjectStoreStorageInvalidObject(t *testing.T) {
+	store := newFakeObjectStore()
+	store.objects["checkpoints/namespace-1.json"] = []byte("not json")
+	storage := NewObjectStoreStorage(store, "checkpoints/")
+
+	_, err := storage.List(context.Background(), "namespace-1")
+	assert.Error(t, err)
+	// The object isn't overwritten with the new checkpoints only.
+	assert.Error(t, storage.Store(context.Background(), "namespace-1", []vpa_types.VerticalPodAutoscalerCheckpoint{
+		newTestCheckpoint("vpa-1", "container-1"),
+	}))
+	assert.Equal(t, 0, store.puts)
+}
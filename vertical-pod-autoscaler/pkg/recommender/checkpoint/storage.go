@@ -0,0 +1,97 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checkpoint
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	vpa_api "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/client/clientset/versioned/typed/autoscaling.k8s.io/v1"
+	api_util "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/vpa"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// CheckpointStorage persistently stores VPA checkpoints, one per container of
+// a VPA, grouped by the namespace of the VPA.
+type CheckpointStorage interface {
+	// Namespaces returns the namespaces which may hold checkpoints.
+	Namespaces(ctx context.Context) ([]string, error)
+	// List returns all checkpoints stored in the namespace.
+	List(ctx context.Context, namespace string) ([]vpa_types.VerticalPodAutoscalerCheckpoint, error)
+	// Store creates or replaces the given checkpoints of the namespace, keeping
+	// its other checkpoints.
+	Store(ctx context.Context, namespace string, checkpoints []vpa_types.VerticalPodAutoscalerCheckpoint) error
+	// Delete removes the checkpoints with the given names from the namespace.
+	Delete(ctx context.Context, namespace string, names []string) error
+}
+
+type crdStorage struct {
+	namespaceClient     corev1.NamespacesGetter
+	vpaCheckpointClient vpa_api.VerticalPodAutoscalerCheckpointsGetter
+}
+
+// NewCRDStorage returns a CheckpointStorage keeping checkpoints as
+// VerticalPodAutoscalerCheckpoint objects. Checkpoints of a namespace are
+// written one by one, so a failed Store may leave some of them written.
+func NewCRDStorage(namespaceClient corev1.NamespacesGetter, vpaCheckpointClient vpa_api.VerticalPodAutoscalerCheckpointsGetter) CheckpointStorage {
+	return &crdStorage{
+		namespaceClient:     namespaceClient,
+		vpaCheckpointClient: vpaCheckpointClient,
+	}
+}
+
+func (s *crdStorage) Namespaces(ctx context.Context) ([]string, error) {
+	namespaceList, err := s.namespaceClient.Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	namespaces := make([]string, 0, len(namespaceList.Items))
+	for _, namespace := range namespaceList.Items {
+		namespaces = append(namespaces, namespace.Name)
+	}
+	return namespaces, nil
+}
+
+func (s *crdStorage) List(ctx context.Context, namespace string) ([]vpa_types.VerticalPodAutoscalerCheckpoint, error) {
+	checkpointList, err := s.vpaCheckpointClient.VerticalPodAutoscalerCheckpoints(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return checkpointList.Items, nil
+}
+
+func (s *crdStorage) Store(ctx context.Context, namespace string, checkpoints []vpa_types.VerticalPodAutoscalerCheckpoint) error {
+	var errs []error
+	for i := range checkpoints {
+		if err := api_util.CreateOrUpdateVpaCheckpoint(s.vpaCheckpointClient.VerticalPodAutoscalerCheckpoints(namespace), &checkpoints[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func (s *crdStorage) Delete(ctx context.Context, namespace string, names []string) error {
+	var errs []error
+	for _, name := range names {
+		if err := s.vpaCheckpointClient.VerticalPodAutoscalerCheckpoints(namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package evaluation persists usage samples of containers paired with the
+// recommendations in effect when they were observed, for offline evaluation of
+// the quality of recommendations.
+package evaluation
+
+import (
+	"hash/fnv"
+	"math"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+	vpa_api_util "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/vpa"
+)
+
+// Sample is a usage sample of a resource of a container, as observed by the
+// recommender, with the recommendation of its VPA in effect at the time. The
+// recommendation isn't based on the sample yet. CPU is in cores, memory in
+// bytes.
+type Sample struct {
+	// Time is the start of the usage sample.
+	Time      time.Time
+	Namespace string
+	Vpa       string
+	Pod       string
+	// Container is the name the container is recommended for under, which
+	// differs from its name in the pod if containers are aggregated by label.
+	Container      string
+	Resource       model.ResourceName
+	Usage          float64
+	Target         float64
+	LowerBound     float64
+	UpperBound     float64
+	UncappedTarget float64
+}
+
+type usageKey struct {
+	container model.ContainerID
+	resource  model.ResourceName
+}
+
+// Recorder collects usage samples of a subset of containers on every loop of
+// the recommender and writes them to a Sink once per interval.
+type Recorder struct {
+	sink     Sink
+	interval time.Duration
+	fraction float64
+
+	lastWrite time.Time
+	samples   []Sample
+	// recorded holds the start of the latest recorded usage sample of every
+	// container and resource seen in the previous loop, and seen those of the
+	// current loop.
+	recorded map[usageKey]time.Time
+	seen     map[usageKey]time.Time
+}
+
+// NewRecorder creates a Recorder writing samples to the sink at most once per
+// interval. fraction is the fraction of containers sampled. Containers are
+// picked by a hash of their name, so the same containers are sampled every
+// time.
+func NewRecorder(sink Sink, interval time.Duration, fraction float64) *Recorder {
+	return &Recorder{
+		sink:     sink,
+		interval: interval,
+		fraction: fraction,
+		recorded: make(map[usageKey]time.Time),
+		seen:     make(map[usageKey]time.Time),
+	}
+}
+
+// Add collects the usage samples of the sampled containers of pods under VPAs
+// which were added to the cluster state since the previous loop. It must be
+// called before the recommendations of the VPAs are updated, so samples are
+// paired with the recommendations in effect when they were observed.
+func (r *Recorder) Add(clusterState *model.ClusterState) {
+	vpasByNamespace := make(map[string][]*model.Vpa)
+	for _, vpa := range clusterState.Vpas {
+		if vpa.Recommendation != nil {
+			vpasByNamespace[vpa.ID.Namespace] = append(vpasByNamespace[vpa.ID.Namespace], vpa)
+		}
+	}
+	for podID, pod := range clusterState.Pods {
+		for containerName, container := range pod.Containers {
+			aggregationKey := clusterState.MakeAggregateStateKey(pod, containerName)
+			for _, vpa := range vpasByNamespace[podID.Namespace] {
+				if !vpa.UsesAggregation(aggregationKey) || !r.isSampled(vpa.ID, aggregationKey.ContainerName()) {
+					continue
+				}
+				recommendation := vpa_api_util.GetRecommendationForContainer(aggregationKey.ContainerName(), vpa.Recommendation)
+				if recommendation == nil {
+					continue
+				}
+				containerID := model.ContainerID{PodID: podID, ContainerName: containerName}
+				r.add(vpa.ID, containerID, recommendation, model.ResourceCPU, container.LastCPUSampleStart, model.CoresFromCPUAmount(container.LastCPUUsage))
+				r.add(vpa.ID, containerID, recommendation, model.ResourceMemory, container.LastMemorySampleStart, model.BytesFromMemoryAmount(container.LastMemoryUsage))
+			}
+		}
+	}
+}
+
+func (r *Recorder) add(vpaID model.VpaID, containerID model.ContainerID, recommendation *vpa_types.RecommendedContainerResources, resource model.ResourceName, sampleStart time.Time, usage float64) {
+	if _, found := recommendation.Target[apiv1.ResourceName(resource)]; !found || sampleStart.IsZero() {
+		return
+	}
+	key := usageKey{container: containerID, resource: resource}
+	r.seen[key] = sampleStart
+	if !sampleStart.After(r.recorded[key]) {
+		return
+	}
+	r.samples = append(r.samples, Sample{
+		Time:           sampleStart,
+		Namespace:      vpaID.Namespace,
+		Vpa:            vpaID.VpaName,
+		Pod:            containerID.PodName,
+		Container:      recommendation.ContainerName,
+		Resource:       resource,
+		Usage:          usage,
+		Target:         quantityValue(resource, recommendation.Target),
+		LowerBound:     quantityValue(resource, recommendation.LowerBound),
+		UpperBound:     quantityValue(resource, recommendation.UpperBound),
+		UncappedTarget: quantityValue(resource, recommendation.UncappedTarget),
+	})
+}
+
+// Flush ends a loop of the recommender. It writes the collected samples to the
+// sink if the interval passed since the last write.
+func (r *Recorder) Flush(now time.Time) error {
+	r.recorded, r.seen = r.seen, make(map[usageKey]time.Time, len(r.seen))
+	if now.Sub(r.lastWrite) < r.interval {
+		return nil
+	}
+	r.lastWrite = now
+	samples := r.samples
+	r.samples = nil
+	if len(samples) == 0 {
+		return nil
+	}
+	return r.sink.Write(now, samples)
+}
+
+func (r *Recorder) isSampled(vpaID model.VpaID, container string) bool {
+	if r.fraction >= 1 {
+		return true
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(vpaID.Namespace + "/" + vpaID.VpaName + "/" + container))
+	return float64(hash.Sum32()) < r.fraction*math.MaxUint32
+}
+
+func quantityValue(resource model.ResourceName, resources apiv1.ResourceList) float64 {
+	quantity, found := resources[apiv1.ResourceName(resource)]
+	if !found {
+		return 0
+	}
+	if resource == model.ResourceCPU {
+		return float64(quantity.MilliValue()) / 1000
+	}
+	return float64(quantity.Value())
+}
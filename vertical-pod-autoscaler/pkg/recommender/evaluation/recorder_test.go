@@ -0,0 +1,146 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package evaluation
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/test"
+)
+
+type fakeSink struct {
+	writes [][]Sample
+}
+
+func (s *fakeSink) Write(now time.Time, samples []Sample) error {
+	s.writes = append(s.writes, samples)
+	return nil
+}
+
+var (
+	testVpaID       = model.VpaID{Namespace: "namespace-1", VpaName: "vpa-1"}
+	testContainerID = model.ContainerID{
+		PodID:         model.PodID{Namespace: "namespace-1", PodName: "pod-1"},
+		ContainerName: "container-1",
+	}
+)
+
+// newTestClusterState returns a cluster state with a VPA recommending 2 cores
+// and 1Gi to a container of a pod.
+func newTestClusterState(t *testing.T) (*model.ClusterState, *model.Vpa) {
+	clusterState := model.NewClusterState(time.Hour)
+	podLabels := labels.Set{"app": "app-1"}
+	apiObject := &vpa_types.VerticalPodAutoscaler{}
+	apiObject.Namespace = testVpaID.Namespace
+	apiObject.Name = testVpaID.VpaName
+	assert.NoError(t, clusterState.AddOrUpdateVpa(apiObject, labels.SelectorFromSet(podLabels)))
+	clusterState.AddOrUpdatePod(testContainerID.PodID, podLabels, apiv1.PodRunning)
+	assert.NoError(t, clusterState.AddOrUpdateContainer(testContainerID, model.Resources{}))
+	vpa := clusterState.Vpas[testVpaID]
+	vpa.Recommendation = test.Recommendation().WithContainer("container-1").WithTarget("2", "1Gi").Get()
+	return clusterState, vpa
+}
+
+func addUsage(t *testing.T, clusterState *model.ClusterState, start time.Time, resource model.ResourceName, usage model.ResourceAmount) {
+	assert.NoError(t, clusterState.AddSample(&model.ContainerUsageSampleWithKey{
+		ContainerUsageSample: model.ContainerUsageSample{MeasureStart: start, Usage: usage, Resource: resource},
+		Container:            testContainerID,
+	}))
+}
+
+func TestRecorder(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	sink := &fakeSink{}
+	recorder := NewRecorder(sink, time.Hour, 1)
+	clusterState, _ := newTestClusterState(t)
+	addUsage(t, clusterState, now, model.ResourceCPU, model.CPUAmountFromCores(1.5))
+	addUsage(t, clusterState, now, model.ResourceMemory, model.MemoryAmountFromBytes(512*1024*1024))
+
+	recorder.Add(clusterState)
+	assert.NoError(t, recorder.Flush(now))
+	if assert.Len(t, sink.writes, 1) && assert.Len(t, sink.writes[0], 2) {
+		for _, sample := range sink.writes[0] {
+			assert.Equal(t, now, sample.Time)
+			assert.Equal(t, "vpa-1", sample.Vpa)
+			assert.Equal(t, "pod-1", sample.Pod)
+			assert.Equal(t, "container-1", sample.Container)
+			if sample.Resource == model.ResourceCPU {
+				assert.Equal(t, 1.5, sample.Usage)
+				assert.Equal(t, 2.0, sample.Target)
+			} else {
+				assert.Equal(t, 512.0*1024*1024, sample.Usage)
+				assert.Equal(t, 1024.0*1024*1024, sample.Target)
+			}
+		}
+	}
+
+	// Samples are collected on every loop, only new ones are recorded.
+	addUsage(t, clusterState, now.Add(time.Minute), model.ResourceCPU, model.CPUAmountFromCores(0.5))
+	recorder.Add(clusterState)
+	assert.NoError(t, recorder.Flush(now.Add(time.Minute)))
+	recorder.Add(clusterState)
+	assert.NoError(t, recorder.Flush(now.Add(2*time.Minute)))
+	assert.Len(t, sink.writes, 1)
+
+	recorder.Add(clusterState)
+	assert.NoError(t, recorder.Flush(now.Add(time.Hour)))
+	if assert.Len(t, sink.writes, 2) && assert.Len(t, sink.writes[1], 1) {
+		sample := sink.writes[1][0]
+		assert.Equal(t, now.Add(time.Minute), sample.Time)
+		assert.Equal(t, model.ResourceCPU, sample.Resource)
+		assert.Equal(t, 0.5, sample.Usage)
+	}
+}
+
+func TestRecorderNoRecommendation(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	recorder := NewRecorder(&fakeSink{}, time.Hour, 1)
+	clusterState, vpa := newTestClusterState(t)
+	addUsage(t, clusterState, now, model.ResourceCPU, model.CPUAmountFromCores(1.5))
+	vpa.Recommendation = nil
+
+	recorder.Add(clusterState)
+	assert.Empty(t, recorder.samples)
+}
+
+func TestRecorderFraction(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	recorder := NewRecorder(&fakeSink{}, time.Hour, 0.5)
+	sampled := 0
+	for i := 0; i < 1000; i++ {
+		vpaID := model.VpaID{Namespace: "namespace-1", VpaName: fmt.Sprintf("vpa-%d", i)}
+		if recorder.isSampled(vpaID, "container-1") {
+			sampled++
+		}
+		// Containers are sampled consistently.
+		assert.Equal(t, recorder.isSampled(vpaID, "container-1"), recorder.isSampled(vpaID, "container-1"))
+	}
+	assert.InDelta(t, 500, sampled, 100)
+
+	recorder = NewRecorder(&fakeSink{}, time.Hour, 0)
+	clusterState, _ := newTestClusterState(t)
+	addUsage(t, clusterState, now, model.ResourceCPU, model.CPUAmountFromCores(1.5))
+	recorder.Add(clusterState)
+	assert.Empty(t, recorder.samples)
+}
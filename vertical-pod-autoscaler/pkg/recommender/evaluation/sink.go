@@ -0,0 +1,128 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package evaluation
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/objectstore"
+)
+
+// Sink persists samples.
+type Sink interface {
+	// Write persists the samples collected until now.
+	Write(now time.Time, samples []Sample) error
+}
+
+var csvHeader = []string{
+	"time", "namespace", "vpa", "pod", "container", "resource", "usage",
+	"target", "lower_bound", "upper_bound", "uncapped_target",
+}
+
+func writeCSV(w io.Writer, samples []Sample, header bool) error {
+	writer := csv.NewWriter(w)
+	if header {
+		if err := writer.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+	formatFloat := func(value float64) string {
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+	for _, sample := range samples {
+		record := []string{
+			sample.Time.UTC().Format(time.RFC3339),
+			sample.Namespace,
+			sample.Vpa,
+			sample.Pod,
+			sample.Container,
+			string(sample.Resource),
+			formatFloat(sample.Usage),
+			formatFloat(sample.Target),
+			formatFloat(sample.LowerBound),
+			formatFloat(sample.UpperBound),
+			formatFloat(sample.UncappedTarget),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+type csvFileSink struct {
+	path string
+}
+
+// NewCSVFileSink creates a Sink appending samples to a CSV file, which is
+// created with a header row if missing.
+func NewCSVFileSink(path string) Sink {
+	return &csvFileSink{path: path}
+}
+
+func (s *csvFileSink) Write(now time.Time, samples []Sample) error {
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err == nil {
+		err = writeCSV(file, samples, info.Size() == 0)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+type objectStoreSink struct {
+	store  objectstore.ObjectStore
+	prefix string
+	// host and sequence make keys of writes in the same second unique,
+	// across replicas and within one.
+	host     string
+	sequence int
+}
+
+// NewObjectStoreSink creates a Sink writing the samples of every write as a
+// CSV object under the key <prefix><time of the write>-<host>-<sequence>.csv,
+// host being the name of the recommender pod.
+func NewObjectStoreSink(store objectstore.ObjectStore, prefix string) Sink {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return &objectStoreSink{store: store, prefix: prefix, host: host}
+}
+
+func (s *objectStoreSink) Write(now time.Time, samples []Sample) error {
+	var content bytes.Buffer
+	if err := writeCSV(&content, samples, true); err != nil {
+		return err
+	}
+	key := fmt.Sprintf("%s%s-%s-%d.csv", s.prefix, now.UTC().Format("20060102T150405Z"), s.host, s.sequence)
+	s.sequence++
+	return s.store.Put(context.Background(), key, content.Bytes())
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package evaluation
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+)
+
+var testSample = Sample{
+	Time:           time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+	Namespace:      "namespace-1",
+	Vpa:            "vpa-1",
+	Pod:            "pod-1",
+	Container:      "container-1",
+	Resource:       model.ResourceCPU,
+	Usage:          0.4,
+	Target:         0.5,
+	LowerBound:     0.25,
+	UpperBound:     1,
+	UncappedTarget: 0.5,
+}
+
+const testHeader = "time,namespace,vpa,pod,container,resource,usage,target,lower_bound,upper_bound,uncapped_target\n"
+const testRow = "2022-01-01T00:00:00Z,namespace-1,vpa-1,pod-1,container-1,cpu,0.4,0.5,0.25,1,0.5\n"
+
+func TestCSVFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "samples.csv")
+	sink := NewCSVFileSink(path)
+	assert.NoError(t, sink.Write(testSample.Time, []Sample{testSample}))
+	assert.NoError(t, sink.Write(testSample.Time, []Sample{testSample}))
+
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, testHeader+testRow+testRow, string(content))
+}
+
+type fakeObjectStore struct {
+	objects map[string][]byte
+}
+
+func (s *fakeObjectStore) Get(ctx context.Context, key string) ([]byte, error) {
+	return s.objects[key], nil
+}
+
+func (s *fakeObjectStore) Put(ctx context.Context, key string, content []byte) error {
+	s.objects[key] = content
+	return nil
+}
+
+func (s *fakeObjectStore) Delete(ctx context.Context, key string) error {
+	delete(s.objects, key)
+	return nil
+}
+
+func (s *fakeObjectStore) List(ctx context.Context, prefix string) ([]string, error) {
+	return nil, nil
+}
+
+func TestObjectStoreSink(t *testing.T) {
+	host, err := os.Hostname()
+	assert.NoError(t, err)
+	store := &fakeObjectStore{objects: map[string][]byte{}}
+	sink := NewObjectStoreSink(store, "evaluation/")
+	flushTime := time.Date(2022, 1, 1, 0, 1, 0, 0, time.UTC)
+	assert.NoError(t, sink.Write(flushTime, []Sample{testSample}))
+	// Flushes in the same second with samples of the same time don't
+	// overwrite each other.
+	otherSample := testSample
+	otherSample.Pod = "pod-2"
+	assert.NoError(t, sink.Write(flushTime.Add(100*time.Millisecond), []Sample{testSample, otherSample}))
+	assert.Equal(t, map[string][]byte{
+		"evaluation/20220101T000100Z-" + host + "-0.csv": []byte(testHeader + testRow),
+		"evaluation/20220101T000100Z-" + host + "-1.csv": []byte(testHeader + testRow + strings.Replace(testRow, "pod-1", "pod-2", 1)),
+	}, store.objects)
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+//go:generate protoc --go_out=../../.. --go_opt=paths=source_relative -I ../../.. ../../../pkg/recommender/external/recommender.proto
+
+package external
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/proto"
+)
+
+// GetRecommendationsMethod is the gRPC method name of
+// ExternalRecommender.GetRecommendations.
+const GetRecommendationsMethod = "/autoscaling.k8s.io.vpa.external.v1.ExternalRecommender/GetRecommendations"
+
+const (
+	grpcContentType = "application/grpc"
+	// maxMessageSize limits the size of responses, which grow with the number
+	// of VPAs.
+	maxMessageSize = 64 << 20
+)
+
+// Client is a client of the ExternalRecommender service.
+type Client interface {
+	GetRecommendations(ctx context.Context, request *GetRecommendationsRequest) (*GetRecommendationsResponse, error)
+}
+
+type grpcClient struct {
+	url    string
+	client *http.Client
+}
+
+// NewGRPCClient creates a gRPC client of the ExternalRecommender service at
+// the given host:port. Without a TLS config, the connection is plaintext
+// HTTP/2.
+func NewGRPCClient(address string, tlsConfig *tls.Config) Client {
+	scheme := "https"
+	transport := &http2.Transport{TLSClientConfig: tlsConfig}
+	if tlsConfig == nil {
+		scheme = "http"
+		transport.AllowHTTP = true
+		transport.DialTLS = func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		}
+	}
+	return &grpcClient{
+		url:    (&url.URL{Scheme: scheme, Host: address, Path: GetRecommendationsMethod}).String(),
+		client: &http.Client{Transport: transport},
+	}
+}
+
+func (c *grpcClient) GetRecommendations(ctx context.Context, request *GetRecommendationsRequest) (*GetRecommendationsResponse, error) {
+	body, err := proto.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(frame(body)))
+	if err != nil {
+		return nil, err
+	}
+	httpRequest.Header.Set("Content-Type", grpcContentType)
+	httpRequest.Header.Set("TE", "trailers")
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout := time.Until(deadline).Milliseconds()
+		if timeout < 1 {
+			timeout = 1
+		}
+		httpRequest.Header.Set("Grpc-Timeout", strconv.FormatInt(timeout, 10)+"m")
+	}
+	httpResponse, err := c.client.Do(httpRequest)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResponse.Body.Close()
+	if httpResponse.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("external recommender returned %s", httpResponse.Status)
+	}
+	// Errors may be returned in the headers, without a message.
+	if err := grpcStatusError(httpResponse.Header); err != nil {
+		return nil, err
+	}
+	message, readErr := readFrame(httpResponse.Body)
+	if readErr == nil {
+		// Read to the end, to get the trailers.
+		_, readErr = io.Copy(io.Discard, httpResponse.Body)
+	}
+	if err := grpcStatusError(httpResponse.Trailer); err != nil {
+		return nil, err
+	}
+	if readErr != nil {
+		return nil, fmt.Errorf("cannot read external recommender response: %v", readErr)
+	}
+	if httpResponse.Trailer.Get("Grpc-Status") == "" {
+		return nil, fmt.Errorf("external recommender response has no grpc-status")
+	}
+	response := &GetRecommendationsResponse{}
+	if err := proto.Unmarshal(message, response); err != nil {
+		return nil, fmt.Errorf("cannot decode external recommender response: %v", err)
+	}
+	return response, nil
+}
+
+// grpcStatusError returns the error reported by the grpc-status and
+// grpc-message headers or trailers, if any.
+func grpcStatusError(header http.Header) error {
+	status := header.Get("Grpc-Status")
+	if status == "" || status == "0" {
+		return nil
+	}
+	// The message is percent-encoded.
+	message, err := url.PathUnescape(header.Get("Grpc-Message"))
+	if err != nil {
+		message = header.Get("Grpc-Message")
+	}
+	return fmt.Errorf("external recommender returned gRPC status %s: %s", status, message)
+}
+
+// frame prefixes an uncompressed message with its length, as in the body of
+// gRPC requests and responses.
+func frame(message []byte) []byte {
+	b := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(b[1:], uint32(len(message)))
+	return append(b, message...)
+}
+
+func readFrame(r io.Reader) ([]byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header[0] != 0 {
+		return nil, fmt.Errorf("compressed messages are not supported")
+	}
+	length := binary.BigEndian.Uint32(header[1:])
+	if length > maxMessageSize {
+		return nil, fmt.Errorf("message of %d bytes exceeds the limit of %d bytes", length, maxMessageSize)
+	}
+	message := make([]byte, length)
+	if _, err := io.ReadFull(r, message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
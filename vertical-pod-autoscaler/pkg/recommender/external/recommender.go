@@ -0,0 +1,189 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package external
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/logic"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/util"
+	"k8s.io/klog/v2"
+)
+
+// Recommender computes recommendations of many VPAs at once, from the usage
+// aggregated for their containers.
+type Recommender interface {
+	GetRecommendations(ctx context.Context, vpas map[model.VpaID]model.ContainerNameToAggregateStateMap) (map[model.VpaID]logic.RecommendedPodResources, error)
+}
+
+type externalRecommender struct {
+	client Client
+}
+
+// NewRecommender creates a Recommender delegating to an ExternalRecommender
+// service through the given client.
+func NewRecommender(client Client) Recommender {
+	return &externalRecommender{client: client}
+}
+
+// GetRecommendations sends the usage of all VPAs to the external service in
+// one request. VPAs whose recommendation is missing or invalid in the response
+// are left out of the result.
+func (r *externalRecommender) GetRecommendations(ctx context.Context, vpas map[model.VpaID]model.ContainerNameToAggregateStateMap) (map[model.VpaID]logic.RecommendedPodResources, error) {
+	request := &GetRecommendationsRequest{}
+	for vpaID, containers := range vpas {
+		vpaState, err := newVpaState(vpaID, containers)
+		if err != nil {
+			klog.Errorf("Cannot send usage of VPA %s/%s to external recommender: %v", vpaID.Namespace, vpaID.VpaName, err)
+			continue
+		}
+		request.Vpas = append(request.Vpas, vpaState)
+	}
+	response, err := r.client.GetRecommendations(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	recommendations := make(map[model.VpaID]logic.RecommendedPodResources, len(response.Recommendations))
+	for _, vpaRecommendation := range response.Recommendations {
+		vpaID := model.VpaID{Namespace: vpaRecommendation.Namespace, VpaName: vpaRecommendation.Name}
+		if _, found := vpas[vpaID]; !found {
+			klog.V(4).Infof("External recommender returned a recommendation for unknown VPA %s/%s", vpaID.Namespace, vpaID.VpaName)
+			continue
+		}
+		podResources, err := toRecommendedPodResources(vpaRecommendation)
+		if err != nil {
+			klog.Errorf("Invalid recommendation for VPA %s/%s from external recommender: %v", vpaID.Namespace, vpaID.VpaName, err)
+			continue
+		}
+		recommendations[vpaID] = podResources
+	}
+	return recommendations, nil
+}
+
+func newVpaState(vpaID model.VpaID, containers model.ContainerNameToAggregateStateMap) (*VpaState, error) {
+	vpaState := &VpaState{Namespace: vpaID.Namespace, Name: vpaID.VpaName}
+	config := model.GetAggregationsConfig()
+	for containerName, state := range containers {
+		cpuUsage, err := newHistogram(state.AggregateCPUUsage, config.CPUHistogramOptions)
+		if err != nil {
+			return nil, err
+		}
+		memoryPeaks, err := newHistogram(state.AggregateMemoryPeaks, config.MemoryHistogramOptions)
+		if err != nil {
+			return nil, err
+		}
+		vpaState.Containers = append(vpaState.Containers, &ContainerState{
+			ContainerName:     containerName,
+			CpuUsage:          cpuUsage,
+			MemoryPeaks:       memoryPeaks,
+			FirstSampleStart:  timestamppb.New(state.FirstSampleStart),
+			LastSampleStart:   timestamppb.New(state.LastSampleStart),
+			TotalSamplesCount: int64(state.TotalSamplesCount),
+		})
+	}
+	sort.Slice(vpaState.Containers, func(i, j int) bool {
+		return vpaState.Containers[i].ContainerName < vpaState.Containers[j].ContainerName
+	})
+	return vpaState, nil
+}
+
+func newHistogram(histogram util.Histogram, options util.HistogramOptions) (*Histogram, error) {
+	checkpoint, err := histogram.SaveToChekpoint()
+	if err != nil {
+		return nil, err
+	}
+	// Checkpointed bucket weights are normalized, scale them back to sum up
+	// to the total weight.
+	sum := 0.0
+	for _, weight := range checkpoint.BucketWeights {
+		sum += float64(weight)
+	}
+	result := &Histogram{TotalWeight: checkpoint.TotalWeight}
+	for bucket, weight := range checkpoint.BucketWeights {
+		if weight == 0 {
+			continue
+		}
+		result.Buckets = append(result.Buckets, &Bucket{
+			Start:  options.GetBucketStart(bucket),
+			Weight: checkpoint.TotalWeight * float64(weight) / sum,
+		})
+	}
+	sort.Slice(result.Buckets, func(i, j int) bool {
+		return result.Buckets[i].Start < result.Buckets[j].Start
+	})
+	return result, nil
+}
+
+func toRecommendedPodResources(vpaRecommendation *VpaRecommendation) (logic.RecommendedPodResources, error) {
+	podResources := make(logic.RecommendedPodResources, len(vpaRecommendation.Containers))
+	for _, container := range vpaRecommendation.Containers {
+		target, err := toResources(container.Target)
+		if err != nil {
+			return nil, fmt.Errorf("container %s target: %v", container.ContainerName, err)
+		}
+		if len(target) == 0 {
+			return nil, fmt.Errorf("container %s has no target", container.ContainerName)
+		}
+		for name, amount := range target {
+			if amount <= 0 {
+				return nil, fmt.Errorf("container %s target of %s is not positive", container.ContainerName, name)
+			}
+		}
+		lowerBound, err := toResources(container.LowerBound)
+		if err != nil {
+			return nil, fmt.Errorf("container %s lower bound: %v", container.ContainerName, err)
+		}
+		upperBound, err := toResources(container.UpperBound)
+		if err != nil {
+			return nil, fmt.Errorf("container %s upper bound: %v", container.ContainerName, err)
+		}
+		podResources[container.ContainerName] = logic.RecommendedContainerResources{
+			Target:     target,
+			LowerBound: lowerBound,
+			UpperBound: upperBound,
+		}
+	}
+	return podResources, nil
+}
+
+func toResources(quantities map[string]string) (model.Resources, error) {
+	resources := make(model.Resources, len(quantities))
+	for name, value := range quantities {
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quantity %q of %s: %v", value, name, err)
+		}
+		if quantity.Sign() < 0 {
+			return nil, fmt.Errorf("negative quantity %q of %s", value, name)
+		}
+		switch model.ResourceName(name) {
+		case model.ResourceCPU:
+			resources[model.ResourceCPU] = model.ResourceAmount(quantity.MilliValue())
+		case model.ResourceMemory:
+			resources[model.ResourceMemory] = model.ResourceAmount(quantity.Value())
+		default:
+			return nil, fmt.Errorf("unsupported resource %s", name)
+		}
+	}
+	return resources, nil
+}
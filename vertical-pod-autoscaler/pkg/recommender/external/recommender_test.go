@@ -0,0 +1,191 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package external
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/proto"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/logic"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+)
+
+var (
+	testVpaID  = model.VpaID{Namespace: "namespace-1", VpaName: "vpa-1"}
+	testVpaID2 = model.VpaID{Namespace: "namespace-1", VpaName: "vpa-2"}
+)
+
+// newTestServer starts a plaintext gRPC server of the ExternalRecommender
+// service. The handler returns either a response or the message of an
+// UNAVAILABLE error.
+func newTestServer(t *testing.T, handler func(request *GetRecommendationsRequest) (*GetRecommendationsResponse, string)) *httptest.Server {
+	return httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, GetRecommendationsMethod, r.URL.Path)
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, grpcContentType, r.Header.Get("Content-Type"))
+		message, err := readFrame(r.Body)
+		assert.NoError(t, err)
+		request := &GetRecommendationsRequest{}
+		assert.NoError(t, proto.Unmarshal(message, request))
+		response, errorMessage := handler(request)
+		w.Header().Set("Content-Type", grpcContentType)
+		if response == nil {
+			// Trailers-only response.
+			w.Header().Set("Grpc-Status", "14")
+			w.Header().Set("Grpc-Message", url.PathEscape(errorMessage))
+			return
+		}
+		message, err = proto.Marshal(response)
+		assert.NoError(t, err)
+		_, err = w.Write(frame(message))
+		assert.NoError(t, err)
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+	}), &http2.Server{}))
+}
+
+func newTestClient(server *httptest.Server) Client {
+	return NewGRPCClient(strings.TrimPrefix(server.URL, "http://"), nil)
+}
+
+func newTestAggregateState(cpuCores float64, sampleStart time.Time) *model.AggregateContainerState {
+	state := model.NewAggregateContainerState()
+	state.AddSample(&model.ContainerUsageSample{
+		MeasureStart: sampleStart,
+		Usage:        model.CPUAmountFromCores(cpuCores),
+		Resource:     model.ResourceCPU,
+	})
+	return state
+}
+
+func TestGetRecommendations(t *testing.T) {
+	sampleStart := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	var gotRequest *GetRecommendationsRequest
+	server := newTestServer(t, func(request *GetRecommendationsRequest) (*GetRecommendationsResponse, string) {
+		gotRequest = request
+		return &GetRecommendationsResponse{Recommendations: []*VpaRecommendation{{
+			Namespace: "namespace-1",
+			Name:      "vpa-1",
+			Containers: []*ContainerRecommendation{{
+				ContainerName: "container-1",
+				Target:        map[string]string{"cpu": "250m", "memory": "512Mi"},
+				LowerBound:    map[string]string{"cpu": "100m"},
+				UpperBound:    map[string]string{"cpu": "1"},
+			}},
+		}, {
+			// Invalid, left out.
+			Namespace:  "namespace-1",
+			Name:       "vpa-2",
+			Containers: []*ContainerRecommendation{{ContainerName: "container-1", Target: map[string]string{"gpu": "1"}}},
+		}, {
+			// Unknown VPA, left out.
+			Namespace: "namespace-1",
+			Name:      "vpa-3",
+		}}}, ""
+	})
+	defer server.Close()
+
+	recommender := NewRecommender(newTestClient(server))
+	recommendations, err := recommender.GetRecommendations(context.Background(), map[model.VpaID]model.ContainerNameToAggregateStateMap{
+		testVpaID:  {"container-1": newTestAggregateState(2.0, sampleStart)},
+		testVpaID2: {"container-1": newTestAggregateState(1.0, sampleStart)},
+	})
+	assert.NoError(t, err)
+
+	assert.Len(t, gotRequest.Vpas, 2)
+	for _, vpa := range gotRequest.Vpas {
+		if assert.Len(t, vpa.Containers, 1) {
+			container := vpa.Containers[0]
+			assert.Equal(t, "container-1", container.ContainerName)
+			assert.Equal(t, int64(1), container.TotalSamplesCount)
+			assert.True(t, sampleStart.Equal(container.FirstSampleStart.AsTime()))
+			if assert.Len(t, container.CpuUsage.Buckets, 1) {
+				assert.InDelta(t, container.CpuUsage.TotalWeight, container.CpuUsage.Buckets[0].Weight, 1e-9)
+			}
+			assert.Empty(t, container.MemoryPeaks.Buckets)
+		}
+	}
+
+	assert.Equal(t, map[model.VpaID]logic.RecommendedPodResources{
+		testVpaID: {
+			"container-1": {
+				Target: model.Resources{
+					model.ResourceCPU:    model.CPUAmountFromCores(0.25),
+					model.ResourceMemory: model.MemoryAmountFromBytes(512 * 1024 * 1024),
+				},
+				LowerBound: model.Resources{model.ResourceCPU: model.CPUAmountFromCores(0.1)},
+				UpperBound: model.Resources{model.ResourceCPU: model.CPUAmountFromCores(1)},
+			},
+		},
+	}, recommendations)
+}
+
+func TestGetRecommendationsError(t *testing.T) {
+	server := newTestServer(t, func(request *GetRecommendationsRequest) (*GetRecommendationsResponse, string) {
+		return nil, "model not loaded"
+	})
+	defer server.Close()
+
+	recommender := NewRecommender(newTestClient(server))
+	_, err := recommender.GetRecommendations(context.Background(), map[model.VpaID]model.ContainerNameToAggregateStateMap{
+		testVpaID: {"container-1": model.NewAggregateContainerState()},
+	})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "model not loaded")
+	}
+}
+
+func TestToRecommendedPodResourcesInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		container *ContainerRecommendation
+	}{
+		{
+			name:      "no target",
+			container: &ContainerRecommendation{ContainerName: "container-1", UpperBound: map[string]string{"cpu": "1"}},
+		},
+		{
+			name:      "zero target",
+			container: &ContainerRecommendation{ContainerName: "container-1", Target: map[string]string{"cpu": "250m", "memory": "0"}},
+		},
+		{
+			name:      "negative target",
+			container: &ContainerRecommendation{ContainerName: "container-1", Target: map[string]string{"cpu": "-250m"}},
+		},
+		{
+			name: "negative bound",
+			container: &ContainerRecommendation{
+				ContainerName: "container-1",
+				Target:        map[string]string{"cpu": "250m"},
+				LowerBound:    map[string]string{"cpu": "-1"},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := toRecommendedPodResources(&VpaRecommendation{Containers: []*ContainerRecommendation{tc.container}})
+			assert.Error(t, err)
+		})
+	}
+}
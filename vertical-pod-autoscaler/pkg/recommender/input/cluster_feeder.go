@@ -19,18 +19,19 @@ package input
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	apiv1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
-	"k8s.io/apimachinery/pkg/util/wait"
-	"k8s.io/apimachinery/pkg/watch"
 	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
 	vpa_clientset "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/client/clientset/versioned"
 	vpa_api "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/client/clientset/versioned/typed/autoscaling.k8s.io/v1"
 	vpa_lister "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/client/listers/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/checkpoint"
 	controllerfetcher "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/input/controller_fetcher"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/input/history"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/input/metrics"
@@ -51,8 +52,6 @@ import (
 )
 
 const (
-	evictionWatchRetryWait               = 10 * time.Second
-	evictionWatchJitterFactor            = 0.5
 	scaleCacheLoopPeriod                 = 7 * time.Second
 	scaleCacheEntryLifetime              = time.Hour
 	scaleCacheEntryFreshnessTime         = 10 * time.Minute
@@ -63,6 +62,30 @@ const (
 	DefaultRecommenderName = "default"
 )
 
+// ShortLivedPodPolicy determines how usage of short-lived pods is handled.
+type ShortLivedPodPolicy string
+
+const (
+	// ExcludeShortLivedPods drops usage samples and OOMs of short-lived pods.
+	ExcludeShortLivedPods ShortLivedPodPolicy = "exclude"
+	// SeparateShortLivedPods aggregates usage of short-lived pods separately
+	// from long-running pods, see model.ShortLivedContainerNameSuffix.
+	SeparateShortLivedPods ShortLivedPodPolicy = "separate"
+)
+
+// ShortLivedPodConfig configures the handling of pods which have been running
+// for less than Threshold, e.g. CI jobs, whose usage would otherwise pollute
+// the recommendations of long-running pods matched by the same VPA.
+type ShortLivedPodConfig struct {
+	// Threshold below which pods are short-lived. Zero disables it.
+	Threshold time.Duration
+	Policy    ShortLivedPodPolicy
+}
+
+func (c ShortLivedPodConfig) isShortLived(pod *spec.BasicPodSpec, now time.Time) bool {
+	return c.Threshold > 0 && !pod.StartTime.IsZero() && now.Sub(pod.StartTime) < c.Threshold
+}
+
 // ClusterStateFeeder can update state of ClusterState object.
 type ClusterStateFeeder interface {
 	// InitFromHistoryProvider loads historical pod spec into clusterState.
@@ -97,45 +120,111 @@ type ClusterStateFeederFactory struct {
 	MemorySaveMode      bool
 	ControllerFetcher   controllerfetcher.ControllerFetcher
 	RecommenderName     string
+	// CPUNormalizer scales CPU usage samples by node performance. Nil disables normalization.
+	CPUNormalizer CPUNormalizer
+	// Workers is the number of goroutines adding usage samples to the cluster
+	// state. Less than 2 adds them sequentially.
+	Workers int
+	// VpaObjectFilter selects the namespaces pods are tracked in. Optional.
+	VpaObjectFilter *vpa_api_util.VpaObjectFilter
+	// VpaClient lists VPAs regardless of VpaObjectFilter, so that checkpoints
+	// of VPAs not selected by the filter aren't garbage collected. Required
+	// with VpaObjectFilter.
+	VpaClient vpa_api.VerticalPodAutoscalersGetter
+	// CheckpointStorage holds the checkpoints of VPAs. Defaults to
+	// VerticalPodAutoscalerCheckpoint objects accessed by VpaCheckpointClient.
+	CheckpointStorage checkpoint.CheckpointStorage
+	// ShortLivedPods configures the handling of short-lived pods.
+	ShortLivedPods ShortLivedPodConfig
+	// PodChanges tracks the pods changed in PodLister, so that only they are
+	// synced, except every FullPodSyncInterval. Nil syncs all pods on every
+	// LoadPods.
+	PodChanges          *spec.PodChangeTracker
+	FullPodSyncInterval time.Duration
+	// PodMetricsClient provides the usage of pods, distributed to their
+	// containers missing from the metrics of MetricsClient. Nil disables
+	// the estimation.
+	PodMetricsClient metrics.PodMetricsClient
 }
 
 // Make creates new ClusterStateFeeder with internal data providers, based on kube client.
 func (m ClusterStateFeederFactory) Make() *clusterStateFeeder {
+	checkpointStorage := m.CheckpointStorage
+	if checkpointStorage == nil {
+		checkpointStorage = checkpoint.NewCRDStorage(m.KubeClient.CoreV1(), m.VpaCheckpointClient)
+	}
 	return &clusterStateFeeder{
-		coreClient:          m.KubeClient.CoreV1(),
-		metricsClient:       m.MetricsClient,
-		oomChan:             m.OOMObserver.GetObservedOomsChannel(),
-		vpaCheckpointClient: m.VpaCheckpointClient,
-		vpaLister:           m.VpaLister,
-		clusterState:        m.ClusterState,
-		specClient:          spec.NewSpecClient(m.PodLister),
-		selectorFetcher:     m.SelectorFetcher,
-		memorySaveMode:      m.MemorySaveMode,
-		controllerFetcher:   m.ControllerFetcher,
-		recommenderName:     m.RecommenderName,
+		coreClient:        m.KubeClient.CoreV1(),
+		metricsClient:     m.MetricsClient,
+		oomChan:           m.OOMObserver.GetObservedOomsChannel(),
+		checkpointStorage: checkpointStorage,
+		vpaLister:         m.VpaLister,
+		vpaClient:         m.VpaClient,
+		clusterState:      m.ClusterState,
+		specClient:        spec.NewSpecClient(m.PodLister),
+		selectorFetcher:   m.SelectorFetcher,
+		memorySaveMode:    m.MemorySaveMode,
+		controllerFetcher: m.ControllerFetcher,
+		recommenderName:   m.RecommenderName,
+		cpuNormalizer:     m.CPUNormalizer,
+		workers:           m.Workers,
+		vpaObjectFilter:   m.VpaObjectFilter,
+		shortLivedPods:    m.ShortLivedPods,
+		podNodes:          make(map[model.PodID]string),
+		excludedPods:      make(map[model.PodID]bool),
+
+		shortLivedPodSpecs:  make(map[model.PodID]*spec.BasicPodSpec),
+		podChanges:          m.PodChanges,
+		fullPodSyncInterval: m.FullPodSyncInterval,
+		podMetricsClient:    m.PodMetricsClient,
 	}
 }
 
 // NewClusterStateFeeder creates new ClusterStateFeeder with internal data providers, based on kube client config.
 // Deprecated; Use ClusterStateFeederFactory instead.
-func NewClusterStateFeeder(config *rest.Config, clusterState *model.ClusterState, memorySave bool, namespace, metricsClientName string, recommenderName string) ClusterStateFeeder {
+func NewClusterStateFeeder(config *rest.Config, clusterState *model.ClusterState, memorySave bool, vpaObjectFilter *vpa_api_util.VpaObjectFilter, metricsClientName string, recommenderName string, oomConfig oom.ObserverConfig, cpuPerformanceFactorLabel string, workers int, checkpointStorage checkpoint.CheckpointStorage, shortLivedPods ShortLivedPodConfig, fullPodSyncInterval time.Duration, podLevelUsageFallback bool) ClusterStateFeeder {
+	namespace := vpaObjectFilter.Namespace()
 	kubeClient := kube_client.NewForConfigOrDie(config)
-	podLister, oomObserver := NewPodListerAndOOMObserver(kubeClient, namespace)
+	vpaClient := vpa_clientset.NewForConfigOrDie(config)
+	var podChanges *spec.PodChangeTracker
+	var podHandlers []cache.ResourceEventHandler
+	if fullPodSyncInterval > 0 {
+		podChanges = spec.NewPodChangeTracker()
+		podHandlers = append(podHandlers, podChanges)
+	}
+	podLister, oomObserver := NewPodListerAndOOMObserver(kubeClient, namespace, oomConfig, podHandlers...)
 	factory := informers.NewSharedInformerFactoryWithOptions(kubeClient, defaultResyncPeriod, informers.WithNamespace(namespace))
 	controllerFetcher := controllerfetcher.NewControllerFetcher(config, kubeClient, factory, scaleCacheEntryFreshnessTime, scaleCacheEntryLifetime, scaleCacheEntryJitterFactor)
 	controllerFetcher.Start(context.TODO(), scaleCacheLoopPeriod)
+	var cpuNormalizer CPUNormalizer
+	if cpuPerformanceFactorLabel != "" {
+		cpuNormalizer = NewNodeLabelCPUNormalizer(newNodeLister(kubeClient), cpuPerformanceFactorLabel)
+	}
+	var podMetricsClient metrics.PodMetricsClient
+	if podLevelUsageFallback {
+		podMetricsClient = metrics.NewKubeletSummaryClient(kubeClient.CoreV1())
+	}
 	return ClusterStateFeederFactory{
 		PodLister:           podLister,
 		OOMObserver:         oomObserver,
 		KubeClient:          kubeClient,
 		MetricsClient:       newMetricsClient(config, namespace, metricsClientName),
-		VpaCheckpointClient: vpa_clientset.NewForConfigOrDie(config).AutoscalingV1(),
-		VpaLister:           vpa_api_util.NewVpasLister(vpa_clientset.NewForConfigOrDie(config), make(chan struct{}), namespace),
+		VpaCheckpointClient: vpaClient.AutoscalingV1(),
+		VpaLister:           vpa_api_util.NewFilteredVpasLister(vpaClient, make(chan struct{}), vpaObjectFilter),
+		VpaClient:           vpaClient.AutoscalingV1(),
 		ClusterState:        clusterState,
 		SelectorFetcher:     target.NewVpaTargetSelectorFetcher(config, kubeClient, factory),
 		MemorySaveMode:      memorySave,
 		ControllerFetcher:   controllerFetcher,
 		RecommenderName:     recommenderName,
+		CPUNormalizer:       cpuNormalizer,
+		Workers:             workers,
+		CheckpointStorage:   checkpointStorage,
+		VpaObjectFilter:     vpaObjectFilter,
+		ShortLivedPods:      shortLivedPods,
+		PodChanges:          podChanges,
+		FullPodSyncInterval: fullPodSyncInterval,
+		PodMetricsClient:    podMetricsClient,
 	}.Make()
 }
 
@@ -144,45 +233,24 @@ func newMetricsClient(config *rest.Config, namespace, clientName string) metrics
 	return metrics.NewMetricsClient(metricsGetter, namespace, clientName)
 }
 
-// WatchEvictionEventsWithRetries watches new Events with reason=Evicted and passes them to the observer.
-func WatchEvictionEventsWithRetries(kubeClient kube_client.Interface, observer oom.Observer, namespace string) {
-	go func() {
-		options := metav1.ListOptions{
-			FieldSelector: "reason=Evicted",
-		}
+// podEventHandlers passes pod events to all of its handlers.
+type podEventHandlers []cache.ResourceEventHandler
 
-		watchEvictionEventsOnce := func() {
-			watchInterface, err := kubeClient.CoreV1().Events(namespace).Watch(context.TODO(), options)
-			if err != nil {
-				klog.Errorf("Cannot initialize watching events. Reason %v", err)
-				return
-			}
-			watchEvictionEvents(watchInterface.ResultChan(), observer)
-		}
-		for {
-			watchEvictionEventsOnce()
-			// Wait between attempts, retrying too often breaks API server.
-			waitTime := wait.Jitter(evictionWatchRetryWait, evictionWatchJitterFactor)
-			klog.V(1).Infof("An attempt to watch eviction events finished. Waiting %v before the next one.", waitTime)
-			time.Sleep(waitTime)
-		}
-	}()
+func (h podEventHandlers) OnAdd(obj interface{}) {
+	for _, handler := range h {
+		handler.OnAdd(obj)
+	}
 }
 
-func watchEvictionEvents(evictedEventChan <-chan watch.Event, observer oom.Observer) {
-	for {
-		evictedEvent, ok := <-evictedEventChan
-		if !ok {
-			klog.V(3).Infof("Eviction event chan closed")
-			return
-		}
-		if evictedEvent.Type == watch.Added {
-			evictedEvent, ok := evictedEvent.Object.(*apiv1.Event)
-			if !ok {
-				continue
-			}
-			observer.OnEvent(evictedEvent)
-		}
+func (h podEventHandlers) OnUpdate(oldObj, newObj interface{}) {
+	for _, handler := range h {
+		handler.OnUpdate(oldObj, newObj)
+	}
+}
+
+func (h podEventHandlers) OnDelete(obj interface{}) {
+	for _, handler := range h {
+		handler.OnDelete(obj)
 	}
 }
 
@@ -210,26 +278,71 @@ func newPodClients(kubeClient kube_client.Interface, resourceEventHandler cache.
 	return podLister
 }
 
+// Creates a NodeLister backed by a started informer.
+func newNodeLister(kubeClient kube_client.Interface) v1lister.NodeLister {
+	factory := informers.NewSharedInformerFactory(kubeClient, defaultResyncPeriod)
+	nodeLister := factory.Core().V1().Nodes().Lister()
+	stopCh := make(chan struct{})
+	factory.Start(stopCh)
+	for informerType, synced := range factory.WaitForCacheSync(stopCh) {
+		if !synced {
+			klog.Warningf("Could not sync cache for %s", informerType)
+		}
+	}
+	return nodeLister
+}
+
 // NewPodListerAndOOMObserver creates pair of pod lister and OOM observer.
-func NewPodListerAndOOMObserver(kubeClient kube_client.Interface, namespace string) (v1lister.PodLister, oom.Observer) {
-	oomObserver := oom.NewObserver()
-	podLister := newPodClients(kubeClient, oomObserver, namespace)
-	WatchEvictionEventsWithRetries(kubeClient, oomObserver, namespace)
+// Events of the pods listed are passed to podHandlers as well.
+func NewPodListerAndOOMObserver(kubeClient kube_client.Interface, namespace string, oomConfig oom.ObserverConfig, podHandlers ...cache.ResourceEventHandler) (v1lister.PodLister, oom.Observer) {
+	oomObserver := oom.NewObserverWithDedupWindow(oomConfig.DedupWindow)
+	podLister := newPodClients(kubeClient, append(podEventHandlers{oomObserver}, podHandlers...), namespace)
+	stopCh := make(chan struct{})
+	oom.WatchEvictionEvents(kubeClient, oomObserver, namespace, oomConfig.Events, stopCh)
+	if oomConfig.Kmsg != nil {
+		if err := oom.WatchKmsgOoms(*oomConfig.Kmsg, podLister, oomObserver, stopCh); err != nil {
+			klog.Errorf("Cannot watch kernel OOM kills: %v", err)
+		}
+	}
 	return podLister, oomObserver
 }
 
 type clusterStateFeeder struct {
-	coreClient          corev1.CoreV1Interface
-	specClient          spec.SpecClient
-	metricsClient       metrics.MetricsClient
-	oomChan             <-chan oom.OomInfo
-	vpaCheckpointClient vpa_api.VerticalPodAutoscalerCheckpointsGetter
-	vpaLister           vpa_lister.VerticalPodAutoscalerLister
-	clusterState        *model.ClusterState
-	selectorFetcher     target.VpaTargetSelectorFetcher
-	memorySaveMode      bool
-	controllerFetcher   controllerfetcher.ControllerFetcher
-	recommenderName     string
+	coreClient        corev1.CoreV1Interface
+	specClient        spec.SpecClient
+	metricsClient     metrics.MetricsClient
+	oomChan           <-chan oom.OomInfo
+	checkpointStorage checkpoint.CheckpointStorage
+	vpaLister         vpa_lister.VerticalPodAutoscalerLister
+	vpaClient         vpa_api.VerticalPodAutoscalersGetter
+	clusterState      *model.ClusterState
+	selectorFetcher   target.VpaTargetSelectorFetcher
+	memorySaveMode    bool
+	controllerFetcher controllerfetcher.ControllerFetcher
+	recommenderName   string
+	cpuNormalizer     CPUNormalizer
+	workers           int
+	vpaObjectFilter   *vpa_api_util.VpaObjectFilter
+	shortLivedPods    ShortLivedPodConfig
+	// podNodes maps pods to the nodes they run on, as of the last LoadPods.
+	podNodes map[model.PodID]string
+	// excludedPods are short-lived pods whose usage is dropped, as of the
+	// last LoadPods.
+	excludedPods map[model.PodID]bool
+	// shortLivedPodSpecs are the pods which were short-lived as of the last
+	// LoadPods, synced again until they aren't.
+	shortLivedPodSpecs map[model.PodID]*spec.BasicPodSpec
+	// podChanges tracks pods changed since the last LoadPods. Nil syncs all
+	// pods every time.
+	podChanges          *spec.PodChangeTracker
+	fullPodSyncInterval time.Duration
+	nextFullPodSync     time.Time
+	// podSelectorsKey identifies the VPA selectors pods were tracked for in
+	// memory saver mode.
+	podSelectorsKey string
+	// podMetricsClient provides pod usage to estimate missing container
+	// metrics. Nil disables the estimation.
+	podMetricsClient metrics.PodMetricsClient
 }
 
 func (feeder *clusterStateFeeder) InitFromHistoryProvider(historyProvider history.HistoryProvider) {
@@ -251,6 +364,9 @@ func (feeder *clusterStateFeeder) InitFromHistoryProvider(historyProvider histor
 			}
 			klog.V(4).Infof("Adding %d samples for container %v", len(sampleList), containerID)
 			for _, sample := range sampleList {
+				if sample.Resource == model.ResourceCPU && feeder.cpuNormalizer != nil {
+					sample.Usage = feeder.cpuNormalizer.Normalize(podHistory.NodeName, sample.Usage)
+				}
 				if err := feeder.clusterState.AddSample(
 					&model.ContainerUsageSampleWithKey{
 						ContainerUsageSample: sample,
@@ -290,11 +406,11 @@ func (feeder *clusterStateFeeder) InitFromCheckpoints() {
 
 	for namespace := range namespaces {
 		klog.V(3).Infof("Fetching checkpoints from namespace %s", namespace)
-		checkpointList, err := feeder.vpaCheckpointClient.VerticalPodAutoscalerCheckpoints(namespace).List(context.TODO(), metav1.ListOptions{})
+		checkpoints, err := feeder.checkpointStorage.List(context.TODO(), namespace)
 		if err != nil {
 			klog.Errorf("Cannot list VPA checkpoints from namespace %v. Reason: %+v", namespace, err)
 		}
-		for _, checkpoint := range checkpointList.Items {
+		for _, checkpoint := range checkpoints {
 
 			klog.V(3).Infof("Loading VPA %s/%s checkpoint for %s", checkpoint.ObjectMeta.Namespace, checkpoint.Spec.VPAObjectName, checkpoint.Spec.ContainerName)
 			err = feeder.setVpaCheckpoint(&checkpoint)
@@ -310,33 +426,74 @@ func (feeder *clusterStateFeeder) GarbageCollectCheckpoints() {
 	klog.V(3).Info("Starting garbage collection of checkpoints")
 	feeder.LoadVPAs()
 
-	namspaceList, err := feeder.coreClient.Namespaces().List(context.TODO(), metav1.ListOptions{})
+	namespaces, err := feeder.checkpointStorage.Namespaces(context.TODO())
 	if err != nil {
 		klog.Errorf("Cannot list namespaces. Reason: %+v", err)
 		return
 	}
 
-	for _, namespaceItem := range namspaceList.Items {
-		namespace := namespaceItem.Name
-		checkpointList, err := feeder.vpaCheckpointClient.VerticalPodAutoscalerCheckpoints(namespace).List(context.TODO(), metav1.ListOptions{})
+	for _, namespace := range namespaces {
+		// Checkpoints in other namespaces belong to other recommenders.
+		if !feeder.matchesNamespace(namespace) {
+			continue
+		}
+		checkpoints, err := feeder.checkpointStorage.List(context.TODO(), namespace)
 		if err != nil {
 			klog.Errorf("Cannot list VPA checkpoints from namespace %v. Reason: %+v", namespace, err)
+			continue
 		}
-		for _, checkpoint := range checkpointList.Items {
-			vpaID := model.VpaID{Namespace: checkpoint.Namespace, VpaName: checkpoint.Spec.VPAObjectName}
-			_, exists := feeder.clusterState.Vpas[vpaID]
-			if !exists {
-				err = feeder.vpaCheckpointClient.VerticalPodAutoscalerCheckpoints(namespace).Delete(context.TODO(), checkpoint.Name, metav1.DeleteOptions{})
-				if err == nil {
-					klog.V(3).Infof("Orphaned VPA checkpoint cleanup - deleting %v/%v.", namespace, checkpoint.Name)
-				} else {
-					klog.Errorf("Cannot delete VPA checkpoint %v/%v. Reason: %+v", namespace, checkpoint.Name, err)
-				}
+		var missingVpaCheckpoints []vpa_types.VerticalPodAutoscalerCheckpoint
+		for _, checkpoint := range checkpoints {
+			vpaID := model.VpaID{Namespace: namespace, VpaName: checkpoint.Spec.VPAObjectName}
+			if _, exists := feeder.clusterState.Vpas[vpaID]; !exists {
+				missingVpaCheckpoints = append(missingVpaCheckpoints, checkpoint)
 			}
 		}
+		if len(missingVpaCheckpoints) == 0 {
+			continue
+		}
+		orphanedCheckpoints, err := feeder.getOrphanedCheckpoints(namespace, missingVpaCheckpoints)
+		if err != nil {
+			klog.Errorf("Cannot list VPAs in namespace %v. Reason: %+v", namespace, err)
+			continue
+		}
+		if len(orphanedCheckpoints) == 0 {
+			continue
+		}
+		err = feeder.checkpointStorage.Delete(context.TODO(), namespace, orphanedCheckpoints)
+		if err == nil {
+			klog.V(3).Infof("Orphaned VPA checkpoint cleanup - deleting %v in namespace %v.", orphanedCheckpoints, namespace)
+		} else {
+			klog.Errorf("Cannot delete VPA checkpoints %v in namespace %v. Reason: %+v", orphanedCheckpoints, namespace, err)
+		}
 	}
 }
 
+// getOrphanedCheckpoints returns the names of the checkpoints, whose VPAs are
+// missing from the model, which can be deleted: those of VPAs which don't
+// exist, or are selected by the VPA object filter. Checkpoints of VPAs not
+// selected by the filter belong to other recommenders and are kept.
+func (feeder *clusterStateFeeder) getOrphanedCheckpoints(namespace string, checkpoints []vpa_types.VerticalPodAutoscalerCheckpoint) ([]string, error) {
+	existingVpas := make(map[string]*vpa_types.VerticalPodAutoscaler)
+	if feeder.vpaObjectFilter != nil {
+		vpas, err := feeder.vpaClient.VerticalPodAutoscalers(namespace).List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for i := range vpas.Items {
+			existingVpas[vpas.Items[i].Name] = &vpas.Items[i]
+		}
+	}
+	var orphanedCheckpoints []string
+	for _, checkpoint := range checkpoints {
+		vpa, exists := existingVpas[checkpoint.Spec.VPAObjectName]
+		if !exists || feeder.vpaObjectFilter.Matches(vpa) {
+			orphanedCheckpoints = append(orphanedCheckpoints, checkpoint.Name)
+		}
+	}
+	return orphanedCheckpoints, nil
+}
+
 func implicitDefaultRecommender(selectors []*vpa_types.VerticalPodAutoscalerRecommenderSelector) bool {
 	return len(selectors) == 0
 }
@@ -383,6 +540,7 @@ func (feeder *clusterStateFeeder) LoadVPAs() {
 		klog.Errorf("Cannot list VPAs. Reason: %+v", err)
 		return
 	}
+	metrics_recommender.MarkSubsystemFresh(metrics_recommender.VpaSyncSubsystem)
 
 	// Filter out VPAs that specified recommenders with names not equal to "default"
 	vpaCRDs := filterVPAs(feeder, allVpaCRDs)
@@ -424,55 +582,161 @@ func (feeder *clusterStateFeeder) LoadVPAs() {
 	feeder.clusterState.ObservedVpas = vpaCRDs
 }
 
-// Load pod into the cluster state.
+// LoadPods syncs the pods of the cluster state. With a pod change tracker,
+// only pods changed since the previous call, and short-lived pods, which may
+// no longer be, are synced, except for a full sync every full pod sync
+// interval and, in memory saver mode, whenever the VPA selectors change.
 func (feeder *clusterStateFeeder) LoadPods() {
+	now := time.Now()
+	var selectors map[string][]labels.Selector
+	selectorsChanged := false
+	if feeder.memorySaveMode {
+		selectors = feeder.vpaSelectorsByNamespace()
+		key := selectorsKey(selectors)
+		selectorsChanged = key != feeder.podSelectorsKey
+		feeder.podSelectorsKey = key
+	}
+	if feeder.podChanges == nil || selectorsChanged || !now.Before(feeder.nextFullPodSync) {
+		feeder.loadAllPods(selectors, now)
+	} else {
+		feeder.loadChangedPods(selectors, now)
+	}
+}
+
+// loadAllPods syncs all pods of the cluster state.
+func (feeder *clusterStateFeeder) loadAllPods(selectors map[string][]labels.Selector, now time.Time) {
+	if feeder.podChanges != nil {
+		// Changes so far are included in the pods listed below.
+		feeder.podChanges.TakeChanges()
+		feeder.nextFullPodSync = now.Add(feeder.fullPodSyncInterval)
+	}
 	podSpecs, err := feeder.specClient.GetPodSpecs()
 	if err != nil {
 		klog.Errorf("Cannot get SimplePodSpecs. Reason: %+v", err)
 	}
 	pods := make(map[model.PodID]*spec.BasicPodSpec)
 	for _, spec := range podSpecs {
-		pods[spec.ID] = spec
+		if feeder.tracksPod(spec, selectors) {
+			pods[spec.ID] = spec
+		}
 	}
 	for key := range feeder.clusterState.Pods {
 		if _, exists := pods[key]; !exists {
-			klog.V(3).Infof("Deleting Pod %v", key)
-			feeder.clusterState.DeletePod(key)
+			feeder.deletePod(key)
 		}
 	}
+	feeder.podNodes = make(map[model.PodID]string)
+	feeder.excludedPods = make(map[model.PodID]bool)
+	feeder.shortLivedPodSpecs = make(map[model.PodID]*spec.BasicPodSpec)
 	for _, pod := range pods {
-		if feeder.memorySaveMode && !feeder.matchesVPA(pod) {
+		feeder.addPod(pod, now)
+	}
+}
+
+// loadChangedPods syncs the pods changed since the previous sync and the
+// short-lived pods.
+func (feeder *clusterStateFeeder) loadChangedPods(selectors map[string][]labels.Selector, now time.Time) {
+	changes := feeder.podChanges.TakeChanges()
+	for podID, pod := range feeder.shortLivedPodSpecs {
+		if _, changed := changes[podID]; !changed {
+			changes[podID] = pod
+		}
+	}
+	klog.V(3).Infof("Syncing %d changed pods", len(changes))
+	for podID, pod := range changes {
+		if pod == nil || !feeder.tracksPod(pod, selectors) {
+			feeder.deletePod(podID)
 			continue
 		}
-		feeder.clusterState.AddOrUpdatePod(pod.ID, pod.PodLabels, pod.Phase)
-		for _, container := range pod.Containers {
-			if err = feeder.clusterState.AddOrUpdateContainer(container.ID, container.Request); err != nil {
-				klog.Warningf("Failed to add container %+v. Reason: %+v", container.ID, err)
-			}
+		feeder.addPod(pod, now)
+	}
+}
+
+// tracksPod returns whether the pod belongs in the cluster state.
+func (feeder *clusterStateFeeder) tracksPod(pod *spec.BasicPodSpec, selectors map[string][]labels.Selector) bool {
+	if feeder.vpaObjectFilter != nil && !feeder.vpaObjectFilter.MatchesNamespace(pod.ID.Namespace) {
+		return false
+	}
+	// In memory saver mode pods which no longer match a VPA, e.g. after
+	// their VPA was deleted, are deleted from the model.
+	return !feeder.memorySaveMode || matchesVPA(pod, selectors)
+}
+
+func (feeder *clusterStateFeeder) addPod(pod *spec.BasicPodSpec, now time.Time) {
+	feeder.clusterState.AddOrUpdatePod(pod.ID, pod.PodLabels, pod.Phase)
+	feeder.podNodes[pod.ID] = pod.NodeName
+	shortLived := feeder.shortLivedPods.isShortLived(pod, now)
+	if shortLived {
+		feeder.shortLivedPodSpecs[pod.ID] = pod
+	} else {
+		delete(feeder.shortLivedPodSpecs, pod.ID)
+	}
+	switch feeder.shortLivedPods.Policy {
+	case ExcludeShortLivedPods:
+		if shortLived {
+			feeder.excludedPods[pod.ID] = true
+		} else {
+			delete(feeder.excludedPods, pod.ID)
+		}
+	case SeparateShortLivedPods:
+		feeder.clusterState.SetPodShortLived(pod.ID, shortLived)
+	}
+	for _, container := range pod.Containers {
+		if err := feeder.clusterState.AddOrUpdateContainerWithLimit(container.ID, container.Request, container.Limit); err != nil {
+			klog.Warningf("Failed to add container %+v. Reason: %+v", container.ID, err)
 		}
 	}
 }
 
+func (feeder *clusterStateFeeder) deletePod(podID model.PodID) {
+	if _, found := feeder.clusterState.Pods[podID]; found {
+		klog.V(3).Infof("Deleting Pod %v", podID)
+		feeder.clusterState.DeletePod(podID)
+	}
+	delete(feeder.podNodes, podID)
+	delete(feeder.excludedPods, podID)
+	delete(feeder.shortLivedPodSpecs, podID)
+}
+
 func (feeder *clusterStateFeeder) LoadRealTimeMetrics() {
-	containersMetrics, err := feeder.metricsClient.GetContainersMetrics()
+	containersMetrics, err := feeder.getContainersMetrics()
 	if err != nil {
 		klog.Errorf("Cannot get ContainerMetricsSnapshot from MetricsClient. Reason: %+v", err)
+	} else {
+		metrics_recommender.MarkSubsystemFresh(metrics_recommender.MetricsFeedSubsystem)
+	}
+	containersMetrics = dropDuplicateContainersMetrics(containersMetrics)
+	if feeder.podMetricsClient != nil && err == nil {
+		containersMetrics = append(containersMetrics, feeder.estimateMissingContainersMetrics(containersMetrics)...)
 	}
 
-	sampleCount := 0
-	droppedSampleCount := 0
+	var samples []*model.ContainerUsageSampleWithKey
 	for _, containerMetrics := range containersMetrics {
+		if _, found := feeder.clusterState.Pods[containerMetrics.ID.PodID]; !found && feeder.memorySaveMode {
+			continue
+		}
+		if feeder.excludedPods[containerMetrics.ID.PodID] || !feeder.matchesNamespace(containerMetrics.ID.Namespace) {
+			continue
+		}
 		for _, sample := range newContainerUsageSamplesWithKey(containerMetrics) {
-			if err := feeder.clusterState.AddSample(sample); err != nil {
-				// Not all pod states are tracked in memory saver mode
-				if _, isKeyError := err.(model.KeyError); isKeyError && feeder.memorySaveMode {
-					continue
-				}
-				klog.Warningf("Error adding metric sample for container %v: %v", sample.Container, err)
-				droppedSampleCount++
-			} else {
-				sampleCount++
+			if sample.Resource == model.ResourceCPU && feeder.cpuNormalizer != nil {
+				sample.Usage = feeder.cpuNormalizer.Normalize(feeder.podNodes[sample.Container.PodID], sample.Usage)
+			}
+			samples = append(samples, sample)
+		}
+	}
+	sampleCount := 0
+	droppedSampleCount := 0
+	for i, err := range feeder.clusterState.AddSamples(samples, feeder.workers) {
+		if err != nil {
+			// Not all pod states are tracked in memory saver mode
+			if _, isKeyError := err.(model.KeyError); isKeyError && feeder.memorySaveMode {
+				continue
 			}
+			klog.Warningf("Error adding metric sample for container %v: %v", samples[i].Container, err)
+			droppedSampleCount++
+		} else {
+			sampleCount++
 		}
 	}
 	klog.V(3).Infof("ClusterSpec fed with #%v ContainerUsageSamples for #%v containers. Dropped #%v samples.", sampleCount, len(containersMetrics), droppedSampleCount)
@@ -481,6 +745,9 @@ Loop:
 		select {
 		case oomInfo := <-feeder.oomChan:
 			klog.V(3).Infof("OOM detected %+v", oomInfo)
+			if feeder.excludedPods[oomInfo.ContainerID.PodID] || !feeder.matchesNamespace(oomInfo.ContainerID.Namespace) {
+				continue
+			}
 			if err = feeder.clusterState.RecordOOM(oomInfo.ContainerID, oomInfo.Timestamp, oomInfo.Memory); err != nil {
 				klog.Warningf("Failed to record OOM %+v. Reason: %+v", oomInfo, err)
 			}
@@ -491,10 +758,89 @@ Loop:
 	metrics_recommender.RecordAggregateContainerStatesCount(feeder.clusterState.StateMapSize())
 }
 
-func (feeder *clusterStateFeeder) matchesVPA(pod *spec.BasicPodSpec) bool {
-	for vpaKey, vpa := range feeder.clusterState.Vpas {
-		podLabels := labels.Set(pod.PodLabels)
-		if vpaKey.Namespace == pod.ID.Namespace && vpa.PodSelector.Matches(podLabels) {
+// matchesNamespace returns true iff pods in the namespace are tracked
+// according to the VPA object filter.
+func (feeder *clusterStateFeeder) matchesNamespace(namespace string) bool {
+	return feeder.vpaObjectFilter == nil || feeder.vpaObjectFilter.MatchesNamespace(namespace)
+}
+
+// getContainersMetrics gets the metrics of all containers or, if the metrics
+// client supports it, only of containers in namespaces with VPAs in memory
+// saver mode, or in the namespaces selected by the VPA object filter.
+func (feeder *clusterStateFeeder) getContainersMetrics() ([]*metrics.ContainerMetricsSnapshot, error) {
+	namespacedClient, ok := feeder.metricsClient.(metrics.NamespacedMetricsClient)
+	if !ok {
+		return feeder.metricsClient.GetContainersMetrics()
+	}
+	if !feeder.memorySaveMode {
+		var namespaces []string
+		if feeder.vpaObjectFilter != nil {
+			namespaces = feeder.vpaObjectFilter.Namespaces()
+		}
+		if namespaces == nil {
+			return feeder.metricsClient.GetContainersMetrics()
+		}
+		return namespacedClient.GetContainersMetricsInNamespaces(namespaces)
+	}
+	namespaces := make([]string, 0, len(feeder.clusterState.Vpas))
+	for namespace := range feeder.vpaSelectorsByNamespace() {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	return namespacedClient.GetContainersMetricsInNamespaces(namespaces)
+}
+
+// dropDuplicateContainersMetrics drops snapshots of a container with the same
+// time as a previous one, e.g. returned by two replicas of metrics-server, so
+// that its usage isn't weighted twice.
+func dropDuplicateContainersMetrics(containersMetrics []*metrics.ContainerMetricsSnapshot) []*metrics.ContainerMetricsSnapshot {
+	type snapshotKey struct {
+		container model.ContainerID
+		time      time.Time
+	}
+	result := make([]*metrics.ContainerMetricsSnapshot, 0, len(containersMetrics))
+	seen := make(map[snapshotKey]bool, len(containersMetrics))
+	for _, containerMetrics := range containersMetrics {
+		key := snapshotKey{container: containerMetrics.ID, time: containerMetrics.SnapshotTime}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, containerMetrics)
+	}
+	if duplicates := len(containersMetrics) - len(result); duplicates > 0 {
+		klog.V(3).Infof("Dropped %d duplicate ContainerMetricsSnapshots", duplicates)
+		metrics_recommender.RecordDuplicateUsageSamples("metrics", duplicates)
+	}
+	return result
+}
+
+// selectorsKey returns a string identifying the selectors.
+func selectorsKey(selectors map[string][]labels.Selector) string {
+	keys := make([]string, 0, len(selectors))
+	for namespace, namespaceSelectors := range selectors {
+		for _, selector := range namespaceSelectors {
+			keys = append(keys, namespace+"/"+selector.String())
+		}
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ";")
+}
+
+// vpaSelectorsByNamespace returns the pod selectors of the VPAs in the model
+// by namespace.
+func (feeder *clusterStateFeeder) vpaSelectorsByNamespace() map[string][]labels.Selector {
+	selectors := make(map[string][]labels.Selector)
+	for vpaID, vpa := range feeder.clusterState.Vpas {
+		selectors[vpaID.Namespace] = append(selectors[vpaID.Namespace], vpa.PodSelector)
+	}
+	return selectors
+}
+
+func matchesVPA(pod *spec.BasicPodSpec, selectors map[string][]labels.Selector) bool {
+	podLabels := labels.Set(pod.PodLabels)
+	for _, selector := range selectors[pod.ID.Namespace] {
+		if selector.Matches(podLabels) {
 			return true
 		}
 	}
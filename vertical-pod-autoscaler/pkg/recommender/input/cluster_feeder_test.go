@@ -17,6 +17,7 @@ limitations under the License.
 package input
 
 import (
+	"context"
 	"fmt"
 	"testing"
 	"time"
@@ -25,15 +26,22 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	apiv1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	vpa_fake "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/client/clientset/versioned/fake"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/checkpoint"
 	controllerfetcher "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/input/controller_fetcher"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/input/history"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/input/metrics"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/input/oom"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/input/spec"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
 	target_mock "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/target/mock"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/test"
+	vpa_api_util "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/vpa"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
 type fakeControllerFetcher struct {
@@ -450,6 +458,223 @@ func TestClusterStateFeeder_LoadPods(t *testing.T) {
 	}
 }
 
+func TestClusterStateFeeder_LoadPodsMemorySaverVpaDeleted(t *testing.T) {
+	clusterState := model.NewClusterState(testGcPeriod)
+	vpaID := model.VpaID{VpaName: "test-vpa", Namespace: "default"}
+	clusterState.Vpas = map[model.VpaID]*model.Vpa{vpaID: {PodSelector: labels.SelectorFromSet(labels.Set{"name": "vpa-pod"})}}
+	feeder := clusterStateFeeder{
+		specClient:     makeTestSpecClient([]map[string]string{{"name": "vpa-pod"}}),
+		memorySaveMode: true,
+		clusterState:   clusterState,
+	}
+
+	feeder.LoadPods()
+	assert.Len(t, clusterState.Pods, 1)
+
+	delete(clusterState.Vpas, vpaID)
+	feeder.LoadPods()
+	assert.Empty(t, clusterState.Pods)
+}
+
+func TestClusterStateFeeder_LoadPodsIncrementally(t *testing.T) {
+	clusterState := model.NewClusterState(testGcPeriod)
+	specClient := makeTestSpecClient([]map[string]string{{"name": "vpa-pod"}}).(*testSpecClient)
+	podChanges := spec.NewPodChangeTracker()
+	feeder := ClusterStateFeederFactory{
+		KubeClient:          fake.NewSimpleClientset(),
+		OOMObserver:         oom.NewObserver(),
+		ClusterState:        clusterState,
+		PodChanges:          podChanges,
+		FullPodSyncInterval: time.Hour,
+	}.Make()
+	feeder.specClient = specClient
+	pod0 := model.PodID{Namespace: "default", PodName: "pod-0"}
+	pod1 := model.PodID{Namespace: "default", PodName: "pod-1"}
+
+	// The first sync is a full sync.
+	feeder.LoadPods()
+	assert.Len(t, clusterState.Pods, 1)
+
+	// Pods without events aren't synced until the next full sync.
+	specClient.pods = append(specClient.pods, &spec.BasicPodSpec{ID: pod1})
+	feeder.LoadPods()
+	assert.NotContains(t, clusterState.Pods, pod1)
+
+	podChanges.OnAdd(test.Pod().WithName("pod-1").Get())
+	feeder.LoadPods()
+	assert.Contains(t, clusterState.Pods, pod1)
+
+	podChanges.OnDelete(test.Pod().WithName("pod-0").Get())
+	feeder.LoadPods()
+	assert.NotContains(t, clusterState.Pods, pod0)
+	assert.Contains(t, clusterState.Pods, pod1)
+
+	// The full sync brings back pods whose events were missed.
+	feeder.nextFullPodSync = time.Now()
+	feeder.LoadPods()
+	assert.Len(t, clusterState.Pods, 2)
+}
+
+type fakeNamespacedMetricsClient struct {
+	snapshots  []*metrics.ContainerMetricsSnapshot
+	namespaces []string
+}
+
+func (c *fakeNamespacedMetricsClient) GetContainersMetrics() ([]*metrics.ContainerMetricsSnapshot, error) {
+	return c.snapshots, nil
+}
+
+func (c *fakeNamespacedMetricsClient) GetContainersMetricsInNamespaces(namespaces []string) ([]*metrics.ContainerMetricsSnapshot, error) {
+	c.namespaces = namespaces
+	return c.snapshots, nil
+}
+
+func TestClusterStateFeeder_LoadRealTimeMetricsMemorySaver(t *testing.T) {
+	clusterState := model.NewClusterState(testGcPeriod)
+	clusterState.Vpas = map[model.VpaID]*model.Vpa{
+		{VpaName: "test-vpa", Namespace: "default"}: {PodSelector: labels.SelectorFromSet(labels.Set{"name": "vpa-pod"})},
+	}
+	tracked := model.PodID{Namespace: "default", PodName: "pod-0"}
+	clusterState.AddOrUpdatePod(tracked, labels.Set{"name": "vpa-pod"}, "Running")
+	trackedContainer := model.ContainerID{PodID: tracked, ContainerName: "container-1"}
+	assert.NoError(t, clusterState.AddOrUpdateContainer(trackedContainer, model.Resources{}))
+	now := time.Now()
+	snapshot := func(podID model.PodID) *metrics.ContainerMetricsSnapshot {
+		return &metrics.ContainerMetricsSnapshot{
+			ID:           model.ContainerID{PodID: podID, ContainerName: "container-1"},
+			SnapshotTime: now,
+			Usage:        model.Resources{model.ResourceCPU: 100, model.ResourceMemory: 1024},
+		}
+	}
+	metricsClient := &fakeNamespacedMetricsClient{snapshots: []*metrics.ContainerMetricsSnapshot{
+		snapshot(tracked),
+		snapshot(model.PodID{Namespace: "default", PodName: "pod-1"}),
+	}}
+	feeder := clusterStateFeeder{
+		metricsClient:  metricsClient,
+		memorySaveMode: true,
+		clusterState:   clusterState,
+	}
+
+	feeder.LoadRealTimeMetrics()
+	assert.Equal(t, []string{"default"}, metricsClient.namespaces)
+	assert.Equal(t, now, clusterState.Pods[tracked].Containers["container-1"].LastCPUSampleStart)
+	assert.Len(t, clusterState.Pods, 1)
+}
+
+func TestClusterStateFeeder_LoadRealTimeMetricsFilteredNamespaces(t *testing.T) {
+	clusterState := model.NewClusterState(testGcPeriod)
+	tracked := model.PodID{Namespace: "namespace-1", PodName: "pod-0"}
+	clusterState.AddOrUpdatePod(tracked, labels.Set{"name": "vpa-pod"}, "Running")
+	trackedContainer := model.ContainerID{PodID: tracked, ContainerName: "container-1"}
+	assert.NoError(t, clusterState.AddOrUpdateContainer(trackedContainer, model.Resources{}))
+	now := time.Now()
+	metricsClient := &fakeNamespacedMetricsClient{snapshots: []*metrics.ContainerMetricsSnapshot{{
+		ID:           trackedContainer,
+		SnapshotTime: now,
+		Usage:        model.Resources{model.ResourceCPU: 100, model.ResourceMemory: 1024},
+	}, {
+		// Not tracked, in an ignored namespace.
+		ID:           model.ContainerID{PodID: model.PodID{Namespace: "namespace-2", PodName: "pod-1"}, ContainerName: "container-1"},
+		SnapshotTime: now,
+		Usage:        model.Resources{model.ResourceCPU: 100, model.ResourceMemory: 1024},
+	}}}
+	filter, err := vpa_api_util.NewVpaObjectFilter("namespace-1,namespace-2", "namespace-2", "")
+	assert.NoError(t, err)
+	feeder := clusterStateFeeder{
+		metricsClient:   metricsClient,
+		clusterState:    clusterState,
+		vpaObjectFilter: filter,
+	}
+
+	feeder.LoadRealTimeMetrics()
+	assert.Equal(t, []string{"namespace-1"}, metricsClient.namespaces)
+	assert.Equal(t, now, clusterState.Pods[tracked].Containers["container-1"].LastCPUSampleStart)
+	assert.Len(t, clusterState.Pods, 1)
+}
+
+func TestDropDuplicateContainersMetrics(t *testing.T) {
+	now := time.Now()
+	snapshot := func(containerName string, snapshotTime time.Time) *metrics.ContainerMetricsSnapshot {
+		return &metrics.ContainerMetricsSnapshot{
+			ID:           model.ContainerID{PodID: model.PodID{Namespace: "default", PodName: "pod-0"}, ContainerName: containerName},
+			SnapshotTime: snapshotTime,
+			Usage:        model.Resources{model.ResourceCPU: 100, model.ResourceMemory: 1024},
+		}
+	}
+	first := snapshot("container-1", now)
+	later := snapshot("container-1", now.Add(time.Minute))
+	other := snapshot("container-2", now)
+	// Snapshots returned twice, e.g. by two metrics-server replicas.
+	assert.Equal(t, []*metrics.ContainerMetricsSnapshot{first, later, other},
+		dropDuplicateContainersMetrics([]*metrics.ContainerMetricsSnapshot{first, later, snapshot("container-1", now), other, snapshot("container-2", now)}))
+}
+
+func TestClusterStateFeeder_ShortLivedPods(t *testing.T) {
+	now := time.Now()
+	shortLived := model.PodID{Namespace: "default", PodName: "short-lived"}
+	longRunning := model.PodID{Namespace: "default", PodName: "long-running"}
+	podSpec := func(podID model.PodID, startTime time.Time) *spec.BasicPodSpec {
+		return &spec.BasicPodSpec{
+			ID:         podID,
+			PodLabels:  map[string]string{"name": "vpa-pod"},
+			Containers: []spec.BasicContainerSpec{{ID: model.ContainerID{PodID: podID, ContainerName: "container-1"}}},
+			StartTime:  startTime,
+		}
+	}
+	snapshot := func(podID model.PodID) *metrics.ContainerMetricsSnapshot {
+		return &metrics.ContainerMetricsSnapshot{
+			ID:           model.ContainerID{PodID: podID, ContainerName: "container-1"},
+			SnapshotTime: now,
+			Usage:        model.Resources{model.ResourceCPU: 100, model.ResourceMemory: 1024},
+		}
+	}
+
+	for _, tc := range []struct {
+		name                  string
+		policy                ShortLivedPodPolicy
+		expectShortLivedUsage bool
+		expectShortLivedName  string
+	}{
+		{
+			name:                  "exclude",
+			policy:                ExcludeShortLivedPods,
+			expectShortLivedUsage: false,
+			expectShortLivedName:  "container-1",
+		},
+		{
+			name:                  "separate",
+			policy:                SeparateShortLivedPods,
+			expectShortLivedUsage: true,
+			expectShortLivedName:  "container-1" + model.ShortLivedContainerNameSuffix,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			clusterState := model.NewClusterState(testGcPeriod)
+			feeder := clusterStateFeeder{
+				specClient: &testSpecClient{pods: []*spec.BasicPodSpec{
+					podSpec(shortLived, now.Add(-time.Minute)),
+					podSpec(longRunning, now.Add(-time.Hour)),
+				}},
+				metricsClient: &fakeNamespacedMetricsClient{snapshots: []*metrics.ContainerMetricsSnapshot{
+					snapshot(shortLived),
+					snapshot(longRunning),
+				}},
+				clusterState:   clusterState,
+				shortLivedPods: ShortLivedPodConfig{Threshold: 10 * time.Minute, Policy: tc.policy},
+			}
+
+			feeder.LoadPods()
+			feeder.LoadRealTimeMetrics()
+			assert.Len(t, clusterState.Pods, 2)
+			assert.Equal(t, now, clusterState.Pods[longRunning].Containers["container-1"].LastCPUSampleStart)
+			assert.Equal(t, tc.expectShortLivedUsage, clusterState.Pods[shortLived].Containers["container-1"].LastCPUSampleStart.Equal(now))
+			assert.Equal(t, tc.expectShortLivedName, clusterState.MakeAggregateStateKey(clusterState.Pods[shortLived], "container-1").ContainerName())
+			assert.Equal(t, "container-1", clusterState.MakeAggregateStateKey(clusterState.Pods[longRunning], "container-1").ContainerName())
+		})
+	}
+}
+
 type fakeHistoryProvider struct {
 	history map[model.PodID]*history.PodHistory
 	err     error
@@ -522,3 +747,96 @@ func TestClusterStateFeeder_InitFromHistoryProvider(t *testing.T) {
 	}
 	assert.Equal(t, memAmount, containerState.GetMaxMemoryPeak())
 }
+
+type fakeCPUNormalizer struct {
+	nodeNames []string
+}
+
+func (n *fakeCPUNormalizer) Normalize(nodeName string, usage model.ResourceAmount) model.ResourceAmount {
+	n.nodeNames = append(n.nodeNames, nodeName)
+	return usage * 2
+}
+
+func TestClusterStateFeeder_InitFromHistoryProviderNormalizesCPU(t *testing.T) {
+	pod1 := model.PodID{Namespace: "ns", PodName: "a-pod"}
+	t0 := time.Date(2021, time.August, 30, 10, 21, 0, 0, time.UTC)
+	provider := fakeHistoryProvider{
+		history: map[model.PodID]*history.PodHistory{
+			pod1: {
+				LastLabels: map[string]string{},
+				LastSeen:   t0,
+				NodeName:   "fast-node",
+				Samples: map[string][]model.ContainerUsageSample{
+					"container": {
+						{MeasureStart: t0, Usage: 10, Resource: model.ResourceCPU},
+						{MeasureStart: t0, Usage: 1024, Resource: model.ResourceMemory},
+					},
+				},
+			},
+		},
+	}
+	normalizer := &fakeCPUNormalizer{}
+	feeder := clusterStateFeeder{
+		clusterState:  model.NewClusterState(testGcPeriod),
+		cpuNormalizer: normalizer,
+	}
+	feeder.InitFromHistoryProvider(&provider)
+	assert.Equal(t, []string{"fast-node"}, normalizer.nodeNames)
+}
+
+func TestClusterStateFeeder_GarbageCollectCheckpointsOfOtherTenants(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tenantAVpa := test.VerticalPodAutoscaler().WithName("vpa-a").WithContainer("container").WithNamespace("default").Get()
+	tenantAVpa.Labels = map[string]string{"tenant": "a"}
+	tenantBVpa := test.VerticalPodAutoscaler().WithName("vpa-b").WithContainer("container").WithNamespace("default").Get()
+	tenantBVpa.Labels = map[string]string{"tenant": "b"}
+	vpaClient := vpa_fake.NewSimpleClientset(tenantAVpa, tenantBVpa)
+	kubeClient := fake.NewSimpleClientset(
+		&apiv1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+		&apiv1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system"}})
+	for _, checkpoint := range []struct{ namespace, vpaName string }{
+		{"default", "vpa-a"},
+		{"default", "vpa-b"},
+		{"default", "vpa-deleted"},
+		// Not in the namespaces selected by the filter.
+		{"kube-system", "vpa-deleted"},
+	} {
+		_, err := vpaClient.AutoscalingV1().VerticalPodAutoscalerCheckpoints(checkpoint.namespace).Create(context.TODO(), &vpa_types.VerticalPodAutoscalerCheckpoint{
+			ObjectMeta: metav1.ObjectMeta{Namespace: checkpoint.namespace, Name: checkpoint.vpaName + "-container"},
+			Spec:       vpa_types.VerticalPodAutoscalerCheckpointSpec{VPAObjectName: checkpoint.vpaName, ContainerName: "container"},
+		}, metav1.CreateOptions{})
+		assert.NoError(t, err)
+	}
+
+	filter, err := vpa_api_util.NewVpaObjectFilter("", "kube-system", "tenant=a")
+	assert.NoError(t, err)
+	vpaLister := &test.VerticalPodAutoscalerListerMock{}
+	vpaLister.On("List").Return([]*vpa_types.VerticalPodAutoscaler{tenantAVpa, tenantBVpa}, nil)
+	targetSelectorFetcher := target_mock.NewMockVpaTargetSelectorFetcher(ctrl)
+	targetSelectorFetcher.EXPECT().Fetch(tenantAVpa).Return(labels.Everything(), nil)
+	feeder := clusterStateFeeder{
+		checkpointStorage: checkpoint.NewCRDStorage(kubeClient.CoreV1(), vpaClient.AutoscalingV1()),
+		vpaLister:         vpa_api_util.NewFilteringVpaLister(vpaLister, filter),
+		vpaClient:         vpaClient.AutoscalingV1(),
+		vpaObjectFilter:   filter,
+		clusterState:      model.NewClusterState(testGcPeriod),
+		selectorFetcher:   targetSelectorFetcher,
+		controllerFetcher: &fakeControllerFetcher{},
+		recommenderName:   DefaultRecommenderName,
+	}
+
+	feeder.GarbageCollectCheckpoints()
+
+	checkpoints, err := vpaClient.AutoscalingV1().VerticalPodAutoscalerCheckpoints("default").List(context.TODO(), metav1.ListOptions{})
+	assert.NoError(t, err)
+	var names []string
+	for _, checkpoint := range checkpoints.Items {
+		names = append(names, checkpoint.Name)
+	}
+	assert.ElementsMatch(t, []string{"vpa-a-container", "vpa-b-container"}, names)
+	checkpoints, err = vpaClient.AutoscalingV1().VerticalPodAutoscalerCheckpoints("kube-system").List(context.TODO(), metav1.ListOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, checkpoints.Items, 1)
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package input
+
+import (
+	"strconv"
+
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+	v1lister "k8s.io/client-go/listers/core/v1"
+	klog "k8s.io/klog/v2"
+)
+
+// CPUNormalizer scales CPU usage observed on a node to the CPU usage the
+// same work would take on a reference node. Nodes of newer CPU generations do
+// the same work with less CPU time, so without normalization workloads moving
+// between node generations get skewed recommendations.
+type CPUNormalizer interface {
+	// Normalize returns the CPU usage scaled by the performance factor of the node.
+	Normalize(nodeName string, usage model.ResourceAmount) model.ResourceAmount
+}
+
+type nodeLabelCPUNormalizer struct {
+	nodeLister v1lister.NodeLister
+	label      string
+}
+
+// NewNodeLabelCPUNormalizer returns a CPUNormalizer which reads the performance
+// factor of a node from the given node label. The factor is a positive number
+// relative to the reference node, e.g. 1.5 for a node doing the same work with
+// 1.5 times less CPU time. Nodes without a valid label have a factor of 1.
+func NewNodeLabelCPUNormalizer(nodeLister v1lister.NodeLister, label string) CPUNormalizer {
+	return &nodeLabelCPUNormalizer{
+		nodeLister: nodeLister,
+		label:      label,
+	}
+}
+
+func (n *nodeLabelCPUNormalizer) Normalize(nodeName string, usage model.ResourceAmount) model.ResourceAmount {
+	factor := n.performanceFactor(nodeName)
+	if factor == 1.0 {
+		return usage
+	}
+	return model.ScaleResource(usage, factor)
+}
+
+func (n *nodeLabelCPUNormalizer) performanceFactor(nodeName string) float64 {
+	if nodeName == "" {
+		return 1.0
+	}
+	node, err := n.nodeLister.Get(nodeName)
+	if err != nil {
+		klog.V(4).Infof("Cannot get node %s to normalize CPU usage: %v", nodeName, err)
+		return 1.0
+	}
+	value, found := node.Labels[n.label]
+	if !found {
+		return 1.0
+	}
+	factor, err := strconv.ParseFloat(value, 64)
+	if err != nil || factor <= 0 {
+		klog.Warningf("Invalid CPU performance factor %q of node %s", value, nodeName)
+		return 1.0
+	}
+	return factor
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package input
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+	v1lister "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const testPerformanceLabel = "example.com/cpu-performance-factor"
+
+func TestNodeLabelCPUNormalizer(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for name, factor := range map[string]string{"fast": "1.5", "slow": "0.5", "invalid": "abc", "negative": "-2"} {
+		assert.NoError(t, indexer.Add(&apiv1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{testPerformanceLabel: factor}}}))
+	}
+	assert.NoError(t, indexer.Add(&apiv1.Node{ObjectMeta: metav1.ObjectMeta{Name: "unlabeled"}}))
+	normalizer := NewNodeLabelCPUNormalizer(v1lister.NewNodeLister(indexer), testPerformanceLabel)
+
+	testCases := []struct {
+		nodeName string
+		expected model.ResourceAmount
+	}{
+		{nodeName: "fast", expected: 150},
+		{nodeName: "slow", expected: 50},
+		{nodeName: "invalid", expected: 100},
+		{nodeName: "negative", expected: 100},
+		{nodeName: "unlabeled", expected: 100},
+		{nodeName: "missing", expected: 100},
+		{nodeName: "", expected: 100},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.nodeName, func(t *testing.T) {
+			assert.Equal(t, tc.expected, normalizer.Normalize(tc.nodeName, 100))
+		})
+	}
+}
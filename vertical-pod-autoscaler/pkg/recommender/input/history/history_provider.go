@@ -25,11 +25,11 @@ import (
 
 	"k8s.io/klog/v2"
 
-	promapi "github.com/prometheus/client_golang/api"
 	prometheusv1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	prommodel "github.com/prometheus/common/model"
 
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+	metrics_recommender "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/metrics/recommender"
 )
 
 // PrometheusHistoryProviderConfig allow to select which metrics
@@ -43,6 +43,14 @@ type PrometheusHistoryProviderConfig struct {
 	CtrNamespaceLabel, CtrPodNameLabel, CtrNameLabel string
 	CadvisorMetricsJobName                           string
 	Namespace                                        string
+	// ShardDuration splits the history window into ranges queried separately,
+	// each within QueryTimeout. Zero queries the whole window at once.
+	ShardDuration time.Duration
+	// CtrNodeNameLabel is the label of the container usage metrics holding
+	// the name of the node the container runs on. Empty doesn't read it.
+	CtrNodeNameLabel string
+	// ClientConfig holds the credentials and TLS settings of the connection.
+	ClientConfig PrometheusClientConfig
 }
 
 // PodHistory represents history of usage and labels for a given pod.
@@ -50,6 +58,8 @@ type PodHistory struct {
 	// Current samples if pod is still alive, last known samples otherwise.
 	LastLabels map[string]string
 	LastSeen   time.Time
+	// Name of the node the pod ran on, if known.
+	NodeName string
 	// A map for container name to a list of its usage samples, in chronological
 	// order.
 	Samples map[string][]model.ContainerUsageSample
@@ -72,13 +82,12 @@ type prometheusHistoryProvider struct {
 	queryTimeout      time.Duration
 	historyDuration   prommodel.Duration
 	historyResolution prommodel.Duration
+	shardDuration     time.Duration
 }
 
 // NewPrometheusHistoryProvider contructs a history provider that gets data from Prometheus.
 func NewPrometheusHistoryProvider(config PrometheusHistoryProviderConfig) (HistoryProvider, error) {
-	promClient, err := promapi.NewClient(promapi.Config{
-		Address: config.Address,
-	})
+	promClient, err := NewPrometheusClient(config.Address, config.ClientConfig)
 	if err != nil {
 		return &prometheusHistoryProvider{}, err
 	}
@@ -100,6 +109,7 @@ func NewPrometheusHistoryProvider(config PrometheusHistoryProviderConfig) (Histo
 		queryTimeout:      config.QueryTimeout,
 		historyDuration:   historyDuration,
 		historyResolution: historyResolution,
+		shardDuration:     config.ShardDuration,
 	}, nil
 }
 
@@ -182,18 +192,66 @@ func getContainerUsageSamplesFromSamples(samples []prommodel.SamplePair, resourc
 	return res
 }
 
-func (p *prometheusHistoryProvider) readResourceHistory(res map[model.PodID]*PodHistory, query string, resource model.ResourceName) error {
-	end := time.Now()
+// dropDuplicateSamples drops samples of a resource with the same timestamp as
+// a previous one, e.g. from a container scraped by two Prometheus jobs, so
+// that its usage isn't weighted twice. The samples must be sorted by time. It
+// returns the remaining samples and the number of dropped ones.
+func dropDuplicateSamples(samples []model.ContainerUsageSample) ([]model.ContainerUsageSample, int) {
+	type sampleKey struct {
+		resource model.ResourceName
+		time     time.Time
+	}
+	result := samples[:0]
+	seen := make(map[sampleKey]bool)
+	for i, sample := range samples {
+		// Samples at an earlier time can't be duplicates anymore.
+		if i > 0 && !sample.MeasureStart.Equal(samples[i-1].MeasureStart) {
+			seen = make(map[sampleKey]bool)
+		}
+		key := sampleKey{resource: sample.Resource, time: sample.MeasureStart}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, sample)
+	}
+	return result, len(samples) - len(result)
+}
+
+// queryRanges splits the history window ending at end into shards.
+func (p *prometheusHistoryProvider) queryRanges(end time.Time) []prometheusv1.Range {
 	start := end.Add(-time.Duration(p.historyDuration))
+	step := time.Duration(p.historyResolution)
+	if p.shardDuration <= 0 {
+		return []prometheusv1.Range{{Start: start, End: end, Step: step}}
+	}
+	var ranges []prometheusv1.Range
+	for shardStart := start; ; {
+		shardEnd := shardStart.Add(p.shardDuration)
+		if !shardEnd.Before(end) {
+			return append(ranges, prometheusv1.Range{Start: shardStart, End: end, Step: step})
+		}
+		ranges = append(ranges, prometheusv1.Range{Start: shardStart, End: shardEnd, Step: step})
+		// Range queries include both ends, start the next shard one step later
+		// to not read the sample at the shard boundary twice.
+		shardStart = shardEnd.Add(step)
+	}
+}
 
+func (p *prometheusHistoryProvider) readResourceHistory(res map[model.PodID]*PodHistory, query string, resource model.ResourceName) error {
+	for _, queryRange := range p.queryRanges(time.Now()) {
+		if err := p.readResourceHistoryRange(res, query, resource, queryRange); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *prometheusHistoryProvider) readResourceHistoryRange(res map[model.PodID]*PodHistory, query string, resource model.ResourceName, queryRange prometheusv1.Range) error {
 	ctx, cancel := context.WithTimeout(context.Background(), p.queryTimeout)
 	defer cancel()
 
-	result, _, err := p.prometheusClient.QueryRange(ctx, query, prometheusv1.Range{
-		Start: start,
-		End:   end,
-		Step:  time.Duration(p.historyResolution),
-	})
+	result, _, err := p.prometheusClient.QueryRange(ctx, query, queryRange)
 	if err != nil {
 		return fmt.Errorf("cannot get timeseries for %v: %v", resource, err)
 	}
@@ -215,6 +273,11 @@ func (p *prometheusHistoryProvider) readResourceHistory(res map[model.PodID]*Pod
 			podHistory = newEmptyHistory()
 			res[containerID.PodID] = podHistory
 		}
+		if p.config.CtrNodeNameLabel != "" {
+			if nodeName := string(ts.Metric[prommodel.LabelName(p.config.CtrNodeNameLabel)]); nodeName != "" {
+				podHistory.NodeName = nodeName
+			}
+		}
 		podHistory.Samples[containerID.ContainerName] = append(
 			podHistory.Samples[containerID.ContainerName],
 			newSamples...)
@@ -284,11 +347,19 @@ func (p *prometheusHistoryProvider) GetClusterHistory() (map[model.PodID]*PodHis
 	if err != nil {
 		return nil, fmt.Errorf("cannot get usage history: %v", err)
 	}
-	for _, podHistory := range res {
-		for _, samples := range podHistory.Samples {
+	duplicates := 0
+	for podID, podHistory := range res {
+		for containerName, samples := range podHistory.Samples {
 			sort.Slice(samples, func(i, j int) bool { return samples[i].MeasureStart.Before(samples[j].MeasureStart) })
+			var dropped int
+			podHistory.Samples[containerName], dropped = dropDuplicateSamples(samples)
+			if dropped > 0 {
+				klog.V(4).Infof("Dropped %d duplicate samples of container %s of pod %v", dropped, containerName, podID)
+			}
+			duplicates += dropped
 		}
 	}
+	metrics_recommender.RecordDuplicateUsageSamples("history", duplicates)
 	err = p.readLastLabels(res, p.config.PodLabelsMetricName)
 	if err != nil {
 		return nil, fmt.Errorf("cannot read last labels: %v", err)
@@ -345,3 +345,93 @@ func TestGetLabels(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, histories, map[model.PodID]*PodHistory{podID: podHistory})
 }
+
+func TestQueryRangesSharded(t *testing.T) {
+	historyProvider := prometheusHistoryProvider{
+		historyDuration:   prommodel.Duration(3 * 24 * time.Hour),
+		historyResolution: prommodel.Duration(time.Hour),
+		shardDuration:     24 * time.Hour,
+	}
+	end := time.Unix(1000000, 0)
+	start := end.Add(-3 * 24 * time.Hour)
+	assert.Equal(t, []prometheusv1.Range{
+		{Start: start, End: start.Add(24 * time.Hour), Step: time.Hour},
+		{Start: start.Add(25 * time.Hour), End: start.Add(49 * time.Hour), Step: time.Hour},
+		{Start: start.Add(50 * time.Hour), End: end, Step: time.Hour},
+	}, historyProvider.queryRanges(end))
+}
+
+func TestGetCPUSamplesSharded(t *testing.T) {
+	mockClient := mockPrometheusAPI{}
+	historyProvider := prometheusHistoryProvider{
+		config:            getDefaultPrometheusHistoryProviderConfigForTest(),
+		prometheusClient:  &mockClient,
+		historyDuration:   prommodel.Duration(2 * time.Hour),
+		historyResolution: prommodel.Duration(30 * time.Second),
+		shardDuration:     time.Hour,
+	}
+	containerMetric := map[prommodel.LabelName]prommodel.LabelValue{
+		"namespace": "default",
+		"pod_name":  "pod",
+		"name":      "container",
+	}
+	firstShard := mock.MatchedBy(func(r prometheusv1.Range) bool { return r.End.Sub(r.Start) == time.Hour })
+	lastShard := mock.MatchedBy(func(r prometheusv1.Range) bool { return r.End.Sub(r.Start) < time.Hour })
+	mockClient.On("QueryRange", mock.Anything, cpuQuery, firstShard).Return(
+		prommodel.Matrix{{Metric: containerMetric, Values: []prommodel.SamplePair{{Timestamp: prommodel.TimeFromUnix(1), Value: 1}}}}, nil)
+	mockClient.On("QueryRange", mock.Anything, cpuQuery, lastShard).Return(
+		prommodel.Matrix{{Metric: containerMetric, Values: []prommodel.SamplePair{{Timestamp: prommodel.TimeFromUnix(2), Value: 2}}}}, nil)
+	mockClient.On("QueryRange", mock.Anything, memoryQuery, mock.AnythingOfType("v1.Range")).Return(prommodel.Matrix{}, nil)
+	mockClient.On("Query", mock.Anything, labelsQuery, mock.AnythingOfType("time.Time")).Return(prommodel.Matrix{}, nil)
+
+	histories, err := historyProvider.GetClusterHistory()
+	assert.Nil(t, err)
+	samples := histories[model.PodID{Namespace: "default", PodName: "pod"}].Samples["container"]
+	assert.Equal(t, []model.ContainerUsageSample{
+		{MeasureStart: time.Unix(1, 0), Usage: model.CPUAmountFromCores(1), Resource: model.ResourceCPU},
+		{MeasureStart: time.Unix(2, 0), Usage: model.CPUAmountFromCores(2), Resource: model.ResourceCPU},
+	}, samples)
+	mockClient.AssertNumberOfCalls(t, "QueryRange", 4)
+}
+
+func TestDropDuplicateSamples(t *testing.T) {
+	cpuSample := func(second int64, cores float64) model.ContainerUsageSample {
+		return model.ContainerUsageSample{MeasureStart: time.Unix(second, 0), Usage: model.CPUAmountFromCores(cores), Resource: model.ResourceCPU}
+	}
+	memorySample := model.ContainerUsageSample{MeasureStart: time.Unix(1, 0), Usage: model.MemoryAmountFromBytes(1024), Resource: model.ResourceMemory}
+	// The container is scraped twice, the memory sample at the same time
+	// isn't a duplicate of the CPU sample.
+	samples, dropped := dropDuplicateSamples([]model.ContainerUsageSample{
+		cpuSample(1, 1), memorySample, cpuSample(1, 1.1), cpuSample(2, 2), cpuSample(2, 2),
+	})
+	assert.Equal(t, 2, dropped)
+	assert.Equal(t, []model.ContainerUsageSample{cpuSample(1, 1), memorySample, cpuSample(2, 2)}, samples)
+}
+
+func TestGetCPUSamplesNodeName(t *testing.T) {
+	mockClient := mockPrometheusAPI{}
+	config := getDefaultPrometheusHistoryProviderConfigForTest()
+	config.CtrNodeNameLabel = "instance"
+	historyProvider := prometheusHistoryProvider{
+		config:           config,
+		prometheusClient: &mockClient,
+	}
+	mockClient.On("QueryRange", mock.Anything, cpuQuery, mock.AnythingOfType("v1.Range")).Return().Return(
+		prommodel.Matrix{
+			{
+				Metric: map[prommodel.LabelName]prommodel.LabelValue{
+					"namespace": "default",
+					"pod_name":  "pod",
+					"name":      "container",
+					"instance":  "node-1",
+				},
+				Values: []prommodel.SamplePair{{Timestamp: prommodel.TimeFromUnix(1), Value: 5.5}},
+			},
+		},
+		nil)
+	mockClient.On("QueryRange", mock.Anything, memoryQuery, mock.AnythingOfType("v1.Range")).Return().Return(prommodel.Matrix{}, nil)
+	mockClient.On("Query", mock.Anything, labelsQuery, mock.AnythingOfType("time.Time")).Return(prommodel.Matrix{}, nil)
+	histories, err := historyProvider.GetClusterHistory()
+	assert.Nil(t, err)
+	assert.Equal(t, "node-1", histories[model.PodID{Namespace: "default", PodName: "pod"}].NodeName)
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package history
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	promapi "github.com/prometheus/client_golang/api"
+)
+
+// PrometheusClientConfig holds the credentials and TLS settings used to
+// connect to Prometheus. The zero value connects without authentication.
+// Secrets are only read from files, so that they don't show up in the
+// command line of the recommender.
+type PrometheusClientConfig struct {
+	// BearerTokenFile is read on every request and its content is sent in the
+	// Authorization header, so that the token can be rotated without
+	// restarting.
+	BearerTokenFile string
+	// Username and the content of PasswordFile, read on every request, are
+	// used for basic authentication.
+	Username, PasswordFile string
+	// CAFile verifies the certificate of the server instead of the system
+	// roots.
+	CAFile string
+	// CertFile and KeyFile are presented to the server as a client
+	// certificate.
+	CertFile, KeyFile string
+	// InsecureSkipVerify disables verification of the server certificate.
+	InsecureSkipVerify bool
+	// Headers are added to every request.
+	Headers map[string]string
+}
+
+// NewPrometheusClient creates a client of the Prometheus at the given address,
+// authenticating as set in the config.
+func NewPrometheusClient(address string, config PrometheusClientConfig) (promapi.Client, error) {
+	roundTripper, err := newPrometheusRoundTripper(config)
+	if err != nil {
+		return nil, err
+	}
+	return promapi.NewClient(promapi.Config{
+		Address:      address,
+		RoundTripper: roundTripper,
+	})
+}
+
+func newPrometheusRoundTripper(config PrometheusClientConfig) (http.RoundTripper, error) {
+	if config.BearerTokenFile != "" && config.Username != "" {
+		return nil, fmt.Errorf("at most one of bearer token and basic auth can be set")
+	}
+	if config.PasswordFile != "" && config.Username == "" {
+		return nil, fmt.Errorf("password file requires a username")
+	}
+	if (config.CertFile == "") != (config.KeyFile == "") {
+		return nil, fmt.Errorf("client certificate and key must be set together")
+	}
+
+	tlsConfig, err := newPrometheusTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	transport := promapi.DefaultRoundTripper.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &authRoundTripper{config: config, next: transport}, nil
+}
+
+func newPrometheusTLSConfig(config PrometheusClientConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+	if config.CAFile != "" {
+		caCert, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CA file %s: %v", config.CAFile, err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", config.CAFile)
+		}
+	}
+	if config.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// authRoundTripper adds the configured headers and credentials to requests.
+type authRoundTripper struct {
+	config PrometheusClientConfig
+	next   http.RoundTripper
+}
+
+func (rt *authRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the original request.
+	req = req.Clone(req.Context())
+	for name, value := range rt.config.Headers {
+		req.Header.Set(name, value)
+	}
+	if rt.config.BearerTokenFile != "" {
+		token, err := os.ReadFile(rt.config.BearerTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read bearer token file %s: %v", rt.config.BearerTokenFile, err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	} else if rt.config.Username != "" {
+		var password []byte
+		if rt.config.PasswordFile != "" {
+			var err error
+			password, err = os.ReadFile(rt.config.PasswordFile)
+			if err != nil {
+				return nil, fmt.Errorf("cannot read password file %s: %v", rt.config.PasswordFile, err)
+			}
+		}
+		req.SetBasicAuth(rt.config.Username, strings.TrimSpace(string(password)))
+	}
+	return rt.next.RoundTrip(req)
+}
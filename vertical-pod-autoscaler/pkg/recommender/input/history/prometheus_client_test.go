@@ -0,0 +1,115 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package history
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func doRequest(t *testing.T, address string, config PrometheusClientConfig) (*http.Response, error) {
+	client, err := NewPrometheusClient(address, config)
+	if !assert.NoError(t, err) {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, client.URL("/api/v1/query", nil).String(), nil)
+	assert.NoError(t, err)
+	resp, _, err := client.Do(context.Background(), req)
+	return resp, err
+}
+
+func TestPrometheusClientAuth(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, os.WriteFile(tokenFile, []byte("from-file\n"), 0600))
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	assert.NoError(t, os.WriteFile(passwordFile, []byte("pass\n"), 0600))
+
+	tests := []struct {
+		name              string
+		config            PrometheusClientConfig
+		wantAuthorization string
+	}{
+		{
+			name: "no auth",
+		},
+		{
+			name:              "bearer token file",
+			config:            PrometheusClientConfig{BearerTokenFile: tokenFile},
+			wantAuthorization: "Bearer from-file",
+		},
+		{
+			name:              "basic auth",
+			config:            PrometheusClientConfig{Username: "user", PasswordFile: passwordFile},
+			wantAuthorization: "Basic dXNlcjpwYXNz",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var got http.Header
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header
+			}))
+			defer server.Close()
+
+			tc.config.Headers = map[string]string{"X-Scope-OrgID": "tenant"}
+			_, err := doRequest(t, server.URL, tc.config)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantAuthorization, got.Get("Authorization"))
+			assert.Equal(t, "tenant", got.Get("X-Scope-OrgID"))
+		})
+	}
+}
+
+func TestPrometheusClientTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	assert.NoError(t, os.WriteFile(caFile, caCert, 0600))
+
+	_, err := doRequest(t, server.URL, PrometheusClientConfig{})
+	assert.Error(t, err, "server certificate shouldn't be trusted without the CA")
+
+	resp, err := doRequest(t, server.URL, PrometheusClientConfig{CAFile: caFile})
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	resp, err = doRequest(t, server.URL, PrometheusClientConfig{InsecureSkipVerify: true})
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+}
+
+func TestPrometheusClientInvalidConfig(t *testing.T) {
+	for _, config := range []PrometheusClientConfig{
+		{BearerTokenFile: "file", Username: "user"},
+		{PasswordFile: "file"},
+		{CertFile: "cert"},
+		{CAFile: filepath.Join(t.TempDir(), "missing")},
+	} {
+		_, err := NewPrometheusClient("http://localhost:9090", config)
+		assert.Error(t, err, "config %+v", config)
+	}
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package history
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// HistoryProviderFactory creates a HistoryProvider from the config.
+type HistoryProviderFactory func(config PrometheusHistoryProviderConfig) (HistoryProvider, error)
+
+var (
+	providerFactoriesLock sync.Mutex
+	providerFactories     = make(map[string]HistoryProviderFactory)
+)
+
+// RegisterHistoryProvider makes a HistoryProvider available under the given
+// name, e.g. as a value of the recommender's --storage flag. It panics if the
+// name is already registered.
+func RegisterHistoryProvider(name string, factory HistoryProviderFactory) {
+	providerFactoriesLock.Lock()
+	defer providerFactoriesLock.Unlock()
+	if _, found := providerFactories[name]; found {
+		panic(fmt.Sprintf("history provider %q is already registered", name))
+	}
+	providerFactories[name] = factory
+}
+
+// NewHistoryProvider creates the HistoryProvider registered under the given name.
+func NewHistoryProvider(name string, config PrometheusHistoryProviderConfig) (HistoryProvider, error) {
+	providerFactoriesLock.Lock()
+	factory, found := providerFactories[name]
+	providerFactoriesLock.Unlock()
+	if !found {
+		return nil, fmt.Errorf("unknown history provider %q, registered providers: %v", name, RegisteredHistoryProviders())
+	}
+	return factory(config)
+}
+
+// RegisteredHistoryProviders returns the sorted names of registered history providers.
+func RegisteredHistoryProviders() []string {
+	providerFactoriesLock.Lock()
+	defer providerFactoriesLock.Unlock()
+	names := make([]string, 0, len(providerFactories))
+	for name := range providerFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,43 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package history
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewHistoryProvider(t *testing.T) {
+	assert.Equal(t, []string{PrometheusProviderName, ShardedPrometheusProviderName}, RegisteredHistoryProviders())
+
+	config := getDefaultPrometheusHistoryProviderConfigForTest()
+	provider, err := NewHistoryProvider(ShardedPrometheusProviderName, config)
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultShardDuration, provider.(*prometheusHistoryProvider).shardDuration)
+
+	provider, err = NewHistoryProvider(PrometheusProviderName, config)
+	assert.NoError(t, err)
+	assert.Zero(t, provider.(*prometheusHistoryProvider).shardDuration)
+
+	_, err = NewHistoryProvider("unknown", config)
+	assert.Error(t, err)
+}
+
+func TestRegisterHistoryProviderTwicePanics(t *testing.T) {
+	assert.Panics(t, func() { RegisterHistoryProvider(PrometheusProviderName, NewPrometheusHistoryProvider) })
+}
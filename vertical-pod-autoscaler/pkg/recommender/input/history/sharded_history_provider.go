@@ -0,0 +1,53 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package history
+
+import (
+	"time"
+)
+
+const (
+	// PrometheusProviderName is the name of the history provider querying Prometheus.
+	PrometheusProviderName = "prometheus"
+	// ShardedPrometheusProviderName is the name of the history provider
+	// querying the Prometheus query API in shards of the history window, for
+	// long term storage like Thanos Query, Cortex or VictoriaMetrics. It
+	// doesn't use the Prometheus remote read protocol.
+	ShardedPrometheusProviderName = "sharded-prometheus"
+
+	// DefaultShardDuration is the default length of the time range queried
+	// at once by the sharded Prometheus history provider.
+	DefaultShardDuration = 24 * time.Hour
+)
+
+func init() {
+	RegisterHistoryProvider(PrometheusProviderName, NewPrometheusHistoryProvider)
+	RegisterHistoryProvider(ShardedPrometheusProviderName, NewShardedPrometheusHistoryProvider)
+}
+
+// NewShardedPrometheusHistoryProvider constructs a history provider that gets
+// data through the Prometheus query API, splitting the history window into
+// shards of config.ShardDuration, DefaultShardDuration if unset, each queried
+// with query_range separately within config.QueryTimeout, so that queries of
+// long term storage don't time out on the whole window and can be split by
+// its query frontend.
+func NewShardedPrometheusHistoryProvider(config PrometheusHistoryProviderConfig) (HistoryProvider, error) {
+	if config.ShardDuration <= 0 {
+		config.ShardDuration = DefaultShardDuration
+	}
+	return NewPrometheusHistoryProvider(config)
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package input
+
+import (
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+	"k8s.io/client-go/informers"
+	kube_client "k8s.io/client-go/kubernetes"
+	v1lister "k8s.io/client-go/listers/core/v1"
+	klog "k8s.io/klog/v2"
+)
+
+const (
+	// MarginFractionAnnotation is the VPA annotation overriding the safety
+	// margin of its recommendations.
+	MarginFractionAnnotation = "vpa-recommender.k8s.io/recommendation-margin-fraction"
+	// MarginFractionConfigMapKey is the key of the namespace ConfigMap
+	// overriding the safety margin of recommendations of VPAs in the namespace.
+	MarginFractionConfigMapKey = "recommendationMarginFraction"
+)
+
+// MarginResolver resolves the safety margin added to recommendations of a VPA.
+type MarginResolver interface {
+	// MarginFraction returns the safety margin fraction of the VPA and true,
+	// or false if the VPA should use the default margin.
+	MarginFraction(vpa *model.Vpa) (float64, bool)
+}
+
+type marginResolver struct {
+	// Nil if namespace overrides are disabled.
+	configMapLister v1lister.ConfigMapLister
+	configMapName   string
+}
+
+// NewMarginResolver returns a MarginResolver which takes the margin from the
+// VPA annotation, then from the ConfigMap with the given name in the namespace
+// of the VPA. If configMapLister is nil, only VPA annotations are used.
+func NewMarginResolver(configMapLister v1lister.ConfigMapLister, configMapName string) MarginResolver {
+	return &marginResolver{
+		configMapLister: configMapLister,
+		configMapName:   configMapName,
+	}
+}
+
+// NewConfigMapMarginResolver returns a MarginResolver watching ConfigMaps with
+// the given name. If configMapName is empty, only VPA annotations are used.
+func NewConfigMapMarginResolver(kubeClient kube_client.Interface, namespace, configMapName string) MarginResolver {
+	if configMapName == "" {
+		return NewMarginResolver(nil, "")
+	}
+	return NewMarginResolver(newConfigMapLister(kubeClient, namespace, configMapName), configMapName)
+}
+
+func newConfigMapLister(kubeClient kube_client.Interface, namespace, configMapName string) v1lister.ConfigMapLister {
+	factory := informers.NewSharedInformerFactoryWithOptions(kubeClient, defaultResyncPeriod,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", configMapName).String()
+		}))
+	configMapLister := factory.Core().V1().ConfigMaps().Lister()
+	stopCh := make(chan struct{})
+	factory.Start(stopCh)
+	for informerType, synced := range factory.WaitForCacheSync(stopCh) {
+		if !synced {
+			klog.Warningf("Could not sync cache for %s", informerType)
+		}
+	}
+	return configMapLister
+}
+
+func (r *marginResolver) MarginFraction(vpa *model.Vpa) (float64, bool) {
+	if value, found := vpa.Annotations[MarginFractionAnnotation]; found {
+		if fraction, ok := parseMarginFraction(value); ok {
+			return fraction, true
+		}
+		klog.Warningf("Invalid safety margin %q in annotation of VPA %s/%s", value, vpa.ID.Namespace, vpa.ID.VpaName)
+	}
+	if r.configMapLister == nil {
+		return 0, false
+	}
+	configMap, err := r.configMapLister.ConfigMaps(vpa.ID.Namespace).Get(r.configMapName)
+	if err != nil {
+		return 0, false
+	}
+	value, found := configMap.Data[MarginFractionConfigMapKey]
+	if !found {
+		return 0, false
+	}
+	if fraction, ok := parseMarginFraction(value); ok {
+		return fraction, true
+	}
+	klog.Warningf("Invalid safety margin %q in ConfigMap %s/%s", value, vpa.ID.Namespace, r.configMapName)
+	return 0, false
+}
+
+func parseMarginFraction(value string) (float64, bool) {
+	fraction, err := strconv.ParseFloat(value, 64)
+	if err != nil || fraction < 0 {
+		return 0, false
+	}
+	return fraction, true
+}
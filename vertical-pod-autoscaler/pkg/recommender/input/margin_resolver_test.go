@@ -0,0 +1,68 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package input
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+	v1lister "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const testMarginConfigMap = "vpa-recommendation-margin"
+
+func TestMarginResolver(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for namespace, margin := range map[string]string{"overridden": "0.3", "invalid": "abc"} {
+		assert.NoError(t, indexer.Add(&apiv1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: testMarginConfigMap},
+			Data:       map[string]string{MarginFractionConfigMapKey: margin},
+		}))
+	}
+	resolver := NewMarginResolver(v1lister.NewConfigMapLister(indexer), testMarginConfigMap)
+
+	testCases := []struct {
+		name           string
+		namespace      string
+		annotation     string
+		expectedFound  bool
+		expectedMargin float64
+	}{
+		{name: "no overrides", namespace: "default"},
+		{name: "namespace override", namespace: "overridden", expectedFound: true, expectedMargin: 0.3},
+		{name: "invalid namespace override", namespace: "invalid"},
+		{name: "VPA override", namespace: "default", annotation: "0.5", expectedFound: true, expectedMargin: 0.5},
+		{name: "VPA override over namespace", namespace: "overridden", annotation: "0", expectedFound: true, expectedMargin: 0},
+		{name: "invalid VPA override falls back to namespace", namespace: "overridden", annotation: "-1", expectedFound: true, expectedMargin: 0.3},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			vpa := model.NewVpa(model.VpaID{Namespace: tc.namespace, VpaName: "vpa"}, nil, time.Unix(0, 0))
+			if tc.annotation != "" {
+				vpa.Annotations = map[string]string{MarginFractionAnnotation: tc.annotation}
+			}
+			margin, found := resolver.MarginFraction(vpa)
+			assert.Equal(t, tc.expectedFound, found)
+			assert.Equal(t, tc.expectedMargin, margin)
+		})
+	}
+}
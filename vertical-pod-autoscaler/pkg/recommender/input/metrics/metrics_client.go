@@ -48,6 +48,16 @@ type MetricsClient interface {
 	GetContainersMetrics() ([]*ContainerMetricsSnapshot, error)
 }
 
+// NamespacedMetricsClient is a MetricsClient which can limit the metrics it
+// returns to a set of namespaces.
+type NamespacedMetricsClient interface {
+	MetricsClient
+	// GetContainersMetricsInNamespaces returns ContainerMetricsSnapshots of
+	// the running containers in the given namespaces, with one query per
+	// namespace.
+	GetContainersMetricsInNamespaces(namespaces []string) ([]*ContainerMetricsSnapshot, error)
+}
+
 type metricsClient struct {
 	metricsGetter resourceclient.PodMetricsesGetter
 	namespace     string
@@ -66,15 +76,39 @@ func NewMetricsClient(metricsGetter resourceclient.PodMetricsesGetter, namespace
 }
 
 func (c *metricsClient) GetContainersMetrics() ([]*ContainerMetricsSnapshot, error) {
+	return c.getContainersMetrics(c.namespace, nil)
+}
+
+func (c *metricsClient) GetContainersMetricsInNamespaces(namespaces []string) ([]*ContainerMetricsSnapshot, error) {
 	var metricsSnapshots []*ContainerMetricsSnapshot
+	for _, namespace := range namespaces {
+		// Namespaces outside of the namespace of the client aren't queried.
+		if c.namespace != k8sapiv1.NamespaceAll && c.namespace != namespace {
+			continue
+		}
+		var err error
+		metricsSnapshots, err = c.getContainersMetrics(namespace, metricsSnapshots)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return metricsSnapshots, nil
+}
 
-	podMetricsInterface := c.metricsGetter.PodMetricses(c.namespace)
+// getContainersMetrics appends snapshots of the containers in the namespace
+// to metricsSnapshots.
+func (c *metricsClient) getContainersMetrics(namespace string, metricsSnapshots []*ContainerMetricsSnapshot) ([]*ContainerMetricsSnapshot, error) {
+	podMetricsInterface := c.metricsGetter.PodMetricses(namespace)
 	podMetricsList, err := podMetricsInterface.List(context.TODO(), metav1.ListOptions{})
 	recommender_metrics.RecordMetricsServerResponse(err, c.clientName)
 	if err != nil {
 		return nil, err
 	}
-	klog.V(3).Infof("%v podMetrics retrieved for all namespaces", len(podMetricsList.Items))
+	if namespace == k8sapiv1.NamespaceAll {
+		klog.V(3).Infof("%v podMetrics retrieved for all namespaces", len(podMetricsList.Items))
+	} else {
+		klog.V(3).Infof("%v podMetrics retrieved for namespace %s", len(podMetricsList.Items), namespace)
+	}
 	for _, podMetrics := range podMetricsList.Items {
 		metricsSnapshotsForPod := createContainerMetricsSnapshots(podMetrics)
 		metricsSnapshots = append(metricsSnapshots, metricsSnapshotsForPod...)
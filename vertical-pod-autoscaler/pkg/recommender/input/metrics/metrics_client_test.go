@@ -20,6 +20,9 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/runtime"
+	core "k8s.io/client-go/testing"
+	"k8s.io/metrics/pkg/client/clientset/versioned/fake"
 )
 
 func TestGetContainersMetricsReturnsEmptyList(t *testing.T) {
@@ -44,3 +47,26 @@ func TestGetContainersMetricsReturnsResults(t *testing.T) {
 		assert.Contains(t, tc.getAllSnaps(), snap, "One of returned ContainerMetricsSnapshot is different then expected ")
 	}
 }
+
+func TestGetContainersMetricsInNamespaces(t *testing.T) {
+	tc := newMetricsClientTestCase()
+	var namespaces []string
+	fakeMetricsGetter := &fake.Clientset{}
+	fakeMetricsGetter.AddReactor("list", "pods", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+		namespaces = append(namespaces, action.GetNamespace())
+		return true, tc.getFakePodMetricsList(), nil
+	})
+	client := NewMetricsClient(fakeMetricsGetter.MetricsV1beta1(), "", "fake").(NamespacedMetricsClient)
+
+	snapshots, err := client.GetContainersMetricsInNamespaces([]string{"namespace-1", "namespace-2"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"namespace-1", "namespace-2"}, namespaces)
+	assert.Len(t, snapshots, 2*len(tc.getAllSnaps()))
+
+	// Namespaces outside of the namespace of the client aren't queried.
+	namespaces = nil
+	client = NewMetricsClient(fakeMetricsGetter.MetricsV1beta1(), "namespace-2", "fake").(NamespacedMetricsClient)
+	_, err = client.GetContainersMetricsInNamespaces([]string{"namespace-1", "namespace-2"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"namespace-2"}, namespaces)
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	klog "k8s.io/klog/v2"
+)
+
+// PodMetricsSnapshot contains the usage of a pod as a whole, as measured on
+// its cgroup, at a point in time.
+type PodMetricsSnapshot struct {
+	ID           model.PodID
+	SnapshotTime time.Time
+	Usage        model.Resources
+}
+
+// PodMetricsClient provides metrics on resources usage on pod level.
+type PodMetricsClient interface {
+	// GetPodsMetrics returns PodMetricsSnapshots of the pods running on
+	// the given nodes.
+	GetPodsMetrics(nodes []string) ([]*PodMetricsSnapshot, error)
+}
+
+// summaryGetter returns the kubelet stats summary of a node.
+type summaryGetter func(ctx context.Context, node string) ([]byte, error)
+
+type kubeletSummaryClient struct {
+	getSummary summaryGetter
+}
+
+// NewKubeletSummaryClient creates a PodMetricsClient reading the stats
+// summary of kubelets through the API server node proxy.
+func NewKubeletSummaryClient(coreClient corev1.CoreV1Interface) PodMetricsClient {
+	return &kubeletSummaryClient{
+		getSummary: func(ctx context.Context, node string) ([]byte, error) {
+			return coreClient.RESTClient().Get().Resource("nodes").Name(node).SubResource("proxy").Suffix("stats/summary").Do(ctx).Raw()
+		},
+	}
+}
+
+func (c *kubeletSummaryClient) GetPodsMetrics(nodes []string) ([]*PodMetricsSnapshot, error) {
+	var snapshots []*PodMetricsSnapshot
+	for _, node := range nodes {
+		data, err := c.getSummary(context.TODO(), node)
+		if err != nil {
+			// Pods of other nodes can still be measured.
+			klog.Warningf("Cannot get stats summary of node %s: %v", node, err)
+			continue
+		}
+		nodeSnapshots, err := parseSummary(data)
+		if err != nil {
+			klog.Warningf("Cannot parse stats summary of node %s: %v", node, err)
+			continue
+		}
+		snapshots = append(snapshots, nodeSnapshots...)
+	}
+	return snapshots, nil
+}
+
+// summary holds the fields of the kubelet stats summary used by the
+// recommender.
+type summary struct {
+	Pods []struct {
+		PodRef struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"podRef"`
+		CPU *struct {
+			Time           time.Time `json:"time"`
+			UsageNanoCores *uint64   `json:"usageNanoCores"`
+		} `json:"cpu"`
+		Memory *struct {
+			Time            time.Time `json:"time"`
+			WorkingSetBytes *uint64   `json:"workingSetBytes"`
+		} `json:"memory"`
+	} `json:"pods"`
+}
+
+func parseSummary(data []byte) ([]*PodMetricsSnapshot, error) {
+	var nodeSummary summary
+	if err := json.Unmarshal(data, &nodeSummary); err != nil {
+		return nil, err
+	}
+	snapshots := make([]*PodMetricsSnapshot, 0, len(nodeSummary.Pods))
+	for _, pod := range nodeSummary.Pods {
+		// Pods without both CPU and memory usage are skipped, like
+		// metrics-server does.
+		if pod.CPU == nil || pod.CPU.UsageNanoCores == nil || pod.Memory == nil || pod.Memory.WorkingSetBytes == nil {
+			continue
+		}
+		snapshots = append(snapshots, &PodMetricsSnapshot{
+			ID:           model.PodID{Namespace: pod.PodRef.Namespace, PodName: pod.PodRef.Name},
+			SnapshotTime: pod.CPU.Time,
+			Usage: model.Resources{
+				model.ResourceCPU:    model.CPUAmountFromCores(float64(*pod.CPU.UsageNanoCores) / 1e9),
+				model.ResourceMemory: model.MemoryAmountFromBytes(float64(*pod.Memory.WorkingSetBytes)),
+			},
+		})
+	}
+	return snapshots, nil
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+)
+
+const testSummary = `{
+  "node": {"nodeName": "node-1"},
+  "pods": [
+    {
+      "podRef": {"name": "pod-1", "namespace": "default"},
+      "cpu": {"time": "2022-05-01T10:00:00Z", "usageNanoCores": 1500000000},
+      "memory": {"time": "2022-05-01T10:00:00Z", "workingSetBytes": 1048576}
+    },
+    {
+      "podRef": {"name": "pod-2", "namespace": "default"},
+      "cpu": {"time": "2022-05-01T10:00:00Z"}
+    }
+  ]
+}`
+
+func TestGetPodsMetrics(t *testing.T) {
+	var nodes []string
+	client := &kubeletSummaryClient{
+		getSummary: func(ctx context.Context, node string) ([]byte, error) {
+			nodes = append(nodes, node)
+			if node == "node-2" {
+				return nil, fmt.Errorf("node unreachable")
+			}
+			return []byte(testSummary), nil
+		},
+	}
+
+	snapshots, err := client.GetPodsMetrics([]string{"node-1", "node-2"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"node-1", "node-2"}, nodes)
+	// pod-2 has no usage, node-2 is skipped.
+	assert.Equal(t, []*PodMetricsSnapshot{{
+		ID:           model.PodID{Namespace: "default", PodName: "pod-1"},
+		SnapshotTime: time.Date(2022, time.May, 1, 10, 0, 0, 0, time.UTC),
+		Usage: model.Resources{
+			model.ResourceCPU:    model.CPUAmountFromCores(1.5),
+			model.ResourceMemory: model.MemoryAmountFromBytes(1048576),
+		},
+	}}, snapshots)
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oom
+
+import (
+	"golang.org/x/time/rate"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	kube_client "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+// EventSourceConfig configures how eviction events are consumed.
+type EventSourceConfig struct {
+	// Workers is the number of goroutines processing events in parallel.
+	Workers int
+	// QPS and Burst limit the rate at which events are processed.
+	QPS   float64
+	Burst int
+}
+
+// DefaultEventSourceConfig returns the default configuration of the event source.
+func DefaultEventSourceConfig() EventSourceConfig {
+	return EventSourceConfig{
+		Workers: 2,
+		QPS:     50,
+		Burst:   100,
+	}
+}
+
+// eventSource feeds eviction events from an informer to the observer. Events
+// are queued by the informer and processed by a pool of workers at a limited
+// rate, so bursts of events don't block the informer and don't flood the
+// observer.
+type eventSource struct {
+	observer Observer
+	queue    workqueue.RateLimitingInterface
+	workers  int
+}
+
+// WatchEvictionEvents starts an informer on Events with reason=Evicted and
+// passes them to the observer until stopCh is closed.
+func WatchEvictionEvents(kubeClient kube_client.Interface, observer Observer, namespace string, config EventSourceConfig, stopCh <-chan struct{}) {
+	selector := fields.OneTermEqualSelector("reason", "Evicted")
+	eventListWatch := cache.NewListWatchFromClient(kubeClient.CoreV1().RESTClient(), "events", namespace, selector)
+	informer := cache.NewSharedIndexInformer(eventListWatch, &apiv1.Event{}, 0, cache.Indexers{})
+
+	source := newEventSource(observer, config)
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: source.enqueue,
+	})
+	go informer.Run(stopCh)
+	source.run(stopCh)
+}
+
+func newEventSource(observer Observer, config EventSourceConfig) *eventSource {
+	limiter := &workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(config.QPS), config.Burst)}
+	workers := config.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	return &eventSource{
+		observer: observer,
+		queue:    workqueue.NewNamedRateLimitingQueue(limiter, "oom-events"),
+		workers:  workers,
+	}
+}
+
+func (s *eventSource) enqueue(obj interface{}) {
+	event, ok := obj.(*apiv1.Event)
+	if !ok {
+		klog.Errorf("OOM event source received invalid object: %v", obj)
+		return
+	}
+	s.queue.AddRateLimited(event)
+}
+
+func (s *eventSource) run(stopCh <-chan struct{}) {
+	for i := 0; i < s.workers; i++ {
+		go s.worker()
+	}
+	go func() {
+		<-stopCh
+		s.queue.ShutDown()
+	}()
+}
+
+func (s *eventSource) worker() {
+	for s.processNextEvent() {
+	}
+}
+
+func (s *eventSource) processNextEvent() bool {
+	item, shutdown := s.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer s.queue.Done(item)
+	// Events are never retried, so there is no rate limiting history to keep.
+	defer s.queue.Forget(item)
+	s.observer.OnEvent(item.(*apiv1.Event))
+	return true
+}
@@ -0,0 +1,204 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oom
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	prometheusv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	prommodel "github.com/prometheus/common/model"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/input/history"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+	metrics_recommender "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/metrics/recommender"
+	v1lister "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// KmsgSourceConfig configures detection of OOM kills from a node-level
+// exporter which turns kernel log OOM messages into a Prometheus counter.
+type KmsgSourceConfig struct {
+	// Address of the Prometheus server scraping the exporter.
+	Address string
+	// MetricName is the name of the counter incremented on every OOM kill.
+	MetricName string
+	// Labels of the counter identifying the killed container.
+	NamespaceLabel, PodNameLabel, ContainerNameLabel string
+	// PollInterval is how often Prometheus is queried.
+	PollInterval time.Duration
+	QueryTimeout time.Duration
+	// ClientConfig holds the credentials and TLS settings of the connection.
+	ClientConfig history.PrometheusClientConfig
+}
+
+// kmsgSource polls Prometheus for containers whose OOM kill counter increased
+// since the last poll and passes them to the observer. OOM kills are reported
+// with the memory request of the container, as in the pod update path, and
+// the time of the first scrape of the counter showing the increase, so that
+// they are deduplicated with the same OOM kills reported by other sources.
+type kmsgSource struct {
+	prometheusClient prometheusv1.API
+	podLister        v1lister.PodLister
+	observer         Observer
+	config           KmsgSourceConfig
+	// lastSamples holds the newest sample of every counter series at the
+	// last poll, nil before the first one. Comparing with them, rather than
+	// querying increase() over consecutive windows, counts every OOM kill
+	// once.
+	lastSamples map[prommodel.Fingerprint]prommodel.SamplePair
+}
+
+// WatchKmsgOoms starts polling Prometheus for kernel OOM kills and passes them
+// to the observer until stopCh is closed.
+func WatchKmsgOoms(config KmsgSourceConfig, podLister v1lister.PodLister, observer Observer, stopCh <-chan struct{}) error {
+	promClient, err := history.NewPrometheusClient(config.Address, config.ClientConfig)
+	if err != nil {
+		return fmt.Errorf("cannot create Prometheus client for kmsg OOM source: %v", err)
+	}
+	source := &kmsgSource{
+		prometheusClient: prometheusv1.NewAPI(promClient),
+		podLister:        podLister,
+		observer:         observer,
+		config:           config,
+	}
+	go wait.Until(source.poll, config.PollInterval, stopCh)
+	return nil
+}
+
+// query returns the raw samples of the counter over twice the poll interval,
+// not to miss samples if a poll is late.
+func (s *kmsgSource) query() string {
+	return fmt.Sprintf("%s[%s]", s.config.MetricName, prommodel.Duration(2*s.config.PollInterval))
+}
+
+func (s *kmsgSource) poll() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.QueryTimeout)
+	defer cancel()
+	result, _, err := s.prometheusClient.Query(ctx, s.query(), time.Now())
+	if err != nil {
+		klog.Errorf("Cannot query Prometheus for kernel OOM kills: %v", err)
+		return
+	}
+	matrix, ok := result.(prommodel.Matrix)
+	if !ok {
+		klog.Errorf("Unexpected result type %v of kernel OOM kills query", result.Type())
+		return
+	}
+	s.report(matrix)
+}
+
+// report passes the OOM kills counted in the matrix since the last poll to
+// the observer.
+func (s *kmsgSource) report(matrix prommodel.Matrix) {
+	for _, oomInfo := range s.parseSamples(s.increasedSamples(matrix)) {
+		metrics_recommender.RecordOomObservation(oomSourceKmsg)
+		s.observer.OnOom(oomInfo)
+	}
+}
+
+// increasedSamples returns, for every counter series which increased since
+// the last poll, the first sample showing the increase, and remembers the
+// newest sample of all series for the next poll. Series which appeared with a
+// positive value, or were reset to one, count as increased. On the first poll,
+// no series does, as OOM kills counted so far may have happened long ago.
+func (s *kmsgSource) increasedSamples(matrix prommodel.Matrix) prommodel.Vector {
+	lastSamples := make(map[prommodel.Fingerprint]prommodel.SamplePair, len(matrix))
+	increased := make(prommodel.Vector, 0)
+	for _, stream := range matrix {
+		if len(stream.Values) == 0 {
+			continue
+		}
+		fingerprint := stream.Metric.Fingerprint()
+		lastSamples[fingerprint] = stream.Values[len(stream.Values)-1]
+		if s.lastSamples == nil {
+			continue
+		}
+		last := s.lastSamples[fingerprint]
+		for _, pair := range stream.Values {
+			if pair.Timestamp <= last.Timestamp {
+				continue
+			}
+			if pair.Value > 0 && pair.Value != last.Value {
+				increased = append(increased, &prommodel.Sample{Metric: stream.Metric, Value: pair.Value, Timestamp: pair.Timestamp})
+				break
+			}
+			last = pair
+		}
+	}
+	s.lastSamples = lastSamples
+	return increased
+}
+
+func (s *kmsgSource) parseSamples(vector prommodel.Vector) []OomInfo {
+	result := make([]OomInfo, 0, len(vector))
+	for _, sample := range vector {
+		containerID, err := s.getContainerIDFromLabels(sample.Metric)
+		if err != nil {
+			klog.Warningf("Skipping kernel OOM kill sample %v: %v", sample.Metric, err)
+			continue
+		}
+		memory, err := s.getContainerMemoryRequest(containerID)
+		if err != nil {
+			klog.V(3).Infof("Skipping kernel OOM kill of %+v: %v", containerID, err)
+			continue
+		}
+		result = append(result, OomInfo{
+			Timestamp:   sample.Timestamp.Time().UTC(),
+			Memory:      memory,
+			ContainerID: containerID,
+		})
+	}
+	return result
+}
+
+func (s *kmsgSource) getContainerIDFromLabels(metric prommodel.Metric) (model.ContainerID, error) {
+	namespace, ok := metric[prommodel.LabelName(s.config.NamespaceLabel)]
+	if !ok {
+		return model.ContainerID{}, fmt.Errorf("no %s label", s.config.NamespaceLabel)
+	}
+	podName, ok := metric[prommodel.LabelName(s.config.PodNameLabel)]
+	if !ok {
+		return model.ContainerID{}, fmt.Errorf("no %s label", s.config.PodNameLabel)
+	}
+	containerName, ok := metric[prommodel.LabelName(s.config.ContainerNameLabel)]
+	if !ok {
+		return model.ContainerID{}, fmt.Errorf("no %s label", s.config.ContainerNameLabel)
+	}
+	return model.ContainerID{
+		PodID: model.PodID{
+			Namespace: string(namespace),
+			PodName:   string(podName),
+		},
+		ContainerName: string(containerName),
+	}, nil
+}
+
+func (s *kmsgSource) getContainerMemoryRequest(containerID model.ContainerID) (model.ResourceAmount, error) {
+	pod, err := s.podLister.Pods(containerID.PodID.Namespace).Get(containerID.PodID.PodName)
+	if err != nil {
+		return 0, err
+	}
+	spec := findSpec(containerID.ContainerName, pod.Spec.Containers)
+	if spec == nil {
+		return 0, fmt.Errorf("container not found in pod spec")
+	}
+	memory := spec.Resources.Requests[apiv1.ResourceMemory]
+	return model.ResourceAmount(memory.Value()), nil
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oom
+
+import (
+	"testing"
+	"time"
+
+	prommodel "github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+	v1lister "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func samples(values ...interface{}) []prommodel.SamplePair {
+	pairs := make([]prommodel.SamplePair, 0, len(values)/2)
+	for i := 0; i < len(values); i += 2 {
+		pairs = append(pairs, prommodel.SamplePair{Timestamp: prommodel.Time(values[i].(int) * 1000), Value: prommodel.SampleValue(values[i+1].(int))})
+	}
+	return pairs
+}
+
+func TestKmsgSourceIncreasedSamples(t *testing.T) {
+	series1 := prommodel.Metric{"namespace": "ns", "pod": "pod", "container": "c1"}
+	series2 := prommodel.Metric{"namespace": "ns", "pod": "pod", "container": "c2"}
+	series3 := prommodel.Metric{"namespace": "ns", "pod": "pod", "container": "c3"}
+	source := &kmsgSource{}
+
+	// OOM kills counted before the first poll are not reported.
+	assert.Empty(t, source.increasedSamples(prommodel.Matrix{{Metric: series1, Values: samples(0, 1, 15, 2)}}))
+	// Samples seen by the last poll, and unchanged counters, are not reported again.
+	assert.Empty(t, source.increasedSamples(prommodel.Matrix{{Metric: series1, Values: samples(0, 1, 15, 2, 30, 2, 45, 2)}}))
+	// The first sample showing the increase is reported.
+	assert.Equal(t, prommodel.Vector{{Metric: series1, Value: 3, Timestamp: 60000}, {Metric: series2, Value: 1, Timestamp: 75000}},
+		source.increasedSamples(prommodel.Matrix{
+			{Metric: series1, Values: samples(30, 2, 45, 2, 60, 3, 75, 4)},
+			{Metric: series2, Values: samples(75, 1)},
+			{Metric: series3, Values: samples(75, 0)},
+		}))
+	// Counter resets.
+	assert.Equal(t, prommodel.Vector{{Metric: series1, Value: 1, Timestamp: 90000}},
+		source.increasedSamples(prommodel.Matrix{
+			{Metric: series1, Values: samples(75, 4, 90, 1)},
+			{Metric: series2, Values: samples(75, 1, 90, 0)},
+		}))
+}
+
+// Verifies that an OOM kill reported by pod status updates and, on a later
+// poll, by the kernel log counter is counted once.
+func TestKmsgSourceDeduplicatedWithPodUpdates(t *testing.T) {
+	p1, err := newPod(pod1Yaml)
+	assert.NoError(t, err)
+	p2, err := newPod(pod2Yaml)
+	assert.NoError(t, err)
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	assert.NoError(t, indexer.Add(p2))
+	observer := NewObserver()
+	source := &kmsgSource{
+		podLister: v1lister.NewPodLister(indexer),
+		observer:  observer,
+		config: KmsgSourceConfig{
+			NamespaceLabel:     "namespace",
+			PodNameLabel:       "pod",
+			ContainerNameLabel: "container",
+			PollInterval:       30 * time.Second,
+		},
+	}
+	series := prommodel.Metric{"namespace": "mockNamespace", "pod": "Pod1", "container": "Name11"}
+	killed, err := time.Parse(time.RFC3339, "2018-02-23T13:38:48Z")
+	assert.NoError(t, err)
+	scraped := func(after time.Duration) prommodel.SamplePair {
+		return prommodel.SamplePair{Timestamp: prommodel.TimeFromUnixNano(killed.Add(after).UnixNano()), Value: 1}
+	}
+
+	source.report(prommodel.Matrix{{Metric: series, Values: []prommodel.SamplePair{{Timestamp: prommodel.TimeFromUnixNano(killed.Add(-15 * time.Second).UnixNano())}}}})
+	observer.OnUpdate(p1, p2)
+	assert.Len(t, observer.observedOomsChannel, 1)
+	// The poll runs long after the dedup window, but the OOM kill is reported
+	// with the time of the scrape.
+	source.report(prommodel.Matrix{{Metric: series, Values: []prommodel.SamplePair{scraped(5 * time.Second), scraped(20 * time.Second)}}})
+	assert.Len(t, observer.observedOomsChannel, 1)
+}
+
+func TestKmsgSourceParseSamples(t *testing.T) {
+	pod, err := newPod(pod1Yaml)
+	assert.NoError(t, err)
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	assert.NoError(t, indexer.Add(pod))
+
+	source := &kmsgSource{
+		podLister: v1lister.NewPodLister(indexer),
+		config: KmsgSourceConfig{
+			NamespaceLabel:     "namespace",
+			PodNameLabel:       "pod",
+			ContainerNameLabel: "container",
+		},
+	}
+	timestamp := time.Unix(1000, 0)
+	vector := prommodel.Vector{
+		{Metric: prommodel.Metric{"namespace": "mockNamespace", "pod": "Pod1", "container": "Name11"}, Value: 1, Timestamp: prommodel.TimeFromUnix(1000)},
+		// Container not present in the pod.
+		{Metric: prommodel.Metric{"namespace": "mockNamespace", "pod": "Pod1", "container": "Other"}, Value: 1, Timestamp: prommodel.TimeFromUnix(1000)},
+		// Unknown pod.
+		{Metric: prommodel.Metric{"namespace": "mockNamespace", "pod": "Pod2", "container": "Name11"}, Value: 1, Timestamp: prommodel.TimeFromUnix(1000)},
+		// Missing container label.
+		{Metric: prommodel.Metric{"namespace": "mockNamespace", "pod": "Pod1"}, Value: 1, Timestamp: prommodel.TimeFromUnix(1000)},
+	}
+
+	result := source.parseSamples(vector)
+	assert.Equal(t, []OomInfo{
+		{
+			Timestamp: timestamp.UTC(),
+			Memory:    model.ResourceAmount(1024),
+			ContainerID: model.ContainerID{
+				PodID:         model.PodID{Namespace: "mockNamespace", PodName: "Pod1"},
+				ContainerName: "Name11",
+			},
+		},
+	}, result)
+}
@@ -18,11 +18,13 @@ package oom
 
 import (
 	"strings"
+	"sync"
 	"time"
 
 	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+	metrics_recommender "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/metrics/recommender"
 	"k8s.io/client-go/tools/cache"
 
 	"k8s.io/klog/v2"
@@ -35,22 +37,67 @@ type OomInfo struct {
 	ContainerID model.ContainerID
 }
 
+const (
+	oomSourcePod   = "pod"
+	oomSourceEvent = "event"
+	oomSourceKmsg  = "kmsg"
+)
+
+// DefaultDedupWindow is the default period within which OOMs reported for the
+// same container by different sources are considered to be the same OOM.
+const DefaultDedupWindow = 10 * time.Second
+
+// ObserverConfig configures the observer and the sources it is fed from.
+type ObserverConfig struct {
+	DedupWindow time.Duration
+	Events      EventSourceConfig
+	// Kmsg enables detection of OOM kills from node kernel logs if not nil.
+	Kmsg *KmsgSourceConfig
+}
+
+// DefaultObserverConfig returns the default configuration of the observer.
+func DefaultObserverConfig() ObserverConfig {
+	return ObserverConfig{
+		DedupWindow: DefaultDedupWindow,
+		Events:      DefaultEventSourceConfig(),
+	}
+}
+
 // Observer can observe pod resource update and collect OOM events.
 type Observer interface {
 	GetObservedOomsChannel() chan OomInfo
 	OnEvent(*apiv1.Event)
+	// OnOom passes an OOM detected by a source other than pod updates and
+	// events (e.g. a node-level kernel log exporter) to the observer.
+	OnOom(OomInfo)
 	cache.ResourceEventHandler
 }
 
 // observer can observe pod resource update and collect OOM events.
 type observer struct {
 	observedOomsChannel chan OomInfo
+	dedupWindow         time.Duration
+
+	mutex sync.Mutex
+	// recentOoms holds the timestamps of observed OOMs by container, in
+	// buckets of dedupWindow length, so that only the buckets next to the one
+	// of an OOM need to be checked for duplicates.
+	recentOoms   map[int64]map[model.ContainerID]time.Time
+	newestBucket int64
 }
 
 // NewObserver returns new instance of the observer.
 func NewObserver() *observer {
+	return NewObserverWithDedupWindow(DefaultDedupWindow)
+}
+
+// NewObserverWithDedupWindow returns new instance of the observer which drops
+// OOMs of a container reported within dedupWindow of an already observed one.
+func NewObserverWithDedupWindow(dedupWindow time.Duration) *observer {
 	return &observer{
 		observedOomsChannel: make(chan OomInfo, 5000),
+		dedupWindow:         dedupWindow,
+		recentOoms:          make(map[int64]map[model.ContainerID]time.Time),
 	}
 }
 
@@ -58,6 +105,58 @@ func (o *observer) GetObservedOomsChannel() chan OomInfo {
 	return o.observedOomsChannel
 }
 
+func (o *observer) bucket(timestamp time.Time) int64 {
+	if o.dedupWindow <= 0 {
+		return timestamp.UnixNano()
+	}
+	return timestamp.UnixNano() / int64(o.dedupWindow)
+}
+
+// isDuplicate returns true if an OOM of the same container was already
+// observed within the dedup window. Otherwise the OOM is remembered.
+func (o *observer) isDuplicate(oomInfo OomInfo) bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	bucket := o.bucket(oomInfo.Timestamp)
+	// OOMs within the dedup window are in the same or an adjacent bucket.
+	for b := bucket - 1; b <= bucket+1; b++ {
+		last, found := o.recentOoms[b][oomInfo.ContainerID]
+		if !found {
+			continue
+		}
+		diff := oomInfo.Timestamp.Sub(last)
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff <= o.dedupWindow {
+			return true
+		}
+	}
+	if bucket > o.newestBucket {
+		o.newestBucket = bucket
+		for b := range o.recentOoms {
+			if b < bucket-1 {
+				delete(o.recentOoms, b)
+			}
+		}
+	}
+	if o.recentOoms[bucket] == nil {
+		o.recentOoms[bucket] = make(map[model.ContainerID]time.Time)
+	}
+	o.recentOoms[bucket][oomInfo.ContainerID] = oomInfo.Timestamp
+	return false
+}
+
+// OnOom deduplicates the OOM and passes it to the ObservedOomsChannel.
+func (o *observer) OnOom(oomInfo OomInfo) {
+	if o.isDuplicate(oomInfo) {
+		klog.V(4).Infof("OOM Observer dropping duplicated OOM %+v", oomInfo)
+		metrics_recommender.RecordDuplicatedOom()
+		return
+	}
+	o.observedOomsChannel <- oomInfo
+}
+
 func parseEvictionEvent(event *apiv1.Event) []OomInfo {
 	if event.Reason != "Evicted" ||
 		event.InvolvedObject.Kind != "Pod" {
@@ -109,7 +208,8 @@ func parseEvictionEvent(event *apiv1.Event) []OomInfo {
 func (o *observer) OnEvent(event *apiv1.Event) {
 	klog.V(1).Infof("OOM Observer processing event: %+v", event)
 	for _, oomInfo := range parseEvictionEvent(event) {
-		o.observedOomsChannel <- oomInfo
+		metrics_recommender.RecordOomObservation(oomSourceEvent)
+		o.OnOom(oomInfo)
 	}
 }
 
@@ -167,7 +267,8 @@ func (o *observer) OnUpdate(oldObj, newObj interface{}) {
 							ContainerName: containerStatus.Name,
 						},
 					}
-					o.observedOomsChannel <- oomInfo
+					metrics_recommender.RecordOomObservation(oomSourcePod)
+					o.OnOom(oomInfo)
 				}
 			}
 		}
@@ -264,3 +264,32 @@ reason: Evicted
 		assert.Equal(t, tc.oomInfo, oomInfoArray)
 	}
 }
+
+func TestOnOomDeduplication(t *testing.T) {
+	timestamp := time.Unix(1000, 0)
+	container1 := model.ContainerID{PodID: model.PodID{Namespace: "ns", PodName: "pod"}, ContainerName: "c1"}
+	container2 := model.ContainerID{PodID: model.PodID{Namespace: "ns", PodName: "pod"}, ContainerName: "c2"}
+
+	observer := NewObserverWithDedupWindow(10 * time.Second)
+	observer.OnOom(OomInfo{Timestamp: timestamp, Memory: 1024, ContainerID: container1})
+	// Same container within the window, reported by another source.
+	observer.OnOom(OomInfo{Timestamp: timestamp.Add(5 * time.Second), Memory: 2048, ContainerID: container1})
+	// Another container at the same time.
+	observer.OnOom(OomInfo{Timestamp: timestamp, Memory: 1024, ContainerID: container2})
+	// Same container after the window.
+	observer.OnOom(OomInfo{Timestamp: timestamp.Add(time.Minute), Memory: 1024, ContainerID: container1})
+
+	assert.Len(t, observer.observedOomsChannel, 3)
+	assert.Equal(t, container1, (<-observer.observedOomsChannel).ContainerID)
+	assert.Equal(t, container2, (<-observer.observedOomsChannel).ContainerID)
+	last := <-observer.observedOomsChannel
+	assert.Equal(t, container1, last.ContainerID)
+	assert.Equal(t, timestamp.Add(time.Minute), last.Timestamp)
+	// OOMs older than the window before the newest one are forgotten.
+	assert.Len(t, observer.recentOoms, 1)
+
+	// Duplicates are found in the adjacent bucket.
+	observer.OnOom(OomInfo{Timestamp: timestamp.Add(time.Minute + 9*time.Second), Memory: 1024, ContainerID: container1})
+	observer.OnOom(OomInfo{Timestamp: timestamp.Add(time.Minute - 9*time.Second), Memory: 1024, ContainerID: container1})
+	assert.Len(t, observer.observedOomsChannel, 0)
+}
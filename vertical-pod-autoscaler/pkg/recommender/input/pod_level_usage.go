@@ -0,0 +1,140 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package input
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/input/metrics"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+	metrics_recommender "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/metrics/recommender"
+	klog "k8s.io/klog/v2"
+)
+
+// estimateMissingContainersMetrics estimates the usage of the running
+// containers of pods under VPAs which are missing from containersMetrics,
+// e.g. because of container runtime bugs, from the usage of their pods. The
+// usage of a pod not accounted for by its other containers is distributed to
+// the missing containers in proportion to their requests. The VPAs of these
+// containers get the UsageEstimatedFromPodMetrics condition.
+func (feeder *clusterStateFeeder) estimateMissingContainersMetrics(containersMetrics []*metrics.ContainerMetricsSnapshot) []*metrics.ContainerMetricsSnapshot {
+	reported := make(map[model.PodID]map[string]model.Resources)
+	for _, containerMetrics := range containersMetrics {
+		podID := containerMetrics.ID.PodID
+		if reported[podID] == nil {
+			reported[podID] = make(map[string]model.Resources)
+		}
+		reported[podID][containerMetrics.ID.ContainerName] = containerMetrics.Usage
+	}
+	missing := make(map[model.PodID][]string)
+	nodes := make(map[string]bool)
+	for podID, pod := range feeder.clusterState.Pods {
+		if pod.Phase != apiv1.PodRunning || feeder.excludedPods[podID] || feeder.podNodes[podID] == "" {
+			continue
+		}
+		var containers []string
+		for name := range pod.Containers {
+			if _, found := reported[podID][name]; !found {
+				containers = append(containers, name)
+			}
+		}
+		if len(containers) == 0 || feeder.clusterState.GetControllingVPA(pod) == nil {
+			continue
+		}
+		sort.Strings(containers)
+		missing[podID] = containers
+		nodes[feeder.podNodes[podID]] = true
+	}
+
+	var estimated []*metrics.ContainerMetricsSnapshot
+	estimatedByVpa := make(map[model.VpaID][]string)
+	if len(missing) > 0 {
+		nodeNames := make([]string, 0, len(nodes))
+		for node := range nodes {
+			nodeNames = append(nodeNames, node)
+		}
+		sort.Strings(nodeNames)
+		podsMetrics, err := feeder.podMetricsClient.GetPodsMetrics(nodeNames)
+		if err != nil {
+			klog.Errorf("Cannot get PodMetricsSnapshot from PodMetricsClient. Reason: %+v", err)
+		}
+		for _, podMetrics := range podsMetrics {
+			containers, found := missing[podMetrics.ID]
+			if !found {
+				continue
+			}
+			pod := feeder.clusterState.Pods[podMetrics.ID]
+			estimated = append(estimated, distributePodUsage(podMetrics, pod, containers, reported[podMetrics.ID])...)
+			vpa := feeder.clusterState.GetControllingVPA(pod)
+			for _, container := range containers {
+				estimatedByVpa[vpa.ID] = append(estimatedByVpa[vpa.ID], fmt.Sprintf("%s/%s", podMetrics.ID.PodName, container))
+			}
+		}
+	}
+	metrics_recommender.RecordContainersUsageEstimatedFromPod(len(estimated))
+
+	for vpaID, vpa := range feeder.clusterState.Vpas {
+		containers, found := estimatedByVpa[vpaID]
+		if !found {
+			delete(vpa.Conditions, vpa_types.UsageEstimatedFromPodMetrics)
+			continue
+		}
+		sort.Strings(containers)
+		vpa.Conditions.Set(vpa_types.UsageEstimatedFromPodMetrics, true, "MissingContainerMetrics",
+			fmt.Sprintf("Usage of containers %s is estimated from the usage of their pods", strings.Join(containers, ", ")))
+	}
+	return estimated
+}
+
+// distributePodUsage splits the usage of the pod not accounted for by the
+// reported containers among the missing containers, in proportion to their
+// requests, or evenly if they have none.
+func distributePodUsage(podMetrics *metrics.PodMetricsSnapshot, pod *model.PodState, containers []string, reported map[string]model.Resources) []*metrics.ContainerMetricsSnapshot {
+	snapshots := make([]*metrics.ContainerMetricsSnapshot, len(containers))
+	for i, container := range containers {
+		snapshots[i] = &metrics.ContainerMetricsSnapshot{
+			ID:           model.ContainerID{PodID: podMetrics.ID, ContainerName: container},
+			SnapshotTime: podMetrics.SnapshotTime,
+			Usage:        make(model.Resources),
+		}
+	}
+	for resource, podUsage := range podMetrics.Usage {
+		remaining := podUsage
+		for _, usage := range reported {
+			remaining -= usage[resource]
+		}
+		if remaining < 0 {
+			remaining = 0
+		}
+		var totalRequest model.ResourceAmount
+		for _, container := range containers {
+			totalRequest += pod.Containers[container].Request[resource]
+		}
+		for i, container := range containers {
+			share := 1.0 / float64(len(containers))
+			if totalRequest > 0 {
+				share = float64(pod.Containers[container].Request[resource]) / float64(totalRequest)
+			}
+			snapshots[i].Usage[resource] = model.ResourceAmount(float64(remaining) * share)
+		}
+	}
+	return snapshots
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package input
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/labels"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/input/metrics"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+)
+
+type fakePodMetricsClient struct {
+	snapshots []*metrics.PodMetricsSnapshot
+	nodes     []string
+}
+
+func (c *fakePodMetricsClient) GetPodsMetrics(nodes []string) ([]*metrics.PodMetricsSnapshot, error) {
+	c.nodes = nodes
+	return c.snapshots, nil
+}
+
+func TestClusterStateFeeder_EstimateMissingContainersMetrics(t *testing.T) {
+	clusterState := model.NewClusterState(testGcPeriod)
+	vpaID := model.VpaID{VpaName: "test-vpa", Namespace: "default"}
+	clusterState.Vpas = map[model.VpaID]*model.Vpa{
+		vpaID: model.NewVpa(vpaID, labels.SelectorFromSet(labels.Set{"name": "vpa-pod"}), time.Now()),
+	}
+	podID := model.PodID{Namespace: "default", PodName: "pod-0"}
+	clusterState.AddOrUpdatePod(podID, labels.Set{"name": "vpa-pod"}, "Running")
+	for name, request := range map[string]model.Resources{
+		"app":     {model.ResourceCPU: 100, model.ResourceMemory: 1000},
+		"sidecar": {model.ResourceCPU: 300, model.ResourceMemory: 1000},
+		"proxy":   {model.ResourceCPU: 100, model.ResourceMemory: 1000},
+	} {
+		assert.NoError(t, clusterState.AddOrUpdateContainer(model.ContainerID{PodID: podID, ContainerName: name}, request))
+	}
+	now := time.Now()
+	containersMetrics := []*metrics.ContainerMetricsSnapshot{{
+		ID:           model.ContainerID{PodID: podID, ContainerName: "proxy"},
+		SnapshotTime: now,
+		Usage:        model.Resources{model.ResourceCPU: 200, model.ResourceMemory: 1000},
+	}}
+	podMetricsClient := &fakePodMetricsClient{snapshots: []*metrics.PodMetricsSnapshot{{
+		ID:           podID,
+		SnapshotTime: now,
+		Usage:        model.Resources{model.ResourceCPU: 1000, model.ResourceMemory: 5000},
+	}}}
+	feeder := clusterStateFeeder{
+		clusterState:     clusterState,
+		podNodes:         map[model.PodID]string{podID: "node-1"},
+		podMetricsClient: podMetricsClient,
+	}
+
+	estimated := feeder.estimateMissingContainersMetrics(containersMetrics)
+	assert.Equal(t, []string{"node-1"}, podMetricsClient.nodes)
+	// The usage not accounted for by proxy is split by the requests of app
+	// and sidecar for CPU, evenly for memory.
+	assert.Equal(t, []*metrics.ContainerMetricsSnapshot{{
+		ID:           model.ContainerID{PodID: podID, ContainerName: "app"},
+		SnapshotTime: now,
+		Usage:        model.Resources{model.ResourceCPU: 200, model.ResourceMemory: 2000},
+	}, {
+		ID:           model.ContainerID{PodID: podID, ContainerName: "sidecar"},
+		SnapshotTime: now,
+		Usage:        model.Resources{model.ResourceCPU: 600, model.ResourceMemory: 2000},
+	}}, estimated)
+	condition := clusterState.Vpas[vpaID].Conditions[vpa_types.UsageEstimatedFromPodMetrics]
+	assert.Equal(t, "Usage of containers pod-0/app, pod-0/sidecar is estimated from the usage of their pods", condition.Message)
+
+	// Once all containers are reported, the condition is removed.
+	for _, name := range []string{"app", "sidecar"} {
+		containersMetrics = append(containersMetrics, &metrics.ContainerMetricsSnapshot{
+			ID:           model.ContainerID{PodID: podID, ContainerName: name},
+			SnapshotTime: now,
+			Usage:        model.Resources{model.ResourceCPU: 100, model.ResourceMemory: 1000},
+		})
+	}
+	podMetricsClient.nodes = nil
+	assert.Empty(t, feeder.estimateMissingContainersMetrics(containersMetrics))
+	assert.Nil(t, podMetricsClient.nodes)
+	assert.NotContains(t, clusterState.Vpas[vpaID].Conditions, vpa_types.UsageEstimatedFromPodMetrics)
+}
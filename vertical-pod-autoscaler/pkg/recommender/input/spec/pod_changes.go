@@ -0,0 +1,80 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spec
+
+import (
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+	"k8s.io/client-go/tools/cache"
+)
+
+// PodChangeTracker records the pods added, updated or deleted since the
+// changes were last taken, from the events of a pod informer, so that only
+// they need to be synced instead of all pods.
+type PodChangeTracker struct {
+	mutex   sync.Mutex
+	changes map[model.PodID]*BasicPodSpec
+}
+
+// NewPodChangeTracker creates a PodChangeTracker with no changes.
+func NewPodChangeTracker() *PodChangeTracker {
+	return &PodChangeTracker{changes: make(map[model.PodID]*BasicPodSpec)}
+}
+
+// OnAdd records the pod as changed.
+func (t *PodChangeTracker) OnAdd(obj interface{}) {
+	if pod, ok := obj.(*v1.Pod); ok {
+		t.record(podID(pod), newBasicPodSpec(pod))
+	}
+}
+
+// OnUpdate records the pod as changed.
+func (t *PodChangeTracker) OnUpdate(_, newObj interface{}) {
+	t.OnAdd(newObj)
+}
+
+// OnDelete records the pod as deleted.
+func (t *PodChangeTracker) OnDelete(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	if pod, ok := obj.(*v1.Pod); ok {
+		t.record(podID(pod), nil)
+	}
+}
+
+// TakeChanges returns the current spec of every pod changed since the last
+// call, nil for deleted pods, and forgets them.
+func (t *PodChangeTracker) TakeChanges() map[model.PodID]*BasicPodSpec {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	changes := t.changes
+	t.changes = make(map[model.PodID]*BasicPodSpec)
+	return changes
+}
+
+func (t *PodChangeTracker) record(podID model.PodID, spec *BasicPodSpec) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.changes[podID] = spec
+}
+
+func podID(pod *v1.Pod) model.PodID {
+	return model.PodID{PodName: pod.Name, Namespace: pod.Namespace}
+}
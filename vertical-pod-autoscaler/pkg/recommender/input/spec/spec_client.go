@@ -17,6 +17,8 @@ limitations under the License.
 package spec
 
 import (
+	"time"
+
 	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
@@ -33,6 +35,10 @@ type BasicPodSpec struct {
 	Containers []BasicContainerSpec
 	// PodPhase describing current life cycle phase of the Pod.
 	Phase v1.PodPhase
+	// Name of the node the pod is scheduled on.
+	NodeName string
+	// Time the pod was started at, zero if unknown.
+	StartTime time.Time
 }
 
 // BasicContainerSpec contains basic information defining a container.
@@ -43,6 +49,8 @@ type BasicContainerSpec struct {
 	Image string
 	// Currently requested resources for this container.
 	Request model.Resources
+	// Current resource limits of this container, zero if not limited.
+	Limit model.Resources
 }
 
 // SpecClient provides information about pods and containers Specification
@@ -88,6 +96,10 @@ func newBasicPodSpec(pod *v1.Pod) *BasicPodSpec {
 		PodLabels:  pod.Labels,
 		Containers: containerSpecs,
 		Phase:      pod.Status.Phase,
+		NodeName:   pod.Spec.NodeName,
+	}
+	if pod.Status.StartTime != nil {
+		basicPodSpec.StartTime = pod.Status.StartTime.Time
 	}
 	return basicPodSpec
 }
@@ -111,6 +123,7 @@ func newContainerSpec(podID model.PodID, container v1.Container) BasicContainerS
 		},
 		Image:   container.Image,
 		Request: calculateRequestedResources(container),
+		Limit:   calculateLimitResources(container),
 	}
 	return containerSpec
 }
@@ -122,9 +135,24 @@ func calculateRequestedResources(container v1.Container) model.Resources {
 	memoryQuantity := container.Resources.Requests[v1.ResourceMemory]
 	memoryBytes := memoryQuantity.Value()
 
-	return model.Resources{
+	resources := model.Resources{
 		model.ResourceCPU:    model.ResourceAmount(cpuMillicores),
 		model.ResourceMemory: model.ResourceAmount(memoryBytes),
 	}
+	for name, quantity := range container.Resources.Requests {
+		if model.IsExtendedResource(model.ResourceName(name)) {
+			resources[model.ResourceName(name)] = model.ResourceAmount(quantity.Value())
+		}
+	}
+	return resources
+}
+
+func calculateLimitResources(container v1.Container) model.Resources {
+	cpuQuantity := container.Resources.Limits[v1.ResourceCPU]
+	memoryQuantity := container.Resources.Limits[v1.ResourceMemory]
 
+	return model.Resources{
+		model.ResourceCPU:    model.ResourceAmount(cpuQuantity.MilliValue()),
+		model.ResourceMemory: model.ResourceAmount(memoryQuantity.Value()),
+	}
 }
@@ -137,6 +137,10 @@ func newTestContainerSpec(podID model.PodID, containerName string, milicores int
 		ID:      containerID,
 		Image:   containerName + "Image",
 		Request: requestedResources,
+		Limit: model.Resources{
+			model.ResourceCPU:    0,
+			model.ResourceMemory: 0,
+		},
 	}
 }
 
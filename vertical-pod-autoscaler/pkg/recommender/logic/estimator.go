@@ -45,6 +45,13 @@ type percentileEstimator struct {
 	memoryPercentile float64
 }
 
+// Implementation of ResourceEstimator that returns the target percentiles
+// overridden by the VPA of the aggregated containers, or the default ones.
+type targetPercentileEstimator struct {
+	defaultCPUPercentile    float64
+	defaultMemoryPercentile float64
+}
+
 type marginEstimator struct {
 	marginFraction float64
 	baseEstimator  ResourceEstimator
@@ -55,12 +62,46 @@ type minResourcesEstimator struct {
 	baseEstimator ResourceEstimator
 }
 
+// Implementation of ResourceEstimator that treats CPU capped by the limit as
+// a lower bound of the real demand.
+type cpuLimitCensoringEstimator struct {
+	threshold     float64
+	bumpUpRatio   float64
+	baseEstimator ResourceEstimator
+}
+
+// Implementation of ResourceEstimator that passes the requests of extended
+// resources of the containers through to the estimation.
+type extendedResourcesEstimator struct {
+	baseEstimator ResourceEstimator
+}
+
 type confidenceMultiplier struct {
 	multiplier    float64
 	exponent      float64
 	baseEstimator ResourceEstimator
 }
 
+// Implementation of ResourceEstimator that applies the confidence multiplier
+// of the lower or upper bound overridden by the VPA of the aggregated
+// containers, or the default one.
+type boundConfidenceMultiplier struct {
+	bound             Bound
+	defaultMultiplier float64
+	defaultExponent   float64
+	baseEstimator     ResourceEstimator
+}
+
+// Bound is the lower or the upper bound of a recommendation.
+type Bound string
+
+const (
+	// LowerBound is the lower bound of a recommendation.
+	LowerBound Bound = "lower"
+	// UpperBound is the upper bound of a recommendation.
+	UpperBound Bound = "upper"
+)
+
 // NewConstEstimator returns a new constEstimator with given resources.
 func NewConstEstimator(resources model.Resources) ResourceEstimator {
 	return &constEstimator{resources}
@@ -71,6 +112,12 @@ func NewPercentileEstimator(cpuPercentile float64, memoryPercentile float64) Res
 	return &percentileEstimator{cpuPercentile, memoryPercentile}
 }
 
+// NewTargetPercentileEstimator returns a new targetPercentileEstimator that
+// uses provided percentiles unless overridden for the aggregated containers.
+func NewTargetPercentileEstimator(defaultCPUPercentile float64, defaultMemoryPercentile float64) ResourceEstimator {
+	return &targetPercentileEstimator{defaultCPUPercentile, defaultMemoryPercentile}
+}
+
 // WithMargin returns a given ResourceEstimator with margin applied.
 // The returned resources are equal to the original resources plus (originalResource * marginFraction)
 func WithMargin(marginFraction float64, baseEstimator ResourceEstimator) ResourceEstimator {
@@ -88,6 +135,27 @@ func WithConfidenceMultiplier(multiplier, exponent float64, baseEstimator Resour
 	return &confidenceMultiplier{multiplier, exponent, baseEstimator}
 }
 
+// WithBoundConfidenceMultiplier returns a given ResourceEstimator with
+// confidenceMultiplier applied, with the multiplier and the exponent of the
+// bound overridden by the VPA of the aggregated containers, or the given
+// default ones.
+func WithBoundConfidenceMultiplier(bound Bound, defaultMultiplier, defaultExponent float64, baseEstimator ResourceEstimator) ResourceEstimator {
+	return &boundConfidenceMultiplier{bound, defaultMultiplier, defaultExponent, baseEstimator}
+}
+
+// WithCPULimitCensoring returns a given ResourceEstimator that raises the CPU
+// estimation to limit * bumpUpRatio when it falls within the range capped by
+// the CPU limit, i.e. above threshold * limit.
+func WithCPULimitCensoring(threshold, bumpUpRatio float64, baseEstimator ResourceEstimator) ResourceEstimator {
+	return &cpuLimitCensoringEstimator{threshold, bumpUpRatio, baseEstimator}
+}
+
+// WithExtendedResources returns a given ResourceEstimator which also estimates
+// extended resources, e.g. GPUs or hugepages, as the containers request them.
+func WithExtendedResources(baseEstimator ResourceEstimator) ResourceEstimator {
+	return &extendedResourcesEstimator{baseEstimator}
+}
+
 // Returns a constant amount of resources.
 func (e *constEstimator) GetResourceEstimation(s *model.AggregateContainerState) model.Resources {
 	return e.resources
@@ -103,6 +171,26 @@ func (e *percentileEstimator) GetResourceEstimation(s *model.AggregateContainerS
 	}
 }
 
+// Returns the overridden or default percentiles of CPU and memory peaks distributions.
+func (e *targetPercentileEstimator) GetResourceEstimation(s *model.AggregateContainerState) model.Resources {
+	cpuPercentile, memoryPercentile := targetPercentiles(s, e.defaultCPUPercentile, e.defaultMemoryPercentile)
+	estimator := percentileEstimator{cpuPercentile, memoryPercentile}
+	return estimator.GetResourceEstimation(s)
+}
+
+// targetPercentiles returns the target percentiles overridden for the
+// aggregated containers, or the default ones.
+func targetPercentiles(s *model.AggregateContainerState, defaultCPUPercentile, defaultMemoryPercentile float64) (float64, float64) {
+	cpuPercentile, memoryPercentile := defaultCPUPercentile, defaultMemoryPercentile
+	if percentile := s.AggregationOverrides.TargetCPUPercentile; percentile > 0 {
+		cpuPercentile = percentile
+	}
+	if percentile := s.AggregationOverrides.TargetMemoryPercentile; percentile > 0 {
+		memoryPercentile = percentile
+	}
+	return cpuPercentile, memoryPercentile
+}
+
 // Returns a non-negative real number that heuristically measures how much
 // confidence the history aggregated in the AggregateContainerState provides.
 // For a workload producing a steady stream of samples over N days at the rate
@@ -127,16 +215,45 @@ func getConfidence(s *model.AggregateContainerState) float64 {
 // This can be used to widen or narrow the gap between the lower and upper bound
 // estimators depending on how much input data is available to the estimators.
 func (e *confidenceMultiplier) GetResourceEstimation(s *model.AggregateContainerState) model.Resources {
-	confidence := getConfidence(s)
+	factor := confidenceFactor(s, e.multiplier, e.exponent)
 	originalResources := e.baseEstimator.GetResourceEstimation(s)
 	scaledResources := make(model.Resources)
 	for resource, resourceAmount := range originalResources {
-		scaledResources[resource] = model.ScaleResource(
-			resourceAmount, math.Pow(1.+e.multiplier/confidence, e.exponent))
+		scaledResources[resource] = model.ScaleResource(resourceAmount, factor)
 	}
 	return scaledResources
 }
 
+func (e *boundConfidenceMultiplier) GetResourceEstimation(s *model.AggregateContainerState) model.Resources {
+	multiplier, exponent := boundConfidenceScaling(s, e.bound, e.defaultMultiplier, e.defaultExponent)
+	estimator := confidenceMultiplier{multiplier, exponent, e.baseEstimator}
+	return estimator.GetResourceEstimation(s)
+}
+
+// confidenceFactor returns the factor (1 + multiplier/confidence)^exponent an
+// estimation is scaled by, given the confidence in the aggregated history.
+func confidenceFactor(s *model.AggregateContainerState, multiplier, exponent float64) float64 {
+	return math.Pow(1.+multiplier/getConfidence(s), exponent)
+}
+
+// boundConfidenceScaling returns the multiplier and the exponent of the
+// confidence scaling of the bound overridden for the aggregated containers,
+// or the default ones.
+func boundConfidenceScaling(s *model.AggregateContainerState, bound Bound, defaultMultiplier, defaultExponent float64) (float64, float64) {
+	multiplier, exponent := defaultMultiplier, defaultExponent
+	overrideMultiplier, overrideExponent := s.AggregationOverrides.LowerBoundConfidenceMultiplier, s.AggregationOverrides.LowerBoundConfidenceExponent
+	if bound == UpperBound {
+		overrideMultiplier, overrideExponent = s.AggregationOverrides.UpperBoundConfidenceMultiplier, s.AggregationOverrides.UpperBoundConfidenceExponent
+	}
+	if overrideMultiplier > 0 {
+		multiplier = overrideMultiplier
+	}
+	if overrideExponent != 0 {
+		exponent = overrideExponent
+	}
+	return multiplier, exponent
+}
+
 func (e *marginEstimator) GetResourceEstimation(s *model.AggregateContainerState) model.Resources {
 	originalResources := e.baseEstimator.GetResourceEstimation(s)
 	newResources := make(model.Resources)
@@ -147,6 +264,28 @@ func (e *marginEstimator) GetResourceEstimation(s *model.AggregateContainerState
 	return newResources
 }
 
+// Returns resources computed by the underlying estimator. If the CPU usage of
+// the containers was recently capped by their limit and the estimated CPU is
+// within the capped range, the demand is only known to be at least the limit,
+// so the estimation is raised above it.
+func (e *cpuLimitCensoringEstimator) GetResourceEstimation(s *model.AggregateContainerState) model.Resources {
+	originalResources := e.baseEstimator.GetResourceEstimation(s)
+	limit := s.CPUCensoringLimit
+	if e.threshold <= 0 || limit <= 0 {
+		return originalResources
+	}
+	cpu, found := originalResources[model.ResourceCPU]
+	if !found || cpu < model.ScaleResource(limit, e.threshold) {
+		return originalResources
+	}
+	newResources := make(model.Resources)
+	for resource, resourceAmount := range originalResources {
+		newResources[resource] = resourceAmount
+	}
+	newResources[model.ResourceCPU] = model.ResourceAmountMax(cpu, model.ScaleResource(limit, e.bumpUpRatio))
+	return newResources
+}
+
 func (e *minResourcesEstimator) GetResourceEstimation(s *model.AggregateContainerState) model.Resources {
 	originalResources := e.baseEstimator.GetResourceEstimation(s)
 	newResources := make(model.Resources)
@@ -158,3 +297,18 @@ func (e *minResourcesEstimator) GetResourceEstimation(s *model.AggregateContaine
 	}
 	return newResources
 }
+
+func (e *extendedResourcesEstimator) GetResourceEstimation(s *model.AggregateContainerState) model.Resources {
+	originalResources := e.baseEstimator.GetResourceEstimation(s)
+	if len(s.ExtendedRequests) == 0 {
+		return originalResources
+	}
+	newResources := make(model.Resources)
+	for resource, resourceAmount := range originalResources {
+		newResources[resource] = resourceAmount
+	}
+	for resource, resourceAmount := range s.ExtendedRequests {
+		newResources[resource] = resourceAmount
+	}
+	return newResources
+}
@@ -62,6 +62,39 @@ func TestPercentileEstimator(t *testing.T) {
 	assert.InEpsilon(t, 2e9, model.BytesFromMemoryAmount(resourceEstimation[model.ResourceMemory]), maxRelativeError)
 }
 
+// Verifies that the targetPercentileEstimator uses the target percentiles
+// overridden for the aggregated containers, and the default ones otherwise.
+func TestTargetPercentileEstimator(t *testing.T) {
+	config := model.GetAggregationsConfig()
+	cpuHistogram := util.NewHistogram(config.CPUHistogramOptions)
+	cpuHistogram.AddSample(1.0, 1.0, anyTime)
+	cpuHistogram.AddSample(2.0, 1.0, anyTime)
+	cpuHistogram.AddSample(3.0, 1.0, anyTime)
+	memoryPeaksHistogram := util.NewHistogram(config.MemoryHistogramOptions)
+	memoryPeaksHistogram.AddSample(1e9, 1.0, anyTime)
+	memoryPeaksHistogram.AddSample(2e9, 1.0, anyTime)
+	memoryPeaksHistogram.AddSample(3e9, 1.0, anyTime)
+	estimator := NewTargetPercentileEstimator(0.2, 0.5)
+
+	maxRelativeError := 0.05 // Allow 5% relative error to account for histogram rounding.
+	resourceEstimation := estimator.GetResourceEstimation(
+		&model.AggregateContainerState{
+			AggregateCPUUsage:    cpuHistogram,
+			AggregateMemoryPeaks: memoryPeaksHistogram,
+		})
+	assert.InEpsilon(t, 1.0, model.CoresFromCPUAmount(resourceEstimation[model.ResourceCPU]), maxRelativeError)
+	assert.InEpsilon(t, 2e9, model.BytesFromMemoryAmount(resourceEstimation[model.ResourceMemory]), maxRelativeError)
+
+	resourceEstimation = estimator.GetResourceEstimation(
+		&model.AggregateContainerState{
+			AggregateCPUUsage:    cpuHistogram,
+			AggregateMemoryPeaks: memoryPeaksHistogram,
+			AggregationOverrides: model.AggregationOverrides{TargetCPUPercentile: 0.9},
+		})
+	assert.InEpsilon(t, 3.0, model.CoresFromCPUAmount(resourceEstimation[model.ResourceCPU]), maxRelativeError)
+	assert.InEpsilon(t, 2e9, model.BytesFromMemoryAmount(resourceEstimation[model.ResourceMemory]), maxRelativeError)
+}
+
 // Verifies that the confidenceMultiplier calculates the internal
 // confidence based on the amount of historical samples and scales the resources
 // returned by the base estimator according to the formula, using the calculated
@@ -117,6 +150,38 @@ func TestConfidenceMultiplierNoHistory(t *testing.T) {
 		testedEstimator2.GetResourceEstimation(s)[model.ResourceCPU])
 }
 
+// Verifies that the confidence scaling of the bounds can be overridden for the
+// aggregated containers.
+func TestBoundConfidenceMultiplier(t *testing.T) {
+	baseEstimator := NewConstEstimator(model.Resources{
+		model.ResourceCPU: model.CPUAmountFromCores(1),
+	})
+	s := model.NewAggregateContainerState()
+	timestamp := anyTime
+	for i := 0; i < 24*60; i++ {
+		s.AddSample(&model.ContainerUsageSample{
+			MeasureStart: timestamp,
+			Usage:        model.CPUAmountFromCores(1.0),
+			Request:      testRequest[model.ResourceCPU],
+			Resource:     model.ResourceCPU,
+		})
+		timestamp = timestamp.Add(time.Minute)
+	}
+	assert.InDelta(t, 1.0, getConfidence(s), 0.001)
+
+	lowerBound := WithBoundConfidenceMultiplier(LowerBound, 1.0, -1.0, baseEstimator)
+	upperBound := WithBoundConfidenceMultiplier(UpperBound, 1.0, 1.0, baseEstimator)
+	assert.InDelta(t, 0.5, model.CoresFromCPUAmount(lowerBound.GetResourceEstimation(s)[model.ResourceCPU]), 0.01)
+	assert.InDelta(t, 2.0, model.CoresFromCPUAmount(upperBound.GetResourceEstimation(s)[model.ResourceCPU]), 0.01)
+
+	s.SetAggregationOverrides(model.AggregationOverrides{
+		LowerBoundConfidenceExponent:   -2.0,
+		UpperBoundConfidenceMultiplier: 3.0,
+	})
+	assert.InDelta(t, 0.25, model.CoresFromCPUAmount(lowerBound.GetResourceEstimation(s)[model.ResourceCPU]), 0.01)
+	assert.InDelta(t, 4.0, model.CoresFromCPUAmount(upperBound.GetResourceEstimation(s)[model.ResourceCPU]), 0.01)
+}
+
 // Verifies that the MarginEstimator adds margin to the originally
 // estimated resources.
 func TestMarginEstimator(t *testing.T) {
@@ -136,6 +201,31 @@ func TestMarginEstimator(t *testing.T) {
 	assert.Equal(t, 3.14e9*1.1, model.BytesFromMemoryAmount(resourceEstimation[model.ResourceMemory]))
 }
 
+// Verifies that the CPU estimation within the range capped by the CPU limit
+// is raised above the limit.
+func TestCPULimitCensoringEstimator(t *testing.T) {
+	baseEstimator := NewConstEstimator(model.Resources{
+		model.ResourceCPU:    model.CPUAmountFromCores(0.95),
+		model.ResourceMemory: model.MemoryAmountFromBytes(1e9),
+	})
+	testedEstimator := WithCPULimitCensoring(0.9, 1.5, baseEstimator)
+
+	s := model.NewAggregateContainerState()
+	// Not capped.
+	assert.Equal(t, model.CPUAmountFromCores(0.95), testedEstimator.GetResourceEstimation(s)[model.ResourceCPU])
+	// Capped at 1 core.
+	s.CPUCensoringLimit = model.CPUAmountFromCores(1.0)
+	resourceEstimation := testedEstimator.GetResourceEstimation(s)
+	assert.Equal(t, model.CPUAmountFromCores(1.5), resourceEstimation[model.ResourceCPU])
+	assert.Equal(t, model.MemoryAmountFromBytes(1e9), resourceEstimation[model.ResourceMemory])
+	// Capped at 2 cores, the estimation is below the capped range.
+	s.CPUCensoringLimit = model.CPUAmountFromCores(2.0)
+	assert.Equal(t, model.CPUAmountFromCores(0.95), testedEstimator.GetResourceEstimation(s)[model.ResourceCPU])
+	// Censoring disabled.
+	s.CPUCensoringLimit = model.CPUAmountFromCores(1.0)
+	assert.Equal(t, model.CPUAmountFromCores(0.95), WithCPULimitCensoring(0, 1.5, baseEstimator).GetResourceEstimation(s)[model.ResourceCPU])
+}
+
 // Verifies that the MinResourcesEstimator returns at least MinResources.
 func TestMinResourcesEstimator(t *testing.T) {
 
@@ -159,3 +249,19 @@ func TestMinResourcesEstimator(t *testing.T) {
 	// Original Memory is below min resources
 	assert.Equal(t, 4e8, model.BytesFromMemoryAmount(resourceEstimation[model.ResourceMemory]))
 }
+
+// Verifies that the requests of extended resources are passed through.
+func TestExtendedResourcesEstimator(t *testing.T) {
+	baseEstimator := NewConstEstimator(model.Resources{
+		model.ResourceCPU: model.CPUAmountFromCores(3.14),
+	})
+	testedEstimator := WithExtendedResources(baseEstimator)
+
+	s := model.NewAggregateContainerState()
+	assert.Equal(t, model.Resources{model.ResourceCPU: model.CPUAmountFromCores(3.14)}, testedEstimator.GetResourceEstimation(s))
+	s.ExtendedRequests = model.Resources{"nvidia.com/gpu": 1}
+	assert.Equal(t, model.Resources{
+		model.ResourceCPU: model.CPUAmountFromCores(3.14),
+		"nvidia.com/gpu":  1,
+	}, testedEstimator.GetResourceEstimation(s))
+}
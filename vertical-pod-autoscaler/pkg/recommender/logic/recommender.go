@@ -19,23 +19,64 @@ package logic
 import (
 	"flag"
 	"sort"
+	"strconv"
 
 	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+	"k8s.io/klog/v2"
 )
 
 var (
-	safetyMarginFraction = flag.Float64("recommendation-margin-fraction", 0.15, `Fraction of usage added as the safety margin to the recommended request`)
-	podMinCPUMillicores  = flag.Float64("pod-recommendation-min-cpu-millicores", 25, `Minimum CPU recommendation for a pod`)
-	podMinMemoryMb       = flag.Float64("pod-recommendation-min-memory-mb", 250, `Minimum memory recommendation for a pod`)
-	targetCPUPercentile  = flag.Float64("target-cpu-percentile", 0.9, "CPU usage percentile that will be used as a base for CPU target recommendation. Doesn't affect CPU lower bound, CPU upper bound nor memory recommendations.")
+	safetyMarginFraction        = flag.Float64("recommendation-margin-fraction", 0.15, `Fraction of usage added as the safety margin to the recommended request`)
+	podMinCPUMillicores         = flag.Float64("pod-recommendation-min-cpu-millicores", 25, `Minimum CPU recommendation for a pod`)
+	podMinMemoryMb              = flag.Float64("pod-recommendation-min-memory-mb", 250, `Minimum memory recommendation for a pod`)
+	targetCPUPercentile         = flag.Float64("target-cpu-percentile", 0.9, "CPU usage percentile that will be used as a base for CPU target recommendation. Doesn't affect CPU lower bound, CPU upper bound nor memory recommendations.")
+	cpuLimitCensoredBumpUpRatio = flag.Float64("cpu-limit-censored-bump-up-ratio", 1.2, `Ratio of the CPU limit the CPU recommendation is raised to when the usage is capped by the limit. Only used with --cpu-limit-censoring-threshold`)
 )
 
+var (
+	lowerBoundConfidenceMultiplier = flag.Float64("lower-bound-confidence-multiplier", 0.001, `Positive multiplier m of the factor (1 + m/history-length-in-days)^e the lower bound recommendation is scaled by. Larger values keep the lower bound of containers with a short history low for longer, so that the updater is less eager to evict them to raise their requests`)
+	lowerBoundConfidenceExponent   = flag.Float64("lower-bound-confidence-exponent", -2, `Exponent e of the factor the lower bound recommendation is scaled by, see --lower-bound-confidence-multiplier`)
+	upperBoundConfidenceMultiplier = flag.Float64("upper-bound-confidence-multiplier", 1, `Positive multiplier m of the factor (1 + m/history-length-in-days)^e the upper bound recommendation is scaled by. Larger values keep the upper bound of containers with a short history high for longer, so that the updater is less eager to evict them to reclaim unused resources`)
+	upperBoundConfidenceExponent   = flag.Float64("upper-bound-confidence-exponent", 1, `Exponent e of the factor the upper bound recommendation is scaled by, see --upper-bound-confidence-multiplier`)
+)
+
+// targetMemoryPeaksPercentile is the memory peaks percentile the target
+// recommendation is based on.
+const targetMemoryPeaksPercentile = 0.9
+
+// GetTargetPercentiles returns the CPU usage and memory peaks percentiles the
+// target recommendation of the aggregated containers is based on.
+func GetTargetPercentiles(s *model.AggregateContainerState) (cpuPercentile, memoryPercentile float64) {
+	return targetPercentiles(s, *targetCPUPercentile, targetMemoryPeaksPercentile)
+}
+
+// GetBoundConfidenceFactors returns the factors the lower and upper bound
+// recommendations of the aggregated containers are scaled by, given the
+// confidence in their history.
+func GetBoundConfidenceFactors(s *model.AggregateContainerState) BoundConfidenceFactors {
+	lowerMultiplier, lowerExponent := boundConfidenceScaling(s, LowerBound, *lowerBoundConfidenceMultiplier, *lowerBoundConfidenceExponent)
+	upperMultiplier, upperExponent := boundConfidenceScaling(s, UpperBound, *upperBoundConfidenceMultiplier, *upperBoundConfidenceExponent)
+	return BoundConfidenceFactors{
+		LowerBound: confidenceFactor(s, lowerMultiplier, lowerExponent),
+		UpperBound: confidenceFactor(s, upperMultiplier, upperExponent),
+	}
+}
+
 // PodResourceRecommender computes resource recommendation for a Vpa object.
 type PodResourceRecommender interface {
 	GetRecommendedPodResources(containerNameToAggregateStateMap model.ContainerNameToAggregateStateMap) RecommendedPodResources
 }
 
+// MarginAwarePodResourceRecommender is a PodResourceRecommender which can
+// apply a safety margin other than the default one.
+type MarginAwarePodResourceRecommender interface {
+	PodResourceRecommender
+	// GetRecommendedPodResourcesWithMargin computes the recommendation with the
+	// given safety margin fraction.
+	GetRecommendedPodResourcesWithMargin(containerNameToAggregateStateMap model.ContainerNameToAggregateStateMap, marginFraction float64) RecommendedPodResources
+}
+
 // RecommendedPodResources is a Map from container name to recommended resources.
 type RecommendedPodResources map[string]RecommendedContainerResources
 
@@ -48,6 +89,16 @@ type RecommendedContainerResources struct {
 	LowerBound model.Resources
 	// Recommended maximum amount of resources.
 	UpperBound model.Resources
+	// Factors the bounds were scaled by, given the confidence in the
+	// history. Nil if unknown, e.g. for external recommendations.
+	ConfidenceFactors *BoundConfidenceFactors
+}
+
+// BoundConfidenceFactors are the factors the lower and upper bound
+// recommendations are scaled by, given the confidence in the history.
+type BoundConfidenceFactors struct {
+	LowerBound float64
+	UpperBound float64
 }
 
 type podResourceRecommender struct {
@@ -82,10 +133,12 @@ func (r *podResourceRecommender) GetRecommendedPodResources(containerNameToAggre
 
 // Takes AggregateContainerState and returns a container recommendation.
 func (r *podResourceRecommender) estimateContainerResources(s *model.AggregateContainerState) RecommendedContainerResources {
+	confidenceFactors := GetBoundConfidenceFactors(s)
 	return RecommendedContainerResources{
-		FilterControlledResources(r.targetEstimator.GetResourceEstimation(s), s.GetControlledResources()),
-		FilterControlledResources(r.lowerBoundEstimator.GetResourceEstimation(s), s.GetControlledResources()),
-		FilterControlledResources(r.upperBoundEstimator.GetResourceEstimation(s), s.GetControlledResources()),
+		Target:            FilterControlledResources(r.targetEstimator.GetResourceEstimation(s), s.GetControlledResources()),
+		LowerBound:        FilterControlledResources(r.lowerBoundEstimator.GetResourceEstimation(s), s.GetControlledResources()),
+		UpperBound:        FilterControlledResources(r.upperBoundEstimator.GetResourceEstimation(s), s.GetControlledResources()),
+		ConfidenceFactors: &confidenceFactors,
 	}
 }
 
@@ -100,27 +153,48 @@ func FilterControlledResources(estimation model.Resources, controlledResources [
 	return result
 }
 
+type marginAwarePodResourceRecommender struct {
+	podResourceRecommender
+}
+
+func (r *marginAwarePodResourceRecommender) GetRecommendedPodResourcesWithMargin(containerNameToAggregateStateMap model.ContainerNameToAggregateStateMap, marginFraction float64) RecommendedPodResources {
+	return newPodResourceRecommender(marginFraction).GetRecommendedPodResources(containerNameToAggregateStateMap)
+}
+
 // CreatePodResourceRecommender returns the primary recommender.
 func CreatePodResourceRecommender() PodResourceRecommender {
+	if *lowerBoundConfidenceMultiplier <= 0 || *upperBoundConfidenceMultiplier <= 0 {
+		klog.Fatalf("--lower-bound-confidence-multiplier and --upper-bound-confidence-multiplier must be positive")
+	}
+	return &marginAwarePodResourceRecommender{*newPodResourceRecommender(*safetyMarginFraction)}
+}
+
+func newPodResourceRecommender(safetyMarginFraction float64) *podResourceRecommender {
 	lowerBoundCPUPercentile := 0.5
 	upperBoundCPUPercentile := 0.95
 
-	targetMemoryPeaksPercentile := 0.9
 	lowerBoundMemoryPeaksPercentile := 0.5
 	upperBoundMemoryPeaksPercentile := 0.95
 
-	targetEstimator := NewPercentileEstimator(*targetCPUPercentile, targetMemoryPeaksPercentile)
+	targetEstimator := NewTargetPercentileEstimator(*targetCPUPercentile, targetMemoryPeaksPercentile)
 	lowerBoundEstimator := NewPercentileEstimator(lowerBoundCPUPercentile, lowerBoundMemoryPeaksPercentile)
 	upperBoundEstimator := NewPercentileEstimator(upperBoundCPUPercentile, upperBoundMemoryPeaksPercentile)
 
-	targetEstimator = WithMargin(*safetyMarginFraction, targetEstimator)
-	lowerBoundEstimator = WithMargin(*safetyMarginFraction, lowerBoundEstimator)
-	upperBoundEstimator = WithMargin(*safetyMarginFraction, upperBoundEstimator)
+	// CPU usage capped by the limit doesn't show the real demand, raise the
+	// estimations that fall within the capped range above the limit.
+	censoringThreshold := model.GetAggregationsConfig().CPULimitCensoringThreshold
+	targetEstimator = WithCPULimitCensoring(censoringThreshold, *cpuLimitCensoredBumpUpRatio, targetEstimator)
+	lowerBoundEstimator = WithCPULimitCensoring(censoringThreshold, *cpuLimitCensoredBumpUpRatio, lowerBoundEstimator)
+	upperBoundEstimator = WithCPULimitCensoring(censoringThreshold, *cpuLimitCensoredBumpUpRatio, upperBoundEstimator)
+
+	targetEstimator = WithMargin(safetyMarginFraction, targetEstimator)
+	lowerBoundEstimator = WithMargin(safetyMarginFraction, lowerBoundEstimator)
+	upperBoundEstimator = WithMargin(safetyMarginFraction, upperBoundEstimator)
 
 	// Apply confidence multiplier to the upper bound estimator. This means
 	// that the updater will be less eager to evict pods with short history
 	// in order to reclaim unused resources.
-	// Using the confidence multiplier 1 with exponent +1 means that
+	// By default, using the confidence multiplier 1 with exponent +1 means that
 	// the upper bound is multiplied by (1 + 1/history-length-in-days).
 	// See estimator.go to see how the history length and the confidence
 	// multiplier are determined. The formula yields the following multipliers:
@@ -128,12 +202,14 @@ func CreatePodResourceRecommender() PodResourceRecommender {
 	// 12h history    : *3    (force pod eviction if the request is > 3 * upper bound)
 	// 24h history    : *2
 	// 1 week history : *1.14
-	upperBoundEstimator = WithConfidenceMultiplier(1.0, 1.0, upperBoundEstimator)
+	// The multiplier and the exponent are set with flags and can be
+	// overridden per VPA.
+	upperBoundEstimator = WithBoundConfidenceMultiplier(UpperBound, *upperBoundConfidenceMultiplier, *upperBoundConfidenceExponent, upperBoundEstimator)
 
 	// Apply confidence multiplier to the lower bound estimator. This means
 	// that the updater will be less eager to evict pods with short history
 	// in order to provision them with more resources.
-	// Using the confidence multiplier 0.001 with exponent -2 means that
+	// By default, using the confidence multiplier 0.001 with exponent -2 means that
 	// the lower bound is multiplied by the factor (1 + 0.001/history-length-in-days)^-2
 	// (which is very rapidly converging to 1.0).
 	// See estimator.go to see how the history length and the confidence
@@ -142,7 +218,13 @@ func CreatePodResourceRecommender() PodResourceRecommender {
 	// 5m history   : *0.6 (force pod eviction if the request is < 0.6 * lower bound)
 	// 30m history  : *0.9
 	// 60m history  : *0.95
-	lowerBoundEstimator = WithConfidenceMultiplier(0.001, -2.0, lowerBoundEstimator)
+	lowerBoundEstimator = WithBoundConfidenceMultiplier(LowerBound, *lowerBoundConfidenceMultiplier, *lowerBoundConfidenceExponent, lowerBoundEstimator)
+
+	// Extended resources aren't measured, recommend what the containers request
+	// so that they are kept when the recommendation is applied.
+	targetEstimator = WithExtendedResources(targetEstimator)
+	lowerBoundEstimator = WithExtendedResources(lowerBoundEstimator)
+	upperBoundEstimator = WithExtendedResources(upperBoundEstimator)
 
 	return &podResourceRecommender{
 		targetEstimator,
@@ -164,16 +246,27 @@ func MapToListOfRecommendedContainerResources(resources RecommendedPodResources)
 	sort.Strings(containerNames)
 	// Create the list of recommendations for each container.
 	for _, name := range containerNames {
-		containerResources = append(containerResources, vpa_types.RecommendedContainerResources{
+		containerRecommendation := vpa_types.RecommendedContainerResources{
 			ContainerName:  name,
 			Target:         model.ResourcesAsResourceList(resources[name].Target),
 			LowerBound:     model.ResourcesAsResourceList(resources[name].LowerBound),
 			UpperBound:     model.ResourcesAsResourceList(resources[name].UpperBound),
 			UncappedTarget: model.ResourcesAsResourceList(resources[name].Target),
-		})
+		}
+		if factors := resources[name].ConfidenceFactors; factors != nil {
+			containerRecommendation.LowerBoundConfidenceFactor = formatConfidenceFactor(factors.LowerBound)
+			containerRecommendation.UpperBoundConfidenceFactor = formatConfidenceFactor(factors.UpperBound)
+		}
+		containerResources = append(containerResources, containerRecommendation)
 	}
 	recommendation := &vpa_types.RecommendedPodResources{
 		ContainerRecommendations: containerResources,
 	}
 	return recommendation
 }
+
+// formatConfidenceFactor formats a confidence factor with 3 significant
+// digits, so that the status doesn't change with every sample.
+func formatConfidenceFactor(factor float64) string {
+	return strconv.FormatFloat(factor, 'g', 3, 64)
+}
@@ -17,9 +17,12 @@ limitations under the License.
 package logic
 
 import (
+	"math"
+
 	"github.com/stretchr/testify/assert"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
 	"testing"
+	"time"
 )
 
 func TestMinResourcesApplied(t *testing.T) {
@@ -165,3 +168,32 @@ func TestMapToListOfRecommendedContainerResources(t *testing.T) {
 		})
 	}
 }
+
+func TestMapToListOfRecommendedContainerResources_ConfidenceFactors(t *testing.T) {
+	resources := RecommendedPodResources{
+		"a-container": RecommendedContainerResources{ConfidenceFactors: &BoundConfidenceFactors{LowerBound: 0.9523, UpperBound: math.Inf(1)}},
+		"b-container": RecommendedContainerResources{},
+	}
+	recommendations := MapToListOfRecommendedContainerResources(resources).ContainerRecommendations
+	assert.Equal(t, "0.952", recommendations[0].LowerBoundConfidenceFactor)
+	assert.Equal(t, "+Inf", recommendations[0].UpperBoundConfidenceFactor)
+	assert.Empty(t, recommendations[1].LowerBoundConfidenceFactor)
+	assert.Empty(t, recommendations[1].UpperBoundConfidenceFactor)
+}
+
+func TestRecommendationWithMargin(t *testing.T) {
+	recommender := CreatePodResourceRecommender().(MarginAwarePodResourceRecommender)
+	containerName := "container-1"
+	state := model.NewAggregateContainerState()
+	state.AddSample(&model.ContainerUsageSample{
+		MeasureStart: time.Unix(0, 0),
+		Usage:        model.CPUAmountFromCores(1),
+		Request:      model.CPUAmountFromCores(1),
+		Resource:     model.ResourceCPU,
+	})
+	containerNameToAggregateStateMap := model.ContainerNameToAggregateStateMap{containerName: state}
+
+	withoutMargin := recommender.GetRecommendedPodResourcesWithMargin(containerNameToAggregateStateMap, 0)
+	withMargin := recommender.GetRecommendedPodResourcesWithMargin(containerNameToAggregateStateMap, 1)
+	assert.InDelta(t, 2*float64(withoutMargin[containerName].Target[model.ResourceCPU]), float64(withMargin[containerName].Target[model.ResourceCPU]), 1)
+}
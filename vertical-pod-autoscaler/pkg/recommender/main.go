@@ -17,18 +17,27 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/input"
+	"strings"
 	"time"
 
 	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/common"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/apiserver"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/input/history"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/input/oom"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/routines"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/leaderelection"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/metrics"
 	metrics_quality "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/metrics/quality"
 	metrics_recommender "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/metrics/recommender"
+	vpa_api_util "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/vpa"
+	kube_client "k8s.io/client-go/kubernetes"
 	kube_flag "k8s.io/component-base/cli/flag"
 	klog "k8s.io/klog/v2"
 )
@@ -44,11 +53,22 @@ var (
 	kubeApiQps             = flag.Float64("kube-api-qps", 5.0, `QPS limit when making requests to Kubernetes apiserver`)
 	kubeApiBurst           = flag.Float64("kube-api-burst", 10.0, `QPS burst limit when making requests to Kubernetes apiserver`)
 
-	storage = flag.String("storage", "", `Specifies storage mode. Supported values: prometheus, checkpoint (default)`)
+	metricsCertFile       = flag.String("metrics-tls-cert-file", "", `Path to the certificate PEM file metrics are served with over HTTPS at --address. Empty serves plain HTTP`)
+	metricsKeyFile        = flag.String("metrics-tls-private-key", "", `Path to the key PEM file of --metrics-tls-cert-file`)
+	metricsReloadInterval = flag.Duration("metrics-tls-reload-interval", time.Minute, `How often --metrics-tls-cert-file and --metrics-tls-private-key are reloaded, to pick up rotated certificates`)
+	metricsAuthentication = flag.Bool("metrics-authentication", false, `If true, clients of --address must authenticate with a bearer token, reviewed with a TokenReview, and be allowed to get the requested path, e.g. /metrics, by RBAC. Health checks are exempt`)
+	healthAddress         = flag.String("health-address", "", `Address to serve /healthz and /readyz at, separately from --address. Empty serves them at --address`)
+
+	metricsFeedMaxAge      = flag.Duration("metrics-feed-max-staleness", 0, `How long after the last successful load of usage samples from the metrics API the metrics feed is reported stale at /health-details. 0 means 5 times --recommender-interval`)
+	vpaSyncMaxAge          = flag.Duration("vpa-sync-max-staleness", 0, `How long after the last successful load of VPA objects the VPA sync is reported stale at /health-details. 0 means 5 times --recommender-interval`)
+	checkpointWritesMaxAge = flag.Duration("checkpoint-writes-max-staleness", 0, `How long after the last successful write of checkpoints the checkpoint writes are reported stale at /health-details. 0 means 5 times --recommender-interval`)
+
+	storage = flag.String("storage", "", `Specifies storage mode. Supported values: checkpoint (default), prometheus, sharded-prometheus`)
 	// prometheus history provider configs
 	historyLength       = flag.String("history-length", "8d", `How much time back prometheus have to be queried to get historical metrics`)
 	historyResolution   = flag.String("history-resolution", "1h", `Resolution at which Prometheus is queried for historical metrics`)
 	queryTimeout        = flag.String("prometheus-query-timeout", "5m", `How long to wait before killing long queries`)
+	shardDuration       = flag.Duration("history-shard-duration", 0, `Length of the time range of historical metrics queried at once, each query within --prometheus-query-timeout. 0 queries the whole --history-length at once, or 24h with --storage=sharded-prometheus`)
 	podLabelPrefix      = flag.String("pod-label-prefix", "pod_label_", `Which prefix to look for pod labels in metrics`)
 	podLabelsMetricName = flag.String("metric-for-pod-labels", "up{job=\"kubernetes-pods\"}", `Which metric to look for pod labels in metrics`)
 	podNamespaceLabel   = flag.String("pod-namespace-label", "kubernetes_namespace", `Label name to look for pod namespaces`)
@@ -56,81 +76,309 @@ var (
 	ctrNamespaceLabel   = flag.String("container-namespace-label", "namespace", `Label name to look for container namespaces`)
 	ctrPodNameLabel     = flag.String("container-pod-name-label", "pod_name", `Label name to look for container pod names`)
 	ctrNameLabel        = flag.String("container-name-label", "name", `Label name to look for container names`)
-	vpaObjectNamespace  = flag.String("vpa-object-namespace", apiv1.NamespaceAll, "Namespace to search for VPA objects and pod stats. Empty means all namespaces will be used.")
+	ctrNodeNameLabel    = flag.String("container-node-name-label", "instance", `Label name to look for the names of the nodes containers run on, used to normalize historical CPU usage with --cpu-performance-factor-node-label. Empty doesn't normalize historical CPU usage`)
+	vpaObjectNamespace  = flag.String("vpa-object-namespace", apiv1.NamespaceAll, "Comma separated list of namespaces to search for VPA objects and pod stats. Empty means all namespaces will be used.")
+)
+
+// VPA object filter flags
+var (
+	ignoredVpaObjectNamespaces = flag.String("ignored-vpa-object-namespaces", "", "Comma separated list of namespaces whose VPA objects and pods are ignored.")
+	vpaObjectLabels            = flag.String("vpa-object-labels", "", "Label selector of the VPA objects to process, e.g. tenant=a. Empty means all VPA objects will be processed.")
+)
+
+// Leader election flags
+var (
+	leaderElect                  = flag.Bool("leader-elect", false, `Start a leader election client and gain leadership before running the recommender loop. Allows running standby replicas`)
+	leaderElectLeaseDuration     = flag.Duration("leader-elect-lease-duration", leaderelection.DefaultLeaseDuration, `Duration that standby replicas wait before trying to acquire a lease which wasn't renewed`)
+	leaderElectRenewDeadline     = flag.Duration("leader-elect-renew-deadline", leaderelection.DefaultRenewDeadline, `Duration that the leader retries renewing the lease before giving it up`)
+	leaderElectRetryPeriod       = flag.Duration("leader-elect-retry-period", leaderelection.DefaultRetryPeriod, `Duration between attempts to acquire or renew the lease`)
+	leaderElectResourceName      = flag.String("leader-elect-resource-name", "", `Name of the Lease object used for leader election. Empty uses vpa-recommender-<recommender-name>`)
+	leaderElectResourceNamespace = flag.String("leader-elect-resource-namespace", "kube-system", `Namespace of the Lease object used for leader election`)
 )
 
+// Prometheus connection flags
+var (
+	prometheusBearerTokenFile    = flag.String("prometheus-bearer-token-file", "", `File with the bearer token sent to Prometheus, read on every request`)
+	prometheusUsername           = flag.String("prometheus-username", "", `Username for basic authentication to Prometheus`)
+	prometheusPasswordFile       = flag.String("prometheus-password-file", "", `File with the password for basic authentication to Prometheus as --prometheus-username, read on every request`)
+	prometheusCAFile             = flag.String("prometheus-ca-file", "", `CA certificate file used to verify the Prometheus server certificate. Empty uses the system roots`)
+	prometheusCertFile           = flag.String("prometheus-cert-file", "", `Client certificate file presented to Prometheus`)
+	prometheusKeyFile            = flag.String("prometheus-key-file", "", `Client key file matching --prometheus-cert-file`)
+	prometheusInsecureSkipVerify = flag.Bool("prometheus-insecure-skip-verify", false, `Skip verification of the Prometheus server certificate`)
+	prometheusHeaders            = map[string]string{}
+)
+
+func init() {
+	flag.Var(kube_flag.NewMapStringString(&prometheusHeaders), "prometheus-headers", `Comma separated list of Name=Value headers sent to Prometheus, e.g. X-Scope-OrgID=tenant`)
+}
+
 // Aggregation configuration flags
 var (
 	memoryAggregationInterval      = flag.Duration("memory-aggregation-interval", model.DefaultMemoryAggregationInterval, `The length of a single interval, for which the peak memory usage is computed. Memory usage peaks are aggregated in multiples of this interval. In other words there is one memory usage sample per interval (the maximum usage over that interval)`)
 	memoryAggregationIntervalCount = flag.Int64("memory-aggregation-interval-count", model.DefaultMemoryAggregationIntervalCount, `The number of consecutive memory-aggregation-intervals which make up the MemoryAggregationWindowLength which in turn is the period for memory usage aggregation by VPA. In other words, MemoryAggregationWindowLength = memory-aggregation-interval * memory-aggregation-interval-count.`)
 	memoryHistogramDecayHalfLife   = flag.Duration("memory-histogram-decay-half-life", model.DefaultMemoryHistogramDecayHalfLife, `The amount of time it takes a historical memory usage sample to lose half of its weight. In other words, a fresh usage sample is twice as 'important' as one with age equal to the half life period.`)
 	cpuHistogramDecayHalfLife      = flag.Duration("cpu-histogram-decay-half-life", model.DefaultCPUHistogramDecayHalfLife, `The amount of time it takes a historical CPU usage sample to lose half of its weight.`)
+	cpuLimitCensoringThreshold     = flag.Float64("cpu-limit-censoring-threshold", 0, `Fraction of the CPU limit above which CPU usage samples are considered capped by the limit, e.g. 0.95. The CPU recommendation of containers capped by their limit is raised above it. Zero disables it`)
+)
+
+// OOM observer flags
+var (
+	oomDedupWindow            = flag.Duration("oom-dedup-window", oom.DefaultDedupWindow, `OOMs of a container reported within this period of an already observed OOM are considered duplicates and dropped`)
+	oomEventWorkers           = flag.Int("oom-event-workers", oom.DefaultEventSourceConfig().Workers, `Number of workers processing eviction events in parallel`)
+	oomEventQps               = flag.Float64("oom-event-qps", oom.DefaultEventSourceConfig().QPS, `Rate limit of processing eviction events`)
+	oomEventBurst             = flag.Int("oom-event-burst", oom.DefaultEventSourceConfig().Burst, `Burst limit of processing eviction events`)
+	oomKmsgMetric             = flag.String("oom-kmsg-metric", "", `Name of the Prometheus counter exported by a node-level kernel log exporter, incremented on every OOM kill. Empty disables node-level OOM detection. Requires --prometheus-address`)
+	oomKmsgPollInterval       = flag.Duration("oom-kmsg-poll-interval", 30*time.Second, `How often Prometheus is queried for node-level OOM kills`)
+	oomKmsgNamespaceLabel     = flag.String("oom-kmsg-namespace-label", "namespace", `Label name to look for namespaces in the node-level OOM kill metric`)
+	oomKmsgPodNameLabel       = flag.String("oom-kmsg-pod-name-label", "pod", `Label name to look for pod names in the node-level OOM kill metric`)
+	oomKmsgContainerNameLabel = flag.String("oom-kmsg-container-name-label", "container", `Label name to look for container names in the node-level OOM kill metric`)
+	oomBumpUpRatio            = flag.Float64("oom-bump-up-ratio", model.OOMBumpUpRatio, `Ratio the memory of an OOM killed container is multiplied by to estimate the memory it needs`)
+	oomMinBumpUp              = flag.Float64("oom-min-bump-up-bytes", model.OOMMinBumpUp, `Minimal increase in bytes of the memory of an OOM killed container to estimate the memory it needs`)
+	oomSampleWeight           = flag.Float64("oom-sample-weight", model.DefaultOOMSampleWeight, `Weight of memory samples estimated from OOMs relative to regular memory peaks. Higher weights make memory recommendations recover from OOMs within fewer recommender loops`)
+)
+
+// Recommendation API flags
+var (
+	recommendationAPIAddress      = flag.String("recommendation-api-address", "", `Address to serve recommendations at as the read-only recommendations.autoscaling.k8s.io API, registered with the kube-aggregator by an APIService, e.g. :6443. Empty disables the API`)
+	recommendationAPICertFile     = flag.String("recommendation-api-tls-cert-file", "/etc/tls-certs/serverCert.pem", `Path to the recommendation API server certificate PEM file`)
+	recommendationAPIKeyFile      = flag.String("recommendation-api-tls-private-key", "/etc/tls-certs/serverKey.pem", `Path to the recommendation API server certificate key PEM file`)
+	recommendationAPIClientCAFile = flag.String("recommendation-api-client-ca-file", "/etc/tls-certs/requestheaderCA.pem", `Path to the CA PEM file verifying the client certificate the kube-apiserver proxies requests with, i.e. its --requestheader-client-ca-file`)
+	recommendationAPIAllowedNames = flag.String("recommendation-api-allowed-names", "", `Comma separated list of client certificate common names allowed to proxy requests, i.e. the kube-apiserver's --requestheader-allowed-names. Empty allows any name`)
+	readOnly                      = flag.Bool("read-only", false, `Don't write VPA statuses nor checkpoints, only serve recommendations at --recommendation-api-address`)
 )
 
 // Post processors flags
 var (
 	// CPU as integer to benefit for CPU management Static Policy ( https://kubernetes.io/docs/tasks/administer-cluster/cpu-management-policies/#static-policy )
 	postProcessorCPUasInteger = flag.Bool("cpu-integer-post-processor-enabled", false, "Enable the cpu-integer recommendation post processor. The post processor will round up CPU recommendations to a whole CPU for pods which were opted in by setting an appropriate label on VPA object (experimental)")
+
+	postProcessorNames       = flag.String("post-processors", "", `Comma separated, ordered list of recommendation post processors to apply, out of: `+strings.Join(routines.PostProcessorNames(), ", ")+`. Overrides --cpu-integer-post-processor-enabled. Capping to the resource policy is only done if "capping" is listed, usually last. Empty applies integer-cpu, if enabled, and capping`)
+	memoryRoundingIncrement  = flag.String("memory-rounding-increment", "128Mi", `Quantity the memory-rounding post processor rounds memory recommendations up to a multiple of`)
+	memoryRoundingPowerOfTwo = flag.Bool("memory-rounding-power-of-two", false, `If true, the memory-rounding post processor rounds memory recommendations up to the next power of two instead`)
+	cpuToMemoryRatio         = flag.Float64("cpu-to-memory-ratio", 0, `Number of CPU cores per GiB of memory the cpu-memory-ratio post processor keeps recommendations at, by raising whichever resource is below the ratio`)
 )
 
+func newPostProcessors() ([]routines.RecommendationPostProcessor, error) {
+	names := []string{"capping"}
+	if *postProcessorNames != "" {
+		names = strings.Split(*postProcessorNames, ",")
+		for i := range names {
+			names[i] = strings.TrimSpace(names[i])
+		}
+	} else if *postProcessorCPUasInteger {
+		names = []string{"integer-cpu", "capping"}
+	}
+	increment, err := resource.ParseQuantity(*memoryRoundingIncrement)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --memory-rounding-increment: %v", err)
+	}
+	return routines.NewPostProcessors(names, routines.PostProcessorConfig{
+		MemoryRoundingIncrement:  increment.Value(),
+		MemoryRoundingPowerOfTwo: *memoryRoundingPowerOfTwo,
+		CPUToMemoryRatio:         *cpuToMemoryRatio,
+	})
+}
+
+// freshnessMaxAges returns the maximum ages of the subsystems whose freshness
+// is reported at /health-details. Checkpoint writes are only checked if
+// checkpoints are written.
+func freshnessMaxAges(useCheckpoints bool) map[string]time.Duration {
+	maxAge := func(flagValue time.Duration) time.Duration {
+		if flagValue > 0 {
+			return flagValue
+		}
+		return *metricsFetcherInterval * 5
+	}
+	maxAges := map[string]time.Duration{
+		metrics_recommender.MetricsFeedSubsystem: maxAge(*metricsFeedMaxAge),
+		metrics_recommender.VpaSyncSubsystem:     maxAge(*vpaSyncMaxAge),
+	}
+	if useCheckpoints && !*readOnly {
+		maxAges[metrics_recommender.CheckpointWritesSubsystem] = maxAge(*checkpointWritesMaxAge)
+	}
+	return maxAges
+}
+
+func metricsServerConfig(kubeClient kube_client.Interface) metrics.ServerConfig {
+	config := metrics.ServerConfig{
+		Address:            *address,
+		HealthAddress:      *healthAddress,
+		CertFile:           *metricsCertFile,
+		KeyFile:            *metricsKeyFile,
+		CertReloadInterval: *metricsReloadInterval,
+	}
+	if *metricsAuthentication {
+		config.KubeClient = kubeClient
+	}
+	return config
+}
+
 func main() {
 	klog.InitFlags(nil)
 	kube_flag.InitFlags()
 	klog.V(1).Infof("Vertical Pod Autoscaler %s Recommender: %v", common.VerticalPodAutoscalerVersion, recommenderName)
 
 	config := common.CreateKubeConfigOrDie(*kubeconfig, float32(*kubeApiQps), int(*kubeApiBurst))
+	kubeClient := kube_client.NewForConfigOrDie(config)
 
-	model.InitializeAggregationsConfig(model.NewAggregationsConfig(*memoryAggregationInterval, *memoryAggregationIntervalCount, *memoryHistogramDecayHalfLife, *cpuHistogramDecayHalfLife))
+	if *cpuLimitCensoringThreshold < 0 || *cpuLimitCensoringThreshold > 1 {
+		klog.Fatalf("--cpu-limit-censoring-threshold must be between 0 and 1")
+	}
+	if *oomBumpUpRatio < 1 || *oomMinBumpUp < 0 || *oomSampleWeight <= 0 {
+		klog.Fatalf("--oom-bump-up-ratio must be at least 1, --oom-min-bump-up-bytes non-negative and --oom-sample-weight positive")
+	}
+	aggregationsConfig := model.NewAggregationsConfig(*memoryAggregationInterval, *memoryAggregationIntervalCount, *memoryHistogramDecayHalfLife, *cpuHistogramDecayHalfLife)
+	aggregationsConfig.OOMBumpUpRatio = *oomBumpUpRatio
+	aggregationsConfig.OOMMinBumpUp = *oomMinBumpUp
+	aggregationsConfig.OOMSampleWeight = *oomSampleWeight
+	aggregationsConfig.CPULimitCensoringThreshold = *cpuLimitCensoringThreshold
+	model.InitializeAggregationsConfig(aggregationsConfig)
 
-	healthCheck := metrics.NewHealthCheck(*metricsFetcherInterval*5, true)
-	metrics.Initialize(*address, healthCheck)
+	useCheckpoints := *storage == "" || *storage == "checkpoint"
+
+	// Activity is only checked once this replica runs the recommender loop.
+	healthCheck := metrics.NewHealthCheck(*metricsFetcherInterval*5, false)
+	readinessCheck := metrics.NewReadinessCheck()
+	freshnessCheck := metrics_recommender.RegisterFreshnessCheck(freshnessMaxAges(useCheckpoints))
+	serverConfig := metricsServerConfig(kubeClient)
+	serverConfig.FreshnessCheck = freshnessCheck
+	metrics.Serve(serverConfig, healthCheck, readinessCheck)
 	metrics_recommender.Register()
 	metrics_quality.Register()
 
-	useCheckpoints := *storage != "prometheus"
-
-	var postProcessors []routines.RecommendationPostProcessor
-	if *postProcessorCPUasInteger {
-		postProcessors = append(postProcessors, &routines.IntegerCPUPostProcessor{})
+	postProcessors, err := newPostProcessors()
+	if err != nil {
+		klog.Fatalf("Invalid post processors: %v", err)
 	}
-	// CappingPostProcessor, should always come in the last position for post-processing
-	postProcessors = append(postProcessors, &routines.CappingPostProcessor{})
-
-	recommender := routines.NewRecommender(config, *checkpointsGCInterval, useCheckpoints, *vpaObjectNamespace, *recommenderName, postProcessors)
 
 	promQueryTimeout, err := time.ParseDuration(*queryTimeout)
 	if err != nil {
 		klog.Fatalf("Could not parse --prometheus-query-timeout as a time.Duration: %v", err)
 	}
 
-	if useCheckpoints {
-		recommender.GetClusterStateFeeder().InitFromCheckpoints()
-	} else {
-		config := history.PrometheusHistoryProviderConfig{
-			Address:                *prometheusAddress,
-			QueryTimeout:           promQueryTimeout,
-			HistoryLength:          *historyLength,
-			HistoryResolution:      *historyResolution,
-			PodLabelPrefix:         *podLabelPrefix,
-			PodLabelsMetricName:    *podLabelsMetricName,
-			PodNamespaceLabel:      *podNamespaceLabel,
-			PodNameLabel:           *podNameLabel,
-			CtrNamespaceLabel:      *ctrNamespaceLabel,
-			CtrPodNameLabel:        *ctrPodNameLabel,
-			CtrNameLabel:           *ctrNameLabel,
-			CadvisorMetricsJobName: *prometheusJobName,
-			Namespace:              *vpaObjectNamespace,
+	oomConfig := oom.ObserverConfig{
+		DedupWindow: *oomDedupWindow,
+		Events: oom.EventSourceConfig{
+			Workers: *oomEventWorkers,
+			QPS:     *oomEventQps,
+			Burst:   *oomEventBurst,
+		},
+	}
+	if *oomKmsgMetric != "" {
+		if *prometheusAddress == "" {
+			klog.Fatalf("--oom-kmsg-metric requires --prometheus-address to be set")
+		}
+		oomConfig.Kmsg = &oom.KmsgSourceConfig{
+			Address:            *prometheusAddress,
+			MetricName:         *oomKmsgMetric,
+			NamespaceLabel:     *oomKmsgNamespaceLabel,
+			PodNameLabel:       *oomKmsgPodNameLabel,
+			ContainerNameLabel: *oomKmsgContainerNameLabel,
+			PollInterval:       *oomKmsgPollInterval,
+			QueryTimeout:       promQueryTimeout,
+			ClientConfig:       prometheusClientConfig(),
+		}
+	}
+
+	if *readOnly && *recommendationAPIAddress == "" {
+		klog.Fatalf("--read-only requires --recommendation-api-address to be set")
+	}
+	var recommendationStore *apiserver.RecommendationStore
+	if *recommendationAPIAddress != "" {
+		recommendationStore = apiserver.NewRecommendationStore()
+	}
+
+	vpaObjectFilter, err := vpa_api_util.NewVpaObjectFilter(*vpaObjectNamespace, *ignoredVpaObjectNamespaces, *vpaObjectLabels)
+	if err != nil {
+		klog.Fatalf("Invalid --vpa-object-labels: %v", err)
+	}
+	recommender := routines.NewRecommender(config, *checkpointsGCInterval, useCheckpoints, vpaObjectFilter, *recommenderName, postProcessors, oomConfig, recommendationStore, *readOnly)
+
+	leaderElection := leaderelection.Config{
+		Enabled:           *leaderElect,
+		ResourceName:      *leaderElectResourceName,
+		ResourceNamespace: *leaderElectResourceNamespace,
+		LeaseDuration:     *leaderElectLeaseDuration,
+		RenewDeadline:     *leaderElectRenewDeadline,
+		RetryPeriod:       *leaderElectRetryPeriod,
+	}
+	if leaderElection.ResourceName == "" {
+		leaderElection.ResourceName = "vpa-recommender-" + *recommenderName
+	}
+	// Standby replicas are ready too, to take over the leadership.
+	readinessCheck.MarkReady()
+	err = leaderelection.Run(context.Background(), kubeClient, leaderElection, func(_ context.Context) {
+		healthCheck.StartMonitoring()
+		freshnessCheck.StartMonitoring()
+		if recommendationStore != nil {
+			go serveRecommendationAPI(kubeClient, recommendationStore)
+		}
+		if useCheckpoints {
+			recommender.GetClusterStateFeeder().InitFromCheckpoints()
+		} else {
+			config := history.PrometheusHistoryProviderConfig{
+				Address:                *prometheusAddress,
+				QueryTimeout:           promQueryTimeout,
+				HistoryLength:          *historyLength,
+				HistoryResolution:      *historyResolution,
+				PodLabelPrefix:         *podLabelPrefix,
+				PodLabelsMetricName:    *podLabelsMetricName,
+				PodNamespaceLabel:      *podNamespaceLabel,
+				PodNameLabel:           *podNameLabel,
+				CtrNamespaceLabel:      *ctrNamespaceLabel,
+				CtrPodNameLabel:        *ctrPodNameLabel,
+				CtrNameLabel:           *ctrNameLabel,
+				CtrNodeNameLabel:       *ctrNodeNameLabel,
+				CadvisorMetricsJobName: *prometheusJobName,
+				Namespace:              vpaObjectFilter.Namespace(),
+				ShardDuration:          *shardDuration,
+				ClientConfig:           prometheusClientConfig(),
+			}
+			provider, err := history.NewHistoryProvider(*storage, config)
+			if err != nil {
+				klog.Fatalf("Could not initialize history provider: %v", err)
+			}
+			recommender.GetClusterStateFeeder().InitFromHistoryProvider(provider)
 		}
-		provider, err := history.NewPrometheusHistoryProvider(config)
-		if err != nil {
-			klog.Fatalf("Could not initialize history provider: %v", err)
+
+		ticker := time.Tick(*metricsFetcherInterval)
+		for range ticker {
+			recommender.RunOnce()
+			healthCheck.UpdateLastActivity()
 		}
-		recommender.GetClusterStateFeeder().InitFromHistoryProvider(provider)
+	})
+	if err != nil {
+		klog.Fatalf("Leader election failed: %v", err)
+	}
+}
+
+func serveRecommendationAPI(kubeClient kube_client.Interface, store *apiserver.RecommendationStore) {
+	var allowedNames []string
+	if *recommendationAPIAllowedNames != "" {
+		allowedNames = strings.Split(*recommendationAPIAllowedNames, ",")
+	}
+	handler := apiserver.NewHandler(store, apiserver.NewSubjectAccessReviewAuthorizer(kubeClient), allowedNames)
+	config := apiserver.ServerConfig{
+		Address:      *recommendationAPIAddress,
+		CertFile:     *recommendationAPICertFile,
+		KeyFile:      *recommendationAPIKeyFile,
+		ClientCAFile: *recommendationAPIClientCAFile,
 	}
+	klog.V(1).Infof("Serving recommendation API at %s", config.Address)
+	if err := apiserver.ListenAndServe(config, handler); err != nil {
+		klog.Fatalf("Recommendation API server failed: %v", err)
+	}
+}
 
-	ticker := time.Tick(*metricsFetcherInterval)
-	for range ticker {
-		recommender.RunOnce()
-		healthCheck.UpdateLastActivity()
+func prometheusClientConfig() history.PrometheusClientConfig {
+	return history.PrometheusClientConfig{
+		BearerTokenFile:    *prometheusBearerTokenFile,
+		Username:           *prometheusUsername,
+		PasswordFile:       *prometheusPasswordFile,
+		CAFile:             *prometheusCAFile,
+		CertFile:           *prometheusCertFile,
+		KeyFile:            *prometheusKeyFile,
+		InsecureSkipVerify: *prometheusInsecureSkipVerify,
+		Headers:            prometheusHeaders,
 	}
 }
@@ -110,6 +110,15 @@ type AggregateContainerState struct {
 	UpdateMode          *vpa_types.UpdateMode
 	ScalingMode         *vpa_types.ContainerScalingMode
 	ControlledResources *[]ResourceName
+	// AggregationOverrides are the aggregation parameters overridden by the
+	// VPA controlling this aggregator.
+	AggregationOverrides AggregationOverrides
+	// CPUCensoringLimit is the CPU limit recent CPU usage samples were capped
+	// at, zero if the latest samples were not capped.
+	CPUCensoringLimit ResourceAmount
+	// ExtendedRequests are the latest requests of extended resources of the
+	// containers, which are passed through to their recommendation.
+	ExtendedRequests Resources
 }
 
 // GetLastRecommendation returns last recorded recommendation.
@@ -151,12 +160,47 @@ func (a *AggregateContainerState) MarkNotAutoscaled() {
 	a.UpdateMode = nil
 	a.ScalingMode = nil
 	a.ControlledResources = nil
+	a.SetAggregationOverrides(AggregationOverrides{})
+}
+
+// SetAggregationOverrides sets the aggregation parameters overridden by the VPA
+// controlling this aggregator. Histograms are converted to a changed decay
+// half life, keeping their samples.
+func (a *AggregateContainerState) SetAggregationOverrides(overrides AggregationOverrides) {
+	config := GetAggregationsConfig()
+	if halfLife := cpuHistogramDecayHalfLife(overrides); halfLife != cpuHistogramDecayHalfLife(a.AggregationOverrides) {
+		a.AggregateCPUUsage = convertHistogram(a.AggregateCPUUsage, config.CPUHistogramOptions, halfLife)
+	}
+	if halfLife := memoryHistogramDecayHalfLife(overrides); halfLife != memoryHistogramDecayHalfLife(a.AggregationOverrides) {
+		a.AggregateMemoryPeaks = convertHistogram(a.AggregateMemoryPeaks, config.MemoryHistogramOptions, halfLife)
+	}
+	a.AggregationOverrides = overrides
 }
 
 // MergeContainerState merges two AggregateContainerStates.
 func (a *AggregateContainerState) MergeContainerState(other *AggregateContainerState) {
-	a.AggregateCPUUsage.Merge(other.AggregateCPUUsage)
-	a.AggregateMemoryPeaks.Merge(other.AggregateMemoryPeaks)
+	if cpuHistogramDecayHalfLife(other.AggregationOverrides) != cpuHistogramDecayHalfLife(a.AggregationOverrides) ||
+		memoryHistogramDecayHalfLife(other.AggregationOverrides) != memoryHistogramDecayHalfLife(a.AggregationOverrides) {
+		// Histograms with different decay can't be merged, convert a copy first.
+		converted := &AggregateContainerState{
+			AggregateCPUUsage:    other.AggregateCPUUsage,
+			AggregateMemoryPeaks: other.AggregateMemoryPeaks,
+			AggregationOverrides: other.AggregationOverrides,
+		}
+		converted.SetAggregationOverrides(a.AggregationOverrides)
+		a.AggregateCPUUsage.Merge(converted.AggregateCPUUsage)
+		a.AggregateMemoryPeaks.Merge(converted.AggregateMemoryPeaks)
+	} else {
+		a.AggregateCPUUsage.Merge(other.AggregateCPUUsage)
+		a.AggregateMemoryPeaks.Merge(other.AggregateMemoryPeaks)
+	}
+	a.CPUCensoringLimit = ResourceAmountMax(a.CPUCensoringLimit, other.CPUCensoringLimit)
+	for resource, amount := range other.ExtendedRequests {
+		if a.ExtendedRequests == nil {
+			a.ExtendedRequests = make(Resources)
+		}
+		a.ExtendedRequests[resource] = ResourceAmountMax(a.ExtendedRequests[resource], amount)
+	}
 
 	if a.FirstSampleStart.IsZero() ||
 		(!other.FirstSampleStart.IsZero() && other.FirstSampleStart.Before(a.FirstSampleStart)) {
@@ -168,13 +212,33 @@ func (a *AggregateContainerState) MergeContainerState(other *AggregateContainerS
 	a.TotalSamplesCount += other.TotalSamplesCount
 }
 
+// SetExtendedRequests records the extended resources among the requests of a
+// container aggregated by this state.
+func (a *AggregateContainerState) SetExtendedRequests(request Resources) {
+	a.ExtendedRequests = nil
+	for resource, amount := range request {
+		if !IsExtendedResource(resource) {
+			continue
+		}
+		if a.ExtendedRequests == nil {
+			a.ExtendedRequests = make(Resources)
+		}
+		a.ExtendedRequests[resource] = amount
+	}
+}
+
 // NewAggregateContainerState returns a new, empty AggregateContainerState.
 func NewAggregateContainerState() *AggregateContainerState {
+	return newAggregateContainerStateWithOverrides(AggregationOverrides{})
+}
+
+func newAggregateContainerStateWithOverrides(overrides AggregationOverrides) *AggregateContainerState {
 	config := GetAggregationsConfig()
 	return &AggregateContainerState{
-		AggregateCPUUsage:    util.NewDecayingHistogram(config.CPUHistogramOptions, config.CPUHistogramDecayHalfLife),
-		AggregateMemoryPeaks: util.NewDecayingHistogram(config.MemoryHistogramOptions, config.MemoryHistogramDecayHalfLife),
+		AggregateCPUUsage:    util.NewDecayingHistogram(config.CPUHistogramOptions, cpuHistogramDecayHalfLife(overrides)),
+		AggregateMemoryPeaks: util.NewDecayingHistogram(config.MemoryHistogramOptions, memoryHistogramDecayHalfLife(overrides)),
 		CreationTime:         time.Now(),
+		AggregationOverrides: overrides,
 	}
 }
 
@@ -184,7 +248,7 @@ func (a *AggregateContainerState) AddSample(sample *ContainerUsageSample) {
 	case ResourceCPU:
 		a.addCPUSample(sample)
 	case ResourceMemory:
-		a.AggregateMemoryPeaks.AddSample(BytesFromMemoryAmount(sample.Usage), 1.0, sample.MeasureStart)
+		a.AggregateMemoryPeaks.AddSample(BytesFromMemoryAmount(sample.Usage), sample.memoryPeakWeight(), sample.MeasureStart)
 	default:
 		panic(fmt.Sprintf("AddSample doesn't support resource '%s'", sample.Resource))
 	}
@@ -198,7 +262,7 @@ func (a *AggregateContainerState) AddSample(sample *ContainerUsageSample) {
 func (a *AggregateContainerState) SubtractSample(sample *ContainerUsageSample) {
 	switch sample.Resource {
 	case ResourceMemory:
-		a.AggregateMemoryPeaks.SubtractSample(BytesFromMemoryAmount(sample.Usage), 1.0, sample.MeasureStart)
+		a.AggregateMemoryPeaks.SubtractSample(BytesFromMemoryAmount(sample.Usage), sample.memoryPeakWeight(), sample.MeasureStart)
 	default:
 		panic(fmt.Sprintf("SubtractSample doesn't support resource '%s'", sample.Resource))
 	}
@@ -212,6 +276,14 @@ func (a *AggregateContainerState) addCPUSample(sample *ContainerUsageSample) {
 	// which helps react quickly to CPU starvation.
 	a.AggregateCPUUsage.AddSample(
 		cpuUsageCores, math.Max(cpuRequestCores, minSampleWeight), sample.MeasureStart)
+	// A capped sample only bounds the demand from below, remember the limit
+	// so that the estimation doesn't take it for the real demand. Usage above
+	// the remembered limit means it was raised and no longer caps.
+	if sample.CensoringLimit > 0 {
+		a.CPUCensoringLimit = sample.CensoringLimit
+	} else if sample.Usage > a.CPUCensoringLimit {
+		a.CPUCensoringLimit = 0
+	}
 	if sample.MeasureStart.After(a.LastSampleStart) {
 		a.LastSampleStart = sample.MeasureStart
 	}
@@ -298,7 +370,7 @@ func AggregateStateByContainerName(aggregateContainerStateMap aggregateContainer
 		containerName := aggregationKey.ContainerName()
 		aggregateContainerState, isInitialized := containerNameToAggregateStateMap[containerName]
 		if !isInitialized {
-			aggregateContainerState = NewAggregateContainerState()
+			aggregateContainerState = newAggregateContainerStateWithOverrides(aggregation.AggregationOverrides)
 			containerNameToAggregateStateMap[containerName] = aggregateContainerState
 		}
 		aggregateContainerState.MergeContainerState(aggregation)
@@ -101,7 +101,7 @@ func TestAggregateStateByContainerName(t *testing.T) {
 	assert.NoError(t, addTestMemorySample(cluster, containers[3], 10e9)) // app-C
 
 	// Build the AggregateContainerStateMap.
-	aggregateResources := AggregateStateByContainerName(cluster.aggregateStateMap)
+	aggregateResources := AggregateStateByContainerName(cluster.aggregateStateMap())
 	assert.Contains(t, aggregateResources, "app-A")
 	assert.Contains(t, aggregateResources, "app-B")
 	assert.Contains(t, aggregateResources, "app-C")
@@ -276,6 +276,12 @@ func TestUpdateFromPolicyControlledResources(t *testing.T) {
 				ControlledResources: &[]apiv1.ResourceName{apiv1.ResourceMemory},
 			},
 			expected: []ResourceName{ResourceMemory},
+		}, {
+			name: "ControlledResources with extended resources",
+			policy: &vpa_types.ContainerResourcePolicy{
+				ControlledResources: &[]apiv1.ResourceName{apiv1.ResourceCPU, "nvidia.com/gpu", "hugepages-2Mi", "kubernetes.io/unknown"},
+			},
+			expected: []ResourceName{ResourceCPU, "nvidia.com/gpu", "hugepages-2Mi"},
 		}, {
 			name:     "No ControlledResources specified - used default",
 			policy:   &vpa_types.ContainerResourcePolicy{},
@@ -0,0 +1,48 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// AggregationContainerNameFunc returns the container name under which usage
+// samples of a container with the given name, in a pod with the given labels,
+// are aggregated. Recommendations are published under that name.
+type AggregationContainerNameFunc func(podLabels labels.Set, containerName string) string
+
+// AggregateByContainerName aggregates usage samples by the name of the container.
+func AggregateByContainerName(_ labels.Set, containerName string) string {
+	return containerName
+}
+
+// NewAggregateByLabelPrefix returns an AggregationContainerNameFunc for
+// containers whose names embed unique suffixes, e.g. generated by operators.
+// If the pod has the given label and the container name starts with the label
+// value, samples are aggregated under the label value. Other containers, e.g.
+// sidecars, are aggregated by their names.
+func NewAggregateByLabelPrefix(label string) AggregationContainerNameFunc {
+	return func(podLabels labels.Set, containerName string) string {
+		stableName, found := podLabels[label]
+		if found && stableName != "" && strings.HasPrefix(containerName, stableName) {
+			return stableName
+		}
+		return containerName
+	}
+}
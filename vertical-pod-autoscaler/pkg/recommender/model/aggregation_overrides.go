@@ -0,0 +1,99 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/util"
+	vpa_api_util "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/vpa"
+	"k8s.io/klog/v2"
+)
+
+// AggregationOverrides holds aggregation parameters overridden for the
+// containers of a single VPA, see vpa_api_util.AggregationOverrides.
+type AggregationOverrides = vpa_api_util.AggregationOverrides
+
+// describeAggregationOverrides returns the overridden parameters, e.g.
+// "cpu-histogram-decay-half-life=12h0m0s", or "" if none is overridden.
+func describeAggregationOverrides(o AggregationOverrides) string {
+	var overridden []string
+	add := func(name string, value interface{}, isSet bool) {
+		if isSet {
+			overridden = append(overridden, fmt.Sprintf("%s=%v", name, value))
+		}
+	}
+	add("cpu-histogram-decay-half-life", o.CPUHistogramDecayHalfLife, o.CPUHistogramDecayHalfLife > 0)
+	add("memory-histogram-decay-half-life", o.MemoryHistogramDecayHalfLife, o.MemoryHistogramDecayHalfLife > 0)
+	add("target-cpu-percentile", o.TargetCPUPercentile, o.TargetCPUPercentile > 0)
+	add("target-memory-percentile", o.TargetMemoryPercentile, o.TargetMemoryPercentile > 0)
+	add("lower-bound-confidence-multiplier", o.LowerBoundConfidenceMultiplier, o.LowerBoundConfidenceMultiplier > 0)
+	add("lower-bound-confidence-exponent", o.LowerBoundConfidenceExponent, o.LowerBoundConfidenceExponent != 0)
+	add("upper-bound-confidence-multiplier", o.UpperBoundConfidenceMultiplier, o.UpperBoundConfidenceMultiplier > 0)
+	add("upper-bound-confidence-exponent", o.UpperBoundConfidenceExponent, o.UpperBoundConfidenceExponent != 0)
+	return strings.Join(overridden, ", ")
+}
+
+// setAggregationOverriddenCondition reflects the aggregation overrides of a
+// VPA, and the error parsing them, in its AggregationOverridden condition.
+func (conditionsMap *vpaConditionsMap) setAggregationOverriddenCondition(overrides AggregationOverrides, err error) {
+	description := describeAggregationOverrides(overrides)
+	switch {
+	case err != nil:
+		message := fmt.Sprintf("Ignoring invalid annotations: %v", err)
+		if description != "" {
+			message = fmt.Sprintf("Overridden: %s. %s", description, message)
+		}
+		conditionsMap.Set(vpa_types.AggregationOverridden, description != "", "InvalidAnnotations", message)
+	case description != "":
+		conditionsMap.Set(vpa_types.AggregationOverridden, true, "AnnotationsApplied", fmt.Sprintf("Overridden: %s", description))
+	default:
+		delete(*conditionsMap, vpa_types.AggregationOverridden)
+	}
+}
+
+func cpuHistogramDecayHalfLife(o AggregationOverrides) time.Duration {
+	if o.CPUHistogramDecayHalfLife > 0 {
+		return o.CPUHistogramDecayHalfLife
+	}
+	return GetAggregationsConfig().CPUHistogramDecayHalfLife
+}
+
+func memoryHistogramDecayHalfLife(o AggregationOverrides) time.Duration {
+	if o.MemoryHistogramDecayHalfLife > 0 {
+		return o.MemoryHistogramDecayHalfLife
+	}
+	return GetAggregationsConfig().MemoryHistogramDecayHalfLife
+}
+
+// convertHistogram returns a decaying histogram with the given half life,
+// holding the samples of the given histogram.
+func convertHistogram(histogram util.Histogram, options util.HistogramOptions, halfLife time.Duration) util.Histogram {
+	converted := util.NewDecayingHistogram(options, halfLife)
+	checkpoint, err := histogram.SaveToChekpoint()
+	if err == nil {
+		err = converted.LoadFromCheckpoint(checkpoint)
+	}
+	if err != nil {
+		klog.Errorf("Cannot convert histogram to decay half life %v, dropping its samples: %v", halfLife, err)
+		return util.NewDecayingHistogram(options, halfLife)
+	}
+	return converted
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/util"
+)
+
+// Verifies that overriding the decay half life keeps the aggregated samples,
+// and that aggregations with different half lives can be merged.
+func TestSetAggregationOverrides(t *testing.T) {
+	config := GetAggregationsConfig()
+	overrides := AggregationOverrides{CPUHistogramDecayHalfLife: time.Hour}
+	state := NewAggregateContainerState()
+	state.AddSample(&ContainerUsageSample{MeasureStart: testTimestamp, Usage: CPUAmountFromCores(2.0), Request: testRequest[ResourceCPU], Resource: ResourceCPU})
+
+	state.SetAggregationOverrides(overrides)
+	assert.Equal(t, overrides, state.AggregationOverrides)
+	assert.InEpsilon(t, 2.0, state.AggregateCPUUsage.Percentile(1.0), 0.05)
+	assert.True(t, state.AggregateMemoryPeaks.Equals(util.NewDecayingHistogram(config.MemoryHistogramOptions, config.MemoryHistogramDecayHalfLife)))
+	expected := util.NewDecayingHistogram(config.CPUHistogramOptions, time.Hour)
+	expected.AddSample(1.0, 1.0, testTimestamp)
+	assert.NotPanics(t, func() { state.AggregateCPUUsage.Merge(expected) })
+
+	other := NewAggregateContainerState()
+	other.AddSample(&ContainerUsageSample{MeasureStart: testTimestamp, Usage: CPUAmountFromCores(4.0), Request: testRequest[ResourceCPU], Resource: ResourceCPU})
+	assert.NotPanics(t, func() { state.MergeContainerState(other) })
+	assert.Equal(t, 2, state.TotalSamplesCount)
+	assert.InEpsilon(t, 4.0, state.AggregateCPUUsage.Percentile(1.0), 0.05)
+}
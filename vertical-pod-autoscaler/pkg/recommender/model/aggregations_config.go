@@ -51,6 +51,18 @@ type AggregationsConfig struct {
 	// CPUHistogramDecayHalfLife is the amount of time it takes a historical
 	// CPU usage sample to lose half of its weight.
 	CPUHistogramDecayHalfLife time.Duration
+	// OOMBumpUpRatio specifies how much memory will be added after observing OOM.
+	OOMBumpUpRatio float64
+	// OOMMinBumpUp specifies minimal increase of memory in bytes after observing OOM.
+	OOMMinBumpUp float64
+	// OOMSampleWeight is the weight of memory peaks estimated from OOMs,
+	// relative to regular memory peaks. Heavier OOM samples make memory
+	// recommendations recover from OOMs faster.
+	OOMSampleWeight float64
+	// CPULimitCensoringThreshold is the fraction of the CPU limit above which
+	// CPU usage samples are considered capped by the limit. Such samples only
+	// tell that the demand is at least the usage. Zero disables censoring.
+	CPULimitCensoringThreshold float64
 }
 
 const (
@@ -71,6 +83,8 @@ const (
 	// DefaultCPUHistogramDecayHalfLife is the default value for CPUHistogramDecayHalfLife.
 	// CPU usage sample to lose half of its weight.
 	DefaultCPUHistogramDecayHalfLife = time.Hour * 24
+	// DefaultOOMSampleWeight is the default value for OOMSampleWeight.
+	DefaultOOMSampleWeight = 1.0
 )
 
 // GetMemoryAggregationWindowLength returns the total length of the memory usage history aggregated by VPA.
@@ -110,6 +124,9 @@ func NewAggregationsConfig(memoryAggregationInterval time.Duration, memoryAggreg
 		HistogramBucketSizeGrowth:      DefaultHistogramBucketSizeGrowth,
 		MemoryHistogramDecayHalfLife:   memoryHistogramDecayHalfLife,
 		CPUHistogramDecayHalfLife:      cpuHistogramDecayHalfLife,
+		OOMBumpUpRatio:                 OOMBumpUpRatio,
+		OOMMinBumpUp:                   OOMMinBumpUp,
+		OOMSampleWeight:                DefaultOOMSampleWeight,
 	}
 	a.CPUHistogramOptions = a.cpuHistogramOptions()
 	a.MemoryHistogramOptions = a.memoryHistogramOptions()
@@ -17,7 +17,10 @@ limitations under the License.
 package model
 
 import (
+	"context"
 	"fmt"
+	"hash/fnv"
+	"sync"
 	"time"
 
 	apiv1 "k8s.io/api/core/v1"
@@ -25,12 +28,17 @@ import (
 	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
 	controllerfetcher "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/input/controller_fetcher"
 	vpa_utils "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/vpa"
+	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 )
 
 const (
 	// RecommendationMissingMaxDuration is maximum time that we accept the recommendation can be missing.
 	RecommendationMissingMaxDuration = 30 * time.Minute
+	// ShortLivedContainerNameSuffix is appended to the names of containers of
+	// short-lived pods to aggregate their usage separately. Container names
+	// can't contain dots, so it doesn't clash with names of other containers.
+	ShortLivedContainerNameSuffix = ".short-lived"
 )
 
 // ClusterState holds all runtime information about the cluster required for the
@@ -49,9 +57,14 @@ type ClusterState struct {
 	EmptyVPAs map[VpaID]time.Time
 	// Observed VPAs. Used to check if there are updates needed.
 	ObservedVpas []*vpa_types.VerticalPodAutoscaler
-
-	// All container aggregations where the usage samples are stored.
-	aggregateStateMap aggregateContainerStatesMap
+	// AggregationContainerName determines the container name under which usage
+	// samples of a container are aggregated.
+	AggregationContainerName AggregationContainerNameFunc
+
+	// All container aggregations where the usage samples are stored, sharded
+	// by namespace into segments locked separately, so samples of different
+	// namespaces are added in parallel without contention.
+	aggregateStateSegments []*aggregateStateSegment
 	// Map with all label sets used by the aggregations. It serves as a cache
 	// that allows to quickly access labels.Set corresponding to a labelSetKey.
 	labelSetMap labelSetMap
@@ -62,7 +75,54 @@ type ClusterState struct {
 
 // StateMapSize is the number of pods being tracked by the VPA
 func (cluster *ClusterState) StateMapSize() int {
-	return len(cluster.aggregateStateMap)
+	size := 0
+	for _, segment := range cluster.aggregateStateSegments {
+		segment.mutex.RLock()
+		size += len(segment.states)
+		segment.mutex.RUnlock()
+	}
+	return size
+}
+
+// aggregateStateSegmentCount is the number of segments aggregations are
+// sharded into.
+const aggregateStateSegmentCount = 32
+
+// aggregateStateSegment holds the aggregations of the namespaces hashed to
+// the segment.
+type aggregateStateSegment struct {
+	mutex  sync.RWMutex
+	states aggregateContainerStatesMap
+}
+
+func newAggregateStateSegments() []*aggregateStateSegment {
+	segments := make([]*aggregateStateSegment, aggregateStateSegmentCount)
+	for i := range segments {
+		segments[i] = &aggregateStateSegment{states: make(aggregateContainerStatesMap)}
+	}
+	return segments
+}
+
+// aggregateStateSegment returns the segment holding the aggregations of the
+// namespace. All aggregations, and so all VPAs they are linked to, of a
+// namespace are in the same segment.
+func (cluster *ClusterState) aggregateStateSegment(namespace string) *aggregateStateSegment {
+	hash := fnv.New32a()
+	hash.Write([]byte(namespace))
+	return cluster.aggregateStateSegments[hash.Sum32()%uint32(len(cluster.aggregateStateSegments))]
+}
+
+// aggregateStateMap returns all aggregations of the cluster state.
+func (cluster *ClusterState) aggregateStateMap() aggregateContainerStatesMap {
+	states := make(aggregateContainerStatesMap)
+	for _, segment := range cluster.aggregateStateSegments {
+		segment.mutex.RLock()
+		for key, state := range segment.states {
+			states[key] = state
+		}
+		segment.mutex.RUnlock()
+	}
+	return states
 }
 
 // AggregateStateKey determines the set of containers for which the usage samples
@@ -93,6 +153,10 @@ type PodState struct {
 	Containers map[string]*ContainerState
 	// PodPhase describing current life cycle phase of the Pod.
 	Phase apiv1.PodPhase
+	// ShortLived marks a pod which hasn't been running for long enough to
+	// represent long-running pods, e.g. a CI job. Usage of its containers is
+	// aggregated under names with ShortLivedContainerNameSuffix.
+	ShortLived bool
 }
 
 // NewClusterState returns a new ClusterState with no pods.
@@ -101,7 +165,8 @@ func NewClusterState(gcInterval time.Duration) *ClusterState {
 		Pods:                          make(map[PodID]*PodState),
 		Vpas:                          make(map[VpaID]*Vpa),
 		EmptyVPAs:                     make(map[VpaID]time.Time),
-		aggregateStateMap:             make(aggregateContainerStatesMap),
+		AggregationContainerName:      AggregateByContainerName,
+		aggregateStateSegments:        newAggregateStateSegments(),
 		labelSetMap:                   make(labelSetMap),
 		lastAggregateContainerStateGC: time.Unix(0, 0),
 		gcInterval:                    gcInterval,
@@ -145,6 +210,21 @@ func (cluster *ClusterState) AddOrUpdatePod(podID PodID, newLabels labels.Set, p
 	pod.Phase = phase
 }
 
+// SetPodShortLived marks the pod with the given PodID as short-lived or not,
+// if it is present in the ClusterState, and updates the links between its
+// containers and the aggregations accordingly.
+func (cluster *ClusterState) SetPodShortLived(podID PodID, shortLived bool) {
+	pod, podExists := cluster.Pods[podID]
+	if !podExists || pod.ShortLived == shortLived {
+		return
+	}
+	pod.ShortLived = shortLived
+	for containerName, container := range pod.Containers {
+		containerID := ContainerID{PodID: podID, ContainerName: containerName}
+		container.aggregator = cluster.findOrCreateAggregateContainerState(containerID)
+	}
+}
+
 // addPodToItsVpa increases the count of Pods associated with a VPA object.
 // Does a scan similar to findOrCreateAggregateContainerState so could be optimized if needed.
 func (cluster *ClusterState) addPodToItsVpa(pod *PodState) {
@@ -191,16 +271,26 @@ func (cluster *ClusterState) DeletePod(podID PodID) {
 // Requires the pod to be added to the ClusterState first. Otherwise an error is
 // returned.
 func (cluster *ClusterState) AddOrUpdateContainer(containerID ContainerID, request Resources) error {
+	return cluster.AddOrUpdateContainerWithLimit(containerID, request, nil)
+}
+
+// AddOrUpdateContainerWithLimit is like AddOrUpdateContainer, but also sets
+// the resource limits of the container.
+func (cluster *ClusterState) AddOrUpdateContainerWithLimit(containerID ContainerID, request, limit Resources) error {
 	pod, podExists := cluster.Pods[containerID.PodID]
 	if !podExists {
 		return NewKeyError(containerID.PodID)
 	}
+	aggregateState := cluster.findOrCreateAggregateContainerState(containerID)
+	aggregateState.SetExtendedRequests(request)
 	if container, containerExists := pod.Containers[containerID.ContainerName]; !containerExists {
-		cluster.findOrCreateAggregateContainerState(containerID)
-		pod.Containers[containerID.ContainerName] = NewContainerState(request, NewContainerStateAggregatorProxy(cluster, containerID))
+		container = NewContainerState(request, NewContainerStateAggregatorProxy(cluster, containerID))
+		container.Limit = limit
+		pod.Containers[containerID.ContainerName] = container
 	} else {
-		// Container aleady exists. Possibly update the request.
+		// Container aleady exists. Possibly update the request and limit.
 		container.Request = request
+		container.Limit = limit
 	}
 	return nil
 }
@@ -223,6 +313,40 @@ func (cluster *ClusterState) AddSample(sample *ContainerUsageSampleWithKey) erro
 	return nil
 }
 
+// AddSamples adds usage samples to the cluster state using up to workers
+// goroutines. Samples of containers sharing an aggregation are added by the
+// same goroutine, in order. Returns the error of adding each sample, nil for
+// aggregated samples.
+func (cluster *ClusterState) AddSamples(samples []*ContainerUsageSampleWithKey, workers int) []error {
+	errs := make([]error, len(samples))
+	groupByKey := make(map[AggregateStateKey]int)
+	var groups [][]int
+	for i, sample := range samples {
+		pod, podExists := cluster.Pods[sample.Container.PodID]
+		if !podExists {
+			errs[i] = NewKeyError(sample.Container.PodID)
+			continue
+		}
+		key := cluster.MakeAggregateStateKey(pod, sample.Container.ContainerName)
+		group, found := groupByKey[key]
+		if !found {
+			group = len(groups)
+			groupByKey[key] = group
+			groups = append(groups, nil)
+		}
+		groups[group] = append(groups[group], i)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	workqueue.ParallelizeUntil(context.Background(), workers, len(groups), func(group int) {
+		for _, i := range groups[group] {
+			errs[i] = cluster.AddSample(samples[i])
+		}
+	})
+	return errs
+}
+
 // RecordOOM adds info regarding OOM event in the model as an artificial memory sample.
 func (cluster *ClusterState) RecordOOM(containerID ContainerID, timestamp time.Time, requestedMemory ResourceAmount) error {
 	pod, podExists := cluster.Pods[containerID.PodID]
@@ -268,17 +392,27 @@ func (cluster *ClusterState) AddOrUpdateVpa(apiObject *vpa_types.VerticalPodAuto
 	if !vpaExists {
 		vpa = NewVpa(vpaID, selector, apiObject.CreationTimestamp.Time)
 		cluster.Vpas[vpaID] = vpa
-		for aggregationKey, aggregation := range cluster.aggregateStateMap {
+		segment := cluster.aggregateStateSegment(vpaID.Namespace)
+		segment.mutex.RLock()
+		for aggregationKey, aggregation := range segment.states {
 			vpa.UseAggregationIfMatching(aggregationKey, aggregation)
 		}
+		segment.mutex.RUnlock()
 		vpa.PodCount = len(cluster.GetMatchingPods(vpa))
 	}
 	vpa.TargetRef = apiObject.Spec.TargetRef
 	vpa.Annotations = annotationsMap
 	vpa.Conditions = conditionsMap
+	vpa.ConditionHistory = apiObject.Status.ConditionHistory
 	vpa.Recommendation = currentRecommendation
 	vpa.SetUpdateMode(apiObject.Spec.UpdatePolicy)
 	vpa.SetResourcePolicy(apiObject.Spec.ResourcePolicy)
+	overrides, err := vpa_utils.ParseAggregationOverrides(annotationsMap)
+	if err != nil {
+		klog.Warningf("Ignoring invalid aggregation overrides of VPA %s/%s: %v", vpaID.Namespace, vpaID.VpaName, err)
+	}
+	vpa.SetAggregationOverrides(overrides)
+	vpa.Conditions.setAggregationOverriddenCondition(overrides, err)
 	return nil
 }
 
@@ -314,6 +448,12 @@ func (cluster *ClusterState) getLabelSetKey(labelSet labels.Set) labelSetKey {
 // MakeAggregateStateKey returns the AggregateStateKey that should be used
 // to aggregate usage samples from a container with the given name in a given pod.
 func (cluster *ClusterState) MakeAggregateStateKey(pod *PodState, containerName string) AggregateStateKey {
+	if cluster.AggregationContainerName != nil {
+		containerName = cluster.AggregationContainerName(cluster.labelSetMap[pod.labelSetKey], containerName)
+	}
+	if pod.ShortLived {
+		containerName += ShortLivedContainerNameSuffix
+	}
 	return aggregateStateKey{
 		namespace:     pod.ID.Namespace,
 		containerName: containerName,
@@ -337,10 +477,20 @@ func (cluster *ClusterState) aggregateStateKeyForContainerID(containerID Contain
 // The pod with the corresponding PodID must already be present in the ClusterState.
 func (cluster *ClusterState) findOrCreateAggregateContainerState(containerID ContainerID) *AggregateContainerState {
 	aggregateStateKey := cluster.aggregateStateKeyForContainerID(containerID)
-	aggregateContainerState, aggregateStateExists := cluster.aggregateStateMap[aggregateStateKey]
+	segment := cluster.aggregateStateSegment(aggregateStateKey.Namespace())
+	segment.mutex.RLock()
+	aggregateContainerState, aggregateStateExists := segment.states[aggregateStateKey]
+	segment.mutex.RUnlock()
+	if aggregateStateExists {
+		return aggregateContainerState
+	}
+
+	segment.mutex.Lock()
+	defer segment.mutex.Unlock()
+	aggregateContainerState, aggregateStateExists = segment.states[aggregateStateKey]
 	if !aggregateStateExists {
 		aggregateContainerState = NewAggregateContainerState()
-		cluster.aggregateStateMap[aggregateStateKey] = aggregateContainerState
+		segment.states[aggregateStateKey] = aggregateContainerState
 		// Link the new aggregation to the existing VPAs.
 		for _, vpa := range cluster.Vpas {
 			vpa.UseAggregationIfMatching(aggregateStateKey, aggregateContainerState)
@@ -362,7 +512,7 @@ func (cluster *ClusterState) garbageCollectAggregateCollectionStates(now time.Ti
 	klog.V(1).Info("Garbage collection of AggregateCollectionStates triggered")
 	keysToDelete := make([]AggregateStateKey, 0)
 	contributiveKeys := cluster.getContributiveAggregateStateKeys(controllerFetcher)
-	for key, aggregateContainerState := range cluster.aggregateStateMap {
+	for key, aggregateContainerState := range cluster.aggregateStateMap() {
 		isKeyContributive := contributiveKeys[key]
 		if !isKeyContributive && aggregateContainerState.isEmpty() {
 			keysToDelete = append(keysToDelete, key)
@@ -375,7 +525,10 @@ func (cluster *ClusterState) garbageCollectAggregateCollectionStates(now time.Ti
 		}
 	}
 	for _, key := range keysToDelete {
-		delete(cluster.aggregateStateMap, key)
+		segment := cluster.aggregateStateSegment(key.Namespace())
+		segment.mutex.Lock()
+		delete(segment.states, key)
+		segment.mutex.Unlock()
 		for _, vpa := range cluster.Vpas {
 			vpa.DeleteAggregation(key)
 		}
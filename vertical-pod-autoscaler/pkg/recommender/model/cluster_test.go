@@ -29,6 +29,7 @@ import (
 	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
 	controllerfetcher "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/input/controller_fetcher"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/test"
+	vpa_api_util "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/vpa"
 	"k8s.io/klog/v2"
 )
 
@@ -95,6 +96,100 @@ func TestClusterAddSample(t *testing.T) {
 	assert.Equal(t, testTimestamp, containerStats.LastCPUSampleStart)
 }
 
+func TestClusterExtendedRequests(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	cluster.AddOrUpdatePod(testPodID, testLabels, apiv1.PodRunning)
+	request := Resources{ResourceCPU: CPUAmountFromCores(1), "nvidia.com/gpu": 2}
+	assert.NoError(t, cluster.AddOrUpdateContainer(testContainerID, request))
+	aggregateState := cluster.findOrCreateAggregateContainerState(testContainerID)
+	assert.Equal(t, Resources{"nvidia.com/gpu": 2}, aggregateState.ExtendedRequests)
+
+	// The GPU is removed from the container.
+	assert.NoError(t, cluster.AddOrUpdateContainer(testContainerID, Resources{ResourceCPU: CPUAmountFromCores(1)}))
+	assert.Empty(t, aggregateState.ExtendedRequests)
+}
+
+// Verifies that samples added in parallel are aggregated per aggregation, and
+// that errors are reported for the failing samples.
+func TestClusterAddSamples(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	var samples []*ContainerUsageSampleWithKey
+	for i := 0; i < 20; i++ {
+		podID := PodID{"namespace-1", fmt.Sprintf("pod-%d", i)}
+		labels := map[string]string{"app": fmt.Sprintf("app-%d", i%4)}
+		cluster.AddOrUpdatePod(podID, labels, apiv1.PodRunning)
+		containerID := ContainerID{podID, "container-1"}
+		assert.NoError(t, cluster.AddOrUpdateContainer(containerID, testRequest))
+		for j := 0; j < 5; j++ {
+			samples = append(samples, &ContainerUsageSampleWithKey{ContainerUsageSample{
+				MeasureStart: testTimestamp.Add(time.Duration(j) * time.Minute),
+				Usage:        CPUAmountFromCores(1.0),
+				Request:      testRequest[ResourceCPU],
+				Resource:     ResourceCPU},
+				containerID})
+		}
+	}
+	samples = append(samples, &ContainerUsageSampleWithKey{ContainerUsageSample{
+		MeasureStart: testTimestamp,
+		Usage:        CPUAmountFromCores(1.0),
+		Resource:     ResourceCPU},
+		ContainerID{PodID{"namespace-1", "missing-pod"}, "container-1"}})
+
+	errs := cluster.AddSamples(samples, 4)
+	if assert.Len(t, errs, len(samples)) {
+		for _, err := range errs[:len(samples)-1] {
+			assert.NoError(t, err)
+		}
+		assert.IsType(t, KeyError{}, errs[len(samples)-1])
+	}
+	assert.Len(t, cluster.aggregateStateMap(), 4)
+	for _, aggregateState := range cluster.aggregateStateMap() {
+		assert.Equal(t, 25, aggregateState.TotalSamplesCount)
+	}
+}
+
+// Verifies that aggregations of many namespaces, recreated while samples are
+// added in parallel, are linked to the VPAs of their namespace.
+func TestClusterAddSamplesRecreatesAggregations(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	var samples []*ContainerUsageSampleWithKey
+	var vpas []*Vpa
+	for i := 0; i < 40; i++ {
+		namespace := fmt.Sprintf("namespace-%d", i)
+		vpas = append(vpas, addVpa(cluster, VpaID{namespace, "vpa-1"}, testAnnotations, testSelectorStr, testTargetRef))
+		podID := PodID{namespace, "pod-1"}
+		cluster.AddOrUpdatePod(podID, testLabels, apiv1.PodRunning)
+		containerID := ContainerID{podID, "container-1"}
+		assert.NoError(t, cluster.AddOrUpdateContainer(containerID, testRequest))
+		samples = append(samples, &ContainerUsageSampleWithKey{ContainerUsageSample{
+			MeasureStart: testTimestamp,
+			Usage:        CPUAmountFromCores(1.0),
+			Request:      testRequest[ResourceCPU],
+			Resource:     ResourceCPU},
+			containerID})
+	}
+	// Drop the aggregations, as the garbage collection does.
+	for _, segment := range cluster.aggregateStateSegments {
+		segment.states = make(aggregateContainerStatesMap)
+	}
+	for _, vpa := range vpas {
+		vpa.aggregateContainerStates = make(aggregateContainerStatesMap)
+	}
+
+	for _, err := range cluster.AddSamples(samples, 8) {
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 40, cluster.StateMapSize())
+	for _, vpa := range vpas {
+		if assert.Len(t, vpa.aggregateContainerStates, 1) {
+			for key, aggregateState := range vpa.aggregateContainerStates {
+				assert.Equal(t, vpa.ID.Namespace, key.Namespace())
+				assert.Equal(t, 1, aggregateState.TotalSamplesCount)
+			}
+		}
+	}
+}
+
 func TestClusterGCAggregateContainerStateDeletesOld(t *testing.T) {
 	// Create a pod with a single container.
 	cluster := NewClusterState(testGcPeriod)
@@ -107,14 +202,14 @@ func TestClusterGCAggregateContainerStateDeletesOld(t *testing.T) {
 	// Add a usage sample to the container.
 	assert.NoError(t, cluster.AddSample(usageSample))
 
-	assert.NotEmpty(t, cluster.aggregateStateMap)
+	assert.NotEmpty(t, cluster.aggregateStateMap())
 	assert.NotEmpty(t, vpa.aggregateContainerStates)
 
 	// AggegateContainerState are valid for 8 days since last sample
 	cluster.garbageCollectAggregateCollectionStates(usageSample.MeasureStart.Add(9*24*time.Hour), testControllerFetcher)
 
 	// AggegateContainerState should be deleted from both cluster and vpa
-	assert.Empty(t, cluster.aggregateStateMap)
+	assert.Empty(t, cluster.aggregateStateMap())
 	assert.Empty(t, vpa.aggregateContainerStates)
 }
 
@@ -127,25 +222,25 @@ func TestClusterGCAggregateContainerStateDeletesOldEmpty(t *testing.T) {
 	assert.NoError(t, cluster.AddOrUpdateContainer(testContainerID, testRequest))
 	// No usage samples added.
 
-	assert.NotEmpty(t, cluster.aggregateStateMap)
+	assert.NotEmpty(t, cluster.aggregateStateMap())
 	assert.NotEmpty(t, vpa.aggregateContainerStates)
 
-	assert.Len(t, cluster.aggregateStateMap, 1)
+	assert.Len(t, cluster.aggregateStateMap(), 1)
 	var creationTime time.Time
-	for _, aggregateState := range cluster.aggregateStateMap {
+	for _, aggregateState := range cluster.aggregateStateMap() {
 		creationTime = aggregateState.CreationTime
 	}
 
 	// Verify empty aggregate states are not removed right away.
 	cluster.garbageCollectAggregateCollectionStates(creationTime.Add(1*time.Minute), testControllerFetcher) // AggegateContainerState should be deleted from both cluster and vpa
-	assert.NotEmpty(t, cluster.aggregateStateMap)
+	assert.NotEmpty(t, cluster.aggregateStateMap())
 	assert.NotEmpty(t, vpa.aggregateContainerStates)
 
 	// AggegateContainerState are valid for 8 days since creation
 	cluster.garbageCollectAggregateCollectionStates(creationTime.Add(9*24*time.Hour), testControllerFetcher)
 
 	// AggegateContainerState should be deleted from both cluster and vpa
-	assert.Empty(t, cluster.aggregateStateMap)
+	assert.Empty(t, cluster.aggregateStateMap())
 	assert.Empty(t, vpa.aggregateContainerStates)
 }
 
@@ -163,13 +258,13 @@ func TestClusterGCAggregateContainerStateDeletesEmptyInactiveWithoutController(t
 	assert.NoError(t, cluster.AddOrUpdateContainer(testContainerID, testRequest))
 	// No usage samples added.
 
-	assert.NotEmpty(t, cluster.aggregateStateMap)
+	assert.NotEmpty(t, cluster.aggregateStateMap())
 	assert.NotEmpty(t, vpa.aggregateContainerStates)
 
 	cluster.garbageCollectAggregateCollectionStates(testTimestamp, controller)
 
 	// AggegateContainerState should not be deleted as the pod is still active.
-	assert.NotEmpty(t, cluster.aggregateStateMap)
+	assert.NotEmpty(t, cluster.aggregateStateMap())
 	assert.NotEmpty(t, vpa.aggregateContainerStates)
 
 	cluster.Pods[pod.ID].Phase = apiv1.PodSucceeded
@@ -177,7 +272,7 @@ func TestClusterGCAggregateContainerStateDeletesEmptyInactiveWithoutController(t
 
 	// AggegateContainerState should be empty as the pod is no longer active, controller is not alive
 	// and there are no usage samples.
-	assert.Empty(t, cluster.aggregateStateMap)
+	assert.Empty(t, cluster.aggregateStateMap())
 	assert.Empty(t, vpa.aggregateContainerStates)
 }
 
@@ -192,20 +287,20 @@ func TestClusterGCAggregateContainerStateLeavesEmptyInactiveWithController(t *te
 	assert.NoError(t, cluster.AddOrUpdateContainer(testContainerID, testRequest))
 	// No usage samples added.
 
-	assert.NotEmpty(t, cluster.aggregateStateMap)
+	assert.NotEmpty(t, cluster.aggregateStateMap())
 	assert.NotEmpty(t, vpa.aggregateContainerStates)
 
 	cluster.garbageCollectAggregateCollectionStates(testTimestamp, controller)
 
 	// AggegateContainerState should not be deleted as the pod is still active.
-	assert.NotEmpty(t, cluster.aggregateStateMap)
+	assert.NotEmpty(t, cluster.aggregateStateMap())
 	assert.NotEmpty(t, vpa.aggregateContainerStates)
 
 	cluster.Pods[pod.ID].Phase = apiv1.PodSucceeded
 	cluster.garbageCollectAggregateCollectionStates(testTimestamp, controller)
 
 	// AggegateContainerState should not be delated as the controller is still alive.
-	assert.NotEmpty(t, cluster.aggregateStateMap)
+	assert.NotEmpty(t, cluster.aggregateStateMap())
 	assert.NotEmpty(t, vpa.aggregateContainerStates)
 }
 
@@ -221,13 +316,13 @@ func TestClusterGCAggregateContainerStateLeavesValid(t *testing.T) {
 	// Add a usage sample to the container.
 	assert.NoError(t, cluster.AddSample(usageSample))
 
-	assert.NotEmpty(t, cluster.aggregateStateMap)
+	assert.NotEmpty(t, cluster.aggregateStateMap())
 	assert.NotEmpty(t, vpa.aggregateContainerStates)
 
 	// AggegateContainerState are valid for 8 days since last sample
 	cluster.garbageCollectAggregateCollectionStates(usageSample.MeasureStart.Add(7*24*time.Hour), testControllerFetcher)
 
-	assert.NotEmpty(t, cluster.aggregateStateMap)
+	assert.NotEmpty(t, cluster.aggregateStateMap())
 	assert.NotEmpty(t, vpa.aggregateContainerStates)
 }
 
@@ -244,7 +339,7 @@ func TestAddSampleAfterAggregateContainerStateGCed(t *testing.T) {
 	// Add a usage sample to the container.
 	assert.NoError(t, cluster.AddSample(usageSample))
 
-	assert.NotEmpty(t, cluster.aggregateStateMap)
+	assert.NotEmpty(t, cluster.aggregateStateMap())
 	assert.NotEmpty(t, vpa.aggregateContainerStates)
 
 	aggregateStateKey := cluster.aggregateStateKeyForContainerID(testContainerID)
@@ -254,7 +349,7 @@ func TestAddSampleAfterAggregateContainerStateGCed(t *testing.T) {
 	gcTimestamp := usageSample.MeasureStart.Add(10 * 24 * time.Hour)
 	cluster.garbageCollectAggregateCollectionStates(gcTimestamp, testControllerFetcher)
 
-	assert.Empty(t, cluster.aggregateStateMap)
+	assert.Empty(t, cluster.aggregateStateMap())
 	assert.Empty(t, vpa.aggregateContainerStates)
 	assert.Contains(t, pod.Containers, testContainerID.ContainerName)
 
@@ -284,18 +379,18 @@ func TestClusterGCRateLimiting(t *testing.T) {
 
 	// Add a usage sample to the container.
 	assert.NoError(t, cluster.AddSample(usageSample))
-	assert.NotEmpty(t, cluster.aggregateStateMap)
+	assert.NotEmpty(t, cluster.aggregateStateMap())
 	assert.NotEmpty(t, vpa.aggregateContainerStates)
 
 	// Sample is expired but this run doesn't remove it yet, because less than testGcPeriod
 	// elapsed since the previous run.
 	cluster.RateLimitedGarbageCollectAggregateCollectionStates(sampleExpireTime.Add(testGcPeriod/2), testControllerFetcher)
-	assert.NotEmpty(t, cluster.aggregateStateMap)
+	assert.NotEmpty(t, cluster.aggregateStateMap())
 	assert.NotEmpty(t, vpa.aggregateContainerStates)
 
 	// AggegateContainerState should be deleted from both cluster and vpa
 	cluster.RateLimitedGarbageCollectAggregateCollectionStates(sampleExpireTime.Add(2*testGcPeriod), testControllerFetcher)
-	assert.Empty(t, cluster.aggregateStateMap)
+	assert.Empty(t, cluster.aggregateStateMap())
 	assert.Empty(t, vpa.aggregateContainerStates)
 }
 
@@ -413,6 +508,38 @@ func TestUpdateAnnotations(t *testing.T) {
 	assert.Equal(t, vpa.Annotations, annotations)
 }
 
+// Verifies that the AggregationOverridden condition reflects the aggregation
+// overrides in the annotations of a VPA.
+func TestAggregationOverriddenCondition(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addTestVpa(cluster)
+	assert.NotContains(t, vpa.Conditions, vpa_types.AggregationOverridden)
+
+	vpa = addVpa(cluster, testVpaID, vpaAnnotationsMap{vpa_api_util.CPUHistogramDecayHalfLifeAnnotation: "12h"}, testSelectorStr, testTargetRef)
+	condition := vpa.Conditions[vpa_types.AggregationOverridden]
+	assert.Equal(t, apiv1.ConditionTrue, condition.Status)
+	assert.Equal(t, "AnnotationsApplied", condition.Reason)
+	assert.Equal(t, "Overridden: cpu-histogram-decay-half-life=12h0m0s", condition.Message)
+
+	vpa = addVpa(cluster, testVpaID, vpaAnnotationsMap{
+		vpa_api_util.CPUHistogramDecayHalfLifeAnnotation:    "12h",
+		vpa_api_util.MemoryHistogramDecayHalfLifeAnnotation: "-1h",
+	}, testSelectorStr, testTargetRef)
+	condition = vpa.Conditions[vpa_types.AggregationOverridden]
+	assert.Equal(t, apiv1.ConditionTrue, condition.Status)
+	assert.Equal(t, "InvalidAnnotations", condition.Reason)
+	assert.Contains(t, condition.Message, "Overridden: cpu-histogram-decay-half-life=12h0m0s")
+	assert.Contains(t, condition.Message, vpa_api_util.MemoryHistogramDecayHalfLifeAnnotation)
+
+	vpa = addVpa(cluster, testVpaID, vpaAnnotationsMap{vpa_api_util.MemoryHistogramDecayHalfLifeAnnotation: "-1h"}, testSelectorStr, testTargetRef)
+	condition = vpa.Conditions[vpa_types.AggregationOverridden]
+	assert.Equal(t, apiv1.ConditionFalse, condition.Status)
+	assert.Equal(t, "InvalidAnnotations", condition.Reason)
+
+	vpa = addVpa(cluster, testVpaID, testAnnotations, testSelectorStr, testTargetRef)
+	assert.NotContains(t, vpa.Conditions, vpa_types.AggregationOverridden)
+}
+
 // Creates a VPA and a matching pod, then change the VPA pod selector 3 times:
 // first such that it still matches the pod, then such that it no longer matches
 // the pod, finally such that it matches the pod again. Verifies that the links
@@ -602,7 +729,7 @@ func TestTwoPodsWithSameLabels(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Expect only one aggregation to be created.
-	assert.Equal(t, 1, len(cluster.aggregateStateMap))
+	assert.Equal(t, 1, len(cluster.aggregateStateMap()))
 }
 
 // Verify that two identical containers in different namespaces are not aggregated together.
@@ -621,7 +748,7 @@ func TestTwoPodsWithDifferentNamespaces(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Expect two separate aggregations to be created.
-	assert.Equal(t, 2, len(cluster.aggregateStateMap))
+	assert.Equal(t, 2, len(cluster.aggregateStateMap()))
 	// Expect only one entry to be present in the labels set map.
 	assert.Equal(t, 1, len(cluster.labelSetMap))
 }
@@ -880,3 +1007,53 @@ func TestVPAWithMatchingPods(t *testing.T) {
 		})
 	}
 }
+
+// Verify that containers with generated names are aggregated under the stable
+// name from the pod label, while other containers keep their names.
+func TestAggregateByLabelPrefix(t *testing.T) {
+	podID1 := PodID{"namespace-1", "pod-1"}
+	podID2 := PodID{"namespace-1", "pod-2"}
+	podLabels := map[string]string{"app": "worker", "container-name": "worker"}
+
+	cluster := NewClusterState(testGcPeriod)
+	cluster.AggregationContainerName = NewAggregateByLabelPrefix("container-name")
+	cluster.AddOrUpdatePod(podID1, podLabels, apiv1.PodRunning)
+	cluster.AddOrUpdatePod(podID2, podLabels, apiv1.PodRunning)
+	assert.NoError(t, cluster.AddOrUpdateContainer(ContainerID{podID1, "worker-7f8c9d"}, testRequest))
+	assert.NoError(t, cluster.AddOrUpdateContainer(ContainerID{podID2, "worker-a1b2c3"}, testRequest))
+	assert.NoError(t, cluster.AddOrUpdateContainer(ContainerID{podID1, "sidecar"}, testRequest))
+
+	pod1 := cluster.Pods[podID1]
+	pod2 := cluster.Pods[podID2]
+	key1 := cluster.MakeAggregateStateKey(pod1, "worker-7f8c9d")
+	key2 := cluster.MakeAggregateStateKey(pod2, "worker-a1b2c3")
+	assert.Equal(t, key1, key2)
+	assert.Equal(t, "worker", key1.ContainerName())
+	assert.Equal(t, "sidecar", cluster.MakeAggregateStateKey(pod1, "sidecar").ContainerName())
+	assert.Len(t, cluster.aggregateStateMap(), 2)
+}
+
+func TestSetPodShortLived(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	cluster.AddOrUpdatePod(testPodID, testLabels, apiv1.PodRunning)
+	assert.NoError(t, cluster.AddOrUpdateContainer(testContainerID, testRequest))
+	pod := cluster.Pods[testPodID]
+	longRunningKey := cluster.MakeAggregateStateKey(pod, "container-1")
+
+	cluster.SetPodShortLived(testPodID, true)
+	shortLivedKey := cluster.MakeAggregateStateKey(pod, "container-1")
+	assert.Equal(t, "container-1"+ShortLivedContainerNameSuffix, shortLivedKey.ContainerName())
+	assert.NoError(t, cluster.AddSample(makeTestUsageSample()))
+	aggregateStateMap := cluster.aggregateStateMap()
+	assert.Equal(t, 1, aggregateStateMap[shortLivedKey].TotalSamplesCount)
+	assert.Equal(t, 0, aggregateStateMap[longRunningKey].TotalSamplesCount)
+
+	cluster.SetPodShortLived(testPodID, false)
+	assert.Equal(t, longRunningKey, cluster.MakeAggregateStateKey(pod, "container-1"))
+	sample := makeTestUsageSample()
+	sample.MeasureStart = testTimestamp.Add(time.Minute)
+	assert.NoError(t, cluster.AddSample(sample))
+	aggregateStateMap = cluster.aggregateStateMap()
+	assert.Equal(t, 1, aggregateStateMap[shortLivedKey].TotalSamplesCount)
+	assert.Equal(t, 1, aggregateStateMap[longRunningKey].TotalSamplesCount)
+}
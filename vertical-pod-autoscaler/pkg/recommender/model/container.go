@@ -26,9 +26,9 @@ import (
 )
 
 const (
-	// OOMBumpUpRatio specifies how much memory will be added after observing OOM.
+	// OOMBumpUpRatio is the default value for AggregationsConfig.OOMBumpUpRatio.
 	OOMBumpUpRatio float64 = 1.2
-	// OOMMinBumpUp specifies minimal increase of memory after observing OOM.
+	// OOMMinBumpUp is the default value for AggregationsConfig.OOMMinBumpUp.
 	OOMMinBumpUp float64 = 100 * 1024 * 1024 // 100MB
 )
 
@@ -43,6 +43,12 @@ type ContainerUsageSample struct {
 	Request ResourceAmount
 	// Which resource is this sample for.
 	Resource ResourceName
+	// Weight of a memory peak relative to regular peaks, e.g. of a peak
+	// estimated from an OOM. Zero means a regular peak.
+	Weight float64
+	// CensoringLimit is the CPU limit the usage was capped at. A non-zero
+	// value means the real demand was at least Usage.
+	CensoringLimit ResourceAmount
 }
 
 // ContainerState stores information about a single container instance.
@@ -54,8 +60,16 @@ type ContainerUsageSample struct {
 type ContainerState struct {
 	// Current request.
 	Request Resources
+	// Current limit, zero or missing if not limited.
+	Limit Resources
 	// Start of the latest CPU usage sample that was aggregated.
 	LastCPUSampleStart time.Time
+	// Usage of the latest CPU usage sample that was aggregated.
+	LastCPUUsage ResourceAmount
+	// Start and usage of the latest memory usage sample that was aggregated,
+	// not counting samples estimated from OOMs.
+	LastMemorySampleStart time.Time
+	LastMemoryUsage       ResourceAmount
 	// Max memory usage observed in the current aggregation interval.
 	memoryPeak ResourceAmount
 	// Max memory usage estimated from an OOM event in the current aggregation interval.
@@ -83,17 +97,37 @@ func (sample *ContainerUsageSample) isValid(expectedResource ResourceName) bool
 	return sample.Usage >= 0 && sample.Resource == expectedResource
 }
 
+func (sample *ContainerUsageSample) memoryPeakWeight() float64 {
+	if sample.Weight > 0 {
+		return sample.Weight
+	}
+	return 1.0
+}
+
 func (container *ContainerState) addCPUSample(sample *ContainerUsageSample) bool {
 	// Order should not matter for the histogram, other than deduplication.
 	if !sample.isValid(ResourceCPU) || !sample.MeasureStart.After(container.LastCPUSampleStart) {
 		return false // Discard invalid, duplicate or out-of-order samples.
 	}
 	container.observeQualityMetrics(sample.Usage, false, corev1.ResourceCPU)
+	sample.CensoringLimit = container.cpuCensoringLimit(sample.Usage)
 	container.aggregator.AddSample(sample)
 	container.LastCPUSampleStart = sample.MeasureStart
+	container.LastCPUUsage = sample.Usage
 	return true
 }
 
+// cpuCensoringLimit returns the CPU limit of the container if the usage is
+// close enough to it to be considered throttled, zero otherwise.
+func (container *ContainerState) cpuCensoringLimit(usage ResourceAmount) ResourceAmount {
+	threshold := GetAggregationsConfig().CPULimitCensoringThreshold
+	limit := container.Limit[ResourceCPU]
+	if threshold <= 0 || limit <= 0 || usage < ScaleResource(limit, threshold) {
+		return 0
+	}
+	return limit
+}
+
 func (container *ContainerState) observeQualityMetrics(usage ResourceAmount, isOOM bool, resource corev1.ResourceName) {
 	if !container.aggregator.NeedsRecommendation() {
 		return
@@ -133,6 +167,14 @@ func (container *ContainerState) GetMaxMemoryPeak() ResourceAmount {
 	return ResourceAmountMax(container.memoryPeak, container.oomPeak)
 }
 
+// GetMaxMemoryPeakWeight returns the weight GetMaxMemoryPeak is aggregated with.
+func (container *ContainerState) GetMaxMemoryPeakWeight() float64 {
+	if container.oomPeak > container.memoryPeak {
+		return GetAggregationsConfig().OOMSampleWeight
+	}
+	return 1.0
+}
+
 func (container *ContainerState) addMemorySample(sample *ContainerUsageSample, isOOM bool) bool {
 	ts := sample.MeasureStart
 	// We always process OOM samples.
@@ -141,6 +183,10 @@ func (container *ContainerState) addMemorySample(sample *ContainerUsageSample, i
 		return false // Discard invalid or outdated samples.
 	}
 	container.lastMemorySampleStart = ts
+	if !isOOM {
+		container.LastMemorySampleStart = ts
+		container.LastMemoryUsage = sample.Usage
+	}
 	if container.WindowEnd.IsZero() { // This is the first sample.
 		container.WindowEnd = ts
 	}
@@ -159,6 +205,7 @@ func (container *ContainerState) addMemorySample(sample *ContainerUsageSample, i
 				Usage:        oldMaxMem,
 				Request:      sample.Request,
 				Resource:     ResourceMemory,
+				Weight:       container.GetMaxMemoryPeakWeight(),
 			}
 			container.aggregator.SubtractSample(&oldPeak)
 			addNewPeak = true
@@ -179,6 +226,7 @@ func (container *ContainerState) addMemorySample(sample *ContainerUsageSample, i
 			Usage:        sample.Usage,
 			Request:      sample.Request,
 			Resource:     ResourceMemory,
+			Weight:       sample.Weight,
 		}
 		container.aggregator.AddSample(&newPeak)
 		if isOOM {
@@ -198,14 +246,16 @@ func (container *ContainerState) RecordOOM(timestamp time.Time, requestedMemory
 	}
 	// Get max of the request and the recent usage-based memory peak.
 	// Omitting oomPeak here to protect against recommendation running too high on subsequent OOMs.
+	config := GetAggregationsConfig()
 	memoryUsed := ResourceAmountMax(requestedMemory, container.memoryPeak)
-	memoryNeeded := ResourceAmountMax(memoryUsed+MemoryAmountFromBytes(OOMMinBumpUp),
-		ScaleResource(memoryUsed, OOMBumpUpRatio))
+	memoryNeeded := ResourceAmountMax(memoryUsed+MemoryAmountFromBytes(config.OOMMinBumpUp),
+		ScaleResource(memoryUsed, config.OOMBumpUpRatio))
 
 	oomMemorySample := ContainerUsageSample{
 		MeasureStart: timestamp,
 		Usage:        memoryNeeded,
 		Resource:     ResourceMemory,
+		Weight:       config.OOMSampleWeight,
 	}
 	if !container.addMemorySample(&oomMemorySample, true) {
 		return fmt.Errorf("adding OOM sample failed")
@@ -171,6 +171,53 @@ func TestRecordOOMMaxedWithKnownSample(t *testing.T) {
 	assert.NoError(t, test.container.RecordOOM(testTimestamp, ResourceAmount(1000*mb)))
 }
 
+func TestRecordOOMWithConfiguredBumpUpAndWeight(t *testing.T) {
+	previousConfig := GetAggregationsConfig()
+	defer InitializeAggregationsConfig(previousConfig)
+	config := NewAggregationsConfig(DefaultMemoryAggregationInterval, DefaultMemoryAggregationIntervalCount, DefaultMemoryHistogramDecayHalfLife, DefaultCPUHistogramDecayHalfLife)
+	config.OOMBumpUpRatio = 1.5
+	config.OOMMinBumpUp = 0
+	config.OOMSampleWeight = 10.0
+	InitializeAggregationsConfig(config)
+
+	test := newContainerTest()
+	memoryAggregationWindowEnd := testTimestamp.Add(config.MemoryAggregationInterval)
+	test.mockMemoryHistogram.On("AddSample", 1500.0*mb, 10.0, memoryAggregationWindowEnd)
+	assert.NoError(t, test.container.RecordOOM(testTimestamp, ResourceAmount(1000*mb)))
+
+	// A higher regular peak replaces the OOM peak with its weight.
+	test.mockMemoryHistogram.On("SubtractSample", 1500.0*mb, 10.0, memoryAggregationWindowEnd)
+	test.mockMemoryHistogram.On("AddSample", 2000.0*mb, 1.0, memoryAggregationWindowEnd)
+	assert.True(t, test.container.AddSample(newUsageSample(testTimestamp, 2000*mb, ResourceMemory)))
+	test.mockMemoryHistogram.AssertExpectations(t)
+}
+
+func TestCPUSamplesCensoredAtLimit(t *testing.T) {
+	previousConfig := GetAggregationsConfig()
+	defer InitializeAggregationsConfig(previousConfig)
+	config := NewAggregationsConfig(DefaultMemoryAggregationInterval, DefaultMemoryAggregationIntervalCount, DefaultMemoryHistogramDecayHalfLife, DefaultCPUHistogramDecayHalfLife)
+	config.CPULimitCensoringThreshold = 0.9
+	InitializeAggregationsConfig(config)
+
+	test := newContainerTest()
+	test.container.Limit = Resources{ResourceCPU: CPUAmountFromCores(1.0)}
+	test.mockCPUHistogram.On("AddSample", 0.5, 2.3, testTimestamp)
+	test.mockCPUHistogram.On("AddSample", 0.95, 2.3, testTimestamp.Add(time.Minute))
+	test.mockCPUHistogram.On("AddSample", 1.5, 2.3, testTimestamp.Add(2*time.Minute))
+
+	// Usage well below the limit isn't censored.
+	assert.True(t, test.container.AddSample(newUsageSample(testTimestamp, 500, ResourceCPU)))
+	assert.Equal(t, ResourceAmount(0), test.aggregateContainerState.CPUCensoringLimit)
+	// Usage close to the limit is.
+	assert.True(t, test.container.AddSample(newUsageSample(testTimestamp.Add(time.Minute), 950, ResourceCPU)))
+	assert.Equal(t, CPUAmountFromCores(1.0), test.aggregateContainerState.CPUCensoringLimit)
+	// Usage above the censoring limit after the limit is raised resets it.
+	test.container.Limit = Resources{ResourceCPU: CPUAmountFromCores(2.0)}
+	assert.True(t, test.container.AddSample(newUsageSample(testTimestamp.Add(2*time.Minute), 1500, ResourceCPU)))
+	assert.Equal(t, ResourceAmount(0), test.aggregateContainerState.CPUCensoringLimit)
+	test.mockCPUHistogram.AssertExpectations(t)
+}
+
 func TestRecordOOMDiscardsOldSample(t *testing.T) {
 	test := newContainerTest()
 	memoryAggregationWindowEnd := testTimestamp.Add(GetAggregationsConfig().MemoryAggregationInterval)
@@ -0,0 +1,65 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+// Histogram buckets hold a float64 weight each.
+const histogramBucketBytes = 8
+
+// MemoryStats is an estimate of the memory held by the model, broken down by
+// structure. Byte counts only include the payload of the structures, e.g. the
+// buckets of histograms, not the overhead of the maps holding them.
+type MemoryStats struct {
+	Pods                     int
+	Containers               int
+	Vpas                     int
+	AggregateContainerStates int
+	// Histograms is the number of usage histograms of aggregate container
+	// states, and HistogramBytes the size of their buckets.
+	Histograms     int
+	HistogramBytes int64
+	// LabelSets is the number of distinct pod label sets interned by the
+	// model, and LabelSetBytes the size of their keys and values.
+	LabelSets     int
+	LabelSetBytes int64
+}
+
+// GetMemoryStats estimates the memory held by the cluster state.
+func (cluster *ClusterState) GetMemoryStats() MemoryStats {
+	stats := MemoryStats{
+		Pods:                     len(cluster.Pods),
+		Vpas:                     len(cluster.Vpas),
+		AggregateContainerStates: cluster.StateMapSize(),
+		LabelSets:                len(cluster.labelSetMap),
+	}
+	for _, pod := range cluster.Pods {
+		stats.Containers += len(pod.Containers)
+	}
+
+	config := GetAggregationsConfig()
+	histogramBytes := int64(config.CPUHistogramOptions.NumBuckets()+config.MemoryHistogramOptions.NumBuckets()) * histogramBucketBytes
+	stats.Histograms = 2 * stats.AggregateContainerStates
+	stats.HistogramBytes = int64(stats.AggregateContainerStates) * histogramBytes
+
+	for key, labelSet := range cluster.labelSetMap {
+		// The key is the string representation of the label set.
+		stats.LabelSetBytes += int64(len(key))
+		for name, value := range labelSet {
+			stats.LabelSetBytes += int64(len(name) + len(value))
+		}
+	}
+	return stats
+}
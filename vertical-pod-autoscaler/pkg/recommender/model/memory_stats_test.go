@@ -0,0 +1,43 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+func TestGetMemoryStats(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	cluster.AddOrUpdatePod(testPodID, testLabels, apiv1.PodRunning)
+	cluster.AddOrUpdatePod(testPodID3, testLabels, apiv1.PodRunning)
+	assert.NoError(t, cluster.AddOrUpdateContainer(testContainerID, testRequest))
+	assert.NoError(t, cluster.AddOrUpdateContainer(ContainerID{testPodID3, "container-1"}, testRequest))
+
+	config := GetAggregationsConfig()
+	assert.Equal(t, MemoryStats{
+		Pods:                     2,
+		Containers:               2,
+		AggregateContainerStates: 1,
+		Histograms:               2,
+		HistogramBytes:           int64(config.CPUHistogramOptions.NumBuckets()+config.MemoryHistogramOptions.NumBuckets()) * histogramBucketBytes,
+		LabelSets:                1,
+		LabelSetBytes:            int64(len("label-1=value-1") + len("label-1") + len("value-1")),
+	}, cluster.GetMemoryStats())
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"math"
+
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// RecommendationDrift is the mean relative difference between the requests of
+// running containers and the target recommended for them, per resource.
+// 0 means all containers request exactly the target, 1 means they are off by
+// 100% on average.
+type RecommendationDrift map[ResourceName]float64
+
+// GetRecommendationDrifts returns the drift of the running pods of each VPA
+// from its current recommendation. VPAs without a recommendation or without
+// running pods are skipped.
+func (cluster *ClusterState) GetRecommendationDrifts() map[VpaID]RecommendationDrift {
+	type driftSum struct {
+		sum   float64
+		count int
+	}
+	sums := make(map[VpaID]map[ResourceName]*driftSum)
+	for _, pod := range cluster.Pods {
+		if pod.Phase != apiv1.PodRunning {
+			continue
+		}
+		vpa := cluster.GetControllingVPA(pod)
+		if vpa == nil || !vpa.HasRecommendation() {
+			continue
+		}
+		for containerName, container := range pod.Containers {
+			// Containers are recommended for under the name they are aggregated by.
+			target := findContainerTarget(vpa, cluster.MakeAggregateStateKey(pod, containerName).ContainerName())
+			if target == nil {
+				continue
+			}
+			for resourceName, targetAmount := range resourceAmountsFromList(target) {
+				if targetAmount == 0 {
+					continue
+				}
+				if sums[vpa.ID] == nil {
+					sums[vpa.ID] = make(map[ResourceName]*driftSum)
+				}
+				if sums[vpa.ID][resourceName] == nil {
+					sums[vpa.ID][resourceName] = &driftSum{}
+				}
+				diff := math.Abs(float64(container.Request[resourceName] - targetAmount))
+				sums[vpa.ID][resourceName].sum += diff / float64(targetAmount)
+				sums[vpa.ID][resourceName].count++
+			}
+		}
+	}
+
+	drifts := make(map[VpaID]RecommendationDrift, len(sums))
+	for vpaID, resources := range sums {
+		drifts[vpaID] = make(RecommendationDrift, len(resources))
+		for resourceName, s := range resources {
+			drifts[vpaID][resourceName] = s.sum / float64(s.count)
+		}
+	}
+	return drifts
+}
+
+func findContainerTarget(vpa *Vpa, containerName string) apiv1.ResourceList {
+	for _, recommendation := range vpa.Recommendation.ContainerRecommendations {
+		if recommendation.ContainerName == containerName {
+			return recommendation.Target
+		}
+	}
+	return nil
+}
+
+func resourceAmountsFromList(resources apiv1.ResourceList) Resources {
+	result := make(Resources)
+	for name, quantity := range resources {
+		switch name {
+		case apiv1.ResourceCPU:
+			result[ResourceCPU] = ResourceAmount(quantity.MilliValue())
+		case apiv1.ResourceMemory:
+			result[ResourceMemory] = ResourceAmount(quantity.Value())
+		}
+	}
+	return result
+}
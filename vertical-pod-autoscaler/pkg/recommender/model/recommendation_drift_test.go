@@ -0,0 +1,105 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+)
+
+func TestGetRecommendationDrifts(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addTestVpa(cluster)
+	vpa.Recommendation = &vpa_types.RecommendedPodResources{
+		ContainerRecommendations: []vpa_types.RecommendedContainerResources{{
+			ContainerName: testContainerID.ContainerName,
+			Target: apiv1.ResourceList{
+				apiv1.ResourceCPU:    resource.MustParse("1"),
+				apiv1.ResourceMemory: resource.MustParse("1000"),
+			},
+		}},
+	}
+	podID2 := PodID{"namespace-1", "pod-2"}
+	pendingPodID := PodID{"namespace-1", "pod-pending"}
+	cluster.AddOrUpdatePod(testPodID, testLabels, apiv1.PodRunning)
+	cluster.AddOrUpdatePod(podID2, testLabels, apiv1.PodRunning)
+	cluster.AddOrUpdatePod(pendingPodID, testLabels, apiv1.PodPending)
+	// Applied recommendation.
+	assert.NoError(t, cluster.AddOrUpdateContainer(testContainerID, Resources{
+		ResourceCPU:    CPUAmountFromCores(1),
+		ResourceMemory: MemoryAmountFromBytes(1000),
+	}))
+	// Requesting half of the target CPU and twice the target memory.
+	assert.NoError(t, cluster.AddOrUpdateContainer(ContainerID{podID2, testContainerID.ContainerName}, Resources{
+		ResourceCPU:    CPUAmountFromCores(0.5),
+		ResourceMemory: MemoryAmountFromBytes(2000),
+	}))
+	// Not running, ignored.
+	assert.NoError(t, cluster.AddOrUpdateContainer(ContainerID{pendingPodID, testContainerID.ContainerName}, Resources{}))
+	// Not recommended for, ignored.
+	assert.NoError(t, cluster.AddOrUpdateContainer(ContainerID{podID2, "sidecar"}, Resources{}))
+
+	drifts := cluster.GetRecommendationDrifts()
+	assert.Equal(t, map[VpaID]RecommendationDrift{
+		testVpaID: {
+			ResourceCPU:    0.25,
+			ResourceMemory: 0.5,
+		},
+	}, drifts)
+}
+
+func TestGetRecommendationDriftsOfShortLivedPods(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	// Aggregation by plain container name.
+	cluster.AggregationContainerName = nil
+	vpa := addTestVpa(cluster)
+	vpa.Recommendation = &vpa_types.RecommendedPodResources{
+		ContainerRecommendations: []vpa_types.RecommendedContainerResources{{
+			ContainerName: testContainerID.ContainerName,
+			Target:        apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("1")},
+		}, {
+			ContainerName: testContainerID.ContainerName + ShortLivedContainerNameSuffix,
+			Target:        apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("2")},
+		}},
+	}
+	shortLivedPodID := PodID{"namespace-1", "pod-short-lived"}
+	cluster.AddOrUpdatePod(testPodID, testLabels, apiv1.PodRunning)
+	cluster.AddOrUpdatePod(shortLivedPodID, testLabels, apiv1.PodRunning)
+	cluster.SetPodShortLived(shortLivedPodID, true)
+	assert.NoError(t, cluster.AddOrUpdateContainer(testContainerID, Resources{ResourceCPU: CPUAmountFromCores(1)}))
+	// Compared with the target of short-lived pods.
+	assert.NoError(t, cluster.AddOrUpdateContainer(ContainerID{shortLivedPodID, testContainerID.ContainerName}, Resources{
+		ResourceCPU: CPUAmountFromCores(1),
+	}))
+
+	assert.Equal(t, map[VpaID]RecommendationDrift{
+		testVpaID: {ResourceCPU: 0.25},
+	}, cluster.GetRecommendationDrifts())
+}
+
+func TestGetRecommendationDriftsWithoutRecommendation(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	addTestVpa(cluster)
+	addTestPod(cluster)
+	addTestContainer(t, cluster)
+
+	assert.Empty(t, cluster.GetRecommendationDrifts())
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testutil
+
+import (
+	"time"
+
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/logic"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+)
+
+const (
+	// DefaultSampleInterval is the interval between usage samples, as
+	// metrics are fetched by the recommender by default.
+	DefaultSampleInterval = time.Minute
+	// simulatedContainerName is the name of the simulated container in the
+	// recommendations.
+	simulatedContainerName = "container"
+)
+
+// Step is the recommendation for the simulated container at some time.
+type Step struct {
+	Time           time.Time
+	Usage          Usage
+	Recommendation logic.RecommendedContainerResources
+}
+
+// Simulation samples the usage of a container from a trace and feeds it to
+// the aggregation and estimation code of the recommender, the same way usage
+// fetched from the metrics server is.
+type Simulation struct {
+	// Trace is the usage of the simulated container.
+	Trace Trace
+	// SampleInterval is the interval between usage samples.
+	SampleInterval time.Duration
+	// Request and Limit of the simulated container. The request weights CPU
+	// samples and the limit censors CPU usage close to it, see
+	// --cpu-limit-censoring-threshold.
+	Request model.Resources
+	Limit   model.Resources
+	// Recommender computes the recommendations from the aggregated usage.
+	Recommender logic.PodResourceRecommender
+
+	start     time.Time
+	now       time.Time
+	aggregate *model.AggregateContainerState
+	container *model.ContainerState
+}
+
+// NewSimulation creates a Simulation of a container with the given usage
+// trace, starting at the given time, using the recommender with the current
+// flags and aggregations config.
+func NewSimulation(trace Trace, start time.Time) *Simulation {
+	aggregate := model.NewAggregateContainerState()
+	return &Simulation{
+		Trace:          trace,
+		SampleInterval: DefaultSampleInterval,
+		Request:        model.Resources{},
+		Limit:          model.Resources{},
+		Recommender:    logic.CreatePodResourceRecommender(),
+		start:          start,
+		now:            start,
+		aggregate:      aggregate,
+		container:      model.NewContainerState(model.Resources{}, aggregate),
+	}
+}
+
+// Run samples the trace for the given duration, continuing where the previous
+// run stopped, and returns the recommendation after every recommendation
+// interval. Zero recommendationInterval returns only the final one.
+func (s *Simulation) Run(duration, recommendationInterval time.Duration) []Step {
+	s.container.Request = s.Request
+	s.container.Limit = s.Limit
+	end := s.now.Add(duration)
+	nextRecommendation := s.now.Add(recommendationInterval)
+	var steps []Step
+	var usage Usage
+	for s.now.Before(end) {
+		usage = s.Trace(s.now.Sub(s.start))
+		s.addSample(usage)
+		s.now = s.now.Add(s.SampleInterval)
+		if recommendationInterval > 0 && !s.now.Before(nextRecommendation) {
+			steps = append(steps, s.step(usage))
+			nextRecommendation = nextRecommendation.Add(recommendationInterval)
+		}
+	}
+	if recommendationInterval <= 0 {
+		steps = append(steps, s.step(usage))
+	}
+	return steps
+}
+
+// Recommend returns the recommendation for the usage aggregated so far.
+func (s *Simulation) Recommend() logic.RecommendedContainerResources {
+	return s.Recommender.GetRecommendedPodResources(model.ContainerNameToAggregateStateMap{
+		simulatedContainerName: s.aggregate,
+	})[simulatedContainerName]
+}
+
+// Aggregate returns the usage aggregated so far, e.g. to inspect histograms.
+func (s *Simulation) Aggregate() *model.AggregateContainerState {
+	return s.aggregate
+}
+
+func (s *Simulation) addSample(usage Usage) {
+	s.container.AddSample(&model.ContainerUsageSample{
+		MeasureStart: s.now,
+		Usage:        model.CPUAmountFromCores(usage.CPUCores),
+		Request:      s.Request[model.ResourceCPU],
+		Resource:     model.ResourceCPU,
+	})
+	if usage.OOM {
+		// Errors only report OOMs older than the memory aggregation window,
+		// which samples in order never are.
+		_ = s.container.RecordOOM(s.now, s.Request[model.ResourceMemory])
+		return
+	}
+	s.container.AddSample(&model.ContainerUsageSample{
+		MeasureStart: s.now,
+		Usage:        model.MemoryAmountFromBytes(usage.MemoryBytes),
+		Request:      s.Request[model.ResourceMemory],
+		Resource:     model.ResourceMemory,
+	})
+}
+
+func (s *Simulation) step(usage Usage) Step {
+	return Step{
+		Time:           s.now,
+		Usage:          usage,
+		Recommendation: s.Recommend(),
+	}
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testutil
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+)
+
+var (
+	testStart = time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	testUsage = Usage{CPUCores: 1, MemoryBytes: 1 << 30}
+)
+
+func TestSimulationConstantTrace(t *testing.T) {
+	simulation := NewSimulation(Constant(testUsage), testStart)
+	steps := simulation.Run(24*time.Hour, 0)
+	assert.Len(t, steps, 1)
+	assert.Equal(t, testStart.Add(24*time.Hour), steps[0].Time)
+
+	target := steps[0].Recommendation.Target
+	// The target is the usage, rounded up to a histogram bucket, with the
+	// safety margin of 15%.
+	assert.InEpsilon(t, 1.15, model.CoresFromCPUAmount(target[model.ResourceCPU]), 0.05)
+	assert.InEpsilon(t, 1.15*float64(1<<30), float64(model.BytesFromMemoryAmount(target[model.ResourceMemory])), 0.05)
+	assert.Equal(t, 24*60, simulation.Aggregate().TotalSamplesCount)
+}
+
+func TestSimulationRecommendationInterval(t *testing.T) {
+	simulation := NewSimulation(Constant(testUsage), testStart)
+	steps := simulation.Run(24*time.Hour, time.Hour)
+	assert.Len(t, steps, 24)
+	assert.Equal(t, testStart.Add(time.Hour), steps[0].Time)
+
+	// Runs continue where the previous one stopped.
+	steps = simulation.Run(time.Hour, time.Hour)
+	assert.Len(t, steps, 1)
+	assert.Equal(t, testStart.Add(25*time.Hour), steps[0].Time)
+}
+
+func TestSimulationDiurnalTrace(t *testing.T) {
+	simulation := NewSimulation(Diurnal(testUsage, testUsage), testStart)
+	steps := simulation.Run(7*24*time.Hour, 0)
+	// The target is based on the 90th percentile, which is close to the daily
+	// peak of 2 cores.
+	cpu := model.CoresFromCPUAmount(steps[0].Recommendation.Target[model.ResourceCPU])
+	assert.True(t, cpu > 1.15*1.8 && cpu < 1.15*2.1, "unexpected CPU target %v", cpu)
+}
+
+func TestSimulationSpikyTrace(t *testing.T) {
+	spike := Usage{CPUCores: 4}
+	rare := NewSimulation(Spiky(testUsage, spike, 0.01, rand.New(rand.NewSource(1))), testStart)
+	frequent := NewSimulation(Spiky(testUsage, spike, 0.5, rand.New(rand.NewSource(1))), testStart)
+	rareCPU := rare.Run(24*time.Hour, 0)[0].Recommendation.Target[model.ResourceCPU]
+	frequentCPU := frequent.Run(24*time.Hour, 0)[0].Recommendation.Target[model.ResourceCPU]
+	// Rare spikes are above the target percentile and don't raise the target.
+	assert.InEpsilon(t, 1.15, model.CoresFromCPUAmount(rareCPU), 0.05)
+	assert.InEpsilon(t, 1.15*5, model.CoresFromCPUAmount(frequentCPU), 0.05)
+}
+
+func TestSimulationLeakyTrace(t *testing.T) {
+	simulation := NewSimulation(Leaky(testUsage, 100<<20, 0), testStart)
+	steps := simulation.Run(2*24*time.Hour, 24*time.Hour)
+	assert.Len(t, steps, 2)
+	first := steps[0].Recommendation.Target[model.ResourceMemory]
+	second := steps[1].Recommendation.Target[model.ResourceMemory]
+	assert.Greater(t, second, first)
+}
+
+func TestSimulationOOM(t *testing.T) {
+	oomAt := 12 * time.Hour
+	trace := func(elapsed time.Duration) Usage {
+		usage := testUsage
+		usage.OOM = elapsed == oomAt
+		return usage
+	}
+	simulation := NewSimulation(trace, testStart)
+	simulation.Request = model.Resources{model.ResourceMemory: model.MemoryAmountFromBytes(2 << 30)}
+	steps := simulation.Run(24*time.Hour, 0)
+	// The OOM is recorded as a peak above the request.
+	memory := model.BytesFromMemoryAmount(steps[0].Recommendation.UpperBound[model.ResourceMemory])
+	assert.Greater(t, memory, float64(2<<30))
+}
+
+func TestNoisyTrace(t *testing.T) {
+	trace := Noisy(Constant(testUsage), 0.1, rand.New(rand.NewSource(1)))
+	for elapsed := time.Duration(0); elapsed < time.Hour; elapsed += time.Minute {
+		usage := trace(elapsed)
+		assert.InDelta(t, 1, usage.CPUCores, 0.1)
+		assert.InEpsilon(t, float64(1<<30), usage.MemoryBytes, 0.1)
+	}
+}
+
+func TestSumTrace(t *testing.T) {
+	trace := Sum(Constant(testUsage), Constant(Usage{CPUCores: 1, OOM: true}))
+	assert.Equal(t, Usage{CPUCores: 2, MemoryBytes: 1 << 30, OOM: true}, trace(0))
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package testutil simulates the usage of containers with synthetic traces
+// and feeds it to the aggregation and estimation code of the recommender, to
+// validate parameter choices and reproduce recommendation anomalies.
+package testutil
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Usage is the resource usage of a container at some time.
+type Usage struct {
+	// CPUCores is the average CPU usage, in cores.
+	CPUCores float64
+	// MemoryBytes is the memory usage, in bytes.
+	MemoryBytes float64
+	// OOM marks the container as killed for running out of memory.
+	OOM bool
+}
+
+// Trace returns the usage of a container at the given time, elapsed since the
+// start of the simulation.
+type Trace func(elapsed time.Duration) Usage
+
+// Constant returns a trace with the same usage all the time.
+func Constant(usage Usage) Trace {
+	return func(time.Duration) Usage {
+		return usage
+	}
+}
+
+// Diurnal returns a trace following a daily cycle, between base at the start
+// of the day and base+amplitude at noon.
+func Diurnal(base, amplitude Usage) Trace {
+	return Periodic(base, amplitude, 24*time.Hour)
+}
+
+// Periodic returns a trace following a cosine cycle of the given period,
+// between base at the start of the period and base+amplitude in its middle.
+func Periodic(base, amplitude Usage, period time.Duration) Trace {
+	return func(elapsed time.Duration) Usage {
+		phase := 2 * math.Pi * float64(elapsed%period) / float64(period)
+		scale := (1 - math.Cos(phase)) / 2
+		return Usage{
+			CPUCores:    base.CPUCores + scale*amplitude.CPUCores,
+			MemoryBytes: base.MemoryBytes + scale*amplitude.MemoryBytes,
+		}
+	}
+}
+
+// Spiky returns a trace with the base usage, increased by spike with the
+// given probability at every sample. rng makes the trace reproducible.
+func Spiky(base, spike Usage, probability float64, rng *rand.Rand) Trace {
+	return func(time.Duration) Usage {
+		if rng.Float64() >= probability {
+			return base
+		}
+		return Usage{
+			CPUCores:    base.CPUCores + spike.CPUCores,
+			MemoryBytes: base.MemoryBytes + spike.MemoryBytes,
+			OOM:         spike.OOM,
+		}
+	}
+}
+
+// Leaky returns a trace whose memory usage grows by bytesPerHour from the base
+// usage, as when the container leaks memory, and drops back to the base usage
+// every restartPeriod, as when the container is restarted. Zero restartPeriod
+// never restarts the container.
+func Leaky(base Usage, bytesPerHour float64, restartPeriod time.Duration) Trace {
+	return func(elapsed time.Duration) Usage {
+		if restartPeriod > 0 {
+			elapsed %= restartPeriod
+		}
+		usage := base
+		usage.MemoryBytes += bytesPerHour * elapsed.Hours()
+		return usage
+	}
+}
+
+// Noisy adds uniform noise of up to the given fraction of the usage, in
+// either direction, to the trace. rng makes the trace reproducible.
+func Noisy(trace Trace, fraction float64, rng *rand.Rand) Trace {
+	return func(elapsed time.Duration) Usage {
+		usage := trace(elapsed)
+		usage.CPUCores *= 1 + fraction*(2*rng.Float64()-1)
+		usage.MemoryBytes *= 1 + fraction*(2*rng.Float64()-1)
+		return usage
+	}
+}
+
+// Sum returns a trace with the summed usage of the traces, e.g. to add spikes
+// to a diurnal trace. The container runs out of memory if any of them does.
+func Sum(traces ...Trace) Trace {
+	return func(elapsed time.Duration) Usage {
+		var sum Usage
+		for _, trace := range traces {
+			usage := trace(elapsed)
+			sum.CPUCores += usage.CPUCores
+			sum.MemoryBytes += usage.MemoryBytes
+			sum.OOM = sum.OOM || usage.OOM
+		}
+		return sum
+	}
+}
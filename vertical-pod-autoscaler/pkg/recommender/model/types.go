@@ -17,6 +17,8 @@ limitations under the License.
 package model
 
 import (
+	"strings"
+
 	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/klog/v2"
@@ -73,6 +75,25 @@ func QuantityFromMemoryAmount(memoryAmount ResourceAmount) resource.Quantity {
 	return *resource.NewScaledQuantity(int64(memoryAmount), 0)
 }
 
+// IsExtendedResource returns true for resources other than CPU and memory
+// which are passed through from the requests of containers to their
+// recommendation, i.e. hugepages and extended resources like nvidia.com/gpu.
+func IsExtendedResource(name ResourceName) bool {
+	if strings.HasPrefix(string(name), apiv1.ResourceHugePagesPrefix) {
+		return true
+	}
+	return strings.Contains(string(name), "/") && !strings.HasPrefix(string(name), apiv1.ResourceDefaultNamespacePrefix)
+}
+
+// QuantityFromExtendedAmount converts ResourceAmount of an extended resource,
+// in bytes for hugepages or in units otherwise, to a resource.Quantity.
+func QuantityFromExtendedAmount(name ResourceName, amount ResourceAmount) resource.Quantity {
+	if strings.HasPrefix(string(name), apiv1.ResourceHugePagesPrefix) {
+		return *resource.NewQuantity(int64(amount), resource.BinarySI)
+	}
+	return *resource.NewQuantity(int64(amount), resource.DecimalSI)
+}
+
 // ScaleResource returns the resource amount multiplied by a given factor.
 func ScaleResource(amount ResourceAmount, factor float64) ResourceAmount {
 	return resourceAmountFromFloat(float64(amount) * factor)
@@ -92,8 +113,12 @@ func ResourcesAsResourceList(resources Resources) apiv1.ResourceList {
 			newKey = apiv1.ResourceMemory
 			quantity = QuantityFromMemoryAmount(resourceAmount)
 		default:
-			klog.Errorf("Cannot translate %v resource name", key)
-			continue
+			if !IsExtendedResource(key) {
+				klog.Errorf("Cannot translate %v resource name", key)
+				continue
+			}
+			newKey = apiv1.ResourceName(key)
+			quantity = QuantityFromExtendedAmount(key, resourceAmount)
 		}
 		result[newKey] = quantity
 	}
@@ -110,8 +135,11 @@ func ResourceNamesApiToModel(resources []apiv1.ResourceName) *[]ResourceName {
 		case apiv1.ResourceMemory:
 			result = append(result, ResourceMemory)
 		default:
-			klog.Errorf("Cannot translate %v resource name", resource)
-			continue
+			if !IsExtendedResource(ResourceName(resource)) {
+				klog.Errorf("Cannot translate %v resource name", resource)
+				continue
+			}
+			result = append(result, ResourceName(resource))
 		}
 	}
 	return &result
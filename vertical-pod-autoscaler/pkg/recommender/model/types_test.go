@@ -0,0 +1,58 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestIsExtendedResource(t *testing.T) {
+	assert.False(t, IsExtendedResource(ResourceCPU))
+	assert.False(t, IsExtendedResource(ResourceMemory))
+	assert.False(t, IsExtendedResource("ephemeral-storage"))
+	assert.False(t, IsExtendedResource("kubernetes.io/unknown"))
+	assert.True(t, IsExtendedResource("hugepages-2Mi"))
+	assert.True(t, IsExtendedResource("nvidia.com/gpu"))
+}
+
+func TestResourcesAsResourceList(t *testing.T) {
+	resources := Resources{
+		ResourceCPU:         CPUAmountFromCores(0.5),
+		ResourceMemory:      MemoryAmountFromBytes(1024 * 1024),
+		"nvidia.com/gpu":    2,
+		"hugepages-2Mi":     MemoryAmountFromBytes(4 * 1024 * 1024),
+		"ephemeral-storage": 1,
+	}
+	expected := apiv1.ResourceList{
+		apiv1.ResourceCPU:    resource.MustParse("500m"),
+		apiv1.ResourceMemory: resource.MustParse("1Mi"),
+		"nvidia.com/gpu":     resource.MustParse("2"),
+		"hugepages-2Mi":      resource.MustParse("4Mi"),
+	}
+	resourceList := ResourcesAsResourceList(resources)
+	assert.Len(t, resourceList, len(expected))
+	for name, quantity := range expected {
+		actual := resourceList[name]
+		assert.Zero(t, quantity.Cmp(actual), "unexpected %s: %s", name, actual.String())
+	}
+	hugepages := resourceList["hugepages-2Mi"]
+	assert.Equal(t, "4Mi", hugepages.String())
+}
@@ -88,6 +88,8 @@ type Vpa struct {
 	Annotations vpaAnnotationsMap
 	// Map of the status conditions (keys are condition types).
 	Conditions vpaConditionsMap
+	// Latest transitions of the conditions, oldest first.
+	ConditionHistory []vpa_types.VerticalPodAutoscalerCondition
 	// Most recently computed recommendation. Can be nil.
 	Recommendation *vpa_types.RecommendedPodResources
 	// All container aggregations that contribute to this VPA.
@@ -110,6 +112,9 @@ type Vpa struct {
 	TargetRef *autoscaling.CrossVersionObjectReference
 	// PodCount contains number of live Pods matching a given VPA object.
 	PodCount int
+	// AggregationOverrides are the aggregation parameters overridden by
+	// annotations of the VPA object.
+	AggregationOverrides AggregationOverrides
 }
 
 // NewVpa returns a new Vpa with a given ID and pod selector. Doesn't set the
@@ -140,6 +145,7 @@ func (vpa *Vpa) UseAggregationIfMatching(aggregationKey AggregateStateKey, aggre
 		vpa.aggregateContainerStates[aggregationKey] = aggregation
 		aggregation.IsUnderVPA = true
 		aggregation.UpdateMode = vpa.UpdateMode
+		aggregation.SetAggregationOverrides(vpa.AggregationOverrides)
 		aggregation.UpdateFromPolicy(vpa_api_util.GetContainerResourcePolicy(aggregationKey.ContainerName(), vpa.ResourcePolicy))
 	}
 }
@@ -179,7 +185,7 @@ func (vpa *Vpa) MergeCheckpointedState(aggregateContainerStateMap ContainerNameT
 	for containerName, aggregation := range vpa.ContainersInitialAggregateState {
 		aggregateContainerState, found := aggregateContainerStateMap[containerName]
 		if !found {
-			aggregateContainerState = NewAggregateContainerState()
+			aggregateContainerState = newAggregateContainerStateWithOverrides(vpa.AggregationOverrides)
 			aggregateContainerStateMap[containerName] = aggregateContainerState
 		}
 		aggregateContainerState.MergeContainerState(aggregation)
@@ -234,6 +240,18 @@ func (vpa *Vpa) SetUpdateMode(updatePolicy *vpa_types.PodUpdatePolicy) {
 	}
 }
 
+// SetAggregationOverrides updates the aggregation parameters overridden by the
+// VPA and aggregators under this VPA.
+func (vpa *Vpa) SetAggregationOverrides(overrides AggregationOverrides) {
+	if overrides == vpa.AggregationOverrides {
+		return
+	}
+	vpa.AggregationOverrides = overrides
+	for _, state := range vpa.aggregateContainerStates {
+		state.SetAggregationOverrides(overrides)
+	}
+}
+
 // UpdateConditions updates the conditions of VPA objects based on it's state.
 // PodsMatched is passed to indicate if there are currently active pods in the
 // cluster matching this VPA.
@@ -255,11 +273,56 @@ func (vpa *Vpa) UpdateConditions(podsMatched bool) {
 
 }
 
+// RecordConditionTransitions appends the conditions which transitioned since
+// their latest entry in ConditionHistory to it. Entries older than maxAge are
+// dropped, as are the oldest entries beyond maxLength. A maxLength of 0 clears
+// the history, a maxAge of 0 keeps entries regardless of their age.
+func (vpa *Vpa) RecordConditionTransitions(now time.Time, maxLength int, maxAge time.Duration) {
+	if maxLength <= 0 {
+		vpa.ConditionHistory = nil
+		return
+	}
+	latest := make(map[vpa_types.VerticalPodAutoscalerConditionType]vpa_types.VerticalPodAutoscalerCondition)
+	for _, entry := range vpa.ConditionHistory {
+		latest[entry.Type] = entry
+	}
+	var transitions []vpa_types.VerticalPodAutoscalerCondition
+	for _, condition := range vpa.Conditions.AsList() {
+		if condition.LastTransitionTime.IsZero() {
+			continue
+		}
+		// Times are compared in seconds, the precision they are stored with.
+		entry, found := latest[condition.Type]
+		if found && entry.Status == condition.Status && entry.LastTransitionTime.Unix() == condition.LastTransitionTime.Unix() {
+			continue
+		}
+		transitions = append(transitions, condition)
+	}
+	sort.SliceStable(transitions, func(i, j int) bool {
+		return transitions[i].LastTransitionTime.Before(&transitions[j].LastTransitionTime)
+	})
+	history := append(vpa.ConditionHistory, transitions...)
+
+	first := 0
+	if len(history) > maxLength {
+		first = len(history) - maxLength
+	}
+	for maxAge > 0 && first < len(history) && now.Sub(history[first].LastTransitionTime.Time) > maxAge {
+		first++
+	}
+	if first == len(history) {
+		vpa.ConditionHistory = nil
+		return
+	}
+	vpa.ConditionHistory = append([]vpa_types.VerticalPodAutoscalerCondition(nil), history[first:]...)
+}
+
 // AsStatus returns this objects equivalent of VPA Status. UpdateConditions
 // should be called first.
 func (vpa *Vpa) AsStatus() *vpa_types.VerticalPodAutoscalerStatus {
 	status := &vpa_types.VerticalPodAutoscalerStatus{
-		Conditions: vpa.Conditions.AsList(),
+		Conditions:       vpa.Conditions.AsList(),
+		ConditionHistory: vpa.ConditionHistory,
 	}
 	if vpa.Recommendation != nil {
 		status.Recommendation = vpa.Recommendation
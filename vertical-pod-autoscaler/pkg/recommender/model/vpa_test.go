@@ -22,6 +22,7 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	labels "k8s.io/apimachinery/pkg/labels"
 	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/test"
@@ -591,3 +592,48 @@ func (k mockAggregateStateKey) Labels() labels.Labels {
 	labels, _ := labels.ConvertSelectorToLabelsMap(k.labels)
 	return labels
 }
+
+func TestRecordConditionTransitions(t *testing.T) {
+	now := time.Unix(1000000, 0)
+	condition := func(conditionType vpa_types.VerticalPodAutoscalerConditionType, status corev1.ConditionStatus, age time.Duration) vpa_types.VerticalPodAutoscalerCondition {
+		return vpa_types.VerticalPodAutoscalerCondition{
+			Type:               conditionType,
+			Status:             status,
+			LastTransitionTime: metav1.NewTime(now.Add(-age)),
+		}
+	}
+	vpa := NewVpa(VpaID{}, nil, anyTime)
+	vpa.Conditions[vpa_types.RecommendationProvided] = condition(vpa_types.RecommendationProvided, corev1.ConditionFalse, 3*time.Hour)
+	vpa.Conditions[vpa_types.LowConfidence] = condition(vpa_types.LowConfidence, corev1.ConditionTrue, 2*time.Hour)
+
+	vpa.RecordConditionTransitions(now, 3, 24*time.Hour)
+	assert.Equal(t, []vpa_types.VerticalPodAutoscalerCondition{
+		condition(vpa_types.RecommendationProvided, corev1.ConditionFalse, 3*time.Hour),
+		condition(vpa_types.LowConfidence, corev1.ConditionTrue, 2*time.Hour),
+	}, vpa.ConditionHistory)
+
+	// Unchanged conditions aren't recorded again.
+	vpa.RecordConditionTransitions(now, 3, 24*time.Hour)
+	assert.Len(t, vpa.ConditionHistory, 2)
+
+	// The oldest transitions are dropped beyond the maximum length.
+	vpa.Conditions[vpa_types.RecommendationProvided] = condition(vpa_types.RecommendationProvided, corev1.ConditionTrue, time.Hour)
+	vpa.Conditions[vpa_types.LowConfidence] = condition(vpa_types.LowConfidence, corev1.ConditionFalse, 0)
+	vpa.RecordConditionTransitions(now, 3, 24*time.Hour)
+	assert.Equal(t, []vpa_types.VerticalPodAutoscalerCondition{
+		condition(vpa_types.LowConfidence, corev1.ConditionTrue, 2*time.Hour),
+		condition(vpa_types.RecommendationProvided, corev1.ConditionTrue, time.Hour),
+		condition(vpa_types.LowConfidence, corev1.ConditionFalse, 0),
+	}, vpa.ConditionHistory)
+
+	// Transitions older than the maximum age are dropped.
+	vpa.RecordConditionTransitions(now, 3, 90*time.Minute)
+	assert.Equal(t, []vpa_types.VerticalPodAutoscalerCondition{
+		condition(vpa_types.RecommendationProvided, corev1.ConditionTrue, time.Hour),
+		condition(vpa_types.LowConfidence, corev1.ConditionFalse, 0),
+	}, vpa.ConditionHistory)
+	assert.Equal(t, vpa.ConditionHistory, vpa.AsStatus().ConditionHistory)
+
+	vpa.RecordConditionTransitions(now, 0, 0)
+	assert.Nil(t, vpa.ConditionHistory)
+}
@@ -0,0 +1,40 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package objectstore accesses buckets of S3 compatible object stores, which
+// hold checkpoints and evaluation samples of the recommender.
+package objectstore
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrObjectNotFound is returned by ObjectStore.Get for missing objects.
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectStore is a bucket of an S3 compatible object store. Writing an object
+// replaces it atomically.
+type ObjectStore interface {
+	// Get returns the content of the object, ErrObjectNotFound if missing.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Put creates or replaces the object.
+	Put(ctx context.Context, key string, content []byte) error
+	// Delete removes the object. Deleting a missing object succeeds.
+	Delete(ctx context.Context, key string) error
+	// List returns the keys of all objects starting with the prefix.
+	List(ctx context.Context, prefix string) ([]string, error)
+}
@@ -0,0 +1,260 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Config configures a bucket of an S3 compatible object store, e.g. Amazon
+// S3, Google Cloud Storage through its XML API or MinIO.
+type S3Config struct {
+	// Endpoint is the base URL of the object store, e.g.
+	// https://s3.eu-west-1.amazonaws.com or https://storage.googleapis.com.
+	// Buckets are addressed by path.
+	Endpoint string
+	Bucket   string
+	// Region the requests are signed for, e.g. eu-west-1, or auto for GCS.
+	Region string
+	// AccessKeyID and SecretAccessKey are the HMAC credentials requests are
+	// signed with. Requests are not signed if AccessKeyID is empty.
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+type s3ObjectStore struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+// NewS3ObjectStore returns an ObjectStore accessing a bucket with the S3 REST
+// API, signing requests with AWS Signature Version 4.
+func NewS3ObjectStore(config S3Config, client *http.Client) (ObjectStore, error) {
+	endpoint, err := url.Parse(strings.TrimSuffix(config.Endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid object store endpoint %q: %v", config.Endpoint, err)
+	}
+	if endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid object store endpoint %q: scheme and host are required", config.Endpoint)
+	}
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("object store bucket is required")
+	}
+	return &s3ObjectStore{config: config, endpoint: endpoint, client: client, now: time.Now}, nil
+}
+
+func (s *s3ObjectStore) Get(ctx context.Context, key string) ([]byte, error) {
+	response, err := s.do(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		return nil, ErrObjectNotFound
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, newS3Error(http.MethodGet, key, response)
+	}
+	return io.ReadAll(response.Body)
+}
+
+func (s *s3ObjectStore) Put(ctx context.Context, key string, content []byte) error {
+	response, err := s.do(ctx, http.MethodPut, key, nil, content)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return newS3Error(http.MethodPut, key, response)
+	}
+	return nil
+}
+
+func (s *s3ObjectStore) Delete(ctx context.Context, key string) error {
+	response, err := s.do(ctx, http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusNoContent && response.StatusCode != http.StatusNotFound {
+		return newS3Error(http.MethodDelete, key, response)
+	}
+	return nil
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *s3ObjectStore) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	continuationToken := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if continuationToken != "" {
+			query.Set("continuation-token", continuationToken)
+		}
+		result, err := s.list(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range result.Contents {
+			keys = append(keys, object.Key)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+		continuationToken = result.NextContinuationToken
+	}
+}
+
+func (s *s3ObjectStore) list(ctx context.Context, query url.Values) (*listBucketResult, error) {
+	response, err := s.do(ctx, http.MethodGet, "", query, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, newS3Error("LIST", query.Get("prefix"), response)
+	}
+	result := &listBucketResult{}
+	if err := xml.NewDecoder(response.Body).Decode(result); err != nil {
+		return nil, fmt.Errorf("cannot decode object list: %v", err)
+	}
+	return result, nil
+}
+
+func newS3Error(method, key string, response *http.Response) error {
+	message, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+	return fmt.Errorf("object store %s %s returned %s: %s", method, key, response.Status, strings.TrimSpace(string(message)))
+}
+
+func (s *s3ObjectStore) do(ctx context.Context, method, key string, query url.Values, content []byte) (*http.Response, error) {
+	path := s.endpoint.Path + "/" + s.config.Bucket
+	if key != "" {
+		path += "/" + key
+	}
+	requestURL := *s.endpoint
+	requestURL.Path = path
+	requestURL.RawPath = uriEncode(path, false)
+	requestURL.RawQuery = canonicalQuery(query)
+	request, err := http.NewRequestWithContext(ctx, method, requestURL.String(), bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	if s.config.AccessKeyID != "" {
+		s.sign(request, content)
+	}
+	return s.client.Do(request)
+}
+
+// sign adds the AWS Signature Version 4 of the request, see
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-authenticating-requests.html
+func (s *s3ObjectStore) sign(request *http.Request, content []byte) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(content)
+	request.Header.Set("x-amz-date", amzDate)
+	request.Header.Set("x-amz-content-sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		request.URL.RawQuery,
+		"host:" + request.URL.Host + "\n" +
+			"x-amz-content-sha256:" + payloadHash + "\n" +
+			"x-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := strings.Join([]string{date, s.config.Region, "s3", "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+s.config.SecretAccessKey), date)
+	for _, part := range []string{s.config.Region, "s3", "aws4_request"} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.config.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func sha256Hex(content []byte) string {
+	hash := sha256.Sum256(content)
+	return hex.EncodeToString(hash[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encodes the query sorted by parameter names, as required
+// by the signature.
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var parameters []string
+	for _, name := range names {
+		for _, value := range query[name] {
+			parameters = append(parameters, uriEncode(name, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(parameters, "&")
+}
+
+// uriEncode percent-encodes all but the unreserved characters, keeping
+// slashes unless encodeSlash is set.
+func uriEncode(value string, encodeSlash bool) string {
+	var encoded strings.Builder
+	for _, b := range []byte(value) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '.', b == '_', b == '~':
+			encoded.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			encoded.WriteByte(b)
+		default:
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	return encoded.String()
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routines
+
+import (
+	"fmt"
+	"math"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+)
+
+const bytesPerGiB = 1 << 30
+
+// CPUMemoryRatioPostProcessor keeps recommendations at a fixed ratio of CPU
+// cores per GiB of memory, e.g. to match the shape of the nodes. Whichever
+// resource is below the ratio is raised to it, the other one is kept.
+type CPUMemoryRatioPostProcessor struct {
+	CPUPerGiB float64
+}
+
+var _ RecommendationPostProcessor = &CPUMemoryRatioPostProcessor{}
+
+// NewCPUMemoryRatioPostProcessor creates a CPUMemoryRatioPostProcessor from the config.
+func NewCPUMemoryRatioPostProcessor(config PostProcessorConfig) (RecommendationPostProcessor, error) {
+	if config.CPUToMemoryRatio <= 0 {
+		return nil, fmt.Errorf("CPU to memory ratio must be positive, got %v", config.CPUToMemoryRatio)
+	}
+	return &CPUMemoryRatioPostProcessor{CPUPerGiB: config.CPUToMemoryRatio}, nil
+}
+
+// Process applies the ratio to all containers.
+func (p *CPUMemoryRatioPostProcessor) Process(vpa *model.Vpa, recommendation *vpa_types.RecommendedPodResources, policy *vpa_types.PodResourcePolicy) *vpa_types.RecommendedPodResources {
+	amendedRecommendation := recommendation.DeepCopy()
+	for _, r := range amendedRecommendation.ContainerRecommendations {
+		p.applyRatio(r.Target)
+		p.applyRatio(r.LowerBound)
+		p.applyRatio(r.UpperBound)
+		p.applyRatio(r.UncappedTarget)
+	}
+	return amendedRecommendation
+}
+
+func (p *CPUMemoryRatioPostProcessor) applyRatio(recommendation apiv1.ResourceList) {
+	cpu, foundCPU := recommendation[apiv1.ResourceCPU]
+	memory, foundMemory := recommendation[apiv1.ResourceMemory]
+	if !foundCPU || !foundMemory {
+		return
+	}
+	cpuMillis := cpu.MilliValue()
+	memoryBytes := memory.Value()
+	if minCPUMillis := int64(math.Ceil(float64(memoryBytes) / bytesPerGiB * p.CPUPerGiB * 1000)); cpuMillis < minCPUMillis {
+		recommendation[apiv1.ResourceCPU] = *resource.NewMilliQuantity(minCPUMillis, resource.DecimalSI)
+		return
+	}
+	if minMemoryBytes := int64(math.Ceil(float64(cpuMillis) / 1000 / p.CPUPerGiB * bytesPerGiB)); memoryBytes < minMemoryBytes {
+		recommendation[apiv1.ResourceMemory] = *resource.NewQuantity(minMemoryBytes, resource.BinarySI)
+	}
+}
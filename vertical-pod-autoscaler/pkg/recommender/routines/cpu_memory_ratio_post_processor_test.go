@@ -0,0 +1,75 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routines
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/test"
+)
+
+func TestCPUMemoryRatioPostProcessor_Process(t *testing.T) {
+	tests := []struct {
+		name        string
+		cpu, memory string
+		wantCPU     string
+		wantMemory  string
+	}{
+		{
+			name:       "CPU raised",
+			cpu:        "0.1",
+			memory:     "2Gi",
+			wantCPU:    "0.5",
+			wantMemory: "2Gi",
+		},
+		{
+			name:       "memory raised",
+			cpu:        "2",
+			memory:     "1Gi",
+			wantCPU:    "2",
+			wantMemory: "8Gi",
+		},
+		{
+			name:       "at ratio",
+			cpu:        "1",
+			memory:     "4Gi",
+			wantCPU:    "1",
+			wantMemory: "4Gi",
+		},
+	}
+	p, err := NewCPUMemoryRatioPostProcessor(PostProcessorConfig{CPUToMemoryRatio: 0.25})
+	assert.NoError(t, err)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recommendation := &vpa_types.RecommendedPodResources{
+				ContainerRecommendations: []vpa_types.RecommendedContainerResources{
+					test.Recommendation().WithContainer("container1").WithTarget(tt.cpu, tt.memory).GetContainerResources(),
+				},
+			}
+			want := &vpa_types.RecommendedPodResources{
+				ContainerRecommendations: []vpa_types.RecommendedContainerResources{
+					test.Recommendation().WithContainer("container1").WithTarget(tt.wantCPU, tt.wantMemory).GetContainerResources(),
+				},
+			}
+			got := p.Process(&model.Vpa{}, recommendation, nil)
+			assert.True(t, equalRecommendedPodResources(want, got), "Process(%v) = %v", recommendation, got)
+		})
+	}
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routines
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+)
+
+// lastSampleStartGranularity is the granularity of the published last sample
+// start. It moves with every sample, so publishing it exactly would update the
+// status of every VPA every loop.
+const lastSampleStartGranularity = time.Hour
+
+// applyDataWindows removes the recommendations of containers whose samples
+// span less than minWindow and returns the names of these containers. The first
+// and last sample start of the aggregation of each remaining container are set
+// on its recommendation, the latter rounded down to lastSampleStartGranularity.
+// Nothing is done unless minWindow is positive.
+func applyDataWindows(recommendation *vpa_types.RecommendedPodResources, containerNameToAggregateStateMap model.ContainerNameToAggregateStateMap, minWindow time.Duration) []string {
+	if recommendation == nil || minWindow <= 0 {
+		return nil
+	}
+	var withheld []string
+	containerRecommendations := make([]vpa_types.RecommendedContainerResources, 0, len(recommendation.ContainerRecommendations))
+	for _, containerRecommendation := range recommendation.ContainerRecommendations {
+		aggregation, found := containerNameToAggregateStateMap[containerRecommendation.ContainerName]
+		hasSamples := found && !aggregation.FirstSampleStart.IsZero()
+		if !hasSamples || aggregation.LastSampleStart.Sub(aggregation.FirstSampleStart) < minWindow {
+			withheld = append(withheld, containerRecommendation.ContainerName)
+			continue
+		}
+		firstSampleStart := metav1.NewTime(aggregation.FirstSampleStart)
+		lastSampleStart := metav1.NewTime(aggregation.LastSampleStart.Truncate(lastSampleStartGranularity))
+		containerRecommendation.FirstSampleStart = &firstSampleStart
+		containerRecommendation.LastSampleStart = &lastSampleStart
+		containerRecommendations = append(containerRecommendations, containerRecommendation)
+	}
+	recommendation.ContainerRecommendations = containerRecommendations
+	return withheld
+}
+
+// setInsufficientDataWindowCondition sets the InsufficientDataWindow
+// condition of the VPA listing the containers whose recommendation is
+// withheld, or removes it if there are none.
+func setInsufficientDataWindowCondition(vpa *model.Vpa, withheld []string, minWindow time.Duration) {
+	if len(withheld) == 0 {
+		delete(vpa.Conditions, vpa_types.InsufficientDataWindow)
+		return
+	}
+	vpa.Conditions.Set(vpa_types.InsufficientDataWindow, true, "DataWindowBelowMinimum",
+		fmt.Sprintf("Usage samples of containers %s span less than %v, their recommendation is withheld", strings.Join(withheld, ", "), minWindow))
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routines
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/test"
+)
+
+func TestApplyDataWindows(t *testing.T) {
+	now := time.Unix(1000000, 0)
+	aggregation := func(history time.Duration) *model.AggregateContainerState {
+		state := model.NewAggregateContainerState()
+		state.FirstSampleStart = now.Add(-history)
+		state.LastSampleStart = now
+		return state
+	}
+	aggregations := model.ContainerNameToAggregateStateMap{
+		"app":     aggregation(48 * time.Hour),
+		"sidecar": aggregation(time.Hour),
+	}
+	recommendation := func() *vpa_types.RecommendedPodResources {
+		return &vpa_types.RecommendedPodResources{ContainerRecommendations: []vpa_types.RecommendedContainerResources{
+			test.Recommendation().WithContainer("app").WithTarget("1", "1Gi").GetContainerResources(),
+			test.Recommendation().WithContainer("sidecar").WithTarget("100m", "100Mi").GetContainerResources(),
+		}}
+	}
+
+	noMinimum := recommendation()
+	assert.Empty(t, applyDataWindows(noMinimum, aggregations, 0))
+	assert.Equal(t, recommendation(), noMinimum)
+
+	withheld := recommendation()
+	assert.Equal(t, []string{"sidecar"}, applyDataWindows(withheld, aggregations, 24*time.Hour))
+	assert.Len(t, withheld.ContainerRecommendations, 1)
+	assert.Equal(t, "app", withheld.ContainerRecommendations[0].ContainerName)
+	firstSampleStart, lastSampleStart := metav1.NewTime(now.Add(-48*time.Hour)), metav1.NewTime(now.Truncate(time.Hour))
+	assert.Equal(t, &firstSampleStart, withheld.ContainerRecommendations[0].FirstSampleStart)
+	assert.Equal(t, &lastSampleStart, withheld.ContainerRecommendations[0].LastSampleStart)
+
+	// New samples within the hour don't change the published window.
+	for _, state := range aggregations {
+		state.LastSampleStart = now.Add(time.Minute)
+	}
+	later := recommendation()
+	applyDataWindows(later, aggregations, 24*time.Hour)
+	assert.Equal(t, withheld, later)
+
+	vpa := model.NewVpa(model.VpaID{}, nil, now)
+	setInsufficientDataWindowCondition(vpa, []string{"sidecar"}, 24*time.Hour)
+	assert.Equal(t, "Usage samples of containers sidecar span less than 24h0m0s, their recommendation is withheld",
+		vpa.Conditions[vpa_types.InsufficientDataWindow].Message)
+	setInsufficientDataWindowCondition(vpa, nil, 24*time.Hour)
+	assert.NotContains(t, vpa.Conditions, vpa_types.InsufficientDataWindow)
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routines
+
+import (
+	"fmt"
+	"math/bits"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+)
+
+// MemoryRoundingPostProcessor rounds memory recommendations up to a multiple
+// of an increment, e.g. 128Mi, or to the next power of two.
+type MemoryRoundingPostProcessor struct {
+	Increment  int64
+	PowerOfTwo bool
+}
+
+var _ RecommendationPostProcessor = &MemoryRoundingPostProcessor{}
+
+// NewMemoryRoundingPostProcessor creates a MemoryRoundingPostProcessor from the config.
+func NewMemoryRoundingPostProcessor(config PostProcessorConfig) (RecommendationPostProcessor, error) {
+	if !config.MemoryRoundingPowerOfTwo && config.MemoryRoundingIncrement <= 0 {
+		return nil, fmt.Errorf("memory rounding increment must be positive, got %d", config.MemoryRoundingIncrement)
+	}
+	return &MemoryRoundingPostProcessor{
+		Increment:  config.MemoryRoundingIncrement,
+		PowerOfTwo: config.MemoryRoundingPowerOfTwo,
+	}, nil
+}
+
+// Process rounds up the memory of all containers.
+func (p *MemoryRoundingPostProcessor) Process(vpa *model.Vpa, recommendation *vpa_types.RecommendedPodResources, policy *vpa_types.PodResourcePolicy) *vpa_types.RecommendedPodResources {
+	amendedRecommendation := recommendation.DeepCopy()
+	for _, r := range amendedRecommendation.ContainerRecommendations {
+		p.roundMemory(r.Target)
+		p.roundMemory(r.LowerBound)
+		p.roundMemory(r.UpperBound)
+		p.roundMemory(r.UncappedTarget)
+	}
+	return amendedRecommendation
+}
+
+func (p *MemoryRoundingPostProcessor) roundMemory(recommendation apiv1.ResourceList) {
+	memory, found := recommendation[apiv1.ResourceMemory]
+	if !found || memory.Value() <= 0 {
+		return
+	}
+	bytes := memory.Value()
+	var rounded int64
+	if p.PowerOfTwo {
+		rounded = int64(1) << bits.Len64(uint64(bytes-1))
+	} else {
+		rounded = (bytes + p.Increment - 1) / p.Increment * p.Increment
+	}
+	recommendation[apiv1.ResourceMemory] = *resource.NewQuantity(rounded, resource.BinarySI)
+}
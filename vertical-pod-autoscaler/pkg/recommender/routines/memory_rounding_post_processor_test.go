@@ -0,0 +1,83 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routines
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/test"
+)
+
+func TestMemoryRoundingPostProcessor_Process(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     PostProcessorConfig
+		target     string
+		wantTarget string
+	}{
+		{
+			name:       "rounded up to increment",
+			config:     PostProcessorConfig{MemoryRoundingIncrement: 128 * 1024 * 1024},
+			target:     "200Mi",
+			wantTarget: "256Mi",
+		},
+		{
+			name:       "multiple of increment kept",
+			config:     PostProcessorConfig{MemoryRoundingIncrement: 128 * 1024 * 1024},
+			target:     "384Mi",
+			wantTarget: "384Mi",
+		},
+		{
+			name:       "rounded up to power of two",
+			config:     PostProcessorConfig{MemoryRoundingPowerOfTwo: true},
+			target:     "300Mi",
+			wantTarget: "512Mi",
+		},
+		{
+			name:       "power of two kept",
+			config:     PostProcessorConfig{MemoryRoundingPowerOfTwo: true},
+			target:     "1Gi",
+			wantTarget: "1Gi",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewMemoryRoundingPostProcessor(tt.config)
+			assert.NoError(t, err)
+			recommendation := &vpa_types.RecommendedPodResources{
+				ContainerRecommendations: []vpa_types.RecommendedContainerResources{
+					test.Recommendation().WithContainer("container1").WithTarget("0.5", tt.target).GetContainerResources(),
+				},
+			}
+			want := &vpa_types.RecommendedPodResources{
+				ContainerRecommendations: []vpa_types.RecommendedContainerResources{
+					test.Recommendation().WithContainer("container1").WithTarget("0.5", tt.wantTarget).GetContainerResources(),
+				},
+			}
+			got := p.Process(&model.Vpa{}, recommendation, nil)
+			assert.True(t, equalRecommendedPodResources(want, got), "Process(%v) = %v", recommendation, got)
+		})
+	}
+}
+
+func TestNewMemoryRoundingPostProcessorInvalid(t *testing.T) {
+	_, err := NewMemoryRoundingPostProcessor(PostProcessorConfig{})
+	assert.Error(t, err)
+}
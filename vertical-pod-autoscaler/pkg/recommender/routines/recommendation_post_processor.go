@@ -17,6 +17,10 @@ limitations under the License.
 package routines
 
 import (
+	"fmt"
+	"sort"
+	"strings"
+
 	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
 )
@@ -26,3 +30,64 @@ type RecommendationPostProcessor interface {
 	Process(vpa *model.Vpa, recommendation *vpa_types.RecommendedPodResources,
 		policy *vpa_types.PodResourcePolicy) *vpa_types.RecommendedPodResources
 }
+
+// PostProcessorConfig holds the settings of the post processors which can be
+// enabled by name.
+type PostProcessorConfig struct {
+	// MemoryRoundingIncrement is the number of bytes memory recommendations
+	// are rounded up to a multiple of.
+	MemoryRoundingIncrement int64
+	// MemoryRoundingPowerOfTwo rounds memory recommendations up to the next
+	// power of two instead.
+	MemoryRoundingPowerOfTwo bool
+	// CPUToMemoryRatio is the number of CPU cores per GiB of memory
+	// recommendations are kept at.
+	CPUToMemoryRatio float64
+}
+
+// PostProcessorFactory creates a post processor from the config.
+type PostProcessorFactory func(config PostProcessorConfig) (RecommendationPostProcessor, error)
+
+var postProcessorFactories = map[string]PostProcessorFactory{
+	"integer-cpu": func(PostProcessorConfig) (RecommendationPostProcessor, error) {
+		return &IntegerCPUPostProcessor{}, nil
+	},
+	"capping": func(PostProcessorConfig) (RecommendationPostProcessor, error) {
+		return &CappingPostProcessor{}, nil
+	},
+	"memory-rounding":  NewMemoryRoundingPostProcessor,
+	"cpu-memory-ratio": NewCPUMemoryRatioPostProcessor,
+}
+
+// RegisterPostProcessor makes a post processor available under the given name.
+func RegisterPostProcessor(name string, factory PostProcessorFactory) {
+	postProcessorFactories[name] = factory
+}
+
+// PostProcessorNames returns the names of all registered post processors.
+func PostProcessorNames() []string {
+	names := make([]string, 0, len(postProcessorFactories))
+	for name := range postProcessorFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewPostProcessors creates the post processors of the given names, in the
+// same order.
+func NewPostProcessors(names []string, config PostProcessorConfig) ([]RecommendationPostProcessor, error) {
+	postProcessors := make([]RecommendationPostProcessor, 0, len(names))
+	for _, name := range names {
+		factory, found := postProcessorFactories[name]
+		if !found {
+			return nil, fmt.Errorf("unknown post processor %q, must be one of: %s", name, strings.Join(PostProcessorNames(), ", "))
+		}
+		postProcessor, err := factory(config)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create post processor %q: %v", name, err)
+		}
+		postProcessors = append(postProcessors, postProcessor)
+	}
+	return postProcessors, nil
+}
@@ -0,0 +1,38 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routines
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewPostProcessors(t *testing.T) {
+	postProcessors, err := NewPostProcessors([]string{"integer-cpu", "cpu-memory-ratio", "capping"}, PostProcessorConfig{CPUToMemoryRatio: 0.5})
+	assert.NoError(t, err)
+	if assert.Len(t, postProcessors, 3) {
+		assert.IsType(t, &IntegerCPUPostProcessor{}, postProcessors[0])
+		assert.IsType(t, &CPUMemoryRatioPostProcessor{}, postProcessors[1])
+		assert.IsType(t, &CappingPostProcessor{}, postProcessors[2])
+	}
+
+	_, err = NewPostProcessors([]string{"unknown"}, PostProcessorConfig{})
+	assert.Error(t, err)
+	_, err = NewPostProcessors([]string{"cpu-memory-ratio"}, PostProcessorConfig{})
+	assert.Error(t, err)
+}
@@ -18,21 +18,37 @@ package routines
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
 	"time"
 
+	apiv1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
 	vpa_clientset "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/client/clientset/versioned"
 	vpa_api "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/client/clientset/versioned/typed/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/apiserver"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/audit"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/checkpoint"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/evaluation"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/external"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/input"
 	controllerfetcher "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/input/controller_fetcher"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/input/oom"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/logic"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/objectstore"
 	metrics_recommender "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/metrics/recommender"
 	vpa_utils "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/vpa"
 	"k8s.io/client-go/informers"
 	kube_client "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/workqueue"
 	klog "k8s.io/klog/v2"
 )
 
@@ -48,7 +64,40 @@ const (
 var (
 	checkpointsWriteTimeout = flag.Duration("checkpoints-timeout", time.Minute, `Timeout for writing checkpoints since the start of the recommender's main loop`)
 	minCheckpointsPerRun    = flag.Int("min-checkpoints", 10, "Minimum number of checkpoints to write per recommender's main loop")
-	memorySaver             = flag.Bool("memory-saver", false, `If true, only track pods which have an associated VPA`)
+	checkpointsMinInterval  = flag.Duration("checkpoints-min-interval", time.Minute, `Minimum interval between checkpoints of a VPA whose recommendation changes by at least --checkpoints-volatility-threshold`)
+	checkpointsMaxInterval  = flag.Duration("checkpoints-max-interval", 0, `Maximum interval between checkpoints of a VPA. 0 writes checkpoints of all VPAs on every loop`)
+	checkpointsVolatility   = flag.Float64("checkpoints-volatility-threshold", 0.1, `Relative change of a VPA's target recommendation since its last checkpoint, e.g. 0.1 for 10%, above which its checkpoints are written every --checkpoints-min-interval`)
+	checkpointsQPS          = flag.Float64("checkpoints-qps", 0, `Maximum number of VPAs checkpointed per second. 0 means no limit`)
+	checkpointsBurst        = flag.Int("checkpoints-burst", 10, `Burst of VPAs checkpointed over --checkpoints-qps`)
+	checkpointStorage       = flag.String("checkpoint-storage", "crd", `Where checkpoints are stored: crd for VerticalPodAutoscalerCheckpoint objects, or object-store for a bucket of an S3 compatible object store, holding all checkpoints of a namespace in one object. The object store credentials are read from the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables`)
+	objectStoreEndpoint     = flag.String("checkpoint-object-store-endpoint", "", `Base URL of the S3 compatible object store holding checkpoints, e.g. https://s3.eu-west-1.amazonaws.com or https://storage.googleapis.com`)
+	objectStoreBucket       = flag.String("checkpoint-object-store-bucket", "", `Bucket of the object store holding checkpoints`)
+	objectStoreRegion       = flag.String("checkpoint-object-store-region", "us-east-1", `Region requests to the object store are signed for, auto for Google Cloud Storage`)
+	objectStorePrefix       = flag.String("checkpoint-object-store-prefix", "vpa-checkpoints/", `Prefix of the keys of checkpoint objects in the bucket. Each recommender needs its own prefix`)
+	marginConfigMap         = flag.String("recommendation-margin-configmap", "", `Name of the ConfigMap which overrides --recommendation-margin-fraction for VPAs in its namespace, under the recommendationMarginFraction key. Empty disables namespace overrides`)
+	memorySaver             = flag.Bool("memory-saver", false, `If true, only track pods which have an associated VPA, and only query metrics of namespaces with VPAs`)
+	cpuPerformanceLabel     = flag.String("cpu-performance-factor-node-label", "", `Node label holding the CPU performance factor of the node relative to a reference node, e.g. 1.5 for a node doing the same work with 1.5 times less CPU time. If set, CPU usage samples are scaled by the factor before aggregation, so recommendations are expressed in CPU of the reference node. Empty disables normalization`)
+	externalAddress         = flag.String("external-recommender-address", "", `Address of an external recommender service implementing pkg/recommender/external/recommender.proto, as a gRPC target host:port, e.g. ml-recommender:8080, which computes recommendations instead of the recommender. VPAs it returns no recommendation for are recommended for as usual. Empty disables delegation`)
+	externalTimeout         = flag.Duration("external-recommender-timeout", 30*time.Second, `Timeout of requests to --external-recommender-address`)
+	externalCAFile          = flag.String("external-recommender-ca-file", "", `Path of the PEM CA bundle the certificate of --external-recommender-address is verified with. If set, the connection uses TLS, otherwise it's plaintext`)
+	recommendationWorkers   = flag.Int("recommendation-workers", 1, `Number of goroutines adding usage samples, computing recommendations and updating VPA statuses in parallel`)
+	statusUpdateThreshold   = flag.Float64("vpa-status-update-threshold", 0, `Relative change of a recommended resource, e.g. 0.05 for 5%, above which the status of a VPA is updated. Changes of conditions or recommended containers always update the status. 0 updates the status on any change`)
+	containerMetrics        = flag.Bool("container-recommendation-metrics", false, `If true, the recommendation and usage percentiles of every container of every VPA are exported as metrics. Adds several series per container`)
+	memoryReportInterval    = flag.Duration("model-memory-report-interval", 0, `How often an estimate of the memory held by the recommender model, broken down by structure, is logged. It's always exported as metrics and at /debug/vars. 0 disables the report`)
+	aggregationLabel        = flag.String("aggregation-container-name-label", "", `Pod label holding a stable container name for containers whose names embed unique suffixes. If set, usage of containers whose names start with the label value is aggregated, and recommended, under the label value. Empty aggregates by container name`)
+	evaluationSink          = flag.String("evaluation-sink", "", `Where usage samples of containers, paired with the recommendations in effect when they were observed, are persisted for offline evaluation of recommendations: csv to append them to --evaluation-csv-path, or object-store for a CSV object per write in the bucket configured by --checkpoint-object-store-*. Empty disables them`)
+	evaluationCSVPath       = flag.String("evaluation-csv-path", "vpa-evaluation.csv", `Path of the CSV file evaluation samples are appended to with --evaluation-sink=csv`)
+	evaluationPrefix        = flag.String("evaluation-object-store-prefix", "vpa-evaluation/", `Prefix of the keys of evaluation sample objects with --evaluation-sink=object-store`)
+	evaluationInterval      = flag.Duration("evaluation-interval", time.Hour, `How often evaluation samples are written`)
+	evaluationFraction      = flag.Float64("evaluation-sample-fraction", 1, `Fraction of containers, picked by name, whose evaluation samples are written`)
+	fullPodSyncInterval     = flag.Duration("full-pod-sync-interval", 10*time.Minute, `How often all pods are synced into the model. In between only pods changed according to the pod informer are synced. 0 syncs all pods on every loop`)
+	shortLivedPodThreshold  = flag.Duration("short-lived-pod-threshold", 0, `Pods running for less than this duration, e.g. CI jobs, are short-lived and their usage is handled according to --short-lived-pod-policy instead of being aggregated with long-running pods. Zero disables it`)
+	shortLivedPodPolicy     = flag.String("short-lived-pod-policy", string(input.ExcludeShortLivedPods), `How usage of short-lived pods is handled: exclude drops their usage samples and OOMs, separate aggregates them under the container name with a .short-lived suffix, recommended for separately`)
+	podLevelUsageFallback   = flag.Bool("pod-level-usage-fallback", false, `If true, the usage of running containers of pods under VPAs missing from the metrics API, e.g. because of container runtime bugs, is estimated from the usage of their pods, read from the stats summary of kubelets through the node proxy, and distributed in proportion to their requests. Their VPAs get the UsageEstimatedFromPodMetrics condition`)
+	conditionHistoryLength  = flag.Int("condition-history-length", 10, `Maximum number of condition transitions kept in the conditionHistory of the status of a VPA. 0 disables the history`)
+	conditionHistoryMaxAge  = flag.Duration("condition-history-max-age", 7*24*time.Hour, `Maximum age of condition transitions kept in the conditionHistory of the status of a VPA. 0 keeps transitions regardless of their age`)
+	minDataWindow           = flag.Duration("min-recommendation-data-window", 0, `Minimum time between the first and the last usage sample of a container for its recommendation to be published. Recommendations of containers with a shorter history are withheld and their VPAs get the InsufficientDataWindow condition. 0 publishes recommendations regardless of their history`)
+	auditLogPath            = flag.String("recommendation-audit-log", "", `Path of a file every change of a target recommendation is appended to as a JSON line, with the old and new targets, the usage percentiles the target is based on and the post processors applied. - writes to stdout. Empty disables the log`)
 )
 
 // Recommender recommend resources for certain containers, based on utilization periodically got from metrics api.
@@ -76,7 +125,18 @@ type recommender struct {
 	lastCheckpointGC              time.Time
 	vpaClient                     vpa_api.VerticalPodAutoscalersGetter
 	podResourceRecommender        logic.PodResourceRecommender
+	marginResolver                input.MarginResolver
+	externalRecommender           external.Recommender
+	recommendationStore           *apiserver.RecommendationStore
+	evaluationRecorder            *evaluation.Recorder
+	auditLogger                   *audit.Logger
 	useCheckpoints                bool
+	readOnly                      bool
+	workers                       int
+	statusUpdateThreshold         float64
+	recordContainerMetrics        bool
+	memoryReportInterval          time.Duration
+	lastMemoryReport              time.Time
 	lastAggregateContainerStateGC time.Time
 	recommendationPostProcessor   []RecommendationPostProcessor
 }
@@ -89,11 +149,61 @@ func (r *recommender) GetClusterStateFeeder() input.ClusterStateFeeder {
 	return r.clusterStateFeeder
 }
 
-// Updates VPA CRD objects' statuses.
+// getRecommendedPodResources computes the recommendation of the VPA with the
+// safety margin resolved for it, if any.
+func (r *recommender) getRecommendedPodResources(vpa *model.Vpa, containerNameToAggregateStateMap model.ContainerNameToAggregateStateMap) logic.RecommendedPodResources {
+	if r.marginResolver != nil {
+		if marginAwareRecommender, ok := r.podResourceRecommender.(logic.MarginAwarePodResourceRecommender); ok {
+			if marginFraction, found := r.marginResolver.MarginFraction(vpa); found {
+				return marginAwareRecommender.GetRecommendedPodResourcesWithMargin(containerNameToAggregateStateMap, marginFraction)
+			}
+		}
+	}
+	return r.podResourceRecommender.GetRecommendedPodResources(containerNameToAggregateStateMap)
+}
+
+// getExternalRecommendations gets recommendations of all VPAs from the
+// external recommender, if one is configured.
+func (r *recommender) getExternalRecommendations(updates []*vpaUpdate) map[model.VpaID]logic.RecommendedPodResources {
+	if r.externalRecommender == nil {
+		return nil
+	}
+	vpas := make(map[model.VpaID]model.ContainerNameToAggregateStateMap, len(updates))
+	for _, update := range updates {
+		vpas[update.vpa.ID] = update.containerNameToAggregateStateMap
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *externalTimeout)
+	defer cancel()
+	recommendations, err := r.externalRecommender.GetRecommendations(ctx, vpas)
+	if err != nil {
+		klog.Errorf("Cannot get recommendations from external recommender, falling back to own recommendations: %v", err)
+		return nil
+	}
+	return recommendations
+}
+
+// vpaUpdate holds the state of a single VPA through UpdateVPAs.
+type vpaUpdate struct {
+	observedVpa                      *vpa_types.VerticalPodAutoscaler
+	vpa                              *model.Vpa
+	containerNameToAggregateStateMap model.ContainerNameToAggregateStateMap
+	recommendation                   *vpa_types.RecommendedPodResources
+	withheldContainers               []string
+	status                           *vpa_types.VerticalPodAutoscalerStatus
+}
+
+// Updates VPA CRD objects' statuses. Recommendations are computed and statuses
+// are written by up to r.workers goroutines.
 func (r *recommender) UpdateVPAs() {
 	cnt := metrics_recommender.NewObjectCounter()
 	defer cnt.Observe()
-
+	var containerCnt *metrics_recommender.ContainerRecommendationRecorder
+	if r.recordContainerMetrics {
+		containerCnt = metrics_recommender.NewContainerRecommendationRecorder()
+		defer containerCnt.Observe()
+	}
+	// Aggregations may be shared by VPAs, so they are merged sequentially.
+	var updates []*vpaUpdate
 	for _, observedVpa := range r.clusterState.ObservedVpas {
 		key := model.VpaID{
 			Namespace: observedVpa.Namespace,
@@ -104,21 +214,50 @@ func (r *recommender) UpdateVPAs() {
 		if !found {
 			continue
 		}
-		resources := r.podResourceRecommender.GetRecommendedPodResources(GetContainerNameToAggregateStateMap(vpa))
-		had := vpa.HasRecommendation()
+		updates = append(updates, &vpaUpdate{
+			observedVpa:                      observedVpa,
+			vpa:                              vpa,
+			containerNameToAggregateStateMap: GetContainerNameToAggregateStateMap(vpa),
+		})
+	}
+
+	externalRecommendations := r.getExternalRecommendations(updates)
+	r.parallelize(len(updates), func(i int) {
+		update := updates[i]
+		resources, found := externalRecommendations[update.vpa.ID]
+		if !found {
+			resources = r.getRecommendedPodResources(update.vpa, update.containerNameToAggregateStateMap)
+		}
 
 		listOfResourceRecommendation := logic.MapToListOfRecommendedContainerResources(resources)
 
 		for _, postProcessor := range r.recommendationPostProcessor {
-			listOfResourceRecommendation = postProcessor.Process(vpa, listOfResourceRecommendation, observedVpa.Spec.ResourcePolicy)
+			listOfResourceRecommendation = postProcessor.Process(update.vpa, listOfResourceRecommendation, update.observedVpa.Spec.ResourcePolicy)
 		}
+		update.withheldContainers = applyDataWindows(listOfResourceRecommendation, update.containerNameToAggregateStateMap, *minDataWindow)
+		update.recommendation = listOfResourceRecommendation
+	})
 
-		vpa.UpdateRecommendation(listOfResourceRecommendation)
+	if r.evaluationRecorder != nil {
+		// Usage is paired with the recommendations it was observed under.
+		r.evaluationRecorder.Add(r.clusterState)
+	}
+	statuses := make(map[model.VpaID]vpa_types.VerticalPodAutoscalerStatus, len(updates))
+	for _, update := range updates {
+		vpa := update.vpa
+		if r.auditLogger != nil {
+			if err := r.auditLogger.Record(time.Now(), vpa.ID, vpa.Recommendation, update.recommendation, update.containerNameToAggregateStateMap, r.postProcessorNames()); err != nil {
+				klog.Errorf("Cannot write recommendation audit log of VPA %s/%s: %v", vpa.ID.Namespace, vpa.ID.VpaName, err)
+			}
+		}
+		had := vpa.HasRecommendation()
+		vpa.UpdateRecommendation(update.recommendation)
 		if vpa.HasRecommendation() && !had {
 			metrics_recommender.ObserveRecommendationLatency(vpa.Created)
 		}
 		hasMatchingPods := vpa.PodCount > 0
 		vpa.UpdateConditions(hasMatchingPods)
+		setInsufficientDataWindowCondition(vpa, update.withheldContainers, *minDataWindow)
 		if err := r.clusterState.RecordRecommendation(vpa, time.Now()); err != nil {
 			klog.Warningf("%v", err)
 			if klog.V(4).Enabled() {
@@ -134,21 +273,160 @@ func (r *recommender) UpdateVPAs() {
 			}
 		}
 		cnt.Add(vpa)
+		if containerCnt != nil {
+			containerCnt.Add(vpa.ID, update.recommendation, update.containerNameToAggregateStateMap)
+		}
 
+		vpa.RecordConditionTransitions(time.Now(), *conditionHistoryLength, *conditionHistoryMaxAge)
+		update.status = vpa.AsStatus()
+		statuses[vpa.ID] = *update.status
+	}
+	if r.evaluationRecorder != nil {
+		if err := r.evaluationRecorder.Flush(time.Now()); err != nil {
+			klog.Errorf("Cannot write evaluation samples: %v", err)
+		}
+	}
+	if r.recommendationStore != nil {
+		r.recommendationStore.Replace(statuses)
+	}
+	if r.readOnly {
+		return
+	}
+
+	r.parallelize(len(updates), func(i int) {
+		update := updates[i]
+		if !statusChanged(&update.observedVpa.Status, update.status, r.statusUpdateThreshold) {
+			return
+		}
 		_, err := vpa_utils.UpdateVpaStatusIfNeeded(
-			r.vpaClient.VerticalPodAutoscalers(vpa.ID.Namespace), vpa.ID.VpaName, vpa.AsStatus(), &observedVpa.Status)
+			r.vpaClient.VerticalPodAutoscalers(update.vpa.ID.Namespace), update.vpa.ID.VpaName, update.status, &update.observedVpa.Status)
 		if err != nil {
 			klog.Errorf(
-				"Cannot update VPA %v object. Reason: %+v", vpa.ID.VpaName, err)
+				"Cannot update VPA %v object. Reason: %+v", update.vpa.ID.VpaName, err)
+		}
+	})
+}
+
+// postProcessorNames returns the names of the post processors of the
+// recommender, in the order they are applied.
+func (r *recommender) postProcessorNames() []string {
+	names := make([]string, 0, len(r.recommendationPostProcessor))
+	for _, postProcessor := range r.recommendationPostProcessor {
+		names = append(names, postProcessorName(postProcessor))
+	}
+	return names
+}
+
+func postProcessorName(postProcessor RecommendationPostProcessor) string {
+	switch postProcessor.(type) {
+	case *IntegerCPUPostProcessor:
+		return "integer-cpu"
+	case *CappingPostProcessor:
+		return "capping"
+	case *MemoryRoundingPostProcessor:
+		return "memory-rounding"
+	case *CPUMemoryRatioPostProcessor:
+		return "cpu-memory-ratio"
+	default:
+		return fmt.Sprintf("%T", postProcessor)
+	}
+}
+
+// parallelize runs work for all pieces in up to r.workers goroutines.
+func (r *recommender) parallelize(pieces int, work func(piece int)) {
+	workers := r.workers
+	if workers < 1 {
+		workers = 1
+	}
+	workqueue.ParallelizeUntil(context.Background(), workers, pieces, work)
+}
+
+// statusChanged returns true if the conditions or the recommended containers
+// changed, or any recommended amount changed by more than threshold relative
+// to the old amount. Any change counts if threshold isn't positive.
+func statusChanged(oldStatus, newStatus *vpa_types.VerticalPodAutoscalerStatus, threshold float64) bool {
+	if threshold <= 0 || !apiequality.Semantic.DeepEqual(oldStatus.Conditions, newStatus.Conditions) ||
+		!apiequality.Semantic.DeepEqual(oldStatus.ConditionHistory, newStatus.ConditionHistory) {
+		return true
+	}
+	if oldStatus.Recommendation == nil || newStatus.Recommendation == nil {
+		return oldStatus.Recommendation != newStatus.Recommendation
+	}
+	oldRecommendations := make(map[string]vpa_types.RecommendedContainerResources, len(oldStatus.Recommendation.ContainerRecommendations))
+	for _, recommendation := range oldStatus.Recommendation.ContainerRecommendations {
+		oldRecommendations[recommendation.ContainerName] = recommendation
+	}
+	if len(oldRecommendations) != len(newStatus.Recommendation.ContainerRecommendations) {
+		return true
+	}
+	for _, recommendation := range newStatus.Recommendation.ContainerRecommendations {
+		oldRecommendation, found := oldRecommendations[recommendation.ContainerName]
+		if !found ||
+			resourcesChanged(oldRecommendation.Target, recommendation.Target, threshold) ||
+			resourcesChanged(oldRecommendation.LowerBound, recommendation.LowerBound, threshold) ||
+			resourcesChanged(oldRecommendation.UpperBound, recommendation.UpperBound, threshold) ||
+			resourcesChanged(oldRecommendation.UncappedTarget, recommendation.UncappedTarget, threshold) {
+			return true
+		}
+	}
+	return false
+}
+
+func resourcesChanged(oldResources, newResources apiv1.ResourceList, threshold float64) bool {
+	if len(oldResources) != len(newResources) {
+		return true
+	}
+	for name, quantity := range newResources {
+		oldQuantity, found := oldResources[name]
+		if !found {
+			return true
+		}
+		oldValue, newValue := float64(oldQuantity.MilliValue()), float64(quantity.MilliValue())
+		if oldValue == 0 {
+			if newValue != 0 {
+				return true
+			}
+			continue
 		}
+		if math.Abs(newValue-oldValue)/oldValue > threshold {
+			return true
+		}
+	}
+	return false
+}
+
+// recordRecommendationDrift exports how far the requests of running pods are
+// from the current recommendations, which shows whether they are applied.
+func (r *recommender) recordRecommendationDrift() {
+	cnt := metrics_recommender.NewDriftCounter()
+	defer cnt.Observe()
+
+	for vpaID, drift := range r.clusterState.GetRecommendationDrifts() {
+		cnt.Add(r.clusterState.Vpas[vpaID], drift)
+	}
+}
+
+// recordModelMemoryStats exports the memory held by the model, and logs it
+// every r.memoryReportInterval.
+func (r *recommender) recordModelMemoryStats() {
+	stats := r.clusterState.GetMemoryStats()
+	metrics_recommender.RecordModelMemoryStats(stats)
+	if r.memoryReportInterval > 0 && time.Since(r.lastMemoryReport) >= r.memoryReportInterval {
+		r.lastMemoryReport = time.Now()
+		klog.Infof("Model memory: %d pods, %d containers, %d VPAs, %d aggregate container states, %d histograms holding %d bytes, %d label sets holding %d bytes",
+			stats.Pods, stats.Containers, stats.Vpas, stats.AggregateContainerStates, stats.Histograms, stats.HistogramBytes, stats.LabelSets, stats.LabelSetBytes)
 	}
 }
 
 func (r *recommender) MaintainCheckpoints(ctx context.Context, minCheckpointsPerRun int) {
 	now := time.Now()
-	if r.useCheckpoints {
+	if r.useCheckpoints && !r.readOnly {
+		// StoreCheckpoints fails if no due checkpoint could be stored, so
+		// checkpoint writes are fresh only if they succeed at least partially.
 		if err := r.checkpointWriter.StoreCheckpoints(ctx, now, minCheckpointsPerRun); err != nil {
 			klog.Warningf("Failed to store checkpoints. Reason: %+v", err)
+		} else {
+			metrics_recommender.MarkSubsystemFresh(metrics_recommender.CheckpointWritesSubsystem)
 		}
 		if time.Since(r.lastCheckpointGC) > r.checkpointsGCInterval {
 			r.lastCheckpointGC = now
@@ -180,12 +458,18 @@ func (r *recommender) RunOnce() {
 	r.UpdateVPAs()
 	timer.ObserveStep("UpdateVPAs")
 
+	r.recordRecommendationDrift()
+	timer.ObserveStep("RecordRecommendationDrift")
+
 	r.MaintainCheckpoints(ctx, *minCheckpointsPerRun)
 	timer.ObserveStep("MaintainCheckpoints")
 
 	r.clusterState.RateLimitedGarbageCollectAggregateCollectionStates(time.Now(), r.controllerFetcher)
 	timer.ObserveStep("GarbageCollect")
 	klog.V(3).Infof("ClusterState is tracking %d aggregated container states", r.clusterState.StateMapSize())
+
+	r.recordModelMemoryStats()
+	timer.ObserveStep("RecordModelMemoryStats")
 }
 
 // RecommenderFactory makes instances of Recommender.
@@ -196,12 +480,40 @@ type RecommenderFactory struct {
 	ControllerFetcher      controllerfetcher.ControllerFetcher
 	CheckpointWriter       checkpoint.CheckpointWriter
 	PodResourceRecommender logic.PodResourceRecommender
-	VpaClient              vpa_api.VerticalPodAutoscalersGetter
+	// MarginResolver overrides the safety margin of PodResourceRecommender
+	// per VPA. Optional.
+	MarginResolver input.MarginResolver
+	// ExternalRecommender replaces PodResourceRecommender for the VPAs it
+	// returns recommendations for. Optional.
+	ExternalRecommender external.Recommender
+	// RecommendationStore receives the status computed for every VPA in
+	// each run. Optional.
+	RecommendationStore *apiserver.RecommendationStore
+	VpaClient           vpa_api.VerticalPodAutoscalersGetter
+	// EvaluationRecorder periodically persists recommendations and usage for
+	// offline evaluation. Optional.
+	EvaluationRecorder *evaluation.Recorder
+	// AuditLogger logs every change of a target recommendation. Optional.
+	AuditLogger *audit.Logger
 
 	RecommendationPostProcessors []RecommendationPostProcessor
 
 	CheckpointsGCInterval time.Duration
 	UseCheckpoints        bool
+	// ReadOnly disables writing VPA statuses and checkpoints.
+	ReadOnly bool
+	// Workers is the number of goroutines computing recommendations and
+	// updating VPA statuses. Less than 2 does it sequentially.
+	Workers int
+	// StatusUpdateThreshold is the relative change of a recommended resource
+	// above which VPA statuses are updated. 0 updates them on any change.
+	StatusUpdateThreshold float64
+	// RecordContainerMetrics exports the recommendation and usage of every
+	// container as metrics.
+	RecordContainerMetrics bool
+	// MemoryReportInterval is how often the memory held by the model is
+	// logged. 0 disables the report.
+	MemoryReportInterval time.Duration
 }
 
 // Make creates a new recommender instance,
@@ -216,6 +528,16 @@ func (c RecommenderFactory) Make() Recommender {
 		useCheckpoints:                c.UseCheckpoints,
 		vpaClient:                     c.VpaClient,
 		podResourceRecommender:        c.PodResourceRecommender,
+		marginResolver:                c.MarginResolver,
+		externalRecommender:           c.ExternalRecommender,
+		recommendationStore:           c.RecommendationStore,
+		evaluationRecorder:            c.EvaluationRecorder,
+		auditLogger:                   c.AuditLogger,
+		readOnly:                      c.ReadOnly,
+		workers:                       c.Workers,
+		statusUpdateThreshold:         c.StatusUpdateThreshold,
+		recordContainerMetrics:        c.RecordContainerMetrics,
+		memoryReportInterval:          c.MemoryReportInterval,
 		recommendationPostProcessor:   c.RecommendationPostProcessors,
 		lastAggregateContainerStateGC: time.Now(),
 		lastCheckpointGC:              time.Now(),
@@ -224,24 +546,141 @@ func (c RecommenderFactory) Make() Recommender {
 	return recommender
 }
 
+func checkpointFrequency() checkpoint.FrequencyConfig {
+	if *checkpointsQPS > 0 && *checkpointsBurst < 1 {
+		klog.Fatalf("--checkpoints-burst must be at least 1 with --checkpoints-qps set")
+	}
+	return checkpoint.FrequencyConfig{
+		MinInterval:         *checkpointsMinInterval,
+		MaxInterval:         *checkpointsMaxInterval,
+		VolatilityThreshold: *checkpointsVolatility,
+		QPS:                 *checkpointsQPS,
+		Burst:               *checkpointsBurst,
+	}
+}
+
+func newEvaluationRecorder() *evaluation.Recorder {
+	var sink evaluation.Sink
+	switch *evaluationSink {
+	case "":
+		return nil
+	case "csv":
+		sink = evaluation.NewCSVFileSink(*evaluationCSVPath)
+	case "object-store":
+		sink = evaluation.NewObjectStoreSink(newObjectStore(), *evaluationPrefix)
+	default:
+		klog.Fatalf("Unknown --evaluation-sink %q, supported values are csv and object-store", *evaluationSink)
+	}
+	return evaluation.NewRecorder(sink, *evaluationInterval, *evaluationFraction)
+}
+
+func newAuditLogger() *audit.Logger {
+	switch *auditLogPath {
+	case "":
+		return nil
+	case "-":
+		return audit.NewJSONLogger(os.Stdout)
+	}
+	file, err := os.OpenFile(*auditLogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		klog.Fatalf("Cannot open --recommendation-audit-log: %v", err)
+	}
+	return audit.NewJSONLogger(file)
+}
+
+func newObjectStore() objectstore.ObjectStore {
+	store, err := objectstore.NewS3ObjectStore(objectstore.S3Config{
+		Endpoint:        *objectStoreEndpoint,
+		Bucket:          *objectStoreBucket,
+		Region:          *objectStoreRegion,
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+	}, &http.Client{})
+	if err != nil {
+		klog.Fatalf("Cannot create object store: %v", err)
+	}
+	return store
+}
+
+func newExternalClient() external.Client {
+	if *externalCAFile == "" {
+		return external.NewGRPCClient(*externalAddress, nil)
+	}
+	caBundle, err := os.ReadFile(*externalCAFile)
+	if err != nil {
+		klog.Fatalf("Cannot read --external-recommender-ca-file: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caBundle) {
+		klog.Fatalf("No certificates in --external-recommender-ca-file %s", *externalCAFile)
+	}
+	return external.NewGRPCClient(*externalAddress, &tls.Config{RootCAs: pool})
+}
+
+func newCheckpointStorage(kubeClient kube_client.Interface, vpaCheckpointClient vpa_api.VerticalPodAutoscalerCheckpointsGetter) checkpoint.CheckpointStorage {
+	switch *checkpointStorage {
+	case "crd":
+		return checkpoint.NewCRDStorage(kubeClient.CoreV1(), vpaCheckpointClient)
+	case "object-store":
+		return checkpoint.NewObjectStoreStorage(newObjectStore(), *objectStorePrefix)
+	default:
+		klog.Fatalf("Unknown --checkpoint-storage %q, supported values are crd and object-store", *checkpointStorage)
+		return nil
+	}
+}
+
+func shortLivedPodConfig() input.ShortLivedPodConfig {
+	policy := input.ShortLivedPodPolicy(*shortLivedPodPolicy)
+	if policy != input.ExcludeShortLivedPods && policy != input.SeparateShortLivedPods {
+		klog.Fatalf("Unknown --short-lived-pod-policy %q, supported values are exclude and separate", *shortLivedPodPolicy)
+	}
+	return input.ShortLivedPodConfig{Threshold: *shortLivedPodThreshold, Policy: policy}
+}
+
 // NewRecommender creates a new recommender instance.
 // Dependencies are created automatically.
 // Deprecated; use RecommenderFactory instead.
-func NewRecommender(config *rest.Config, checkpointsGCInterval time.Duration, useCheckpoints bool, namespace string, recommenderName string, recommendationPostProcessors []RecommendationPostProcessor) Recommender {
+func NewRecommender(config *rest.Config, checkpointsGCInterval time.Duration, useCheckpoints bool, vpaObjectFilter *vpa_utils.VpaObjectFilter, recommenderName string, recommendationPostProcessors []RecommendationPostProcessor, oomConfig oom.ObserverConfig, recommendationStore *apiserver.RecommendationStore, readOnly bool) Recommender {
 	clusterState := model.NewClusterState(AggregateContainerStateGCInterval)
+	if *aggregationLabel != "" {
+		clusterState.AggregationContainerName = model.NewAggregateByLabelPrefix(*aggregationLabel)
+	}
+	namespace := vpaObjectFilter.Namespace()
 	kubeClient := kube_client.NewForConfigOrDie(config)
 	factory := informers.NewSharedInformerFactoryWithOptions(kubeClient, defaultResyncPeriod, informers.WithNamespace(namespace))
 	controllerFetcher := controllerfetcher.NewControllerFetcher(config, kubeClient, factory, scaleCacheEntryFreshnessTime, scaleCacheEntryLifetime, scaleCacheEntryJitterFactor)
 
+	vpaClient := vpa_clientset.NewForConfigOrDie(config).AutoscalingV1()
+	checkpointStorage := newCheckpointStorage(kubeClient, vpaClient)
+
+	if *containerMetrics {
+		metrics_recommender.RegisterContainerRecommendations()
+	}
+
+	var externalRecommender external.Recommender
+	if *externalAddress != "" {
+		externalRecommender = external.NewRecommender(newExternalClient())
+	}
+
 	return RecommenderFactory{
 		ClusterState:                 clusterState,
-		ClusterStateFeeder:           input.NewClusterStateFeeder(config, clusterState, *memorySaver, namespace, "default-metrics-client", recommenderName),
+		ClusterStateFeeder:           input.NewClusterStateFeeder(config, clusterState, *memorySaver, vpaObjectFilter, "default-metrics-client", recommenderName, oomConfig, *cpuPerformanceLabel, *recommendationWorkers, checkpointStorage, shortLivedPodConfig(), *fullPodSyncInterval, *podLevelUsageFallback),
 		ControllerFetcher:            controllerFetcher,
-		CheckpointWriter:             checkpoint.NewCheckpointWriter(clusterState, vpa_clientset.NewForConfigOrDie(config).AutoscalingV1()),
-		VpaClient:                    vpa_clientset.NewForConfigOrDie(config).AutoscalingV1(),
+		CheckpointWriter:             checkpoint.NewStorageCheckpointWriter(clusterState, checkpointStorage, checkpointFrequency()),
+		VpaClient:                    vpaClient,
 		PodResourceRecommender:       logic.CreatePodResourceRecommender(),
+		MarginResolver:               input.NewConfigMapMarginResolver(kubeClient, namespace, *marginConfigMap),
+		ExternalRecommender:          externalRecommender,
+		RecommendationStore:          recommendationStore,
+		EvaluationRecorder:           newEvaluationRecorder(),
+		AuditLogger:                  newAuditLogger(),
 		RecommendationPostProcessors: recommendationPostProcessors,
 		CheckpointsGCInterval:        checkpointsGCInterval,
 		UseCheckpoints:               useCheckpoints,
+		ReadOnly:                     readOnly,
+		Workers:                      *recommendationWorkers,
+		StatusUpdateThreshold:        *statusUpdateThreshold,
+		RecordContainerMetrics:       *containerMetrics,
+		MemoryReportInterval:         *memoryReportInterval,
 	}.Make()
 }
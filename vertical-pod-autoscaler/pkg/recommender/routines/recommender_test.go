@@ -0,0 +1,88 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routines
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/test"
+)
+
+func TestStatusChanged(t *testing.T) {
+	recommendation := func(cpu, memory string) *vpa_types.RecommendedPodResources {
+		return test.Recommendation().WithContainer("container-1").WithTarget(cpu, memory).WithLowerBound("100m", "100Mi").WithUpperBound("2", "2Gi").Get()
+	}
+	provided := []vpa_types.VerticalPodAutoscalerCondition{{Type: vpa_types.RecommendationProvided, Status: "True"}}
+	oldStatus := &vpa_types.VerticalPodAutoscalerStatus{Recommendation: recommendation("1", "1Gi"), Conditions: provided}
+
+	cases := []struct {
+		name      string
+		newStatus *vpa_types.VerticalPodAutoscalerStatus
+		threshold float64
+		expected  bool
+	}{
+		{
+			name:      "small change without threshold",
+			newStatus: &vpa_types.VerticalPodAutoscalerStatus{Recommendation: recommendation("1010m", "1Gi"), Conditions: provided},
+			expected:  true,
+		}, {
+			name:      "small change below threshold",
+			newStatus: &vpa_types.VerticalPodAutoscalerStatus{Recommendation: recommendation("1010m", "1Gi"), Conditions: provided},
+			threshold: 0.05,
+			expected:  false,
+		}, {
+			name:      "change above threshold",
+			newStatus: &vpa_types.VerticalPodAutoscalerStatus{Recommendation: recommendation("1", "1200Mi"), Conditions: provided},
+			threshold: 0.05,
+			expected:  true,
+		}, {
+			name:      "conditions changed",
+			newStatus: &vpa_types.VerticalPodAutoscalerStatus{Recommendation: recommendation("1", "1Gi")},
+			threshold: 0.05,
+			expected:  true,
+		}, {
+			name:      "recommendation removed",
+			newStatus: &vpa_types.VerticalPodAutoscalerStatus{Conditions: provided},
+			threshold: 0.05,
+			expected:  true,
+		}, {
+			name: "container added",
+			newStatus: &vpa_types.VerticalPodAutoscalerStatus{Recommendation: &vpa_types.RecommendedPodResources{
+				ContainerRecommendations: append(recommendation("1", "1Gi").ContainerRecommendations,
+					test.Recommendation().WithContainer("container-2").WithTarget("1", "1Gi").GetContainerResources()),
+			}, Conditions: provided},
+			threshold: 0.05,
+			expected:  true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, statusChanged(oldStatus, tc.newStatus, tc.threshold))
+		})
+	}
+}
+
+func TestPostProcessorNames(t *testing.T) {
+	r := &recommender{recommendationPostProcessor: []RecommendationPostProcessor{
+		&IntegerCPUPostProcessor{},
+		&CappingPostProcessor{},
+		&MemoryRoundingPostProcessor{},
+	}}
+	assert.Equal(t, []string{"integer-cpu", "capping", "memory-rounding"}, r.postProcessorNames())
+}
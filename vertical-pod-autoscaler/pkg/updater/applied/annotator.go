@@ -0,0 +1,101 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package applied records the recommendations applied by the updater on the
+// workloads they are applied to.
+package applied
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	kube_client "k8s.io/client-go/kubernetes"
+)
+
+const (
+	// RecommendationAnnotation holds the target recommendation, by container,
+	// last applied to the pods of the workload.
+	RecommendationAnnotation = "vpa-updater.k8s.io/applied-recommendation"
+	// TimeAnnotation holds the time the recommendation was last applied.
+	TimeAnnotation = "vpa-updater.k8s.io/last-applied-time"
+)
+
+// TargetAnnotator records the recommendation applied to the pods of a VPA on
+// its target workload, so that its owners see it without access to VPAs.
+type TargetAnnotator interface {
+	// Annotate sets the annotations of the target of the VPA to the
+	// recommendation applied to its pods at the given time, i.e. the
+	// recommendation of the VPA as processed for the pods, capped to the
+	// resource policy and limit ranges.
+	Annotate(vpa *vpa_types.VerticalPodAutoscaler, recommendation *vpa_types.RecommendedPodResources, now time.Time) error
+}
+
+type targetAnnotator struct {
+	client kube_client.Interface
+}
+
+// NewTargetAnnotator returns a TargetAnnotator supporting Deployments,
+// StatefulSets, DaemonSets and ReplicaSets.
+func NewTargetAnnotator(client kube_client.Interface) TargetAnnotator {
+	return &targetAnnotator{client: client}
+}
+
+func (a *targetAnnotator) Annotate(vpa *vpa_types.VerticalPodAutoscaler, recommendation *vpa_types.RecommendedPodResources, now time.Time) error {
+	if vpa.Spec.TargetRef == nil || recommendation == nil {
+		return nil
+	}
+	targets := make(map[string]apiv1.ResourceList, len(recommendation.ContainerRecommendations))
+	for _, containerRecommendation := range recommendation.ContainerRecommendations {
+		targets[containerRecommendation.ContainerName] = containerRecommendation.Target
+	}
+	value, err := json.Marshal(targets)
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				RecommendationAnnotation: string(value),
+				TimeAnnotation:           now.UTC().Format(time.RFC3339),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	apps := a.client.AppsV1()
+	namespace, name := vpa.Namespace, vpa.Spec.TargetRef.Name
+	switch vpa.Spec.TargetRef.Kind {
+	case "Deployment":
+		_, err = apps.Deployments(namespace).Patch(context.TODO(), name, types.MergePatchType, patch, metav1.PatchOptions{})
+	case "StatefulSet":
+		_, err = apps.StatefulSets(namespace).Patch(context.TODO(), name, types.MergePatchType, patch, metav1.PatchOptions{})
+	case "DaemonSet":
+		_, err = apps.DaemonSets(namespace).Patch(context.TODO(), name, types.MergePatchType, patch, metav1.PatchOptions{})
+	case "ReplicaSet":
+		_, err = apps.ReplicaSets(namespace).Patch(context.TODO(), name, types.MergePatchType, patch, metav1.PatchOptions{})
+	default:
+		return fmt.Errorf("unsupported target kind %s", vpa.Spec.TargetRef.Kind)
+	}
+	return err
+}
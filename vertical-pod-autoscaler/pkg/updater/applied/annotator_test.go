@@ -0,0 +1,72 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package applied
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscaling "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/test"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAnnotate(t *testing.T) {
+	deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+		Namespace:   "default",
+		Name:        "deployment",
+		Annotations: map[string]string{"owner": "team"},
+	}}
+	client := fake.NewSimpleClientset(deployment)
+	vpa := test.VerticalPodAutoscaler().
+		WithName("vpa").
+		WithNamespace("default").
+		WithContainer("container1").
+		WithTarget("250m", "200Mi").
+		WithTargetRef(&autoscaling.CrossVersionObjectReference{Kind: "Deployment", Name: "deployment", APIVersion: "apps/v1"}).
+		Get()
+	now := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// The applied recommendation is capped, unlike the one in the status.
+	applied := test.Recommendation().WithContainer("container1").WithTarget("200m", "200Mi").Get()
+
+	err := NewTargetAnnotator(client).Annotate(vpa, applied, now)
+	assert.NoError(t, err)
+	annotated, err := client.AppsV1().Deployments("default").Get(context.TODO(), deployment.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "team", annotated.Annotations["owner"])
+	assert.JSONEq(t, `{"container1":{"cpu":"200m","memory":"200Mi"}}`, annotated.Annotations[RecommendationAnnotation])
+	assert.Equal(t, "2022-05-01T12:00:00Z", annotated.Annotations[TimeAnnotation])
+}
+
+func TestAnnotateUnsupportedKind(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	vpa := test.VerticalPodAutoscaler().
+		WithName("vpa").
+		WithNamespace("default").
+		WithContainer("container1").
+		WithTarget("250m", "200Mi").
+		WithTargetRef(&autoscaling.CrossVersionObjectReference{Kind: "CronJob", Name: "job", APIVersion: "batch/v1"}).
+		Get()
+
+	assert.Error(t, NewTargetAnnotator(client).Annotate(vpa, vpa.Status.Recommendation, time.Now()))
+	assert.Empty(t, client.Actions())
+}
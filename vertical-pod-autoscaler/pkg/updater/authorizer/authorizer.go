@@ -0,0 +1,228 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package authorizer asks an external approval system, e.g. change
+// management, whether the updater may apply a recommendation to a workload.
+package authorizer
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	autoscaling "k8s.io/api/autoscaling/v1"
+	apiv1 "k8s.io/api/core/v1"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+)
+
+// Action is the way a recommendation is applied to a pod.
+type Action string
+
+const (
+	// ActionEvict evicts the pod, to be recreated with the recommendation.
+	ActionEvict Action = "Evict"
+	// ActionResizeInPlace resizes the running pod to the recommendation.
+	ActionResizeInPlace Action = "ResizeInPlace"
+)
+
+// Request is sent to the webhook to authorize applying a recommendation to
+// the pods of a workload.
+type Request struct {
+	Namespace string                                   `json:"namespace"`
+	Vpa       string                                   `json:"vpa"`
+	TargetRef *autoscaling.CrossVersionObjectReference `json:"targetRef,omitempty"`
+	Action    Action                                   `json:"action"`
+	// Containers are the resource changes, from the requests of the pod to
+	// be evicted to the recommendation.
+	Containers []ContainerChange `json:"containers"`
+}
+
+// ContainerChange holds the current and recommended requests of a container.
+type ContainerChange struct {
+	Name        string             `json:"name"`
+	OldRequests apiv1.ResourceList `json:"oldRequests,omitempty"`
+	NewRequests apiv1.ResourceList `json:"newRequests,omitempty"`
+}
+
+// Response is returned by the webhook.
+type Response struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+	// RetryAfterSeconds delays asking again for a denied change, instead of
+	// the cache TTL, e.g. until the next change window.
+	RetryAfterSeconds int `json:"retryAfterSeconds,omitempty"`
+}
+
+// Decision is the response of the webhook to a request.
+type Decision struct {
+	Response
+	// Cached is true if the response to an earlier request for the same
+	// changes was reused.
+	Cached bool
+}
+
+// Authorizer decides whether the updater may apply a recommendation to a pod.
+type Authorizer interface {
+	// Authorize returns the decision for applying the recommendation to the
+	// pod of the VPA with the action, at the given time.
+	Authorize(ctx context.Context, vpa *vpa_types.VerticalPodAutoscaler, pod *apiv1.Pod, recommendation *vpa_types.RecommendedPodResources, action Action, now time.Time) (Decision, error)
+}
+
+// WebhookConfig configures the webhook authorizer.
+type WebhookConfig struct {
+	// URL the requests are POSTed to.
+	URL string
+	// CAFile verifies the certificate of URL, if set. The system roots are
+	// used otherwise.
+	CAFile  string
+	Timeout time.Duration
+	// CacheTTL is how long decisions are reused for the same changes of a
+	// VPA without asking the webhook again.
+	CacheTTL time.Duration
+}
+
+type cachedDecision struct {
+	response Response
+	expiry   time.Time
+}
+
+type webhookAuthorizer struct {
+	url      string
+	client   *http.Client
+	cacheTTL time.Duration
+
+	mutex     sync.Mutex
+	decisions map[string]cachedDecision
+}
+
+// NewWebhookAuthorizer returns an Authorizer asking the webhook and caching
+// its decisions.
+func NewWebhookAuthorizer(config WebhookConfig) (Authorizer, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config.CAFile != "" {
+		caCert, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CA file %s: %v", config.CAFile, err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", config.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+	}
+	return &webhookAuthorizer{
+		url:       config.URL,
+		client:    &http.Client{Transport: transport, Timeout: config.Timeout},
+		cacheTTL:  config.CacheTTL,
+		decisions: make(map[string]cachedDecision),
+	}, nil
+}
+
+func (a *webhookAuthorizer) Authorize(ctx context.Context, vpa *vpa_types.VerticalPodAutoscaler, pod *apiv1.Pod, recommendation *vpa_types.RecommendedPodResources, action Action, now time.Time) (Decision, error) {
+	request := newRequest(vpa, pod, recommendation, action)
+	body, err := json.Marshal(request)
+	if err != nil {
+		return Decision{}, err
+	}
+	// Pods of a workload usually have the same requests, so the decision
+	// for one of them is reused for the others.
+	key := string(body)
+	if response, found := a.cached(key, now); found {
+		return Decision{Response: response, Cached: true}, nil
+	}
+	response, err := a.post(ctx, body)
+	if err != nil {
+		return Decision{}, err
+	}
+	expiry := now.Add(a.cacheTTL)
+	if !response.Allowed && response.RetryAfterSeconds > 0 {
+		expiry = now.Add(time.Duration(response.RetryAfterSeconds) * time.Second)
+	}
+	a.cache(key, cachedDecision{response: response, expiry: expiry}, now)
+	return Decision{Response: response}, nil
+}
+
+func (a *webhookAuthorizer) post(ctx context.Context, body []byte) (Response, error) {
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return Response{}, err
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	httpResponse, err := a.client.Do(httpRequest)
+	if err != nil {
+		return Response{}, err
+	}
+	defer httpResponse.Body.Close()
+	if httpResponse.StatusCode != http.StatusOK {
+		return Response{}, fmt.Errorf("authorizer webhook returned %s", httpResponse.Status)
+	}
+	var response Response
+	if err := json.NewDecoder(httpResponse.Body).Decode(&response); err != nil {
+		return Response{}, fmt.Errorf("cannot decode authorizer webhook response: %v", err)
+	}
+	return response, nil
+}
+
+func (a *webhookAuthorizer) cached(key string, now time.Time) (Response, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	decision, found := a.decisions[key]
+	if !found || !now.Before(decision.expiry) {
+		return Response{}, false
+	}
+	return decision.response, true
+}
+
+func (a *webhookAuthorizer) cache(key string, decision cachedDecision, now time.Time) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	// Drop expired decisions so changes applied long ago don't pile up.
+	for cachedKey, cached := range a.decisions {
+		if !now.Before(cached.expiry) {
+			delete(a.decisions, cachedKey)
+		}
+	}
+	a.decisions[key] = decision
+}
+
+func newRequest(vpa *vpa_types.VerticalPodAutoscaler, pod *apiv1.Pod, recommendation *vpa_types.RecommendedPodResources, action Action) Request {
+	request := Request{
+		Namespace:  vpa.Namespace,
+		Vpa:        vpa.Name,
+		TargetRef:  vpa.Spec.TargetRef,
+		Action:     action,
+		Containers: make([]ContainerChange, 0, len(pod.Spec.Containers)),
+	}
+	for _, container := range pod.Spec.Containers {
+		change := ContainerChange{Name: container.Name, OldRequests: container.Resources.Requests}
+		if recommendation != nil {
+			for _, containerRecommendation := range recommendation.ContainerRecommendations {
+				if containerRecommendation.ContainerName == container.Name {
+					change.NewRequests = containerRecommendation.Target
+				}
+			}
+		}
+		request.Containers = append(request.Containers, change)
+	}
+	return request
+}
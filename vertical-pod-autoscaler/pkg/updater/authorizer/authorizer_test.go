@@ -0,0 +1,125 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authorizer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/test"
+)
+
+func newTestAuthorizer(t *testing.T, handler http.HandlerFunc) Authorizer {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	authorizer, err := NewWebhookAuthorizer(WebhookConfig{URL: server.URL, Timeout: time.Second, CacheTTL: time.Minute})
+	assert.NoError(t, err)
+	return authorizer
+}
+
+func testVpaAndPod() (*vpa_types.VerticalPodAutoscaler, *apiv1.Pod) {
+	vpa := test.VerticalPodAutoscaler().WithName("vpa").WithNamespace("default").WithContainer("app").WithTarget("2", "200M").Get()
+	pod := test.Pod().WithName("pod").AddContainer(test.Container().WithName("app").WithCPURequest(resource.MustParse("1")).Get()).Get()
+	return vpa, pod
+}
+
+func TestAuthorizeCachesDecisions(t *testing.T) {
+	requests := 0
+	var received Request
+	authorizer := newTestAuthorizer(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		assert.NoError(t, json.NewEncoder(w).Encode(Response{Allowed: true}))
+	})
+	vpa, pod := testVpaAndPod()
+	now := time.Now()
+
+	decision, err := authorizer.Authorize(context.Background(), vpa, pod, vpa.Status.Recommendation, ActionEvict, now)
+	assert.NoError(t, err)
+	assert.True(t, decision.Allowed)
+	assert.False(t, decision.Cached)
+	assert.Equal(t, "default", received.Namespace)
+	assert.Equal(t, "vpa", received.Vpa)
+	assert.Equal(t, ActionEvict, received.Action)
+	if assert.Len(t, received.Containers, 1) {
+		assert.Equal(t, "app", received.Containers[0].Name)
+		assert.Equal(t, "1", received.Containers[0].OldRequests.Cpu().String())
+		assert.Equal(t, "2", received.Containers[0].NewRequests.Cpu().String())
+	}
+
+	// The decision is reused until it expires.
+	decision, err = authorizer.Authorize(context.Background(), vpa, pod, vpa.Status.Recommendation, ActionEvict, now.Add(30*time.Second))
+	assert.NoError(t, err)
+	assert.True(t, decision.Cached)
+	assert.Equal(t, 1, requests)
+	decision, err = authorizer.Authorize(context.Background(), vpa, pod, vpa.Status.Recommendation, ActionEvict, now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.False(t, decision.Cached)
+	assert.Equal(t, 2, requests)
+
+	// Resizes are authorized separately from evictions.
+	decision, err = authorizer.Authorize(context.Background(), vpa, pod, vpa.Status.Recommendation, ActionResizeInPlace, now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.False(t, decision.Cached)
+	assert.Equal(t, ActionResizeInPlace, received.Action)
+	assert.Equal(t, 3, requests)
+}
+
+func TestAuthorizeDeniedWithRetryAfter(t *testing.T) {
+	requests := 0
+	authorizer := newTestAuthorizer(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.NoError(t, json.NewEncoder(w).Encode(Response{Allowed: false, Reason: "change freeze", RetryAfterSeconds: 3600}))
+	})
+	vpa, pod := testVpaAndPod()
+	now := time.Now()
+
+	decision, err := authorizer.Authorize(context.Background(), vpa, pod, vpa.Status.Recommendation, ActionEvict, now)
+	assert.NoError(t, err)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, "change freeze", decision.Reason)
+
+	// The denial is kept for RetryAfterSeconds rather than the cache TTL.
+	_, err = authorizer.Authorize(context.Background(), vpa, pod, vpa.Status.Recommendation, ActionEvict, now.Add(30*time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, requests)
+}
+
+func TestAuthorizeWebhookError(t *testing.T) {
+	requests := 0
+	authorizer := newTestAuthorizer(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+	vpa, pod := testVpaAndPod()
+	now := time.Now()
+
+	_, err := authorizer.Authorize(context.Background(), vpa, pod, vpa.Status.Recommendation, ActionEvict, now)
+	assert.Error(t, err)
+	// Failures are not cached.
+	_, err = authorizer.Authorize(context.Background(), vpa, pod, vpa.Status.Recommendation, ActionEvict, now)
+	assert.Error(t, err)
+	assert.Equal(t, 2, requests)
+}
@@ -25,6 +25,7 @@ import (
 	apiv1 "k8s.io/api/core/v1"
 	policyv1 "k8s.io/api/policy/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
 	appsinformer "k8s.io/client-go/informers/apps/v1"
 	coreinformer "k8s.io/client-go/informers/core/v1"
@@ -61,6 +62,11 @@ type singleGroupStats struct {
 	running           int
 	evictionTolerance int
 	evicted           int
+	// useMaxUnavailable replaces evictionTolerance with a budget of
+	// unavailable replicas, which includes replicas disrupted before.
+	useMaxUnavailable bool
+	maxUnavailable    int
+	unavailable       int
 }
 
 // PodsEvictionRestrictionFactory creates PodsEvictionRestriction
@@ -78,6 +84,7 @@ type podsEvictionRestrictionFactoryImpl struct {
 	dsInformer                cache.SharedIndexInformer // informer for Daemon Sets
 	minReplicas               int
 	evictionToleranceFraction float64
+	maxUnavailable            *intstr.IntOrString
 }
 
 type controllerKind string
@@ -104,6 +111,10 @@ func (e *podsEvictionRestrictionImpl) CanEvict(pod *apiv1.Pod) bool {
 		if pod.Status.Phase == apiv1.PodPending {
 			return true
 		}
+		if present && singleGroupStats.useMaxUnavailable {
+			// Unavailable pods are already counted in unavailable.
+			return !isAvailable(pod) || singleGroupStats.unavailable+singleGroupStats.evicted < singleGroupStats.maxUnavailable
+		}
 		if present {
 			shouldBeAlive := singleGroupStats.configured - singleGroupStats.evictionTolerance
 			if singleGroupStats.running-singleGroupStats.evicted > shouldBeAlive {
@@ -151,16 +162,20 @@ func (e *podsEvictionRestrictionImpl) Evict(podToEvict *apiv1.Pod, eventRecorder
 		if !present {
 			return fmt.Errorf("Internal error - cannot find stats for replication group %v", cr)
 		}
-		singleGroupStats.evicted = singleGroupStats.evicted + 1
-		e.creatorToSingleGroupStatsMap[cr] = singleGroupStats
+		if !singleGroupStats.useMaxUnavailable || isAvailable(podToEvict) {
+			singleGroupStats.evicted = singleGroupStats.evicted + 1
+			e.creatorToSingleGroupStatsMap[cr] = singleGroupStats
+		}
 	}
 
 	return nil
 }
 
-// NewPodsEvictionRestrictionFactory creates PodsEvictionRestrictionFactory
+// NewPodsEvictionRestrictionFactory creates PodsEvictionRestrictionFactory.
+// If maxUnavailable is not nil, it limits the number of unavailable replicas
+// of every workload instead of minReplicas and evictionToleranceFraction.
 func NewPodsEvictionRestrictionFactory(client kube_client.Interface, minReplicas int,
-	evictionToleranceFraction float64) (PodsEvictionRestrictionFactory, error) {
+	evictionToleranceFraction float64, maxUnavailable *intstr.IntOrString) (PodsEvictionRestrictionFactory, error) {
 	rcInformer, err := setUpInformer(client, replicationController)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to create rcInformer: %v", err)
@@ -184,7 +199,8 @@ func NewPodsEvictionRestrictionFactory(client kube_client.Interface, minReplicas
 		rsInformer:                rsInformer, // informer for Stateful Sets
 		dsInformer:                dsInformer, // informer for Daemon Sets
 		minReplicas:               minReplicas,
-		evictionToleranceFraction: evictionToleranceFraction}, nil
+		evictionToleranceFraction: evictionToleranceFraction,
+		maxUnavailable:            maxUnavailable}, nil
 }
 
 // NewPodsEvictionRestriction creates PodsEvictionRestriction for a given set of pods,
@@ -220,9 +236,15 @@ func (f *podsEvictionRestrictionFactoryImpl) NewPodsEvictionRestriction(pods []*
 			f.minReplicas, required, vpa.Namespace, vpa.Name)
 	}
 
+	// Use per-VPA maxUnavailable if present, fall back to the global setting.
+	maxUnavailable := f.maxUnavailable
+	if vpa.Spec.UpdatePolicy != nil && vpa.Spec.UpdatePolicy.MaxUnavailable != nil {
+		maxUnavailable = vpa.Spec.UpdatePolicy.MaxUnavailable
+	}
+
 	for creator, replicas := range livePods {
 		actual := len(replicas)
-		if actual < required {
+		if maxUnavailable == nil && actual < required {
 			klog.V(2).Infof("too few replicas for %v %v/%v. Found %v live pods, needs %v (global %v)",
 				creator.Kind, creator.Namespace, creator.Name, actual, required, f.minReplicas)
 			continue
@@ -245,13 +267,29 @@ func (f *podsEvictionRestrictionFactoryImpl) NewPodsEvictionRestriction(pods []*
 		singleGroup := singleGroupStats{}
 		singleGroup.configured = configured
 		singleGroup.evictionTolerance = int(float64(configured) * f.evictionToleranceFraction)
+		available := 0
 		for _, pod := range replicas {
 			podToReplicaCreatorMap[getPodID(pod)] = creator
 			if pod.Status.Phase == apiv1.PodPending {
 				singleGroup.pending = singleGroup.pending + 1
 			}
+			if isAvailable(pod) {
+				available++
+			}
 		}
 		singleGroup.running = len(replicas) - singleGroup.pending
+		if maxUnavailable != nil {
+			allowed, err := getMaxUnavailable(maxUnavailable, configured)
+			if err != nil {
+				klog.Errorf("invalid maxUnavailable for VPA %v/%v: %v", vpa.Namespace, vpa.Name, err)
+				continue
+			}
+			singleGroup.useMaxUnavailable = true
+			singleGroup.maxUnavailable = allowed
+			if available < configured {
+				singleGroup.unavailable = configured - available
+			}
+		}
 		creatorToSingleGroupStatsMap[creator] = singleGroup
 	}
 	return &podsEvictionRestrictionImpl{
@@ -260,6 +298,33 @@ func (f *podsEvictionRestrictionFactoryImpl) NewPodsEvictionRestriction(pods []*
 		creatorToSingleGroupStatsMap: creatorToSingleGroupStatsMap}
 }
 
+// getMaxUnavailable returns the number of replicas which can be unavailable at
+// the same time. Percentages are rounded down, but at least one replica can
+// always be unavailable.
+func getMaxUnavailable(maxUnavailable *intstr.IntOrString, replicas int) (int, error) {
+	allowed, err := intstr.GetScaledValueFromIntOrPercent(maxUnavailable, replicas, false)
+	if err != nil {
+		return 0, err
+	}
+	if allowed < 1 {
+		allowed = 1
+	}
+	return allowed, nil
+}
+
+// isAvailable returns true if the pod is running, ready and not terminating.
+func isAvailable(pod *apiv1.Pod) bool {
+	if pod.Status.Phase != apiv1.PodRunning || pod.DeletionTimestamp != nil {
+		return false
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == apiv1.PodReady {
+			return condition.Status == apiv1.ConditionTrue
+		}
+	}
+	return false
+}
+
 func getPodReplicaCreator(pod *apiv1.Pod) (*podReplicaCreator, error) {
 	creator := managingControllerRef(pod)
 	if creator == nil {
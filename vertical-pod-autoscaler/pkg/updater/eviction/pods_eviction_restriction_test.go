@@ -26,6 +26,7 @@ import (
 	batchv1 "k8s.io/api/batch/v1"
 	apiv1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/test"
 	appsinformer "k8s.io/client-go/informers/apps/v1"
@@ -558,6 +559,132 @@ func TestEvictAtLeastOne(t *testing.T) {
 	}
 }
 
+func TestEvictMaxUnavailable(t *testing.T) {
+	replicas := int32(10)
+
+	rs := appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "rs",
+			Namespace: "default",
+		},
+		TypeMeta: metav1.TypeMeta{
+			Kind: "ReplicaSet",
+		},
+		Spec: appsv1.ReplicaSetSpec{
+			Replicas: &replicas,
+		},
+	}
+
+	testCases := []struct {
+		name              string
+		notReadyPods      int
+		evictNotReadyPods bool
+		maxUnavailable    intstr.IntOrString
+		expectedEvictions int
+	}{
+		{
+			name:              "percentage",
+			maxUnavailable:    intstr.FromString("20%"),
+			expectedEvictions: 2,
+		},
+		{
+			name:              "percentage rounded down",
+			maxUnavailable:    intstr.FromString("25%"),
+			expectedEvictions: 2,
+		},
+		{
+			name:              "at least one",
+			maxUnavailable:    intstr.FromString("5%"),
+			expectedEvictions: 1,
+		},
+		{
+			name:              "absolute",
+			maxUnavailable:    intstr.FromInt(3),
+			expectedEvictions: 3,
+		},
+		{
+			name:              "unavailable pods use the budget",
+			notReadyPods:      1,
+			maxUnavailable:    intstr.FromString("20%"),
+			expectedEvictions: 1,
+		},
+		{
+			name:              "budget exhausted",
+			notReadyPods:      2,
+			maxUnavailable:    intstr.FromString("20%"),
+			expectedEvictions: 0,
+		},
+		{
+			name:              "evicting unavailable pods uses no budget",
+			notReadyPods:      1,
+			evictNotReadyPods: true,
+			maxUnavailable:    intstr.FromString("20%"),
+			expectedEvictions: 2,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pods := make([]*apiv1.Pod, replicas)
+			for i := range pods {
+				pods[i] = test.Pod().WithName(getTestPodName(i)).WithCreator(&rs.ObjectMeta, &rs.TypeMeta).WithPhase(apiv1.PodRunning).Get()
+				ready := apiv1.ConditionTrue
+				if i < tc.notReadyPods {
+					ready = apiv1.ConditionFalse
+				}
+				pods[i].Status.Conditions = []apiv1.PodCondition{{Type: apiv1.PodReady, Status: ready}}
+			}
+
+			factory, _ := getEvictionRestrictionFactory(nil, &rs, nil, nil, 2, 0.5)
+			factory.(*podsEvictionRestrictionFactoryImpl).maxUnavailable = &tc.maxUnavailable
+			eviction := factory.NewPodsEvictionRestriction(pods, getBasicVpa())
+
+			toEvict := pods[tc.notReadyPods:]
+			if tc.evictNotReadyPods {
+				toEvict = pods
+			}
+			evicted := 0
+			for _, pod := range toEvict {
+				if eviction.Evict(pod, test.FakeEventRecorder()) == nil {
+					evicted++
+				}
+			}
+			assert.Equal(t, tc.expectedEvictions, evicted)
+		})
+	}
+}
+
+func TestEvictMaxUnavailablePerVpaIgnoresMinReplicas(t *testing.T) {
+	replicas := int32(1)
+
+	rs := appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "rs",
+			Namespace: "default",
+		},
+		TypeMeta: metav1.TypeMeta{
+			Kind: "ReplicaSet",
+		},
+		Spec: appsv1.ReplicaSetSpec{
+			Replicas: &replicas,
+		},
+	}
+	pod := test.Pod().WithName(getTestPodName(0)).WithCreator(&rs.ObjectMeta, &rs.TypeMeta).WithPhase(apiv1.PodRunning).Get()
+	pod.Status.Conditions = []apiv1.PodCondition{{Type: apiv1.PodReady, Status: apiv1.ConditionTrue}}
+
+	factory, _ := getEvictionRestrictionFactory(nil, &rs, nil, nil, 2, 0.5)
+
+	eviction := factory.NewPodsEvictionRestriction([]*apiv1.Pod{pod}, getBasicVpa())
+	assert.False(t, eviction.CanEvict(pod))
+
+	vpa := getBasicVpa()
+	maxUnavailable := intstr.FromString("10%")
+	vpa.Spec.UpdatePolicy = &vpa_types.PodUpdatePolicy{MaxUnavailable: &maxUnavailable}
+	eviction = factory.NewPodsEvictionRestriction([]*apiv1.Pod{pod}, vpa)
+	assert.True(t, eviction.CanEvict(pod))
+	assert.NoError(t, eviction.Evict(pod, test.FakeEventRecorder()))
+	assert.False(t, eviction.CanEvict(pod))
+}
+
 func getEvictionRestrictionFactory(rc *apiv1.ReplicationController, rs *appsv1.ReplicaSet,
 	ss *appsv1.StatefulSet, ds *appsv1.DaemonSet, minReplicas int,
 	evictionToleranceFraction float64) (PodsEvictionRestrictionFactory, error) {
@@ -0,0 +1,135 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inplace
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/admission-controller/resource/pod/recommendation"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	kube_client "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	// resizeSubresource is the pod subresource updating container resources
+	// of a running pod.
+	resizeSubresource = "resize"
+	// Pod conditions set by the kubelet while a resize is not yet actuated.
+	podResizePending    apiv1.PodConditionType = "PodResizePending"
+	podResizeInProgress apiv1.PodConditionType = "PodResizeInProgress"
+	// Reason of the PodResizePending condition if the node can't fit the
+	// resized pod.
+	resizeInfeasibleReason = "Infeasible"
+)
+
+// PodResizer updates resources of running pods in place, without recreating them.
+type PodResizer interface {
+	// Resize patches container resources of the pod to the recommendation of
+	// the VPA through the pod resize subresource. Returns error if the resize
+	// was not accepted, e.g. because the cluster doesn't support it.
+	Resize(pod *apiv1.Pod, vpa *vpa_types.VerticalPodAutoscaler, eventRecorder record.EventRecorder) error
+}
+
+type podResizer struct {
+	client                 kube_client.Interface
+	recommendationProvider recommendation.Provider
+}
+
+// NewPodResizer returns a PodResizer applying the same resources the
+// admission controller would assign to a new pod.
+func NewPodResizer(client kube_client.Interface, recommendationProvider recommendation.Provider) PodResizer {
+	return &podResizer{
+		client:                 client,
+		recommendationProvider: recommendationProvider,
+	}
+}
+
+type containerResizePatch struct {
+	Name      string                     `json:"name"`
+	Resources apiv1.ResourceRequirements `json:"resources"`
+}
+
+type podResizePatch struct {
+	Spec struct {
+		Containers []containerResizePatch `json:"containers"`
+	} `json:"spec"`
+}
+
+func (r *podResizer) Resize(pod *apiv1.Pod, vpa *vpa_types.VerticalPodAutoscaler, eventRecorder record.EventRecorder) error {
+	containersResources, _, err := r.recommendationProvider.GetContainersResourcesForPod(pod, vpa)
+	if err != nil {
+		return fmt.Errorf("cannot get recommended resources: %v", err)
+	}
+	var patch podResizePatch
+	for i, resources := range containersResources {
+		if len(resources.Requests) == 0 && len(resources.Limits) == 0 {
+			continue
+		}
+		patch.Spec.Containers = append(patch.Spec.Containers, containerResizePatch{
+			Name: pod.Spec.Containers[i].Name,
+			Resources: apiv1.ResourceRequirements{
+				Requests: resources.Requests,
+				Limits:   resources.Limits,
+			},
+		})
+	}
+	if len(patch.Spec.Containers) == 0 {
+		return fmt.Errorf("no recommendation for containers of pod %s/%s", pod.Namespace, pod.Name)
+	}
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	_, err = r.client.CoreV1().Pods(pod.Namespace).Patch(context.TODO(), pod.Name, types.StrategicMergePatchType, data, metav1.PatchOptions{}, resizeSubresource)
+	if err != nil {
+		return err
+	}
+	eventRecorder.Event(pod, apiv1.EventTypeNormal, "ResizedByVPA",
+		"Pod was resized in place by VPA Updater to apply resource recommendation.")
+	return nil
+}
+
+// IsResizeInfeasible returns true if the kubelet reported that the last resize
+// of the pod can't be actuated on its node.
+func IsResizeInfeasible(pod *apiv1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == podResizePending && condition.Reason == resizeInfeasibleReason {
+			return true
+		}
+	}
+	return false
+}
+
+// IsResizePending returns true if the last resize of the pod is not actuated
+// yet, but may still be.
+func IsResizePending(pod *apiv1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == podResizeInProgress && condition.Status == apiv1.ConditionTrue {
+			return true
+		}
+		if condition.Type == podResizePending && condition.Reason != resizeInfeasibleReason {
+			return true
+		}
+	}
+	return false
+}
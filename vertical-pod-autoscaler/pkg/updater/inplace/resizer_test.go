@@ -0,0 +1,118 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inplace
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/test"
+	vpa_api_util "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/vpa"
+	"k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+)
+
+type fakeRecommendationProvider struct {
+	resources []vpa_api_util.ContainerResources
+	err       error
+}
+
+func (f *fakeRecommendationProvider) GetContainersResourcesForPod(pod *apiv1.Pod, vpa *vpa_types.VerticalPodAutoscaler) ([]vpa_api_util.ContainerResources, vpa_api_util.ContainerToAnnotationsMap, error) {
+	return f.resources, nil, f.err
+}
+
+func TestResize(t *testing.T) {
+	pod := test.Pod().WithName("pod").
+		AddContainer(test.BuildTestContainer("container1", "1", "100M")).
+		AddContainer(test.BuildTestContainer("sidecar", "1", "100M")).
+		Get()
+	provider := &fakeRecommendationProvider{
+		resources: []vpa_api_util.ContainerResources{
+			{Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("2")}},
+			{},
+		},
+	}
+	client := &fake.Clientset{}
+	var patchAction core.PatchAction
+	client.AddReactor("patch", "pods", func(action core.Action) (bool, runtime.Object, error) {
+		patchAction = action.(core.PatchAction)
+		return true, pod, nil
+	})
+
+	err := NewPodResizer(client, provider).Resize(pod, nil, record.NewFakeRecorder(1))
+	assert.NoError(t, err)
+	assert.Equal(t, resizeSubresource, patchAction.GetSubresource())
+	assert.JSONEq(t, `{"spec":{"containers":[{"name":"container1","resources":{"requests":{"cpu":"2"}}}]}}`, string(patchAction.GetPatch()))
+}
+
+func TestResizeRejected(t *testing.T) {
+	pod := test.Pod().WithName("pod").AddContainer(test.BuildTestContainer("container1", "1", "100M")).Get()
+	provider := &fakeRecommendationProvider{
+		resources: []vpa_api_util.ContainerResources{
+			{Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("2")}},
+		},
+	}
+	client := &fake.Clientset{}
+	client.AddReactor("patch", "pods", func(action core.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("the server could not find the requested resource")
+	})
+
+	err := NewPodResizer(client, provider).Resize(pod, nil, record.NewFakeRecorder(1))
+	assert.Error(t, err)
+}
+
+func TestResizeConditions(t *testing.T) {
+	testCases := []struct {
+		name               string
+		conditions         []apiv1.PodCondition
+		expectedInfeasible bool
+		expectedPending    bool
+	}{
+		{
+			name: "no resize",
+		},
+		{
+			name:               "infeasible",
+			conditions:         []apiv1.PodCondition{{Type: podResizePending, Status: apiv1.ConditionTrue, Reason: resizeInfeasibleReason}},
+			expectedInfeasible: true,
+		},
+		{
+			name:            "deferred",
+			conditions:      []apiv1.PodCondition{{Type: podResizePending, Status: apiv1.ConditionTrue, Reason: "Deferred"}},
+			expectedPending: true,
+		},
+		{
+			name:            "in progress",
+			conditions:      []apiv1.PodCondition{{Type: podResizeInProgress, Status: apiv1.ConditionTrue}},
+			expectedPending: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pod := test.Pod().WithName("pod").Get()
+			pod.Status.Conditions = tc.conditions
+			assert.Equal(t, tc.expectedInfeasible, IsResizeInfeasible(pod))
+			assert.Equal(t, tc.expectedPending, IsResizePending(pod))
+		})
+	}
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	vpa_api "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/client/clientset/versioned/typed/autoscaling.k8s.io/v1"
+	metrics_updater "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/metrics/updater"
+	vpa_api_util "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/vpa"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+)
+
+// cappedRecommendationsReporter reports VPAs whose uncapped recommendation
+// has exceeded maxAllowed of their resource policy for longer than a
+// threshold, i.e. whose policy ceiling starves the workload. These VPAs get
+// the RecommendationCapped condition and a warning event, and are counted by
+// the vpas_with_capped_recommendations_total metric.
+type cappedRecommendationsReporter struct {
+	threshold     time.Duration
+	vpaClient     vpa_api.VerticalPodAutoscalersGetter
+	eventRecorder record.EventRecorder
+	// cappedSince is when the recommendation of each VPA started exceeding
+	// maxAllowed.
+	cappedSince map[types.NamespacedName]time.Time
+}
+
+func newCappedRecommendationsReporter(threshold time.Duration, vpaClient vpa_api.VerticalPodAutoscalersGetter, eventRecorder record.EventRecorder) *cappedRecommendationsReporter {
+	return &cappedRecommendationsReporter{
+		threshold:     threshold,
+		vpaClient:     vpaClient,
+		eventRecorder: eventRecorder,
+		cappedSince:   make(map[types.NamespacedName]time.Time),
+	}
+}
+
+// Report updates the condition of the VPAs and the metric at the given time.
+func (r *cappedRecommendationsReporter) Report(vpas []*vpa_types.VerticalPodAutoscaler, now time.Time) {
+	cappedSince := make(map[types.NamespacedName]time.Time)
+	count := 0
+	for _, vpa := range vpas {
+		vpaID := types.NamespacedName{Namespace: vpa.Namespace, Name: vpa.Name}
+		containers := cappedContainers(vpa)
+		capped := false
+		if len(containers) > 0 {
+			since, found := r.cappedSince[vpaID]
+			if !found {
+				since = now
+			}
+			cappedSince[vpaID] = since
+			capped = now.Sub(since) >= r.threshold
+		}
+		if capped {
+			count++
+		}
+		r.setCondition(vpa, capped, containers)
+	}
+	// Dropping the VPAs no longer capped or deleted.
+	r.cappedSince = cappedSince
+	metrics_updater.RecordVpasWithCappedRecommendations(count)
+}
+
+func (r *cappedRecommendationsReporter) setCondition(vpa *vpa_types.VerticalPodAutoscaler, capped bool, containers []string) {
+	wasCapped := false
+	found := false
+	for _, condition := range vpa.Status.Conditions {
+		if condition.Type == vpa_types.RecommendationCapped {
+			found = true
+			wasCapped = condition.Status == apiv1.ConditionTrue
+		}
+	}
+	condition := vpa_types.VerticalPodAutoscalerCondition{
+		Type:               vpa_types.RecommendationCapped,
+		Status:             apiv1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+	}
+	if capped {
+		condition.Status = apiv1.ConditionTrue
+		condition.Reason = "MaxAllowedExceeded"
+		condition.Message = fmt.Sprintf("The uncapped recommendation for containers %s has exceeded maxAllowed for longer than %v",
+			strings.Join(containers, ", "), r.threshold)
+	} else if !found {
+		// Don't add the condition to VPAs which have never been capped.
+		return
+	}
+	if _, err := vpa_api_util.SetVpaConditionIfNeeded(r.vpaClient.VerticalPodAutoscalers(vpa.Namespace), vpa, condition); err != nil {
+		klog.Errorf("Cannot update the %s condition of VPA %s/%s: %v", vpa_types.RecommendationCapped, vpa.Namespace, vpa.Name, err)
+		return
+	}
+	if capped && !wasCapped && r.eventRecorder != nil {
+		r.eventRecorder.Event(vpa, apiv1.EventTypeWarning, "RecommendationCapped", condition.Message)
+	}
+}
+
+// cappedContainers returns the names of the containers of the VPA whose
+// uncapped recommendation exceeds maxAllowed of their resource policy.
+func cappedContainers(vpa *vpa_types.VerticalPodAutoscaler) []string {
+	if vpa.Status.Recommendation == nil {
+		return nil
+	}
+	var containers []string
+	for _, recommendation := range vpa.Status.Recommendation.ContainerRecommendations {
+		policy := vpa_api_util.GetContainerResourcePolicy(recommendation.ContainerName, vpa.Spec.ResourcePolicy)
+		if policy == nil {
+			continue
+		}
+		for resource, maxAllowed := range policy.MaxAllowed {
+			if uncapped, found := recommendation.UncappedTarget[resource]; found && uncapped.Cmp(maxAllowed) > 0 {
+				containers = append(containers, recommendation.ContainerName)
+				break
+			}
+		}
+	}
+	sort.Strings(containers)
+	return containers
+}
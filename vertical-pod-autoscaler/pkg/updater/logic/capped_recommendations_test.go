@@ -0,0 +1,98 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logic
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	vpa_fake "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/client/clientset/versioned/fake"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/test"
+	"k8s.io/client-go/tools/record"
+)
+
+func cappedTestVpa(uncappedCPU string) *vpa_types.VerticalPodAutoscaler {
+	vpa := test.VerticalPodAutoscaler().
+		WithName("vpa").
+		WithNamespace("default").
+		WithContainer("container").
+		WithMaxAllowed("2", "1Gi").
+		WithTarget("2", "500Mi").Get()
+	vpa.Status.Recommendation.ContainerRecommendations[0].UncappedTarget = test.Resources(uncappedCPU, "500Mi")
+	return vpa
+}
+
+func TestCappedContainers(t *testing.T) {
+	assert.Equal(t, []string{"container"}, cappedContainers(cappedTestVpa("4")))
+	assert.Empty(t, cappedContainers(cappedTestVpa("2")))
+
+	vpa := cappedTestVpa("4")
+	vpa.Status.Recommendation = nil
+	assert.Empty(t, cappedContainers(vpa))
+}
+
+func TestCappedRecommendationsReporter(t *testing.T) {
+	vpa := cappedTestVpa("4")
+	vpaClient := vpa_fake.NewSimpleClientset(vpa)
+	eventRecorder := record.NewFakeRecorder(10)
+	reporter := newCappedRecommendationsReporter(time.Hour, vpaClient.AutoscalingV1(), eventRecorder)
+	getVpa := func() *vpa_types.VerticalPodAutoscaler {
+		vpa, err := vpaClient.AutoscalingV1().VerticalPodAutoscalers("default").Get(context.TODO(), "vpa", metav1.GetOptions{})
+		assert.NoError(t, err)
+		return vpa
+	}
+	now := time.Unix(0, 0)
+
+	// Capped for less than the threshold.
+	reporter.Report([]*vpa_types.VerticalPodAutoscaler{vpa}, now)
+	reporter.Report([]*vpa_types.VerticalPodAutoscaler{vpa}, now.Add(30*time.Minute))
+	assert.Empty(t, getVpa().Status.Conditions)
+	assert.Empty(t, eventRecorder.Events)
+
+	// Capped for longer than the threshold.
+	reporter.Report([]*vpa_types.VerticalPodAutoscaler{vpa}, now.Add(time.Hour))
+	vpa = getVpa()
+	if assert.Len(t, vpa.Status.Conditions, 1) {
+		assert.Equal(t, vpa_types.RecommendationCapped, vpa.Status.Conditions[0].Type)
+		assert.Equal(t, apiv1.ConditionTrue, vpa.Status.Conditions[0].Status)
+	}
+	assert.Len(t, eventRecorder.Events, 1)
+
+	// Still capped, the event isn't repeated.
+	reporter.Report([]*vpa_types.VerticalPodAutoscaler{vpa}, now.Add(2*time.Hour))
+	assert.Len(t, eventRecorder.Events, 1)
+
+	// No longer capped.
+	vpa.Status.Recommendation.ContainerRecommendations[0].UncappedTarget = test.Resources("1", "500Mi")
+	reporter.Report([]*vpa_types.VerticalPodAutoscaler{vpa}, now.Add(3*time.Hour))
+	vpa = getVpa()
+	if assert.Len(t, vpa.Status.Conditions, 1) {
+		assert.Equal(t, apiv1.ConditionFalse, vpa.Status.Conditions[0].Status)
+	}
+	assert.Empty(t, reporter.cappedSince)
+
+	// Capped again, the threshold applies from the start.
+	vpa.Status.Recommendation.ContainerRecommendations[0].UncappedTarget = test.Resources("4", "500Mi")
+	reporter.Report([]*vpa_types.VerticalPodAutoscaler{vpa}, now.Add(4*time.Hour))
+	assert.Equal(t, apiv1.ConditionFalse, getVpa().Status.Conditions[0].Status)
+	assert.Len(t, eventRecorder.Events, 1)
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logic
+
+import (
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	vpa_api_util "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/vpa"
+)
+
+// disruptionBudget caps the disruption time of every VPA, i.e. the sum of the
+// termination grace periods of its pods evicted in a loop and the grace time
+// left to its pods still terminating, e.g. evicted in earlier loops. An
+// eviction is always allowed while no pod of the VPA is terminating, so that
+// pods whose grace period alone exceeds the budget are still updated, one at a
+// time. A zero budget disables the limit.
+type disruptionBudget struct {
+	maxPerVpa time.Duration
+	vpas      map[*vpa_types.VerticalPodAutoscaler]time.Duration
+}
+
+func newDisruptionBudget(maxPerVpa time.Duration, pods []*apiv1.Pod, vpas []*vpa_api_util.VpaWithSelector, now time.Time) *disruptionBudget {
+	budget := &disruptionBudget{
+		maxPerVpa: maxPerVpa,
+		vpas:      make(map[*vpa_types.VerticalPodAutoscaler]time.Duration),
+	}
+	if maxPerVpa <= 0 {
+		return budget
+	}
+	for _, pod := range pods {
+		// The deletion timestamp of a terminating pod is when its grace
+		// period ends.
+		if pod.DeletionTimestamp == nil || !pod.DeletionTimestamp.Time.After(now) {
+			continue
+		}
+		if controllingVPA := vpa_api_util.GetControllingVPAForPod(pod, vpas); controllingVPA != nil {
+			budget.vpas[controllingVPA.Vpa] += pod.DeletionTimestamp.Time.Sub(now)
+		}
+	}
+	return budget
+}
+
+// canEvict returns true if the pod of the VPA can be evicted without
+// exceeding the budget of the VPA.
+func (b *disruptionBudget) canEvict(vpa *vpa_types.VerticalPodAutoscaler, pod *apiv1.Pod) bool {
+	used, found := b.vpas[vpa]
+	if b.maxPerVpa <= 0 || !found {
+		return true
+	}
+	return used+terminationGracePeriod(pod) <= b.maxPerVpa
+}
+
+// add records an eviction of the pod of the VPA.
+func (b *disruptionBudget) add(vpa *vpa_types.VerticalPodAutoscaler, pod *apiv1.Pod) {
+	b.vpas[vpa] += terminationGracePeriod(pod)
+}
+
+// terminationGracePeriod returns how long the pod may take to shut down once
+// evicted.
+func terminationGracePeriod(pod *apiv1.Pod) time.Duration {
+	if pod.Spec.TerminationGracePeriodSeconds == nil {
+		return apiv1.DefaultTerminationGracePeriodSeconds * time.Second
+	}
+	return time.Duration(*pod.Spec.TerminationGracePeriodSeconds) * time.Second
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/test"
+	vpa_api_util "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/vpa"
+)
+
+func TestDisruptionBudget(t *testing.T) {
+	vpa1 := test.VerticalPodAutoscaler().WithName("vpa-1").WithNamespace("default").WithContainer("container").Get()
+	vpa2 := test.VerticalPodAutoscaler().WithName("vpa-2").WithNamespace("default").WithContainer("container").Get()
+	newPod := func(gracePeriodSeconds *int64) *apiv1.Pod {
+		pod := test.Pod().WithName("pod").Get()
+		pod.Spec.TerminationGracePeriodSeconds = gracePeriodSeconds
+		return pod
+	}
+	seconds := func(value int64) *int64 {
+		return &value
+	}
+
+	budget := newDisruptionBudget(2*time.Minute, nil, nil, time.Now())
+	// The first eviction is allowed even beyond the budget.
+	assert.True(t, budget.canEvict(vpa1, newPod(seconds(600))))
+	budget.add(vpa1, newPod(seconds(90)))
+	assert.True(t, budget.canEvict(vpa1, newPod(seconds(30))))
+	assert.False(t, budget.canEvict(vpa1, newPod(seconds(31))))
+	// Pods without a grace period use the default of 30s.
+	assert.True(t, budget.canEvict(vpa1, newPod(nil)))
+	budget.add(vpa1, newPod(nil))
+	assert.True(t, budget.canEvict(vpa1, newPod(seconds(0))))
+	assert.False(t, budget.canEvict(vpa1, newPod(seconds(1))))
+	assert.True(t, budget.canEvict(vpa2, newPod(seconds(600))))
+
+	budget = newDisruptionBudget(0, nil, nil, time.Now())
+	budget.add(vpa1, newPod(seconds(600)))
+	assert.True(t, budget.canEvict(vpa1, newPod(seconds(600))))
+}
+
+func TestDisruptionBudgetTerminatingPods(t *testing.T) {
+	vpa := test.VerticalPodAutoscaler().WithName("vpa").WithNamespace("default").WithContainer("container").Get()
+	selector, err := labels.Parse("app=db")
+	assert.NoError(t, err)
+	vpas := []*vpa_api_util.VpaWithSelector{{Vpa: vpa, Selector: selector}}
+	now := time.Unix(1000, 0)
+	newPod := func(name string, deletionTimestamp *metav1.Time) *apiv1.Pod {
+		pod := test.Pod().WithName(name).AddContainer(test.Container().WithName("container").Get()).
+			WithLabels(map[string]string{"app": "db"}).Get()
+		pod.DeletionTimestamp = deletionTimestamp
+		return pod
+	}
+	deletionTimestamp := func(fromNow time.Duration) *metav1.Time {
+		timestamp := metav1.NewTime(now.Add(fromNow))
+		return &timestamp
+	}
+
+	// A pod evicted in an earlier loop has 100s of its grace period left.
+	budget := newDisruptionBudget(2*time.Minute, []*apiv1.Pod{
+		newPod("terminating", deletionTimestamp(100*time.Second)),
+		newPod("terminated", deletionTimestamp(-time.Second)),
+		newPod("running", nil),
+	}, vpas, now)
+	pod := newPod("pod", nil)
+	gracePeriodSeconds := int64(20)
+	pod.Spec.TerminationGracePeriodSeconds = &gracePeriodSeconds
+	assert.True(t, budget.canEvict(vpa, pod))
+	gracePeriodSeconds = 21
+	assert.False(t, budget.canEvict(vpa, pod))
+
+	// Once no pod is terminating, any pod can be evicted.
+	budget = newDisruptionBudget(2*time.Minute, []*apiv1.Pod{newPod("terminated", deletionTimestamp(-time.Second))}, vpas, now)
+	gracePeriodSeconds = 600
+	assert.True(t, budget.canEvict(vpa, pod))
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logic
+
+import (
+	apiv1 "k8s.io/api/core/v1"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	vpa_api_util "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/vpa"
+)
+
+// inFlightEvictions counts the evictions in flight in every namespace and for
+// every VPA, i.e. their pods which are terminating or not running yet, and
+// caps them. Zero caps disable the limit.
+type inFlightEvictions struct {
+	maxPerNamespace int
+	maxPerVpa       int
+	namespaces      map[string]int
+	vpas            map[*vpa_types.VerticalPodAutoscaler]int
+}
+
+func newInFlightEvictions(maxPerNamespace, maxPerVpa int, pods []*apiv1.Pod, vpas []*vpa_api_util.VpaWithSelector) *inFlightEvictions {
+	inFlight := &inFlightEvictions{
+		maxPerNamespace: maxPerNamespace,
+		maxPerVpa:       maxPerVpa,
+		namespaces:      make(map[string]int),
+		vpas:            make(map[*vpa_types.VerticalPodAutoscaler]int),
+	}
+	if maxPerNamespace <= 0 && maxPerVpa <= 0 {
+		return inFlight
+	}
+	for _, pod := range pods {
+		if pod.DeletionTimestamp == nil && pod.Status.Phase != apiv1.PodPending {
+			continue
+		}
+		if controllingVPA := vpa_api_util.GetControllingVPAForPod(pod, vpas); controllingVPA != nil {
+			inFlight.add(controllingVPA.Vpa)
+		}
+	}
+	return inFlight
+}
+
+// canEvict returns true if another pod of the VPA can be evicted without
+// exceeding the caps.
+func (f *inFlightEvictions) canEvict(vpa *vpa_types.VerticalPodAutoscaler) bool {
+	if f.maxPerNamespace > 0 && f.namespaces[vpa.Namespace] >= f.maxPerNamespace {
+		return false
+	}
+	return f.maxPerVpa <= 0 || f.vpas[vpa] < f.maxPerVpa
+}
+
+// add records an eviction of a pod of the VPA.
+func (f *inFlightEvictions) add(vpa *vpa_types.VerticalPodAutoscaler) {
+	f.namespaces[vpa.Namespace]++
+	f.vpas[vpa]++
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logic
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/test"
+	vpa_api_util "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/vpa"
+)
+
+func TestInFlightEvictions(t *testing.T) {
+	vpa1 := test.VerticalPodAutoscaler().WithName("vpa-1").WithNamespace("default").WithContainer("container").Get()
+	vpa2 := test.VerticalPodAutoscaler().WithName("vpa-2").WithNamespace("default").WithContainer("container").Get()
+	vpas := []*vpa_api_util.VpaWithSelector{
+		{Vpa: vpa1, Selector: parseLabelSelector("app = app-1")},
+		{Vpa: vpa2, Selector: parseLabelSelector("app = app-2")},
+	}
+	newPod := func(app string, phase apiv1.PodPhase, deleted bool) *apiv1.Pod {
+		pod := test.Pod().WithName(app).WithLabels(map[string]string{"app": app}).WithPhase(phase).Get()
+		pod.Namespace = "default"
+		if deleted {
+			pod.DeletionTimestamp = &metav1.Time{}
+		}
+		return pod
+	}
+	pods := []*apiv1.Pod{
+		newPod("app-1", apiv1.PodRunning, false),
+		newPod("app-1", apiv1.PodRunning, true),
+		newPod("app-1", apiv1.PodPending, false),
+		newPod("app-2", apiv1.PodRunning, false),
+	}
+
+	inFlight := newInFlightEvictions(0, 2, pods, vpas)
+	assert.False(t, inFlight.canEvict(vpa1))
+	assert.True(t, inFlight.canEvict(vpa2))
+	inFlight.add(vpa2)
+	inFlight.add(vpa2)
+	assert.False(t, inFlight.canEvict(vpa2))
+
+	inFlight = newInFlightEvictions(3, 0, pods, vpas)
+	assert.True(t, inFlight.canEvict(vpa2))
+	inFlight.add(vpa2)
+	assert.False(t, inFlight.canEvict(vpa1))
+	assert.False(t, inFlight.canEvict(vpa2))
+
+	inFlight = newInFlightEvictions(0, 0, pods, vpas)
+	assert.True(t, inFlight.canEvict(vpa1))
+}
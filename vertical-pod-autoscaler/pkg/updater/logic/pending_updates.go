@@ -0,0 +1,86 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logic
+
+import (
+	apiv1 "k8s.io/api/core/v1"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	metrics_updater "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/metrics/updater"
+	vpa_api_util "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/vpa"
+	"k8s.io/klog/v2"
+)
+
+// pendingUpdates sums, per namespace, the change of CPU and memory requests
+// the updates of pods pending an update would make, i.e. their recommended
+// minus their current requests. CPU is in cores and memory in bytes, negative
+// deltas are savings.
+type pendingUpdates struct {
+	recommendationProcessor vpa_api_util.RecommendationProcessor
+	pods                    map[string]int
+	deltas                  map[string]map[apiv1.ResourceName]float64
+}
+
+func newPendingUpdates(recommendationProcessor vpa_api_util.RecommendationProcessor) *pendingUpdates {
+	return &pendingUpdates{
+		recommendationProcessor: recommendationProcessor,
+		pods:                    make(map[string]int),
+		deltas:                  make(map[string]map[apiv1.ResourceName]float64),
+	}
+}
+
+// add records the pods of the VPA pending an update.
+func (p *pendingUpdates) add(vpa *vpa_types.VerticalPodAutoscaler, pods []*apiv1.Pod) {
+	if len(pods) == 0 {
+		return
+	}
+	if p.deltas[vpa.Namespace] == nil {
+		p.deltas[vpa.Namespace] = make(map[apiv1.ResourceName]float64)
+	}
+	vpaDeltas := make(map[apiv1.ResourceName]float64)
+	for _, pod := range pods {
+		recommendation, _, err := p.recommendationProcessor.Apply(vpa.Status.Recommendation, vpa.Spec.ResourcePolicy, vpa.Status.Conditions, pod)
+		if err != nil {
+			klog.V(3).Infof("cannot process the recommendation of VPA %v for pod %v: %v", vpa.Name, pod.Name, err)
+			continue
+		}
+		p.pods[vpa.Namespace]++
+		for _, container := range pod.Spec.Containers {
+			containerRecommendation := vpa_api_util.GetRecommendationForContainer(container.Name, recommendation)
+			if containerRecommendation == nil {
+				continue
+			}
+			for _, resource := range []apiv1.ResourceName{apiv1.ResourceCPU, apiv1.ResourceMemory} {
+				target, found := containerRecommendation.Target[resource]
+				if !found {
+					continue
+				}
+				request := container.Resources.Requests[resource]
+				vpaDeltas[resource] += target.AsApproximateFloat64() - request.AsApproximateFloat64()
+			}
+		}
+	}
+	for resource, delta := range vpaDeltas {
+		p.deltas[vpa.Namespace][resource] += delta
+	}
+	klog.V(2).Infof("VPA %v/%v has %v pods pending an update, changing requests by %.3f CPU cores and %.0f bytes of memory",
+		vpa.Namespace, vpa.Name, len(pods), vpaDeltas[apiv1.ResourceCPU], vpaDeltas[apiv1.ResourceMemory])
+}
+
+// observe exports the sums as metrics.
+func (p *pendingUpdates) observe() {
+	metrics_updater.RecordPendingUpdates(p.pods, p.deltas)
+}
@@ -0,0 +1,45 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logic
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/test"
+)
+
+func TestPendingUpdates(t *testing.T) {
+	vpa := test.VerticalPodAutoscaler().WithName("vpa").WithNamespace("default").
+		WithContainer("app").WithTarget("500m", "1Gi").Get()
+	pods := []*apiv1.Pod{
+		test.Pod().WithName("pod-1").AddContainer(test.BuildTestContainer("app", "1", "1Gi")).
+			AddContainer(test.BuildTestContainer("sidecar", "100m", "100Mi")).Get(),
+		test.Pod().WithName("pod-2").AddContainer(test.BuildTestContainer("app", "2", "512Mi")).Get(),
+	}
+
+	pendingUpdates := newPendingUpdates(&test.FakeRecommendationProcessor{})
+	pendingUpdates.add(vpa, pods)
+	pendingUpdates.add(vpa, nil)
+	assert.Equal(t, map[string]int{"default": 2}, pendingUpdates.pods)
+	// Containers without a recommendation, like sidecar, are not updated.
+	assert.Equal(t, map[string]map[apiv1.ResourceName]float64{"default": {
+		apiv1.ResourceCPU:    -2,
+		apiv1.ResourceMemory: 512 * 1024 * 1024,
+	}}, pendingUpdates.deltas)
+}
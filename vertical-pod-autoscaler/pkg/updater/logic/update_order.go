@@ -0,0 +1,136 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logic
+
+import (
+	"sort"
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	vpa_api_util "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/vpa"
+	"k8s.io/klog/v2"
+)
+
+// UpdateAfterAnnotation holds the comma separated names of VPAs in the
+// namespace of a VPA whose pods are updated before its own, e.g. "cache,db"
+// on the VPA of a frontend.
+const UpdateAfterAnnotation = "vpa-updater.k8s.io/update-after"
+
+// updateOrder sequences the updates of VPAs with UpdateAfterAnnotation. VPAs
+// are processed after the VPAs they depend on, and deferred to a later loop
+// while any of these still has pods needing an update, whether or not they can
+// be evicted in the loop, or pods evicted but not running again. Dependencies on VPAs not
+// processed in the loop are ignored. Cycles are broken by ignoring the
+// dependencies of one of their VPAs.
+type updateOrder struct {
+	vpas         []*vpa_types.VerticalPodAutoscaler
+	dependencies map[*vpa_types.VerticalPodAutoscaler][]*vpa_types.VerticalPodAutoscaler
+	pending      map[*vpa_types.VerticalPodAutoscaler]bool
+}
+
+func newUpdateOrder(vpas []*vpa_types.VerticalPodAutoscaler) *updateOrder {
+	sorted := make([]*vpa_types.VerticalPodAutoscaler, len(vpas))
+	copy(sorted, vpas)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Namespace != sorted[j].Namespace {
+			return sorted[i].Namespace < sorted[j].Namespace
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	byName := make(map[string]*vpa_types.VerticalPodAutoscaler, len(sorted))
+	for _, vpa := range sorted {
+		byName[vpa.Namespace+"/"+vpa.Name] = vpa
+	}
+	order := &updateOrder{
+		vpas:         make([]*vpa_types.VerticalPodAutoscaler, 0, len(sorted)),
+		dependencies: make(map[*vpa_types.VerticalPodAutoscaler][]*vpa_types.VerticalPodAutoscaler),
+		pending:      make(map[*vpa_types.VerticalPodAutoscaler]bool),
+	}
+	for _, vpa := range sorted {
+		for _, name := range strings.Split(vpa.Annotations[UpdateAfterAnnotation], ",") {
+			if dependency, found := byName[vpa.Namespace+"/"+strings.TrimSpace(name)]; found && dependency != vpa {
+				order.dependencies[vpa] = append(order.dependencies[vpa], dependency)
+			}
+		}
+	}
+
+	// Depth first topological sort, keeping the name order otherwise.
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[*vpa_types.VerticalPodAutoscaler]int, len(sorted))
+	var visit func(vpa *vpa_types.VerticalPodAutoscaler) bool
+	visit = func(vpa *vpa_types.VerticalPodAutoscaler) bool {
+		switch state[vpa] {
+		case visiting:
+			return false
+		case visited:
+			return true
+		}
+		state[vpa] = visiting
+		for _, dependency := range order.dependencies[vpa] {
+			if !visit(dependency) {
+				klog.Warningf("Ignoring %s of VPA %s/%s, its dependencies form a cycle", UpdateAfterAnnotation, vpa.Namespace, vpa.Name)
+				delete(order.dependencies, vpa)
+				break
+			}
+		}
+		state[vpa] = visited
+		order.vpas = append(order.vpas, vpa)
+		return true
+	}
+	for _, vpa := range sorted {
+		visit(vpa)
+	}
+	return order
+}
+
+// canUpdate returns true if none of the VPAs the VPA depends on has pods
+// left to update.
+func (o *updateOrder) canUpdate(vpa *vpa_types.VerticalPodAutoscaler) bool {
+	for _, dependency := range o.dependencies[vpa] {
+		if o.pending[dependency] {
+			return false
+		}
+	}
+	return true
+}
+
+// markPending records that the VPA has pods left to update, so that VPAs
+// depending on it are deferred.
+func (o *updateOrder) markPending(vpa *vpa_types.VerticalPodAutoscaler) {
+	o.pending[vpa] = true
+}
+
+// markInFlight marks the VPAs with pods which are terminating or not running
+// yet as pending, so that VPAs depending on them are deferred until their
+// evicted pods are replaced.
+func (o *updateOrder) markInFlight(pods []*apiv1.Pod, vpas []*vpa_api_util.VpaWithSelector) {
+	if len(o.dependencies) == 0 {
+		return
+	}
+	for _, pod := range pods {
+		if pod.DeletionTimestamp == nil && pod.Status.Phase != apiv1.PodPending {
+			continue
+		}
+		if controllingVPA := vpa_api_util.GetControllingVPAForPod(pod, vpas); controllingVPA != nil {
+			o.markPending(controllingVPA.Vpa)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logic
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/test"
+	vpa_api_util "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/vpa"
+)
+
+func TestUpdateOrder(t *testing.T) {
+	newVpa := func(name, updateAfter string) *vpa_types.VerticalPodAutoscaler {
+		return test.VerticalPodAutoscaler().WithName(name).WithNamespace("default").WithContainer("container").
+			WithAnnotations(map[string]string{UpdateAfterAnnotation: updateAfter}).Get()
+	}
+	frontend := newVpa("frontend", "cache, db")
+	cache := newVpa("cache", "db")
+	db := newVpa("db", "")
+	// Dependencies on unknown VPAs are ignored.
+	worker := newVpa("worker", "queue")
+
+	order := newUpdateOrder([]*vpa_types.VerticalPodAutoscaler{worker, frontend, cache, db})
+	assert.Equal(t, []*vpa_types.VerticalPodAutoscaler{db, cache, frontend, worker}, order.vpas)
+	assert.True(t, order.canUpdate(db))
+	assert.True(t, order.canUpdate(cache))
+	order.markPending(cache)
+	assert.False(t, order.canUpdate(frontend))
+	assert.True(t, order.canUpdate(worker))
+}
+
+func TestUpdateOrderCycle(t *testing.T) {
+	a := test.VerticalPodAutoscaler().WithName("a").WithNamespace("default").WithContainer("container").
+		WithAnnotations(map[string]string{UpdateAfterAnnotation: "b"}).Get()
+	b := test.VerticalPodAutoscaler().WithName("b").WithNamespace("default").WithContainer("container").
+		WithAnnotations(map[string]string{UpdateAfterAnnotation: "a"}).Get()
+
+	// The dependency of b on a is ignored to break the cycle.
+	order := newUpdateOrder([]*vpa_types.VerticalPodAutoscaler{a, b})
+	assert.Equal(t, []*vpa_types.VerticalPodAutoscaler{b, a}, order.vpas)
+	order.markPending(a)
+	assert.True(t, order.canUpdate(b))
+	order.markPending(b)
+	assert.False(t, order.canUpdate(a))
+}
+
+func TestUpdateOrderMarkInFlight(t *testing.T) {
+	newVpa := func(name, updateAfter string) *vpa_types.VerticalPodAutoscaler {
+		return test.VerticalPodAutoscaler().WithName(name).WithNamespace("default").WithContainer("container").
+			WithAnnotations(map[string]string{UpdateAfterAnnotation: updateAfter}).Get()
+	}
+	frontend := newVpa("frontend", "db")
+	db := newVpa("db", "")
+	dbSelector, err := labels.Parse("app=db")
+	assert.NoError(t, err)
+	vpas := []*vpa_api_util.VpaWithSelector{{Vpa: db, Selector: dbSelector}}
+	newPod := func(name string, phase apiv1.PodPhase) *apiv1.Pod {
+		return test.Pod().WithName(name).AddContainer(test.Container().WithName("container").Get()).
+			WithLabels(map[string]string{"app": "db"}).WithPhase(phase).Get()
+	}
+
+	order := newUpdateOrder([]*vpa_types.VerticalPodAutoscaler{frontend, db})
+	order.markInFlight([]*apiv1.Pod{newPod("running", apiv1.PodRunning)}, vpas)
+	assert.True(t, order.canUpdate(frontend))
+
+	order.markInFlight([]*apiv1.Pod{newPod("replacement", apiv1.PodPending)}, vpas)
+	assert.False(t, order.canUpdate(frontend))
+}
@@ -26,11 +26,18 @@ import (
 	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
 	vpa_clientset "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/client/clientset/versioned"
+	vpa_scheme "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/client/clientset/versioned/scheme"
 	vpa_lister "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/client/listers/autoscaling.k8s.io/v1"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/target"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/updater/applied"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/updater/authorizer"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/updater/eviction"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/updater/inplace"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/updater/priority"
 	metrics_updater "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/metrics/updater"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/status"
@@ -45,6 +52,10 @@ import (
 	"k8s.io/klog/v2"
 )
 
+// toBeDeletedTaint is the taint Cluster Autoscaler puts on nodes it drains
+// before deleting them.
+const toBeDeletedTaint = "ToBeDeletedByClusterAutoscaler"
+
 // Updater performs updates on pods if recommended by Vertical Pod Autoscaler
 type Updater interface {
 	// RunOnce represents single iteration in the main-loop of Updater
@@ -54,8 +65,10 @@ type Updater interface {
 type updater struct {
 	vpaLister                    vpa_lister.VerticalPodAutoscalerLister
 	podLister                    v1lister.PodLister
+	nodeLister                   v1lister.NodeLister
 	eventRecorder                record.EventRecorder
 	evictionFactory              eviction.PodsEvictionRestrictionFactory
+	podResizer                   inplace.PodResizer
 	recommendationProcessor      vpa_api_util.RecommendationProcessor
 	evictionAdmission            priority.PodEvictionAdmission
 	priorityProcessor            priority.PriorityProcessor
@@ -63,6 +76,13 @@ type updater struct {
 	selectorFetcher              target.VpaTargetSelectorFetcher
 	useAdmissionControllerStatus bool
 	statusValidator              status.Validator
+	maxInFlightPerNamespace      int
+	maxInFlightPerVpa            int
+	maxDisruptionPerVpa          time.Duration
+	targetAnnotator              applied.TargetAnnotator
+	cappedRecommendations        *cappedRecommendationsReporter
+	authorizer                   authorizer.Authorizer
+	reportOnly                   bool
 }
 
 // NewUpdater creates Updater with given configuration
@@ -73,24 +93,45 @@ func NewUpdater(
 	evictionRateLimit float64,
 	evictionRateBurst int,
 	evictionToleranceFraction float64,
+	evictionMaxUnavailable *intstr.IntOrString,
 	useAdmissionControllerStatus bool,
 	statusNamespace string,
 	recommendationProcessor vpa_api_util.RecommendationProcessor,
 	evictionAdmission priority.PodEvictionAdmission,
 	selectorFetcher target.VpaTargetSelectorFetcher,
 	priorityProcessor priority.PriorityProcessor,
-	namespace string,
+	podResizer inplace.PodResizer,
+	vpaObjectFilter *vpa_api_util.VpaObjectFilter,
+	skipDrainingNodes bool,
+	maxInFlightPerNamespace int,
+	maxInFlightPerVpa int,
+	maxDisruptionPerVpa time.Duration,
+	targetAnnotator applied.TargetAnnotator,
+	cappedRecommendationThreshold time.Duration,
+	authorizer authorizer.Authorizer,
+	reportOnly bool,
 ) (Updater, error) {
 	evictionRateLimiter := getRateLimiter(evictionRateLimit, evictionRateBurst)
-	factory, err := eviction.NewPodsEvictionRestrictionFactory(kubeClient, minReplicasForEvicition, evictionToleranceFraction)
+	factory, err := eviction.NewPodsEvictionRestrictionFactory(kubeClient, minReplicasForEvicition, evictionToleranceFraction, evictionMaxUnavailable)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to create eviction restriction factory: %v", err)
 	}
+	var nodeLister v1lister.NodeLister
+	if skipDrainingNodes {
+		nodeLister = newNodeLister(kubeClient)
+	}
+	eventRecorder := newEventRecorder(kubeClient)
+	var cappedRecommendations *cappedRecommendationsReporter
+	if cappedRecommendationThreshold > 0 {
+		cappedRecommendations = newCappedRecommendationsReporter(cappedRecommendationThreshold, vpaClient.AutoscalingV1(), eventRecorder)
+	}
 	return &updater{
-		vpaLister:                    vpa_api_util.NewVpasLister(vpaClient, make(chan struct{}), namespace),
-		podLister:                    newPodLister(kubeClient, namespace),
-		eventRecorder:                newEventRecorder(kubeClient),
+		vpaLister:                    vpa_api_util.NewFilteredVpasLister(vpaClient, make(chan struct{}), vpaObjectFilter),
+		podLister:                    newPodLister(kubeClient, vpaObjectFilter.Namespace()),
+		nodeLister:                   nodeLister,
+		eventRecorder:                eventRecorder,
 		evictionFactory:              factory,
+		podResizer:                   podResizer,
 		recommendationProcessor:      recommendationProcessor,
 		evictionRateLimiter:          evictionRateLimiter,
 		evictionAdmission:            evictionAdmission,
@@ -102,6 +143,13 @@ func NewUpdater(
 			status.AdmissionControllerStatusName,
 			statusNamespace,
 		),
+		maxInFlightPerNamespace: maxInFlightPerNamespace,
+		maxInFlightPerVpa:       maxInFlightPerVpa,
+		maxDisruptionPerVpa:     maxDisruptionPerVpa,
+		targetAnnotator:         targetAnnotator,
+		cappedRecommendations:   cappedRecommendations,
+		authorizer:              authorizer,
+		reportOnly:              reportOnly,
 	}, nil
 }
 
@@ -129,12 +177,22 @@ func (u *updater) RunOnce(ctx context.Context) {
 	}
 	timer.ObserveStep("ListVPAs")
 
+	if u.cappedRecommendations != nil {
+		u.cappedRecommendations.Report(vpaList, time.Now())
+		timer.ObserveStep("ReportCappedRecommendations")
+	}
+
 	vpas := make([]*vpa_api_util.VpaWithSelector, 0)
 
 	for _, vpa := range vpaList {
 		if vpa_api_util.GetUpdateMode(vpa) != vpa_types.UpdateModeRecreate &&
-			vpa_api_util.GetUpdateMode(vpa) != vpa_types.UpdateModeAuto {
-			klog.V(3).Infof("skipping VPA object %v because its mode is not \"Recreate\" or \"Auto\"", vpa.Name)
+			vpa_api_util.GetUpdateMode(vpa) != vpa_types.UpdateModeAuto &&
+			vpa_api_util.GetUpdateMode(vpa) != vpa_types.UpdateModeInPlaceOrRecreate {
+			klog.V(3).Infof("skipping VPA object %v because its mode is not \"Recreate\", \"Auto\" or \"InPlaceOrRecreate\"", vpa.Name)
+			continue
+		}
+		if vpa_api_util.InObservationGracePeriod(vpa, time.Now()) {
+			klog.V(3).Infof("skipping VPA object %v because it is in its observation grace period", vpa.Name)
 			continue
 		}
 		selector, err := u.selectorFetcher.Fetch(vpa)
@@ -164,6 +222,8 @@ func (u *updater) RunOnce(ctx context.Context) {
 	}
 	timer.ObserveStep("ListPods")
 	allLivePods := filterDeletedPods(podsList)
+	inFlight := newInFlightEvictions(u.maxInFlightPerNamespace, u.maxInFlightPerVpa, podsList, vpas)
+	disruption := newDisruptionBudget(u.maxDisruptionPerVpa, podsList, vpas, time.Now())
 
 	controlledPods := make(map[*vpa_types.VerticalPodAutoscaler][]*apiv1.Pod)
 	for _, pod := range allLivePods {
@@ -190,23 +250,88 @@ func (u *updater) RunOnce(ctx context.Context) {
 	defer evictablePodsCounter.Observe()
 	defer vpasWithEvictablePodsCounter.Observe()
 	defer vpasWithEvictedPodsCounter.Observe()
+	pendingUpdates := newPendingUpdates(u.recommendationProcessor)
+	defer pendingUpdates.observe()
+
+	vpasToUpdate := make([]*vpa_types.VerticalPodAutoscaler, 0, len(controlledPods))
+	for vpa := range controlledPods {
+		vpasToUpdate = append(vpasToUpdate, vpa)
+	}
+	order := newUpdateOrder(vpasToUpdate)
+	order.markInFlight(podsList, vpas)
 
 	// NOTE: this loop assumes that controlledPods are filtered
-	// to contain only Pods controlled by a VPA in auto or recreate mode
-	for vpa, livePods := range controlledPods {
+	// to contain only Pods controlled by a VPA in auto, recreate or in-place mode
+	for _, vpa := range order.vpas {
+		livePods := controlledPods[vpa]
 		vpaSize := len(livePods)
 		controlledPodsCounter.Add(vpaSize, vpaSize)
+		podsForUpdate := u.filterPodsOnDrainingNodes(livePods, vpaSize)
+		podsForUpdate = u.getPodsUpdateOrder(podsForUpdate, vpa)
+		pendingUpdates.add(vpa, podsForUpdate)
+		if len(podsForUpdate) > 0 {
+			order.markPending(vpa)
+		}
+		if u.reportOnly {
+			continue
+		}
+		if !order.canUpdate(vpa) {
+			klog.V(3).Infof("deferring updates of VPA %v, VPAs it is updated after still have pods to update", vpa.Name)
+			continue
+		}
 		evictionLimiter := u.evictionFactory.NewPodsEvictionRestriction(livePods, vpa)
-		podsForUpdate := u.getPodsUpdateOrder(filterNonEvictablePods(livePods, evictionLimiter), vpa)
+		inPlace := u.podResizer != nil && vpa_api_util.GetUpdateMode(vpa) == vpa_types.UpdateModeInPlaceOrRecreate
+		// In-place resizes don't disrupt pods, so they are not limited by
+		// eviction restrictions. Evictions falling back from them still are.
+		if !inPlace {
+			podsForUpdate = filterNonEvictablePods(podsForUpdate, evictionLimiter)
+		}
 		evictablePodsCounter.Add(vpaSize, len(podsForUpdate))
 
 		withEvictable := false
 		withEvicted := false
+		var updatedPod *apiv1.Pod
 		for _, pod := range podsForUpdate {
 			withEvictable = true
+			if inPlace && !inplace.IsResizeInfeasible(pod) {
+				if inplace.IsResizePending(pod) {
+					klog.V(3).Infof("skipping pod %v, its previous in-place resize is still pending", pod.Name)
+					continue
+				}
+				if !u.isUpdateAuthorized(ctx, vpa, pod, authorizer.ActionResizeInPlace) {
+					continue
+				}
+				err := u.evictionRateLimiter.Wait(ctx)
+				if err != nil {
+					klog.Warningf("resizing pod %v failed: %v", pod.Name, err)
+					return
+				}
+				klog.V(2).Infof("resizing pod %v in place", pod.Name)
+				resizeErr := u.podResizer.Resize(pod, vpa, u.eventRecorder)
+				if resizeErr == nil {
+					updatedPod = pod
+					metrics_updater.AddInPlaceUpdatedPod(vpaSize)
+					continue
+				}
+				klog.Warningf("resizing pod %v in place failed, falling back to eviction: %v", pod.Name, resizeErr)
+			}
+			if inPlace {
+				metrics_updater.AddInPlaceUpdateFallback(vpaSize)
+			}
 			if !evictionLimiter.CanEvict(pod) {
 				continue
 			}
+			if !inFlight.canEvict(vpa) {
+				klog.V(3).Infof("skipping pod %v, too many evictions in flight in namespace %v or for VPA %v", pod.Name, vpa.Namespace, vpa.Name)
+				continue
+			}
+			if !disruption.canEvict(vpa, pod) {
+				klog.V(3).Infof("deferring eviction of pod %v, it would exceed the disruption time budget of VPA %v in this loop", pod.Name, vpa.Name)
+				continue
+			}
+			if !u.isUpdateAuthorized(ctx, vpa, pod, authorizer.ActionEvict) {
+				continue
+			}
 			err := u.evictionRateLimiter.Wait(ctx)
 			if err != nil {
 				klog.Warningf("evicting pod %v failed: %v", pod.Name, err)
@@ -218,7 +343,12 @@ func (u *updater) RunOnce(ctx context.Context) {
 				klog.Warningf("evicting pod %v failed: %v", pod.Name, evictErr)
 			} else {
 				withEvicted = true
+				updatedPod = pod
 				metrics_updater.AddEvictedPod(vpaSize)
+				inFlight.add(vpa)
+				disruption.add(vpa, pod)
+				u.eventRecorder.Eventf(vpa, apiv1.EventTypeNormal, "EvictedPod",
+					"VPA Updater evicted pod %s to apply resource recommendation.", pod.Name)
 			}
 		}
 
@@ -228,10 +358,64 @@ func (u *updater) RunOnce(ctx context.Context) {
 		if withEvicted {
 			vpasWithEvictedPodsCounter.Add(vpaSize, 1)
 		}
+		if updatedPod != nil {
+			u.annotateTarget(vpa, updatedPod)
+		}
 	}
 	timer.ObserveStep("EvictPods")
 }
 
+// annotateTarget annotates the target of the VPA, if enabled, with the
+// recommendation applied to the pod, which pods of the same workload share.
+func (u *updater) annotateTarget(vpa *vpa_types.VerticalPodAutoscaler, pod *apiv1.Pod) {
+	if u.targetAnnotator == nil {
+		return
+	}
+	recommendation, _, err := u.recommendationProcessor.Apply(vpa.Status.Recommendation, vpa.Spec.ResourcePolicy, vpa.Status.Conditions, pod)
+	if err == nil {
+		err = u.targetAnnotator.Annotate(vpa, recommendation, time.Now())
+	}
+	if err != nil {
+		klog.Warningf("annotating target of VPA %v/%v with applied recommendation failed: %v", vpa.Namespace, vpa.Name, err)
+	}
+}
+
+// notAuthorizedEventReasons are the reasons of the events recorded on VPAs
+// whose updates of pods are not authorized, by action.
+var notAuthorizedEventReasons = map[authorizer.Action]string{
+	authorizer.ActionEvict:         "EvictionNotAuthorized",
+	authorizer.ActionResizeInPlace: "ResizeNotAuthorized",
+}
+
+// isUpdateAuthorized asks the authorizer, if any, whether the recommendation
+// of the VPA may be applied to the pod with the action. Updates are not
+// authorized if the authorizer fails. Denials are recorded as an event on the
+// VPA when the webhook makes them, not when they are reused from the cache.
+func (u *updater) isUpdateAuthorized(ctx context.Context, vpa *vpa_types.VerticalPodAutoscaler, pod *apiv1.Pod, action authorizer.Action) bool {
+	if u.authorizer == nil {
+		return true
+	}
+	recommendation, _, err := u.recommendationProcessor.Apply(vpa.Status.Recommendation, vpa.Spec.ResourcePolicy, vpa.Status.Conditions, pod)
+	if err != nil {
+		klog.Warningf("skipping pod %v, cannot process the recommendation of VPA %v: %v", pod.Name, vpa.Name, err)
+		return false
+	}
+	decision, err := u.authorizer.Authorize(ctx, vpa, pod, recommendation, action, time.Now())
+	if err != nil {
+		klog.Warningf("skipping pod %v, authorizing %s failed: %v", pod.Name, action, err)
+		return false
+	}
+	if !decision.Allowed {
+		klog.V(2).Infof("skipping pod %v, %s was not authorized: %s", pod.Name, action, decision.Reason)
+		if !decision.Cached {
+			u.eventRecorder.Eventf(vpa, apiv1.EventTypeNormal, notAuthorizedEventReasons[action],
+				"%s of pod %s to apply resource recommendation was not authorized: %s", action, pod.Name, decision.Reason)
+		}
+		return false
+	}
+	return true
+}
+
 func getRateLimiter(evictionRateLimit float64, evictionRateLimitBurst int) *rate.Limiter {
 	var evictionRateLimiter *rate.Limiter
 	if evictionRateLimit <= 0 {
@@ -270,18 +454,68 @@ func filterNonEvictablePods(pods []*apiv1.Pod, evictionRestriciton eviction.Pods
 	return result
 }
 
+// filterDeletedPods drops pods which are terminating or not scheduled yet.
+// The latter are listed to count them as evictions in flight, but there's
+// nothing to update on them.
 func filterDeletedPods(pods []*apiv1.Pod) []*apiv1.Pod {
 	result := make([]*apiv1.Pod, 0)
 	for _, pod := range pods {
-		if pod.DeletionTimestamp == nil {
+		if pod.DeletionTimestamp == nil && pod.Spec.NodeName != "" {
 			result = append(result, pod)
 		}
 	}
 	return result
 }
 
+// filterPodsOnDrainingNodes drops pods whose node is cordoned or being
+// drained. They are going to be recreated anyway, updating them first would
+// only restart them twice.
+func (u *updater) filterPodsOnDrainingNodes(pods []*apiv1.Pod, vpaSize int) []*apiv1.Pod {
+	if u.nodeLister == nil {
+		return pods
+	}
+	result := make([]*apiv1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		node, err := u.nodeLister.Get(pod.Spec.NodeName)
+		if err == nil && isNodeDraining(node) {
+			klog.V(3).Infof("skipping pod %v, its node %v is cordoned or being drained", pod.Name, node.Name)
+			metrics_updater.AddSkippedOnDrainingNode(vpaSize)
+			continue
+		}
+		result = append(result, pod)
+	}
+	return result
+}
+
+// isNodeDraining returns true if the node is cordoned, e.g. by kubectl drain,
+// or tainted for deletion by Cluster Autoscaler.
+func isNodeDraining(node *apiv1.Node) bool {
+	if node.Spec.Unschedulable {
+		return true
+	}
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == toBeDeletedTaint || taint.Key == apiv1.TaintNodeUnschedulable {
+			return true
+		}
+	}
+	return false
+}
+
+func newNodeLister(kubeClient kube_client.Interface) v1lister.NodeLister {
+	nodeListWatch := cache.NewListWatchFromClient(kubeClient.CoreV1().RESTClient(), "nodes", apiv1.NamespaceAll, fields.Everything())
+	store := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	nodeLister := v1lister.NewNodeLister(store)
+	nodeReflector := cache.NewReflector(nodeListWatch, &apiv1.Node{}, store, time.Hour)
+	stopCh := make(chan struct{})
+	go nodeReflector.Run(stopCh)
+
+	return nodeLister
+}
+
+// newPodLister lists the pods which haven't finished, including unscheduled
+// ones, e.g. pending replacements of evicted pods.
 func newPodLister(kubeClient kube_client.Interface, namespace string) v1lister.PodLister {
-	selector := fields.ParseSelectorOrDie("spec.nodeName!=" + "" + ",status.phase!=" +
+	selector := fields.ParseSelectorOrDie("status.phase!=" +
 		string(apiv1.PodSucceeded) + ",status.phase!=" + string(apiv1.PodFailed))
 	podListWatch := cache.NewListWatchFromClient(kubeClient.CoreV1().RESTClient(), "pods", namespace, selector)
 	store := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
@@ -299,5 +533,9 @@ func newEventRecorder(kubeClient kube_client.Interface) record.EventRecorder {
 	if _, isFake := kubeClient.(*fake.Clientset); !isFake {
 		eventBroadcaster.StartRecordingToSink(&clientv1.EventSinkImpl{Interface: clientv1.New(kubeClient.CoreV1().RESTClient()).Events("")})
 	}
-	return eventBroadcaster.NewRecorder(scheme.Scheme, apiv1.EventSource{Component: "vpa-updater"})
+	// Events are recorded for pods and VPAs.
+	eventScheme := runtime.NewScheme()
+	utilruntime.Must(scheme.AddToScheme(eventScheme))
+	utilruntime.Must(vpa_scheme.AddToScheme(eventScheme))
+	return eventBroadcaster.NewRecorder(eventScheme, apiv1.EventSource{Component: "vpa-updater"})
 }
@@ -18,6 +18,7 @@ package logic
 
 import (
 	"context"
+	"fmt"
 	"strconv"
 	"testing"
 	"time"
@@ -26,15 +27,23 @@ import (
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	apiv1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
 	target_mock "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/target/mock"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/updater/authorizer"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/updater/eviction"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/updater/inplace"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/updater/priority"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/limitrange"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/status"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/test"
+	vpa_api_util "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/vpa"
+	v1lister "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 )
 
 func parseLabelSelector(selector string) labels.Selector {
@@ -77,6 +86,8 @@ func TestRunOnce_Mode(t *testing.T) {
 				newFakeValidator(true),
 				tc.expectFetchCalls,
 				tc.expectedEvictionCount,
+				nil,
+				false,
 			)
 		})
 	}
@@ -110,6 +121,8 @@ func TestRunOnce_Status(t *testing.T) {
 				tc.statusValidator,
 				tc.expectFetchCalls,
 				tc.expectedEvictionCount,
+				nil,
+				false,
 			)
 		})
 	}
@@ -121,6 +134,8 @@ func testRunOnceBase(
 	statusValidator status.Validator,
 	expectFetchCalls bool,
 	expectedEvictionCount int,
+	podResizer inplace.PodResizer,
+	reportOnly bool,
 ) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -149,8 +164,9 @@ func testRunOnceBase(
 			Get()
 
 		pods[i].Labels = labels
+		pods[i].Spec.NodeName = "node"
 		eviction.On("CanEvict", pods[i]).Return(true)
-		eviction.On("Evict", pods[i], nil).Return(nil)
+		eviction.On("Evict", pods[i], mock.Anything).Return(nil)
 	}
 
 	factory := &fakeEvictFactory{eviction}
@@ -169,10 +185,12 @@ func testRunOnceBase(
 	vpaLister.On("List").Return([]*vpa_types.VerticalPodAutoscaler{vpaObj}, nil).Once()
 
 	mockSelectorFetcher := target_mock.NewMockVpaTargetSelectorFetcher(ctrl)
+	eventRecorder := record.NewFakeRecorder(livePods)
 
 	updater := &updater{
 		vpaLister:                    vpaLister,
 		podLister:                    podLister,
+		eventRecorder:                eventRecorder,
 		evictionFactory:              factory,
 		evictionRateLimiter:          rate.NewLimiter(rate.Inf, 0),
 		recommendationProcessor:      &test.FakeRecommendationProcessor{},
@@ -180,6 +198,8 @@ func testRunOnceBase(
 		useAdmissionControllerStatus: true,
 		statusValidator:              statusValidator,
 		priorityProcessor:            priority.NewProcessor(),
+		podResizer:                   podResizer,
+		reportOnly:                   reportOnly,
 	}
 
 	if expectFetchCalls {
@@ -187,6 +207,40 @@ func testRunOnceBase(
 	}
 	updater.RunOnce(context.Background())
 	eviction.AssertNumberOfCalls(t, "Evict", expectedEvictionCount)
+	// An event is recorded for the VPA on every eviction.
+	assert.Len(t, eventRecorder.Events, expectedEvictionCount)
+}
+
+func TestRunOnce_InPlace(t *testing.T) {
+	resizer := &fakePodResizer{
+		failingPods: map[string]bool{"test_3": true, "test_4": true},
+		resized:     map[string]bool{},
+	}
+	testRunOnceBase(
+		t,
+		vpa_types.UpdateModeInPlaceOrRecreate,
+		newFakeValidator(true),
+		true,
+		2,
+		resizer,
+		false,
+	)
+	assert.Equal(t, map[string]bool{"test_0": true, "test_1": true, "test_2": true}, resizer.resized)
+}
+
+func TestRunOnce_ReportOnly(t *testing.T) {
+	resizer := &fakePodResizer{resized: map[string]bool{}}
+	// Pods pending an update are neither evicted nor resized.
+	testRunOnceBase(
+		t,
+		vpa_types.UpdateModeInPlaceOrRecreate,
+		newFakeValidator(true),
+		true,
+		0,
+		resizer,
+		true,
+	)
+	assert.Empty(t, resizer.resized)
 }
 
 func TestRunOnceNotingToProcess(t *testing.T) {
@@ -208,6 +262,133 @@ func TestRunOnceNotingToProcess(t *testing.T) {
 	updater.RunOnce(context.Background())
 }
 
+func TestRunOnceObservationGracePeriod(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	vpaObj := test.VerticalPodAutoscaler().
+		WithContainer("container1").
+		WithTarget("2", "200M").
+		WithCreationTimestamp(time.Now()).
+		Get()
+	vpaObj.Spec.UpdatePolicy = &vpa_types.PodUpdatePolicy{ObservationGracePeriod: &metav1.Duration{Duration: time.Hour}}
+	vpaLister := &test.VerticalPodAutoscalerListerMock{}
+	vpaLister.On("List").Return([]*vpa_types.VerticalPodAutoscaler{vpaObj}, nil).Once()
+	podLister := &test.PodListerMock{}
+
+	// The VPA is skipped, neither its selector is fetched nor pods are listed.
+	updater := &updater{
+		vpaLister:                    vpaLister,
+		podLister:                    podLister,
+		evictionRateLimiter:          rate.NewLimiter(rate.Inf, 0),
+		recommendationProcessor:      &test.FakeRecommendationProcessor{},
+		selectorFetcher:              target_mock.NewMockVpaTargetSelectorFetcher(ctrl),
+		useAdmissionControllerStatus: true,
+		statusValidator:              newFakeValidator(true),
+	}
+	updater.RunOnce(context.Background())
+	podLister.AssertNotCalled(t, "List")
+}
+
+func TestFilterDeletedPods(t *testing.T) {
+	scheduled := test.Pod().WithName("scheduled").Get()
+	scheduled.Spec.NodeName = "node"
+	terminating := test.Pod().WithName("terminating").Get()
+	terminating.Spec.NodeName = "node"
+	terminating.DeletionTimestamp = &metav1.Time{}
+	unscheduled := test.Pod().WithName("unscheduled").WithPhase(apiv1.PodPending).Get()
+
+	assert.Equal(t, []*apiv1.Pod{scheduled}, filterDeletedPods([]*apiv1.Pod{scheduled, terminating, unscheduled}))
+}
+
+func TestFilterPodsOnDrainingNodes(t *testing.T) {
+	nodes := []*apiv1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "ready"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "cordoned"}, Spec: apiv1.NodeSpec{Unschedulable: true}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "scaled-down"}, Spec: apiv1.NodeSpec{
+			Taints: []apiv1.Taint{{Key: toBeDeletedTaint, Effect: apiv1.TaintEffectNoSchedule}},
+		}},
+	}
+	store := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, node := range nodes {
+		assert.NoError(t, store.Add(node))
+	}
+	pods := []*apiv1.Pod{}
+	for _, nodeName := range []string{"ready", "cordoned", "scaled-down", "unknown"} {
+		pod := test.Pod().WithName("pod-on-" + nodeName).Get()
+		pod.Spec.NodeName = nodeName
+		pods = append(pods, pod)
+	}
+
+	u := &updater{nodeLister: v1lister.NewNodeLister(store)}
+	assert.Equal(t, []*apiv1.Pod{pods[0], pods[3]}, u.filterPodsOnDrainingNodes(pods, len(pods)))
+
+	u = &updater{}
+	assert.Equal(t, pods, u.filterPodsOnDrainingNodes(pods, len(pods)))
+}
+
+func TestIsUpdateAuthorized(t *testing.T) {
+	recreateMode := vpa_types.UpdateModeRecreate
+	vpaObj := test.VerticalPodAutoscaler().WithContainer("container1").WithTarget("2", "200M").Get()
+	vpaObj.Spec.UpdatePolicy = &vpa_types.PodUpdatePolicy{UpdateMode: &recreateMode}
+	pod := test.Pod().WithName("test_pod").Get()
+	eventRecorder := record.NewFakeRecorder(2)
+	u := &updater{
+		eventRecorder:           eventRecorder,
+		recommendationProcessor: &test.FakeRecommendationProcessor{},
+	}
+	assert.True(t, u.isUpdateAuthorized(context.Background(), vpaObj, pod, authorizer.ActionEvict))
+
+	fake := &fakeAuthorizer{decision: authorizer.Decision{Response: authorizer.Response{Allowed: true}}}
+	u.authorizer = fake
+	assert.True(t, u.isUpdateAuthorized(context.Background(), vpaObj, pod, authorizer.ActionEvict))
+	assert.Equal(t, []authorizer.Action{authorizer.ActionEvict}, fake.actions)
+
+	fake.decision = authorizer.Decision{Response: authorizer.Response{Reason: "change freeze"}}
+	assert.False(t, u.isUpdateAuthorized(context.Background(), vpaObj, pod, authorizer.ActionResizeInPlace))
+	assert.Equal(t, authorizer.ActionResizeInPlace, fake.actions[1])
+	assert.Len(t, eventRecorder.Events, 1)
+	assert.Contains(t, <-eventRecorder.Events, "ResizeNotAuthorized")
+
+	// Denials reused from the cache are not recorded again.
+	fake.decision.Cached = true
+	assert.False(t, u.isUpdateAuthorized(context.Background(), vpaObj, pod, authorizer.ActionEvict))
+	assert.Len(t, eventRecorder.Events, 0)
+
+	fake.err = fmt.Errorf("unavailable")
+	assert.False(t, u.isUpdateAuthorized(context.Background(), vpaObj, pod, authorizer.ActionEvict))
+}
+
+type fakeTargetAnnotator struct {
+	recommendation *vpa_types.RecommendedPodResources
+}
+
+func (a *fakeTargetAnnotator) Annotate(vpa *vpa_types.VerticalPodAutoscaler, recommendation *vpa_types.RecommendedPodResources, now time.Time) error {
+	a.recommendation = recommendation
+	return nil
+}
+
+func TestAnnotateTarget(t *testing.T) {
+	vpaObj := test.VerticalPodAutoscaler().
+		WithContainer("container1").
+		WithTarget("2", "200M").
+		WithMaxAllowed("1", "1G").
+		Get()
+	pod := test.Pod().WithName("test_pod").AddContainer(test.BuildTestContainer("container1", "1", "100M")).Get()
+	annotator := &fakeTargetAnnotator{}
+	u := &updater{
+		recommendationProcessor: vpa_api_util.NewCappingRecommendationProcessor(limitrange.NewNoopLimitsCalculator()),
+		targetAnnotator:         annotator,
+	}
+
+	u.annotateTarget(vpaObj, pod)
+	// The target is annotated as applied, capped to the resource policy.
+	if assert.NotNil(t, annotator.recommendation) && assert.Len(t, annotator.recommendation.ContainerRecommendations, 1) {
+		cpu := annotator.recommendation.ContainerRecommendations[0].Target[apiv1.ResourceCPU]
+		assert.Equal(t, "1", cpu.String())
+	}
+}
+
 func TestGetRateLimiter(t *testing.T) {
 	cases := []struct {
 		rateLimit       float64
@@ -233,6 +414,19 @@ func (f fakeEvictFactory) NewPodsEvictionRestriction(pods []*apiv1.Pod, vpa *vpa
 	return f.evict
 }
 
+type fakePodResizer struct {
+	failingPods map[string]bool
+	resized     map[string]bool
+}
+
+func (f *fakePodResizer) Resize(pod *apiv1.Pod, vpa *vpa_types.VerticalPodAutoscaler, eventRecorder record.EventRecorder) error {
+	if f.failingPods[pod.Name] {
+		return fmt.Errorf("resize of %s rejected", pod.Name)
+	}
+	f.resized[pod.Name] = true
+	return nil
+}
+
 type fakeValidator struct {
 	isValid bool
 }
@@ -244,3 +438,14 @@ func newFakeValidator(isValid bool) status.Validator {
 func (f *fakeValidator) IsStatusValid(statusTimeout time.Duration) (bool, error) {
 	return f.isValid, nil
 }
+
+type fakeAuthorizer struct {
+	decision authorizer.Decision
+	err      error
+	actions  []authorizer.Action
+}
+
+func (f *fakeAuthorizer) Authorize(ctx context.Context, vpa *vpa_types.VerticalPodAutoscaler, pod *apiv1.Pod, recommendation *vpa_types.RecommendedPodResources, action authorizer.Action, now time.Time) (authorizer.Decision, error) {
+	f.actions = append(f.actions, action)
+	return f.decision, f.err
+}
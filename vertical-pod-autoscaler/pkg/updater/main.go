@@ -23,11 +23,17 @@ import (
 	"time"
 
 	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/common"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/admission-controller/resource/pod/recommendation"
 	vpa_clientset "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/client/clientset/versioned"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/target"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/updater/applied"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/updater/authorizer"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/updater/inplace"
 	updater "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/updater/logic"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/updater/priority"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/leaderelection"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/limitrange"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/metrics"
 	metrics_updater "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/metrics/updater"
@@ -49,6 +55,12 @@ var (
 	evictionToleranceFraction = flag.Float64("eviction-tolerance", 0.5,
 		`Fraction of replica count that can be evicted for update, if more than one pod can be evicted.`)
 
+	evictionMaxUnavailable = flag.String("eviction-max-unavailable", "",
+		`Maximal number or percentage (e.g. "10%") of replicas of a single workload which can be unavailable
+		at the same time because of evictions. Calculated from the configured replica count, rounded down but at least one.
+		Pods are not evicted while that many replicas are not ready or terminating. If set, replaces --min-replicas
+		and --eviction-tolerance. Empty disables the limit.`)
+
 	evictionRateLimit = flag.Float64("eviction-rate-limit", -1,
 		`Number of pods that can be evicted per seconds. A rate limit set to 0 or -1 will disable
 		the rate limiter.`)
@@ -60,26 +72,88 @@ var (
 	kubeApiQps   = flag.Float64("kube-api-qps", 5.0, `QPS limit when making requests to Kubernetes apiserver`)
 	kubeApiBurst = flag.Float64("kube-api-burst", 10.0, `QPS burst limit when making requests to Kubernetes apiserver`)
 
+	metricsCertFile       = flag.String("metrics-tls-cert-file", "", `Path to the certificate PEM file metrics are served with over HTTPS at --address. Empty serves plain HTTP`)
+	metricsKeyFile        = flag.String("metrics-tls-private-key", "", `Path to the key PEM file of --metrics-tls-cert-file`)
+	metricsReloadInterval = flag.Duration("metrics-tls-reload-interval", time.Minute, `How often --metrics-tls-cert-file and --metrics-tls-private-key are reloaded, to pick up rotated certificates`)
+	metricsAuthentication = flag.Bool("metrics-authentication", false, `If true, clients of --address must authenticate with a bearer token, reviewed with a TokenReview, and be allowed to get the requested path, e.g. /metrics, by RBAC. Health checks are exempt`)
+	healthAddress         = flag.String("health-address", "", `Address to serve /healthz and /readyz at, separately from --address. Empty serves them at --address`)
+
 	useAdmissionControllerStatus = flag.Bool("use-admission-controller-status", true,
 		"If true, updater will only evict pods when admission controller status is valid.")
 
+	skipDrainingNodes = flag.Bool("skip-pods-on-draining-nodes", true,
+		"If true, updater will not update pods running on nodes which are cordoned or being drained, e.g. by Cluster Autoscaler, as they will be recreated anyway.")
+
+	maxInFlightPerNamespace = flag.Int("max-in-flight-evictions-per-namespace", 0,
+		`Maximal number of pods of VPAs in a namespace which can be evicted and not running again yet, i.e. terminating or pending. 0 disables the limit.`)
+
+	maxInFlightPerVpa = flag.Int("max-in-flight-evictions-per-vpa", 0,
+		`Maximal number of pods of a VPA which can be evicted and not running again yet, i.e. terminating or pending. 0 disables the limit.`)
+
+	maxDisruptionPerVpa = flag.Duration("max-disruption-time-per-vpa", 0,
+		`Maximal sum of the termination grace periods of the pods of a VPA evicted in one updater loop and the grace time left to its pods still terminating. Further evictions are deferred to the next loops, but a pod is evicted whenever no pod of the VPA is terminating. 0 disables the limit.`)
+
+	annotateTargets = flag.Bool("annotate-targets", false,
+		`If true, updater will annotate the target Deployment, StatefulSet, DaemonSet or ReplicaSet of a VPA with the recommendation it applied to its pods and when.`)
+
+	cappedRecommendationThreshold = flag.Duration("capped-recommendation-threshold", 0,
+		`How long the uncapped recommendation of a VPA has to exceed maxAllowed of its resource policy before the VPA gets the RecommendationCapped condition and a warning event. 0 disables the reporting.`)
+
+	authorizerWebhookURL      = flag.String("authorizer-webhook-url", "", `URL of a webhook which authorizes evictions and in-place resizes of pods of VPAs in Auto, Recreate and InPlaceOrRecreate modes, e.g. by a change management system. Empty disables the authorization.`)
+	authorizerWebhookCAFile   = flag.String("authorizer-webhook-ca-file", "", `Path to the CA PEM file verifying the certificate of --authorizer-webhook-url. Empty uses the system roots.`)
+	authorizerWebhookTimeout  = flag.Duration("authorizer-webhook-timeout", 10*time.Second, `Timeout of requests to --authorizer-webhook-url.`)
+	authorizerWebhookCacheTTL = flag.Duration("authorizer-webhook-cache-ttl", 5*time.Minute, `How long decisions of --authorizer-webhook-url are reused for the same changes of a VPA.`)
+
+	reportOnly = flag.Bool("report-only", false,
+		`If true, updater only reports the pods pending an update and the change of requests updating them would make, as metrics and logs, without evicting or resizing any pod.`)
+
+	leaderElect                  = flag.Bool("leader-elect", false, `Start a leader election client and gain leadership before running the updater loop. Allows running standby replicas`)
+	leaderElectLeaseDuration     = flag.Duration("leader-elect-lease-duration", leaderelection.DefaultLeaseDuration, `Duration that standby replicas wait before trying to acquire a lease which wasn't renewed`)
+	leaderElectRenewDeadline     = flag.Duration("leader-elect-renew-deadline", leaderelection.DefaultRenewDeadline, `Duration that the leader retries renewing the lease before giving it up`)
+	leaderElectRetryPeriod       = flag.Duration("leader-elect-retry-period", leaderelection.DefaultRetryPeriod, `Duration between attempts to acquire or renew the lease`)
+	leaderElectResourceName      = flag.String("leader-elect-resource-name", "vpa-updater", `Name of the Lease object used for leader election`)
+	leaderElectResourceNamespace = flag.String("leader-elect-resource-namespace", "kube-system", `Namespace of the Lease object used for leader election`)
+
 	namespace          = os.Getenv("NAMESPACE")
-	vpaObjectNamespace = flag.String("vpa-object-namespace", apiv1.NamespaceAll, "Namespace to search for VPA objects. Empty means all namespaces will be used.")
+	vpaObjectNamespace = flag.String("vpa-object-namespace", apiv1.NamespaceAll, "Comma separated list of namespaces to search for VPA objects. Empty means all namespaces will be used.")
+
+	ignoredVpaObjectNamespaces = flag.String("ignored-vpa-object-namespaces", "", "Comma separated list of namespaces whose VPA objects are ignored.")
+	vpaObjectLabels            = flag.String("vpa-object-labels", "", "Label selector of the VPA objects to process, e.g. tenant=a. Empty means all VPA objects will be processed.")
+)
+
+var (
+	aggregationLabel = flag.String("aggregation-container-name-label", "", `Pod label holding the stable container name under which the recommender aggregates usage of containers whose names start with the label value, see --aggregation-container-name-label of the recommender. Recommendations published under the label value are applied to these containers. Empty matches recommendations by container name`)
 )
 
 const defaultResyncPeriod time.Duration = 10 * time.Minute
 
+func metricsServerConfig(kubeClient kube_client.Interface) metrics.ServerConfig {
+	config := metrics.ServerConfig{
+		Address:            *address,
+		HealthAddress:      *healthAddress,
+		CertFile:           *metricsCertFile,
+		KeyFile:            *metricsKeyFile,
+		CertReloadInterval: *metricsReloadInterval,
+	}
+	if *metricsAuthentication {
+		config.KubeClient = kubeClient
+	}
+	return config
+}
+
 func main() {
 	klog.InitFlags(nil)
 	kube_flag.InitFlags()
 	klog.V(1).Infof("Vertical Pod Autoscaler %s Updater", common.VerticalPodAutoscalerVersion)
 
-	healthCheck := metrics.NewHealthCheck(*updaterInterval*5, true)
-	metrics.Initialize(*address, healthCheck)
-	metrics_updater.Register()
+	// Activity is only checked once this replica runs the updater loop.
+	healthCheck := metrics.NewHealthCheck(*updaterInterval*5, false)
+	readinessCheck := metrics.NewReadinessCheck()
 
 	config := common.CreateKubeConfigOrDie(*kubeconfig, float32(*kubeApiQps), int(*kubeApiBurst))
 	kubeClient := kube_client.NewForConfigOrDie(config)
+	metrics.Serve(metricsServerConfig(kubeClient), healthCheck, readinessCheck)
+	metrics_updater.Register()
 	vpaClient := vpa_clientset.NewForConfigOrDie(config)
 	factory := informers.NewSharedInformerFactory(kubeClient, defaultResyncPeriod)
 	targetSelectorFetcher := target.NewVpaTargetSelectorFetcher(config, kubeClient, factory)
@@ -89,10 +163,44 @@ func main() {
 		klog.Errorf("Failed to create limitRangeCalculator, falling back to not checking limits. Error message: %s", err)
 		limitRangeCalculator = limitrange.NewNoopLimitsCalculator()
 	}
+	var maxUnavailable *intstr.IntOrString
+	if *evictionMaxUnavailable != "" {
+		value := intstr.Parse(*evictionMaxUnavailable)
+		if _, err := intstr.GetScaledValueFromIntOrPercent(&value, 100, false); err != nil {
+			klog.Fatalf("Invalid --eviction-max-unavailable: %v", err)
+		}
+		maxUnavailable = &value
+	}
 	admissionControllerStatusNamespace := status.AdmissionControllerStatusNamespace
 	if namespace != "" {
 		admissionControllerStatusNamespace = namespace
 	}
+	recommendationProcessor := vpa_api_util.NewCappingRecommendationProcessor(limitRangeCalculator)
+	if *aggregationLabel != "" {
+		recommendationProcessor = vpa_api_util.NewSequentialProcessor([]vpa_api_util.RecommendationProcessor{
+			vpa_api_util.NewAggregatedContainerProcessor(*aggregationLabel), recommendationProcessor})
+	}
+	podResizer := inplace.NewPodResizer(kubeClient, recommendation.NewProvider(limitRangeCalculator, recommendationProcessor))
+	vpaObjectFilter, err := vpa_api_util.NewVpaObjectFilter(*vpaObjectNamespace, *ignoredVpaObjectNamespaces, *vpaObjectLabels)
+	if err != nil {
+		klog.Fatalf("Invalid --vpa-object-labels: %v", err)
+	}
+	var targetAnnotator applied.TargetAnnotator
+	if *annotateTargets {
+		targetAnnotator = applied.NewTargetAnnotator(kubeClient)
+	}
+	var evictionAuthorizer authorizer.Authorizer
+	if *authorizerWebhookURL != "" {
+		evictionAuthorizer, err = authorizer.NewWebhookAuthorizer(authorizer.WebhookConfig{
+			URL:      *authorizerWebhookURL,
+			CAFile:   *authorizerWebhookCAFile,
+			Timeout:  *authorizerWebhookTimeout,
+			CacheTTL: *authorizerWebhookCacheTTL,
+		})
+		if err != nil {
+			klog.Fatalf("Failed to create authorizer: %v", err)
+		}
+	}
 	// TODO: use SharedInformerFactory in updater
 	updater, err := updater.NewUpdater(
 		kubeClient,
@@ -101,22 +209,48 @@ func main() {
 		*evictionRateLimit,
 		*evictionRateBurst,
 		*evictionToleranceFraction,
+		maxUnavailable,
 		*useAdmissionControllerStatus,
 		admissionControllerStatusNamespace,
-		vpa_api_util.NewCappingRecommendationProcessor(limitRangeCalculator),
+		recommendationProcessor,
 		nil,
 		targetSelectorFetcher,
 		priority.NewProcessor(),
-		*vpaObjectNamespace,
+		podResizer,
+		vpaObjectFilter,
+		*skipDrainingNodes,
+		*maxInFlightPerNamespace,
+		*maxInFlightPerVpa,
+		*maxDisruptionPerVpa,
+		targetAnnotator,
+		*cappedRecommendationThreshold,
+		evictionAuthorizer,
+		*reportOnly,
 	)
 	if err != nil {
 		klog.Fatalf("Failed to create updater: %v", err)
 	}
-	ticker := time.Tick(*updaterInterval)
-	for range ticker {
-		ctx, cancel := context.WithTimeout(context.Background(), *updaterInterval)
-		updater.RunOnce(ctx)
-		healthCheck.UpdateLastActivity()
-		cancel()
+	leaderElection := leaderelection.Config{
+		Enabled:           *leaderElect,
+		ResourceName:      *leaderElectResourceName,
+		ResourceNamespace: *leaderElectResourceNamespace,
+		LeaseDuration:     *leaderElectLeaseDuration,
+		RenewDeadline:     *leaderElectRenewDeadline,
+		RetryPeriod:       *leaderElectRetryPeriod,
+	}
+	// Standby replicas are ready too, to take over the leadership.
+	readinessCheck.MarkReady()
+	err = leaderelection.Run(context.Background(), kubeClient, leaderElection, func(leaderCtx context.Context) {
+		healthCheck.StartMonitoring()
+		ticker := time.Tick(*updaterInterval)
+		for range ticker {
+			ctx, cancel := context.WithTimeout(leaderCtx, *updaterInterval)
+			updater.RunOnce(ctx)
+			healthCheck.UpdateLastActivity()
+			cancel()
+		}
+	})
+	if err != nil {
+		klog.Fatalf("Leader election failed: %v", err)
 	}
 }
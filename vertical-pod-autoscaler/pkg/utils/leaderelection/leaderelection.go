@@ -0,0 +1,107 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package leaderelection
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/rand"
+	kube_client "k8s.io/client-go/kubernetes"
+	kube_leaderelection "k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// DefaultLeaseDuration is the default duration that non-leader replicas
+	// wait before trying to acquire a lease which wasn't renewed.
+	DefaultLeaseDuration = 15 * time.Second
+	// DefaultRenewDeadline is the default duration that the leader retries
+	// renewing the lease before giving it up.
+	DefaultRenewDeadline = 10 * time.Second
+	// DefaultRetryPeriod is the default duration between attempts to acquire
+	// or renew the lease.
+	DefaultRetryPeriod = 2 * time.Second
+)
+
+// Config configures leader election between replicas of a component.
+type Config struct {
+	// Enabled makes replicas compete for the lease, only its holder runs.
+	Enabled bool
+	// ResourceName and ResourceNamespace identify the Lease object.
+	ResourceName, ResourceNamespace string
+
+	// LeaseDuration, RenewDeadline and RetryPeriod are passed to the client-go
+	// leader elector.
+	LeaseDuration, RenewDeadline, RetryPeriod time.Duration
+}
+
+// Run calls run once this replica holds the lease, or right away if leader
+// election isn't enabled. Standby replicas block until they acquire the lease.
+// The process exits if the lease is lost before ctx is done, so that no two
+// replicas run at the same time.
+func Run(ctx context.Context, kubeClient kube_client.Interface, config Config, run func(ctx context.Context)) error {
+	if !config.Enabled {
+		run(ctx)
+		return nil
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("unable to get hostname: %v", err)
+	}
+	identity := hostname + "_" + rand.String(8)
+	lock, err := resourcelock.New(
+		resourcelock.LeasesResourceLock,
+		config.ResourceNamespace,
+		config.ResourceName,
+		kubeClient.CoreV1(),
+		kubeClient.CoordinationV1(),
+		resourcelock.ResourceLockConfig{Identity: identity},
+	)
+	if err != nil {
+		return fmt.Errorf("unable to create leader election lock: %v", err)
+	}
+	elector, err := kube_leaderelection.NewLeaderElector(kube_leaderelection.LeaderElectionConfig{
+		Lock:          lock,
+		LeaseDuration: config.LeaseDuration,
+		RenewDeadline: config.RenewDeadline,
+		RetryPeriod:   config.RetryPeriod,
+		Name:          config.ResourceName,
+		Callbacks: kube_leaderelection.LeaderCallbacks{
+			OnStartedLeading: run,
+			OnStoppedLeading: func() {
+				if ctx.Err() == nil {
+					klog.Fatalf("Lost leader lease %s/%s", config.ResourceNamespace, config.ResourceName)
+				}
+			},
+			OnNewLeader: func(leader string) {
+				if leader != identity {
+					klog.V(1).Infof("Leader lease %s/%s is held by %s, waiting on standby", config.ResourceNamespace, config.ResourceName, leader)
+				}
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to create leader elector: %v", err)
+	}
+	klog.V(1).Infof("Acquiring leader lease %s/%s as %s", config.ResourceNamespace, config.ResourceName, identity)
+	elector.Run(ctx)
+	return nil
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package leaderelection
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var testConfig = Config{
+	Enabled:           true,
+	ResourceName:      "vpa-recommender",
+	ResourceNamespace: "kube-system",
+	LeaseDuration:     time.Second,
+	RenewDeadline:     500 * time.Millisecond,
+	RetryPeriod:       100 * time.Millisecond,
+}
+
+func TestRunDisabled(t *testing.T) {
+	called := false
+	err := Run(context.Background(), fake.NewSimpleClientset(), Config{}, func(ctx context.Context) {
+		called = true
+	})
+	assert.NoError(t, err)
+	assert.True(t, called)
+}
+
+func TestRunAcquiresLease(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	started := make(chan struct{})
+	go func() {
+		err := Run(ctx, client, testConfig, func(ctx context.Context) {
+			close(started)
+			<-ctx.Done()
+		})
+		assert.NoError(t, err)
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(10 * time.Second):
+		t.Fatal("lease wasn't acquired")
+	}
+	lease, err := client.CoordinationV1().Leases("kube-system").Get(context.Background(), "vpa-recommender", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, *lease.Spec.HolderIdentity)
+}
+
+func TestRunStandby(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	leaderStarted := make(chan struct{})
+	go Run(ctx, client, testConfig, func(ctx context.Context) {
+		close(leaderStarted)
+		<-ctx.Done()
+	})
+	<-leaderStarted
+
+	standbyStarted := make(chan struct{})
+	go Run(ctx, client, testConfig, func(ctx context.Context) {
+		close(standbyStarted)
+	})
+	select {
+	case <-standbyStarted:
+		t.Fatal("standby replica shouldn't run while the lease is held")
+	case <-time.After(2 * testConfig.LeaseDuration):
+	}
+}
@@ -58,6 +58,8 @@ const (
 	Pod AdmissionResource = "Pod"
 	// Vpa means VerticalPodAutoscaler object (CRD)
 	Vpa AdmissionResource = "VPA"
+	// Workload means a Deployment or StatefulSet validated against its VPA
+	Workload AdmissionResource = "Workload"
 )
 
 var (
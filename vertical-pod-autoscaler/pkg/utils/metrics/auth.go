@@ -0,0 +1,151 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kube_client "k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// authCacheTTL is how long an allowed token is trusted for a path without
+// reviewing it again, so that every scrape doesn't hit the API server.
+const authCacheTTL = time.Minute
+
+type authKey struct {
+	token string
+	path  string
+}
+
+// authHandler serves requests of clients which authenticate with a bearer
+// token and are allowed to get the requested path, like kube-rbac-proxy does.
+type authHandler struct {
+	kubeClient  kube_client.Interface
+	handler     http.Handler
+	exemptPaths map[string]bool
+
+	mutex   sync.Mutex
+	allowed map[authKey]time.Time
+}
+
+func newAuthHandler(kubeClient kube_client.Interface, handler http.Handler, exemptPaths ...string) *authHandler {
+	exempt := make(map[string]bool, len(exemptPaths))
+	for _, path := range exemptPaths {
+		exempt[path] = true
+	}
+	return &authHandler{
+		kubeClient:  kubeClient,
+		handler:     handler,
+		exemptPaths: exempt,
+		allowed:     make(map[authKey]time.Time),
+	}
+}
+
+func (h *authHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.exemptPaths[r.URL.Path] {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" || token == r.Header.Get("Authorization") {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	key := authKey{token: token, path: r.URL.Path}
+	if !h.isCached(key) {
+		code, err := h.review(r.Context(), key)
+		if err != nil {
+			klog.Errorf("Cannot review access to %s: %v", r.URL.Path, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if code != http.StatusOK {
+			http.Error(w, http.StatusText(code), code)
+			return
+		}
+		h.cache(key)
+	}
+	h.handler.ServeHTTP(w, r)
+}
+
+// review authenticates the token with a TokenReview and authorizes its user
+// to get the path with a SubjectAccessReview. It returns http.StatusOK if
+// the request is allowed.
+func (h *authHandler) review(ctx context.Context, key authKey) (int, error) {
+	tokenReview, err := h.kubeClient.AuthenticationV1().TokenReviews().Create(ctx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: key.token},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return 0, err
+	}
+	if !tokenReview.Status.Authenticated {
+		return http.StatusUnauthorized, nil
+	}
+	user := tokenReview.Status.User
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for key, values := range user.Extra {
+		extra[key] = authorizationv1.ExtraValue(values)
+	}
+	accessReview, err := h.kubeClient.AuthorizationV1().SubjectAccessReviews().Create(ctx, &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			NonResourceAttributes: &authorizationv1.NonResourceAttributes{Path: key.path, Verb: "get"},
+			User:                  user.Username,
+			Groups:                user.Groups,
+			UID:                   user.UID,
+			Extra:                 extra,
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return 0, err
+	}
+	if !accessReview.Status.Allowed {
+		return http.StatusForbidden, nil
+	}
+	return http.StatusOK, nil
+}
+
+func (h *authHandler) isCached(key authKey) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	expiry, found := h.allowed[key]
+	if found && time.Now().After(expiry) {
+		delete(h.allowed, key)
+		return false
+	}
+	return found
+}
+
+func (h *authHandler) cache(key authKey) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	now := time.Now()
+	// Drop expired entries so tokens of past clients don't pile up.
+	for cachedKey, expiry := range h.allowed {
+		if now.After(expiry) {
+			delete(h.allowed, cachedKey)
+		}
+	}
+	h.allowed[key] = now.Add(authCacheTTL)
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
+)
+
+func newFakeAuthClient(reviews *int) *fake.Clientset {
+	client := &fake.Clientset{}
+	client.AddReactor("create", "tokenreviews", func(action core.Action) (bool, runtime.Object, error) {
+		*reviews++
+		review := action.(core.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		if review.Spec.Token == "valid" || review.Spec.Token == "forbidden" {
+			review.Status.Authenticated = true
+			review.Status.User.Username = review.Spec.Token
+		}
+		return true, review, nil
+	})
+	client.AddReactor("create", "subjectaccessreviews", func(action core.Action) (bool, runtime.Object, error) {
+		review := action.(core.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		review.Status.Allowed = review.Spec.User == "valid" && review.Spec.NonResourceAttributes.Path == "/metrics"
+		return true, review, nil
+	})
+	return client
+}
+
+func TestAuthHandler(t *testing.T) {
+	reviews := 0
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := newAuthHandler(newFakeAuthClient(&reviews), backend, healthzPath)
+
+	cases := []struct {
+		name          string
+		path          string
+		authorization string
+		expectedCode  int
+	}{
+		{name: "no token", path: "/metrics", expectedCode: http.StatusUnauthorized},
+		{name: "not a bearer token", path: "/metrics", authorization: "Basic valid", expectedCode: http.StatusUnauthorized},
+		{name: "invalid token", path: "/metrics", authorization: "Bearer invalid", expectedCode: http.StatusUnauthorized},
+		{name: "forbidden user", path: "/metrics", authorization: "Bearer forbidden", expectedCode: http.StatusForbidden},
+		{name: "forbidden path", path: "/debug/vars", authorization: "Bearer valid", expectedCode: http.StatusForbidden},
+		{name: "allowed", path: "/metrics", authorization: "Bearer valid", expectedCode: http.StatusOK},
+		{name: "exempt path", path: healthzPath, expectedCode: http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.authorization != "" {
+				request.Header.Set("Authorization", tc.authorization)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			assert.Equal(t, tc.expectedCode, recorder.Code)
+		})
+	}
+}
+
+func TestAuthHandlerCachesAllowedTokens(t *testing.T) {
+	reviews := 0
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := newAuthHandler(newFakeAuthClient(&reviews), backend)
+	for i := 0; i < 3; i++ {
+		request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		request.Header.Set("Authorization", "Bearer valid")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+	}
+	assert.Equal(t, 1, reviews)
+}
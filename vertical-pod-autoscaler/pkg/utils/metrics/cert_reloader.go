@@ -0,0 +1,75 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"crypto/tls"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// certFileReloader serves the certificate in a pair of files, reloading it
+// periodically so that rotated certificates are picked up without a restart.
+type certFileReloader struct {
+	certFile string
+	keyFile  string
+
+	mutex sync.RWMutex
+	cert  *tls.Certificate
+}
+
+func newCertFileReloader(certFile, keyFile string) (*certFileReloader, error) {
+	reloader := &certFileReloader{certFile: certFile, keyFile: keyFile}
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// reload loads the certificate from the files.
+func (r *certFileReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.cert = &cert
+	return nil
+}
+
+// run reloads the certificate every interval until stopCh is closed.
+func (r *certFileReloader) run(interval time.Duration, stopCh <-chan struct{}) {
+	if interval <= 0 {
+		return
+	}
+	wait.Until(func() {
+		if err := r.reload(); err != nil {
+			klog.Errorf("Cannot reload metrics server certificate: %v", err)
+		}
+	}, interval, stopCh)
+}
+
+// GetCertificate returns the current certificate, as tls.Config.GetCertificate.
+func (r *certFileReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.cert, nil
+}
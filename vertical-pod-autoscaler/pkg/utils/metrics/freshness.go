@@ -0,0 +1,154 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+)
+
+// SubsystemFreshness is the freshness of a subsystem of the monitored
+// component, as served by FreshnessCheck.
+type SubsystemFreshness struct {
+	Subsystem   string    `json:"subsystem"`
+	LastSuccess time.Time `json:"lastSuccess"`
+	// AgeSeconds is the time since LastSuccess.
+	AgeSeconds float64 `json:"ageSeconds"`
+	// MaxAgeSeconds is the age above which the subsystem is stale.
+	MaxAgeSeconds float64 `json:"maxAgeSeconds"`
+	Stale         bool    `json:"stale"`
+}
+
+// FreshnessCheck tracks when subsystems of the monitored component, e.g.
+// metrics ingestion, last succeeded, so that a stuck subsystem is detected
+// even while the main loop keeps running. Each subsystem is stale once its
+// last success is older than its own maximum age. It is a prometheus
+// Collector of the age and staleness of the subsystems.
+type FreshnessCheck struct {
+	maxAges     map[string]time.Duration
+	checkAge    bool
+	lastSuccess map[string]time.Time
+	mutex       *sync.Mutex
+	ageDesc     *prometheus.Desc
+	staleDesc   *prometheus.Desc
+}
+
+// NewFreshnessCheck builds a FreshnessCheck of the subsystems with the given
+// maximum ages, exporting metrics in the given namespace. Staleness is only
+// reported once StartMonitoring is called.
+func NewFreshnessCheck(metricsNamespace string, maxAges map[string]time.Duration) *FreshnessCheck {
+	now := time.Now()
+	lastSuccess := make(map[string]time.Time, len(maxAges))
+	for subsystem := range maxAges {
+		lastSuccess[subsystem] = now
+	}
+	return &FreshnessCheck{
+		maxAges:     maxAges,
+		lastSuccess: lastSuccess,
+		mutex:       &sync.Mutex{},
+		ageDesc: prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "", "subsystem_last_success_age_seconds"),
+			"Time since the subsystem last succeeded.", []string{"subsystem"}, nil),
+		staleDesc: prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "", "subsystem_stale"),
+			"1 if the subsystem last succeeded longer ago than its maximum age, 0 otherwise.", []string{"subsystem"}, nil),
+	}
+}
+
+// MarkFresh records a success of the subsystem now. Subsystems without a
+// maximum age are ignored.
+func (fc *FreshnessCheck) MarkFresh(subsystem string) {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+
+	if _, found := fc.maxAges[subsystem]; found {
+		fc.lastSuccess[subsystem] = time.Now()
+	}
+}
+
+// StartMonitoring activates the staleness checks, counting from now.
+func (fc *FreshnessCheck) StartMonitoring() {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+
+	fc.checkAge = true
+	now := time.Now()
+	for subsystem := range fc.lastSuccess {
+		fc.lastSuccess[subsystem] = now
+	}
+}
+
+// Freshness returns the freshness of all subsystems, sorted by name.
+func (fc *FreshnessCheck) Freshness(now time.Time) []SubsystemFreshness {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+
+	freshness := make([]SubsystemFreshness, 0, len(fc.maxAges))
+	for subsystem, maxAge := range fc.maxAges {
+		age := now.Sub(fc.lastSuccess[subsystem])
+		freshness = append(freshness, SubsystemFreshness{
+			Subsystem:     subsystem,
+			LastSuccess:   fc.lastSuccess[subsystem],
+			AgeSeconds:    age.Seconds(),
+			MaxAgeSeconds: maxAge.Seconds(),
+			Stale:         fc.checkAge && age > maxAge,
+		})
+	}
+	sort.Slice(freshness, func(i, j int) bool {
+		return freshness[i].Subsystem < freshness[j].Subsystem
+	})
+	return freshness
+}
+
+// ServeHTTP implements http.Handler interface to provide the freshness of
+// the subsystems as JSON, with status 500 if any of them is stale.
+func (fc *FreshnessCheck) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	freshness := fc.Freshness(time.Now())
+	status := http.StatusOK
+	for _, subsystem := range freshness {
+		if subsystem.Stale {
+			status = http.StatusInternalServerError
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(freshness); err != nil {
+		klog.Errorf("Failed to write health details: %v", err)
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (fc *FreshnessCheck) Describe(ch chan<- *prometheus.Desc) {
+	ch <- fc.ageDesc
+	ch <- fc.staleDesc
+}
+
+// Collect implements prometheus.Collector.
+func (fc *FreshnessCheck) Collect(ch chan<- prometheus.Metric) {
+	for _, subsystem := range fc.Freshness(time.Now()) {
+		stale := 0.0
+		if subsystem.Stale {
+			stale = 1
+		}
+		ch <- prometheus.MustNewConstMetric(fc.ageDesc, prometheus.GaugeValue, subsystem.AgeSeconds, subsystem.Subsystem)
+		ch <- prometheus.MustNewConstMetric(fc.staleDesc, prometheus.GaugeValue, stale, subsystem.Subsystem)
+	}
+}
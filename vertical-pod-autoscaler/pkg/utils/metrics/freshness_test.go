@@ -0,0 +1,61 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFreshnessCheck(t *testing.T) {
+	check := NewFreshnessCheck("vpa_test", map[string]time.Duration{
+		"metrics_feed": time.Minute,
+		"vpa_sync":     time.Hour,
+	})
+	// Subsystems aren't stale until monitoring starts.
+	for _, subsystem := range check.Freshness(time.Now().Add(2 * time.Minute)) {
+		assert.False(t, subsystem.Stale, subsystem.Subsystem)
+	}
+
+	check.StartMonitoring()
+	check.MarkFresh("vpa_sync")
+	check.MarkFresh("unknown")
+	freshness := check.Freshness(time.Now().Add(2 * time.Minute))
+	assert.Len(t, freshness, 2)
+	assert.Equal(t, "metrics_feed", freshness[0].Subsystem)
+	assert.True(t, freshness[0].Stale)
+	assert.Equal(t, 60.0, freshness[0].MaxAgeSeconds)
+	assert.Equal(t, "vpa_sync", freshness[1].Subsystem)
+	assert.False(t, freshness[1].Stale)
+
+	recorder := httptest.NewRecorder()
+	check.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, healthDetailsPath, nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var served []SubsystemFreshness
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &served))
+	assert.Len(t, served, 2)
+
+	check.maxAges["vpa_sync"] = 0
+	recorder = httptest.NewRecorder()
+	check.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, healthDetailsPath, nil))
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+}
@@ -78,3 +78,12 @@ func (hc *HealthCheck) UpdateLastActivity() {
 
 	hc.lastActivity = time.Now()
 }
+
+// StartMonitoring activates checks of the activity timeout, counting from now.
+func (hc *HealthCheck) StartMonitoring() {
+	hc.mutex.Lock()
+	defer hc.mutex.Unlock()
+
+	hc.checkTimeout = true
+	hc.lastActivity = time.Now()
+}
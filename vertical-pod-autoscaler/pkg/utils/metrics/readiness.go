@@ -0,0 +1,70 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"net/http"
+	"sync"
+
+	"k8s.io/klog/v2"
+)
+
+// ReadinessCheck reports whether the monitored component is ready to serve,
+// e.g. its caches are synced.
+type ReadinessCheck struct {
+	ready bool
+	mutex *sync.Mutex
+}
+
+// NewReadinessCheck builds new ReadinessCheck object, initially not ready.
+func NewReadinessCheck() *ReadinessCheck {
+	return &ReadinessCheck{
+		mutex: &sync.Mutex{},
+	}
+}
+
+// ServeHTTP implements http.Handler interface to provide a readiness-check endpoint.
+func (rc *ReadinessCheck) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mutex.Lock()
+	ready := rc.ready
+	rc.mutex.Unlock()
+	if !ready {
+		http.Error(w, "Error: not ready", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(200)
+	_, err := w.Write([]byte("OK"))
+	if err != nil {
+		klog.Fatalf("Failed to write response message: %v", err)
+	}
+}
+
+// MarkReady marks the component as ready.
+func (rc *ReadinessCheck) MarkReady() {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	rc.ready = true
+}
+
+// MarkNotReady marks the component as not ready, e.g. when it is shutting down.
+func (rc *ReadinessCheck) MarkNotReady() {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	rc.ready = false
+}
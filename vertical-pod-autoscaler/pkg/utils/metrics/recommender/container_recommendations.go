@@ -0,0 +1,149 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package recommender
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	apiv1 "k8s.io/api/core/v1"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+)
+
+var (
+	// Percentiles of the usage of containers exported next to their recommendations.
+	usagePercentiles = []float64{0.5, 0.9, 0.95, 0.99}
+
+	containerRecommendationLabels = []string{"namespace", "vpa", "container", "resource"}
+
+	recommendationTarget = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "recommendation_target",
+			Help:      "Target recommendation of a container of a VPA, in cores for CPU and bytes for memory.",
+		}, containerRecommendationLabels,
+	)
+
+	recommendationLowerBound = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "recommendation_lower_bound",
+			Help:      "Lower bound recommendation of a container of a VPA, in cores for CPU and bytes for memory.",
+		}, containerRecommendationLabels,
+	)
+
+	recommendationUpperBound = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "recommendation_upper_bound",
+			Help:      "Upper bound recommendation of a container of a VPA, in cores for CPU and bytes for memory.",
+		}, containerRecommendationLabels,
+	)
+
+	recommendationUncappedTarget = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "recommendation_uncapped_target",
+			Help:      "Target recommendation of a container of a VPA before capping to the resource policy, in cores for CPU and bytes for memory.",
+		}, containerRecommendationLabels,
+	)
+
+	containerUsagePercentile = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "container_usage_percentile",
+			Help:      "Percentile of the aggregated usage of a container of a VPA, in cores for CPU and bytes for memory peaks.",
+		}, append(containerRecommendationLabels, "percentile"),
+	)
+)
+
+// RegisterContainerRecommendations initializes the per container metrics of
+// VPA Recommender. They have a series per container of every VPA.
+func RegisterContainerRecommendations() {
+	prometheus.MustRegister(recommendationTarget, recommendationLowerBound, recommendationUpperBound, recommendationUncappedTarget, containerUsagePercentile)
+}
+
+type containerKey struct {
+	vpaID     model.VpaID
+	container string
+}
+
+// ContainerRecommendationRecorder records the recommendations and the
+// aggregated usage of the containers of VPAs.
+type ContainerRecommendationRecorder struct {
+	recommendations map[containerKey]vpa_types.RecommendedContainerResources
+	usage           map[containerKey]*model.AggregateContainerState
+}
+
+// NewContainerRecommendationRecorder creates a new helper to record
+// recommendations and usage of containers
+func NewContainerRecommendationRecorder() *ContainerRecommendationRecorder {
+	return &ContainerRecommendationRecorder{
+		recommendations: make(map[containerKey]vpa_types.RecommendedContainerResources),
+		usage:           make(map[containerKey]*model.AggregateContainerState),
+	}
+}
+
+// Add updates the helper state to include the recommendation and usage of the
+// containers of the given VPA
+func (r *ContainerRecommendationRecorder) Add(vpaID model.VpaID, recommendation *vpa_types.RecommendedPodResources, aggregates model.ContainerNameToAggregateStateMap) {
+	if recommendation != nil {
+		for _, containerRecommendation := range recommendation.ContainerRecommendations {
+			r.recommendations[containerKey{vpaID: vpaID, container: containerRecommendation.ContainerName}] = containerRecommendation
+		}
+	}
+	for container, aggregate := range aggregates {
+		r.usage[containerKey{vpaID: vpaID, container: container}] = aggregate
+	}
+}
+
+// Observe passes the recorded values to metrics, dropping containers which
+// weren't added
+func (r *ContainerRecommendationRecorder) Observe() {
+	for _, gauge := range []*prometheus.GaugeVec{recommendationTarget, recommendationLowerBound, recommendationUpperBound, recommendationUncappedTarget, containerUsagePercentile} {
+		gauge.Reset()
+	}
+	for key, recommendation := range r.recommendations {
+		setResources(recommendationTarget, key, recommendation.Target)
+		setResources(recommendationLowerBound, key, recommendation.LowerBound)
+		setResources(recommendationUpperBound, key, recommendation.UpperBound)
+		setResources(recommendationUncappedTarget, key, recommendation.UncappedTarget)
+	}
+	for key, aggregate := range r.usage {
+		for _, percentile := range usagePercentiles {
+			p := strconv.FormatFloat(percentile, 'g', -1, 64)
+			if !aggregate.AggregateCPUUsage.IsEmpty() {
+				containerUsagePercentile.WithLabelValues(key.vpaID.Namespace, key.vpaID.VpaName, key.container, string(model.ResourceCPU), p).
+					Set(aggregate.AggregateCPUUsage.Percentile(percentile))
+			}
+			if !aggregate.AggregateMemoryPeaks.IsEmpty() {
+				containerUsagePercentile.WithLabelValues(key.vpaID.Namespace, key.vpaID.VpaName, key.container, string(model.ResourceMemory), p).
+					Set(aggregate.AggregateMemoryPeaks.Percentile(percentile))
+			}
+		}
+	}
+}
+
+func setResources(gauge *prometheus.GaugeVec, key containerKey, resources apiv1.ResourceList) {
+	if cpu, found := resources[apiv1.ResourceCPU]; found {
+		gauge.WithLabelValues(key.vpaID.Namespace, key.vpaID.VpaName, key.container, string(model.ResourceCPU)).Set(float64(cpu.MilliValue()) / 1000)
+	}
+	if memory, found := resources[apiv1.ResourceMemory]; found {
+		gauge.WithLabelValues(key.vpaID.Namespace, key.vpaID.VpaName, key.container, string(model.ResourceMemory)).Set(float64(memory.Value()))
+	}
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package recommender
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/test"
+)
+
+func TestContainerRecommendationRecorder(t *testing.T) {
+	vpaID := model.VpaID{Namespace: "default", VpaName: "vpa"}
+	aggregate := model.NewAggregateContainerState()
+	aggregate.AddSample(&model.ContainerUsageSample{
+		MeasureStart: time.Now(),
+		Usage:        model.CPUAmountFromCores(1),
+		Resource:     model.ResourceCPU,
+	})
+	recommendation := &vpa_types.RecommendedPodResources{
+		ContainerRecommendations: []vpa_types.RecommendedContainerResources{
+			test.Recommendation().WithContainer("container").WithTarget("250m", "1Gi").GetContainerResources(),
+		},
+	}
+
+	recorder := NewContainerRecommendationRecorder()
+	recorder.Add(vpaID, recommendation, model.ContainerNameToAggregateStateMap{"container": aggregate})
+	recorder.Observe()
+	assert.Equal(t, 0.25, testutil.ToFloat64(recommendationTarget.WithLabelValues("default", "vpa", "container", "cpu")))
+	assert.Equal(t, float64(1<<30), testutil.ToFloat64(recommendationTarget.WithLabelValues("default", "vpa", "container", "memory")))
+	assert.InEpsilon(t, 1.0, testutil.ToFloat64(containerUsagePercentile.WithLabelValues("default", "vpa", "container", "cpu", "0.5")), 0.05)
+	assert.Equal(t, len(usagePercentiles), testutil.CollectAndCount(containerUsagePercentile))
+
+	// Containers which weren't added again are dropped.
+	NewContainerRecommendationRecorder().Observe()
+	assert.Equal(t, 0, testutil.CollectAndCount(recommendationTarget))
+}
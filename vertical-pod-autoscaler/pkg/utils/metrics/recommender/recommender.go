@@ -18,8 +18,11 @@ limitations under the License.
 package recommender
 
 import (
+	"expvar"
 	"fmt"
+	"math"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -32,8 +35,24 @@ const (
 	metricsNamespace = metrics.TopMetricsNamespace + "recommender"
 )
 
+const (
+	// MetricsFeedSubsystem loads usage samples from the metrics API.
+	MetricsFeedSubsystem = "metrics_feed"
+	// VpaSyncSubsystem loads VPA objects into the model.
+	VpaSyncSubsystem = "vpa_sync"
+	// CheckpointWritesSubsystem stores checkpoints of the model.
+	CheckpointWritesSubsystem = "checkpoint_writes"
+)
+
+// freshnessCheck tracks the freshness of the subsystems, nil until
+// RegisterFreshnessCheck is called.
+var freshnessCheck *metrics.FreshnessCheck
+
 var (
-	modes = []string{string(vpa_types.UpdateModeOff), string(vpa_types.UpdateModeInitial), string(vpa_types.UpdateModeRecreate), string(vpa_types.UpdateModeAuto)}
+	// Upper bounds of the buckets VPAs are counted in by recommendation drift.
+	driftBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1.0, math.Inf(1)}
+
+	modes = []string{string(vpa_types.UpdateModeOff), string(vpa_types.UpdateModeInitial), string(vpa_types.UpdateModeRecreate), string(vpa_types.UpdateModeAuto), string(vpa_types.UpdateModeInPlaceOrRecreate)}
 )
 
 type apiVersion string
@@ -80,6 +99,73 @@ var (
 			Help:      "Count of responses to queries to metrics server",
 		}, []string{"is_error", "client_name"},
 	)
+
+	oomObservations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "oom_observations_total",
+			Help:      "Number of OOMs observed by the recommender, by source",
+		}, []string{"source"},
+	)
+
+	duplicatedOoms = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "duplicated_ooms_total",
+			Help:      "Number of OOMs dropped because they were already reported by another source",
+		},
+	)
+
+	containersUsageEstimatedFromPod = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "containers_usage_estimated_from_pod_total",
+			Help:      "Number of container usage snapshots estimated from the usage of their pods because per-container metrics were missing",
+		},
+	)
+
+	duplicateUsageSamples = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "duplicate_usage_samples_total",
+			Help:      "Number of usage samples dropped because a sample of the same container and resource was already read at the same time, by source",
+		}, []string{"source"},
+	)
+
+	recommendationDrift = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "recommendation_drift_ratio",
+			Help:      "Mean relative difference between the requests of running pods of a VPA and its recommended target.",
+		}, []string{"namespace", "vpa", "resource"},
+	)
+
+	vpasByRecommendationDrift = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "vpas_by_recommendation_drift",
+			Help:      "Number of VPAs with running pods by recommendation drift, up to the upper bound given by drift_bucket and above the previous one.",
+		}, []string{"update_mode", "resource", "drift_bucket"},
+	)
+
+	modelObjects = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "model_objects_count",
+			Help:      "Number of objects held by the recommender model, by structure.",
+		}, []string{"structure"},
+	)
+
+	modelMemoryBytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "model_memory_bytes",
+			Help:      "Estimated memory held by the payload of the recommender model, by structure.",
+		}, []string{"structure"},
+	)
+
+	// Last model memory stats, published as an expvar.
+	lastModelMemoryStats atomic.Value
 )
 
 type objectCounterKey struct {
@@ -97,7 +183,10 @@ type ObjectCounter struct {
 
 // Register initializes all metrics for VPA Recommender
 func Register() {
-	prometheus.MustRegister(vpaObjectCount, recommendationLatency, functionLatency, aggregateContainerStatesCount, metricServerResponses)
+	prometheus.MustRegister(vpaObjectCount, recommendationLatency, functionLatency, aggregateContainerStatesCount, metricServerResponses, oomObservations, duplicatedOoms, containersUsageEstimatedFromPod, duplicateUsageSamples, recommendationDrift, vpasByRecommendationDrift, modelObjects, modelMemoryBytes)
+	expvar.Publish("vpa_recommender_model_memory", expvar.Func(func() interface{} {
+		return lastModelMemoryStats.Load()
+	}))
 }
 
 // NewExecutionTimer provides a timer for Recommender's RunOnce execution
@@ -120,6 +209,54 @@ func RecordMetricsServerResponse(err error, clientName string) {
 	metricServerResponses.WithLabelValues(strconv.FormatBool(err != nil), clientName).Inc()
 }
 
+// RecordOomObservation records an OOM reported by the given source
+func RecordOomObservation(source string) {
+	oomObservations.WithLabelValues(source).Inc()
+}
+
+// RecordDuplicatedOom records an OOM dropped as a duplicate of an already observed one
+func RecordDuplicatedOom() {
+	duplicatedOoms.Inc()
+}
+
+// RecordContainersUsageEstimatedFromPod records container usage snapshots estimated from pod usage
+func RecordContainersUsageEstimatedFromPod(count int) {
+	containersUsageEstimatedFromPod.Add(float64(count))
+}
+
+// RecordDuplicateUsageSamples records usage samples of the given source dropped as duplicates
+func RecordDuplicateUsageSamples(source string, count int) {
+	duplicateUsageSamples.WithLabelValues(source).Add(float64(count))
+}
+
+// RegisterFreshnessCheck creates a check of the freshness of the subsystems
+// with the given maximum ages and registers it as metrics
+func RegisterFreshnessCheck(maxAges map[string]time.Duration) *metrics.FreshnessCheck {
+	freshnessCheck = metrics.NewFreshnessCheck(metricsNamespace, maxAges)
+	prometheus.MustRegister(freshnessCheck)
+	return freshnessCheck
+}
+
+// MarkSubsystemFresh records a success of the given subsystem
+func MarkSubsystemFresh(subsystem string) {
+	if freshnessCheck != nil {
+		freshnessCheck.MarkFresh(subsystem)
+	}
+}
+
+// RecordModelMemoryStats records the memory held by the recommender model
+func RecordModelMemoryStats(stats model.MemoryStats) {
+	modelObjects.WithLabelValues("pods").Set(float64(stats.Pods))
+	modelObjects.WithLabelValues("containers").Set(float64(stats.Containers))
+	modelObjects.WithLabelValues("vpas").Set(float64(stats.Vpas))
+	modelObjects.WithLabelValues("aggregate_container_states").Set(float64(stats.AggregateContainerStates))
+	modelObjects.WithLabelValues("histograms").Set(float64(stats.Histograms))
+	modelObjects.WithLabelValues("label_sets").Set(float64(stats.LabelSets))
+	modelMemoryBytes.WithLabelValues("histograms").Set(float64(stats.HistogramBytes))
+	modelMemoryBytes.WithLabelValues("label_sets").Set(float64(stats.LabelSetBytes))
+	lastModelMemoryStats.Store(stats)
+}
+
 // NewObjectCounter creates a new helper to split VPA objects into buckets
 func NewObjectCounter() *ObjectCounter {
 	obj := ObjectCounter{
@@ -182,3 +319,67 @@ func (oc *ObjectCounter) Observe() {
 		).Set(float64(v))
 	}
 }
+
+type driftCounterKey struct {
+	mode     string
+	resource model.ResourceName
+	bucket   float64
+}
+
+// DriftCounter records the recommendation drift of VPAs, per VPA and split
+// into buckets.
+type DriftCounter struct {
+	cnt    map[driftCounterKey]int
+	drifts map[model.VpaID]model.RecommendationDrift
+}
+
+// NewDriftCounter creates a new helper to record recommendation drift of VPAs
+func NewDriftCounter() *DriftCounter {
+	dc := DriftCounter{
+		cnt:    make(map[driftCounterKey]int),
+		drifts: make(map[model.VpaID]model.RecommendationDrift),
+	}
+	// initialize with empty data so we can clean stale gauge values in Observe
+	for _, m := range modes {
+		for _, r := range []model.ResourceName{model.ResourceCPU, model.ResourceMemory} {
+			for _, b := range driftBuckets {
+				dc.cnt[driftCounterKey{mode: m, resource: r, bucket: b}] = 0
+			}
+		}
+	}
+	return &dc
+}
+
+// Add updates the helper state to include the drift of the given VPA
+func (dc *DriftCounter) Add(vpa *model.Vpa, drift model.RecommendationDrift) {
+	mode := string(vpa_types.UpdateModeAuto)
+	if vpa.UpdateMode != nil && string(*vpa.UpdateMode) != "" {
+		mode = string(*vpa.UpdateMode)
+	}
+	dc.drifts[vpa.ID] = drift
+	for resource, value := range drift {
+		for _, b := range driftBuckets {
+			if value <= b {
+				dc.cnt[driftCounterKey{mode: mode, resource: resource, bucket: b}]++
+				break
+			}
+		}
+	}
+}
+
+// Observe passes the recorded drifts to metrics, dropping VPAs which weren't added
+func (dc *DriftCounter) Observe() {
+	recommendationDrift.Reset()
+	for vpaID, drift := range dc.drifts {
+		for resource, value := range drift {
+			recommendationDrift.WithLabelValues(vpaID.Namespace, vpaID.VpaName, string(resource)).Set(value)
+		}
+	}
+	for k, v := range dc.cnt {
+		vpasByRecommendationDrift.WithLabelValues(
+			k.mode,
+			string(k.resource),
+			strconv.FormatFloat(k.bucket, 'g', -1, 64),
+		).Set(float64(v))
+	}
+}
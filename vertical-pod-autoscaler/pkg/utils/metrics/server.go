@@ -0,0 +1,113 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	kube_client "k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+const (
+	healthzPath       = "/healthz"
+	readyzPath        = "/readyz"
+	healthCheckPath   = "/health-check"
+	healthDetailsPath = "/health-details"
+)
+
+// ServerConfig configures serving metrics and health checks.
+type ServerConfig struct {
+	// Address metrics are served at.
+	Address string
+	// HealthAddress serves the health checks at a separate address, so that
+	// probes don't depend on the TLS and authentication settings of Address.
+	// Empty serves them at Address.
+	HealthAddress string
+	// CertFile and KeyFile serve Address over HTTPS if set. They're reloaded
+	// every CertReloadInterval to pick up rotated certificates.
+	CertFile           string
+	KeyFile            string
+	CertReloadInterval time.Duration
+	// KubeClient requires clients of Address to authenticate with a bearer
+	// token, reviewed with a TokenReview, and to be allowed to get the
+	// requested path by a SubjectAccessReview. Health checks are exempt.
+	// Nil serves all clients.
+	KubeClient kube_client.Interface
+	// FreshnessCheck is served at /health-details next to the health checks.
+	// Nil doesn't serve it.
+	FreshnessCheck *FreshnessCheck
+}
+
+// Serve exposes Prometheus metrics, and optionally health checks at
+// /healthz and readiness checks at /readyz, as configured. It fails fatally
+// if the server can't be started.
+func Serve(config ServerConfig, healthCheck *HealthCheck, readinessCheck *ReadinessCheck) {
+	http.Handle("/metrics", promhttp.Handler())
+	healthMux := http.DefaultServeMux
+	if config.HealthAddress != "" {
+		healthMux = http.NewServeMux()
+	}
+	if healthCheck != nil {
+		http.Handle(healthCheckPath, healthCheck)
+		if healthMux != http.DefaultServeMux {
+			healthMux.Handle(healthCheckPath, healthCheck)
+		}
+		healthMux.Handle(healthzPath, healthCheck)
+	}
+	if readinessCheck != nil {
+		healthMux.Handle(readyzPath, readinessCheck)
+	}
+	if config.FreshnessCheck != nil {
+		healthMux.Handle(healthDetailsPath, config.FreshnessCheck)
+	}
+
+	var handler http.Handler = http.DefaultServeMux
+	if config.KubeClient != nil {
+		handler = newAuthHandler(config.KubeClient, handler, healthzPath, readyzPath, healthCheckPath, healthDetailsPath)
+	}
+	server := &http.Server{Addr: config.Address, Handler: handler}
+	if config.CertFile != "" || config.KeyFile != "" {
+		reloader, err := newCertFileReloader(config.CertFile, config.KeyFile)
+		if err != nil {
+			klog.Fatalf("Failed to load metrics server certificate: %v", err)
+		}
+		go reloader.run(config.CertReloadInterval, make(chan struct{}))
+		server.TLSConfig = &tls.Config{
+			GetCertificate: reloader.GetCertificate,
+			MinVersion:     tls.VersionTLS12,
+		}
+	}
+	go func() {
+		var err error
+		if server.TLSConfig != nil {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		klog.Fatalf("Failed to start metrics: %v", err)
+	}()
+	if config.HealthAddress != "" {
+		go func() {
+			err := http.ListenAndServe(config.HealthAddress, healthMux)
+			klog.Fatalf("Failed to start health checks: %v", err)
+		}()
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"strconv"
 
 	"github.com/prometheus/client_golang/prometheus"
+	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/metrics"
 )
 
@@ -59,6 +60,30 @@ var (
 		}, []string{"vpa_size_log2"},
 	)
 
+	inPlaceUpdatedCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "in_place_updated_pods_total",
+			Help:      "Number of Pods resized in place by Updater to apply a new recommendation.",
+		}, []string{"vpa_size_log2"},
+	)
+
+	inPlaceUpdateFallbackCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "in_place_update_fallbacks_total",
+			Help:      "Number of Pods which couldn't be resized in place and fell back to eviction.",
+		}, []string{"vpa_size_log2"},
+	)
+
+	skippedOnDrainingNodeCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "skipped_pods_on_draining_nodes_total",
+			Help:      "Number of times Updater skipped updating a Pod because its node is cordoned or being drained.",
+		}, []string{"vpa_size_log2"},
+	)
+
 	vpasWithEvictablePodsCount = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: metricsNamespace,
@@ -75,13 +100,37 @@ var (
 		}, []string{"vpa_size_log2"},
 	)
 
+	vpasWithCappedRecommendationsCount = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "vpas_with_capped_recommendations_total",
+			Help:      "Number of VPA objects whose uncapped recommendation has exceeded maxAllowed for longer than the threshold.",
+		},
+	)
+
+	podsPendingUpdateCount = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "pods_pending_update_total",
+			Help:      "Number of Pods whose resources differ enough from the recommendation to be updated.",
+		}, []string{"namespace"},
+	)
+
+	pendingUpdateRequestsDelta = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "pending_update_requests_delta",
+			Help:      "Sum of recommended minus current requests of Pods pending an update, in cores for CPU and bytes for memory. Negative values are savings.",
+		}, []string{"namespace", "resource"},
+	)
+
 	functionLatency = metrics.CreateExecutionTimeMetric(metricsNamespace,
 		"Time spent in various parts of VPA Updater main loop.")
 )
 
 // Register initializes all metrics for VPA Updater
 func Register() {
-	prometheus.MustRegister(controlledCount, evictableCount, evictedCount, vpasWithEvictablePodsCount, vpasWithEvictedPodsCount, functionLatency)
+	prometheus.MustRegister(controlledCount, evictableCount, evictedCount, inPlaceUpdatedCount, inPlaceUpdateFallbackCount, skippedOnDrainingNodeCount, vpasWithEvictablePodsCount, vpasWithEvictedPodsCount, vpasWithCappedRecommendationsCount, podsPendingUpdateCount, pendingUpdateRequestsDelta, functionLatency)
 }
 
 // NewExecutionTimer provides a timer for Updater's RunOnce execution
@@ -123,6 +172,44 @@ func AddEvictedPod(vpaSize int) {
 	evictedCount.WithLabelValues(strconv.Itoa(log2)).Inc()
 }
 
+// AddInPlaceUpdatedPod increases the counter of pods resized in place by Updater, by given VPA size
+func AddInPlaceUpdatedPod(vpaSize int) {
+	log2 := metrics.GetVpaSizeLog2(vpaSize)
+	inPlaceUpdatedCount.WithLabelValues(strconv.Itoa(log2)).Inc()
+}
+
+// AddInPlaceUpdateFallback increases the counter of pods which fell back from in-place resize to eviction, by given VPA size
+func AddInPlaceUpdateFallback(vpaSize int) {
+	log2 := metrics.GetVpaSizeLog2(vpaSize)
+	inPlaceUpdateFallbackCount.WithLabelValues(strconv.Itoa(log2)).Inc()
+}
+
+// AddSkippedOnDrainingNode increases the counter of pods not updated because their node is drained, by given VPA size
+func AddSkippedOnDrainingNode(vpaSize int) {
+	log2 := metrics.GetVpaSizeLog2(vpaSize)
+	skippedOnDrainingNodeCount.WithLabelValues(strconv.Itoa(log2)).Inc()
+}
+
+// RecordVpasWithCappedRecommendations records the number of VPA objects whose uncapped recommendation has exceeded maxAllowed for longer than the threshold
+func RecordVpasWithCappedRecommendations(count int) {
+	vpasWithCappedRecommendationsCount.Set(float64(count))
+}
+
+// RecordPendingUpdates records the number of Pods pending an update and the
+// sum of the changes of their requests, by namespace
+func RecordPendingUpdates(pods map[string]int, deltas map[string]map[apiv1.ResourceName]float64) {
+	podsPendingUpdateCount.Reset()
+	for namespace, count := range pods {
+		podsPendingUpdateCount.WithLabelValues(namespace).Set(float64(count))
+	}
+	pendingUpdateRequestsDelta.Reset()
+	for namespace, namespaceDeltas := range deltas {
+		for resource, delta := range namespaceDeltas {
+			pendingUpdateRequestsDelta.WithLabelValues(namespace, string(resource)).Set(delta)
+		}
+	}
+}
+
 // Add increases the counter for the given VPA size
 func (g *SizeBasedGauge) Add(vpaSize int, value int) {
 	log2 := metrics.GetVpaSizeLog2(vpaSize)
@@ -0,0 +1,67 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+)
+
+// NewAggregatedContainerProcessor constructs RecommendationProcessor that resolves
+// recommendations published by the recommender under the value of the given pod
+// label (see --aggregation-container-name-label of the recommender) to the names
+// of the pod containers starting with the label value.
+func NewAggregatedContainerProcessor(label string) RecommendationProcessor {
+	return &aggregatedContainerProcessor{label: label}
+}
+
+type aggregatedContainerProcessor struct {
+	label string
+}
+
+// Apply adds a copy of the recommendation for the aggregation container name for
+// each pod container that has no recommendation of its own and whose name starts
+// with the value of the label.
+func (p *aggregatedContainerProcessor) Apply(podRecommendation *vpa_types.RecommendedPodResources,
+	policy *vpa_types.PodResourcePolicy,
+	conditions []vpa_types.VerticalPodAutoscalerCondition,
+	pod *v1.Pod) (*vpa_types.RecommendedPodResources, ContainerToAnnotationsMap, error) {
+	if podRecommendation == nil || pod == nil || p.label == "" {
+		return podRecommendation, nil, nil
+	}
+	stableName := pod.Labels[p.label]
+	if stableName == "" {
+		return podRecommendation, nil, nil
+	}
+	aggregated := getRecommendationForContainer(stableName, podRecommendation.ContainerRecommendations)
+	if aggregated == nil {
+		return podRecommendation, nil, nil
+	}
+	result := podRecommendation.DeepCopy()
+	for _, container := range pod.Spec.Containers {
+		if !strings.HasPrefix(container.Name, stableName) ||
+			getRecommendationForContainer(container.Name, podRecommendation.ContainerRecommendations) != nil {
+			continue
+		}
+		containerRecommendation := aggregated.DeepCopy()
+		containerRecommendation.ContainerName = container.Name
+		result.ContainerRecommendations = append(result.ContainerRecommendations, *containerRecommendation)
+	}
+	return result, nil, nil
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+)
+
+func TestAggregatedContainerProcessor(t *testing.T) {
+	recommendation := func(name string, cpu string) vpa_types.RecommendedContainerResources {
+		return vpa_types.RecommendedContainerResources{
+			ContainerName: name,
+			Target:        apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse(cpu)},
+		}
+	}
+	pod := &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"stable-name": "worker"}},
+		Spec: apiv1.PodSpec{Containers: []apiv1.Container{
+			{Name: "worker-7f8c9d"}, {Name: "worker-own"}, {Name: "sidecar"},
+		}},
+	}
+	podRecommendation := &vpa_types.RecommendedPodResources{ContainerRecommendations: []vpa_types.RecommendedContainerResources{
+		recommendation("worker", "1"), recommendation("worker-own", "2"), recommendation("sidecar", "3"),
+	}}
+
+	testCases := []struct {
+		name     string
+		label    string
+		pod      *apiv1.Pod
+		expected map[string]string
+	}{
+		{
+			name:     "resolves containers starting with the label value",
+			label:    "stable-name",
+			pod:      pod,
+			expected: map[string]string{"worker": "1", "worker-7f8c9d": "1", "worker-own": "2", "sidecar": "3"},
+		},
+		{
+			name:     "no label configured",
+			label:    "",
+			pod:      pod,
+			expected: map[string]string{"worker": "1", "worker-own": "2", "sidecar": "3"},
+		},
+		{
+			name:     "pod without the label",
+			label:    "other-label",
+			pod:      pod,
+			expected: map[string]string{"worker": "1", "worker-own": "2", "sidecar": "3"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, _, err := NewAggregatedContainerProcessor(tc.label).Apply(podRecommendation, nil, nil, tc.pod)
+			assert.NoError(t, err)
+			got := map[string]string{}
+			for _, r := range result.ContainerRecommendations {
+				got[r.ContainerName] = r.Target.Cpu().String()
+			}
+			assert.Equal(t, tc.expected, got)
+			assert.Len(t, podRecommendation.ContainerRecommendations, 3)
+		})
+	}
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+const (
+	// CPUHistogramDecayHalfLifeAnnotation overrides the CPU histogram decay
+	// half life for the containers of a VPA, e.g. "12h".
+	CPUHistogramDecayHalfLifeAnnotation = "vpa-recommender.k8s.io/cpu-histogram-decay-half-life"
+	// MemoryHistogramDecayHalfLifeAnnotation overrides the memory histogram
+	// decay half life for the containers of a VPA, e.g. "48h".
+	MemoryHistogramDecayHalfLifeAnnotation = "vpa-recommender.k8s.io/memory-histogram-decay-half-life"
+	// TargetCPUPercentileAnnotation overrides the CPU usage percentile the
+	// target recommendation of a VPA is based on, e.g. "0.95".
+	TargetCPUPercentileAnnotation = "vpa-recommender.k8s.io/target-cpu-percentile"
+	// TargetMemoryPercentileAnnotation overrides the memory peaks percentile
+	// the target recommendation of a VPA is based on, e.g. "0.99".
+	TargetMemoryPercentileAnnotation = "vpa-recommender.k8s.io/target-memory-percentile"
+	// LowerBoundConfidenceMultiplierAnnotation overrides the multiplier of
+	// the confidence scaling of the lower bound recommendation of a VPA, e.g.
+	// "0.01".
+	LowerBoundConfidenceMultiplierAnnotation = "vpa-recommender.k8s.io/lower-bound-confidence-multiplier"
+	// LowerBoundConfidenceExponentAnnotation overrides the exponent of the
+	// confidence scaling of the lower bound recommendation of a VPA, e.g. "-1".
+	LowerBoundConfidenceExponentAnnotation = "vpa-recommender.k8s.io/lower-bound-confidence-exponent"
+	// UpperBoundConfidenceMultiplierAnnotation overrides the multiplier of
+	// the confidence scaling of the upper bound recommendation of a VPA, e.g.
+	// "2".
+	UpperBoundConfidenceMultiplierAnnotation = "vpa-recommender.k8s.io/upper-bound-confidence-multiplier"
+	// UpperBoundConfidenceExponentAnnotation overrides the exponent of the
+	// confidence scaling of the upper bound recommendation of a VPA, e.g. "2".
+	UpperBoundConfidenceExponentAnnotation = "vpa-recommender.k8s.io/upper-bound-confidence-exponent"
+)
+
+// AggregationOverrides holds aggregation parameters overridden for the
+// containers of a single VPA. Zero fields keep the global configuration.
+type AggregationOverrides struct {
+	CPUHistogramDecayHalfLife    time.Duration
+	MemoryHistogramDecayHalfLife time.Duration
+	TargetCPUPercentile          float64
+	TargetMemoryPercentile       float64
+
+	// The confidence scaling of the bounds, see logic.WithBoundConfidenceMultiplier.
+	LowerBoundConfidenceMultiplier float64
+	LowerBoundConfidenceExponent   float64
+	UpperBoundConfidenceMultiplier float64
+	UpperBoundConfidenceExponent   float64
+}
+
+// ParseAggregationOverrides reads the aggregation overrides from the
+// annotations of a VPA. Invalid values are skipped and reported in the error.
+func ParseAggregationOverrides(annotations map[string]string) (AggregationOverrides, error) {
+	overrides := AggregationOverrides{}
+	var errs []error
+	parseHalfLife := func(annotation string, halfLife *time.Duration) {
+		value, found := annotations[annotation]
+		if !found {
+			return
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be a positive duration, got %q", annotation, value))
+			return
+		}
+		*halfLife = parsed
+	}
+	parsePercentile := func(annotation string, percentile *float64) {
+		value, found := annotations[annotation]
+		if !found {
+			return
+		}
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed <= 0 || parsed > 1 {
+			errs = append(errs, fmt.Errorf("%s must be a number in (0, 1], got %q", annotation, value))
+			return
+		}
+		*percentile = parsed
+	}
+	parseNumber := func(annotation string, number *float64, positive bool) {
+		value, found := annotations[annotation]
+		if !found {
+			return
+		}
+		parsed, err := strconv.ParseFloat(value, 64)
+		if positive && (err != nil || parsed <= 0) {
+			errs = append(errs, fmt.Errorf("%s must be a positive number, got %q", annotation, value))
+			return
+		}
+		if err != nil || parsed == 0 {
+			errs = append(errs, fmt.Errorf("%s must be a non-zero number, got %q", annotation, value))
+			return
+		}
+		*number = parsed
+	}
+	parseHalfLife(CPUHistogramDecayHalfLifeAnnotation, &overrides.CPUHistogramDecayHalfLife)
+	parseHalfLife(MemoryHistogramDecayHalfLifeAnnotation, &overrides.MemoryHistogramDecayHalfLife)
+	parsePercentile(TargetCPUPercentileAnnotation, &overrides.TargetCPUPercentile)
+	parsePercentile(TargetMemoryPercentileAnnotation, &overrides.TargetMemoryPercentile)
+	parseNumber(LowerBoundConfidenceMultiplierAnnotation, &overrides.LowerBoundConfidenceMultiplier, true)
+	parseNumber(LowerBoundConfidenceExponentAnnotation, &overrides.LowerBoundConfidenceExponent, false)
+	parseNumber(UpperBoundConfidenceMultiplierAnnotation, &overrides.UpperBoundConfidenceMultiplier, true)
+	parseNumber(UpperBoundConfidenceExponentAnnotation, &overrides.UpperBoundConfidenceExponent, false)
+	return overrides, utilerrors.NewAggregate(errs)
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAggregationOverrides(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		expected    AggregationOverrides
+		expectError bool
+	}{
+		{
+			name:     "no annotations",
+			expected: AggregationOverrides{},
+		}, {
+			name: "all overrides",
+			annotations: map[string]string{
+				CPUHistogramDecayHalfLifeAnnotation:    "12h",
+				MemoryHistogramDecayHalfLifeAnnotation: "48h",
+				TargetCPUPercentileAnnotation:          "0.95",
+				TargetMemoryPercentileAnnotation:       "1",
+			},
+			expected: AggregationOverrides{
+				CPUHistogramDecayHalfLife:    12 * time.Hour,
+				MemoryHistogramDecayHalfLife: 48 * time.Hour,
+				TargetCPUPercentile:          0.95,
+				TargetMemoryPercentile:       1,
+			},
+		}, {
+			name: "bound confidence overrides",
+			annotations: map[string]string{
+				LowerBoundConfidenceMultiplierAnnotation: "0.01",
+				LowerBoundConfidenceExponentAnnotation:   "-1",
+				UpperBoundConfidenceMultiplierAnnotation: "0",
+				UpperBoundConfidenceExponentAnnotation:   "none",
+			},
+			expected: AggregationOverrides{
+				LowerBoundConfidenceMultiplier: 0.01,
+				LowerBoundConfidenceExponent:   -1,
+			},
+			expectError: true,
+		}, {
+			name: "invalid values are skipped",
+			annotations: map[string]string{
+				CPUHistogramDecayHalfLifeAnnotation:    "-1h",
+				MemoryHistogramDecayHalfLifeAnnotation: "48h",
+				TargetCPUPercentileAnnotation:          "95",
+				TargetMemoryPercentileAnnotation:       "high",
+			},
+			expected: AggregationOverrides{
+				MemoryHistogramDecayHalfLife: 48 * time.Hour,
+			},
+			expectError: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			overrides, err := ParseAggregationOverrides(tc.annotations)
+			assert.Equal(t, tc.expected, overrides)
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -26,14 +26,12 @@ import (
 	core "k8s.io/api/core/v1"
 	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
 	vpa_clientset "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/client/clientset/versioned"
 	vpa_api "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/client/clientset/versioned/typed/autoscaling.k8s.io/v1"
 	vpa_lister "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/client/listers/autoscaling.k8s.io/v1"
-	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
 )
 
@@ -74,24 +72,48 @@ func UpdateVpaStatusIfNeeded(vpaClient vpa_api.VerticalPodAutoscalerInterface, v
 	return nil, nil
 }
 
+// SetVpaConditionIfNeeded sets the condition of its type in the status of the
+// VPA API object, if the status, reason or message of the condition changed.
+// Other conditions are kept.
+func SetVpaConditionIfNeeded(vpaClient vpa_api.VerticalPodAutoscalerInterface, vpa *vpa_types.VerticalPodAutoscaler,
+	condition vpa_types.VerticalPodAutoscalerCondition) (result *vpa_types.VerticalPodAutoscaler, err error) {
+	conditions := make([]vpa_types.VerticalPodAutoscalerCondition, 0, len(vpa.Status.Conditions)+1)
+	found := false
+	for _, oldCondition := range vpa.Status.Conditions {
+		if oldCondition.Type != condition.Type {
+			conditions = append(conditions, oldCondition)
+			continue
+		}
+		if oldCondition.Status == condition.Status && oldCondition.Reason == condition.Reason &&
+			oldCondition.Message == condition.Message {
+			return nil, nil
+		}
+		if oldCondition.Status == condition.Status {
+			condition.LastTransitionTime = oldCondition.LastTransitionTime
+		}
+		conditions = append(conditions, condition)
+		found = true
+	}
+	if !found {
+		conditions = append(conditions, condition)
+	}
+	patches := []patchRecord{{
+		Op:    "add",
+		Path:  "/status/conditions",
+		Value: conditions,
+	}}
+	return patchVpa(vpaClient, vpa.Name, patches)
+}
+
 // NewVpasLister returns VerticalPodAutoscalerLister configured to fetch all VPA objects from namespace,
 // set namespace to k8sapiv1.NamespaceAll to select all namespaces.
 // The method blocks until vpaLister is initially populated.
 func NewVpasLister(vpaClient *vpa_clientset.Clientset, stopChannel <-chan struct{}, namespace string) vpa_lister.VerticalPodAutoscalerLister {
-	vpaListWatch := cache.NewListWatchFromClient(vpaClient.AutoscalingV1().RESTClient(), "verticalpodautoscalers", namespace, fields.Everything())
-	indexer, controller := cache.NewIndexerInformer(vpaListWatch,
-		&vpa_types.VerticalPodAutoscaler{},
-		1*time.Hour,
-		&cache.ResourceEventHandlerFuncs{},
-		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
-	vpaLister := vpa_lister.NewVerticalPodAutoscalerLister(indexer)
-	go controller.Run(stopChannel)
-	if !cache.WaitForCacheSync(make(chan struct{}), controller.HasSynced) {
-		klog.Fatalf("Failed to sync VPA cache during initialization")
-	} else {
-		klog.Info("Initial VPA synced successfully")
-	}
-	return vpaLister
+	filter := &VpaObjectFilter{
+		namespaces: parseNamespaces(namespace),
+		selector:   labels.Everything(),
+	}
+	return NewFilteredVpasLister(vpaClient, stopChannel, filter)
 }
 
 // PodMatchesVPA returns true iff the vpaWithSelector matches the Pod.
@@ -147,6 +169,24 @@ func GetUpdateMode(vpa *vpa_types.VerticalPodAutoscaler) vpa_types.UpdateMode {
 	return *vpa.Spec.UpdatePolicy.UpdateMode
 }
 
+// GetObservationGracePeriodEnd returns when the
+// updatePolicy.observationGracePeriod of a given VPA ends, or zero time if it
+// isn't specified.
+func GetObservationGracePeriodEnd(vpa *vpa_types.VerticalPodAutoscaler) time.Time {
+	if vpa.Spec.UpdatePolicy == nil || vpa.Spec.UpdatePolicy.ObservationGracePeriod == nil {
+		return time.Time{}
+	}
+	return vpa.CreationTimestamp.Add(vpa.Spec.UpdatePolicy.ObservationGracePeriod.Duration)
+}
+
+// InObservationGracePeriod returns true if a given VPA is in its observation
+// grace period at the given time, i.e. pods keep the resources requested by
+// their users.
+func InObservationGracePeriod(vpa *vpa_types.VerticalPodAutoscaler, now time.Time) bool {
+	end := GetObservationGracePeriodEnd(vpa)
+	return !end.IsZero() && now.Before(end)
+}
+
 // GetContainerResourcePolicy returns the ContainerResourcePolicy for a given policy
 // and container name. It returns nil if there is no policy specified for the container.
 func GetContainerResourcePolicy(containerName string, policy *vpa_types.PodResourcePolicy) *vpa_types.ContainerResourcePolicy {
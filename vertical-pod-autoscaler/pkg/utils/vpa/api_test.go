@@ -157,6 +157,18 @@ func TestGetControllingVPAForPod(t *testing.T) {
 	assert.Equal(t, vpaA, chosen.Vpa)
 }
 
+func TestInObservationGracePeriod(t *testing.T) {
+	created := time.Unix(1000, 0)
+	vpa := test.VerticalPodAutoscaler().WithContainer(containerName).WithCreationTimestamp(created).Get()
+	assert.True(t, GetObservationGracePeriodEnd(vpa).IsZero())
+	assert.False(t, InObservationGracePeriod(vpa, created))
+
+	vpa.Spec.UpdatePolicy = &vpa_types.PodUpdatePolicy{ObservationGracePeriod: &meta.Duration{Duration: time.Hour}}
+	assert.Equal(t, created.Add(time.Hour), GetObservationGracePeriodEnd(vpa))
+	assert.True(t, InObservationGracePeriod(vpa, created.Add(59*time.Minute)))
+	assert.False(t, InObservationGracePeriod(vpa, created.Add(time.Hour)))
+}
+
 func TestGetContainerResourcePolicy(t *testing.T) {
 	containerPolicy1 := vpa_types.ContainerResourcePolicy{
 		ContainerName: "container1",
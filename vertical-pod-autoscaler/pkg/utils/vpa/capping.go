@@ -18,6 +18,7 @@ package api
 
 import (
 	"fmt"
+	"sort"
 
 	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -139,12 +140,25 @@ func getCappedRecommendationForContainer(
 	return cappedRecommendations, cappingAnnotations, nil
 }
 
+// SortedResourceNames returns names of the resources in the list in a stable
+// order, so that patches and annotations derived from the list don't depend on
+// the map iteration order.
+func SortedResourceNames(resources apiv1.ResourceList) []apiv1.ResourceName {
+	names := make([]apiv1.ResourceName, 0, len(resources))
+	for name := range resources {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
 // capRecommendationToContainerLimit makes sure recommendation is not above current limit for the container.
 // If this function makes adjustments appropriate annotations are returned.
 func capRecommendationToContainerLimit(recommendation apiv1.ResourceList, container apiv1.Container) []string {
 	annotations := make([]string, 0)
 	// Iterate over limits set in the container. Unset means Infinite limit.
-	for resourceName, limit := range container.Resources.Limits {
+	for _, resourceName := range SortedResourceNames(container.Resources.Limits) {
+		limit := container.Resources.Limits[resourceName]
 		recommendedValue, found := recommendation[resourceName]
 		if found && recommendedValue.MilliValue() > limit.MilliValue() {
 			recommendation[resourceName] = limit
@@ -160,7 +174,8 @@ func applyVPAPolicy(recommendation apiv1.ResourceList, policy *vpa_types.Contain
 		return nil
 	}
 	annotations := make([]string, 0)
-	for resourceName, recommended := range recommendation {
+	for _, resourceName := range SortedResourceNames(recommendation) {
+		recommended := recommendation[resourceName]
 		cappedToMin, isCapped := maybeCapToPolicyMin(recommended, resourceName, policy)
 		recommendation[resourceName] = cappedToMin
 		if isCapped {
@@ -292,7 +307,8 @@ func applyContainerLimitRange(recommendation apiv1.ResourceList, container apiv1
 	}
 	maxAllowedRecommendation := getMaxAllowedRecommendation(recommendation, container, limitRange)
 	minAllowedRecommendation := getMinAllowedRecommendation(recommendation, container, limitRange)
-	for resourceName, recommended := range recommendation {
+	for _, resourceName := range SortedResourceNames(recommendation) {
+		recommended := recommendation[resourceName]
 		cappedToMin, isCapped := maybeCapToMin(recommended, resourceName, minAllowedRecommendation)
 		recommendation[resourceName] = cappedToMin
 		if isCapped {
@@ -0,0 +1,182 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	vpa_clientset "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/client/clientset/versioned"
+	vpa_lister "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/client/listers/autoscaling.k8s.io/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// VpaObjectFilter selects the VPA objects processed by a VPA component by
+// their namespace and labels.
+type VpaObjectFilter struct {
+	// Empty selects all namespaces.
+	namespaces        map[string]bool
+	ignoredNamespaces map[string]bool
+	selector          labels.Selector
+}
+
+// NewVpaObjectFilter creates a VpaObjectFilter from a comma separated list of
+// namespaces, empty for all namespaces, a comma separated list of ignored
+// namespaces and a label selector, empty for all labels.
+func NewVpaObjectFilter(namespaces, ignoredNamespaces, labelSelector string) (*VpaObjectFilter, error) {
+	selector, err := labels.Parse(labelSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VPA object label selector %q: %v", labelSelector, err)
+	}
+	return &VpaObjectFilter{
+		namespaces:        parseNamespaces(namespaces),
+		ignoredNamespaces: parseNamespaces(ignoredNamespaces),
+		selector:          selector,
+	}, nil
+}
+
+func parseNamespaces(namespaces string) map[string]bool {
+	parsed := make(map[string]bool)
+	for _, namespace := range strings.Split(namespaces, ",") {
+		if namespace = strings.TrimSpace(namespace); namespace != "" {
+			parsed[namespace] = true
+		}
+	}
+	return parsed
+}
+
+// Namespace returns the namespace to watch for objects related to the
+// selected VPA objects: the selected namespace if there is only one, all
+// namespaces otherwise.
+func (f *VpaObjectFilter) Namespace() string {
+	if len(f.namespaces) == 1 {
+		for namespace := range f.namespaces {
+			return namespace
+		}
+	}
+	return core.NamespaceAll
+}
+
+// Namespaces returns the selected namespaces, without the ignored ones, in
+// increasing order, or nil if all namespaces are selected.
+func (f *VpaObjectFilter) Namespaces() []string {
+	if len(f.namespaces) == 0 {
+		return nil
+	}
+	namespaces := make([]string, 0, len(f.namespaces))
+	for namespace := range f.namespaces {
+		if !f.ignoredNamespaces[namespace] {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// MatchesNamespace returns true iff VPA objects in the namespace may be selected.
+func (f *VpaObjectFilter) MatchesNamespace(namespace string) bool {
+	if f.ignoredNamespaces[namespace] {
+		return false
+	}
+	return len(f.namespaces) == 0 || f.namespaces[namespace]
+}
+
+// Matches returns true iff the VPA object is selected.
+func (f *VpaObjectFilter) Matches(vpa *vpa_types.VerticalPodAutoscaler) bool {
+	return f.MatchesNamespace(vpa.Namespace) && f.selector.Matches(labels.Set(vpa.Labels))
+}
+
+// NewFilteredVpasLister returns VerticalPodAutoscalerLister configured to
+// fetch the VPA objects selected by the filter.
+// The method blocks until vpaLister is initially populated.
+func NewFilteredVpasLister(vpaClient *vpa_clientset.Clientset, stopChannel <-chan struct{}, filter *VpaObjectFilter) vpa_lister.VerticalPodAutoscalerLister {
+	vpaListWatch := cache.NewFilteredListWatchFromClient(vpaClient.AutoscalingV1().RESTClient(), "verticalpodautoscalers", filter.Namespace(), func(options *meta.ListOptions) {
+		options.LabelSelector = filter.selector.String()
+	})
+	indexer, controller := cache.NewIndexerInformer(vpaListWatch,
+		&vpa_types.VerticalPodAutoscaler{},
+		1*time.Hour,
+		&cache.ResourceEventHandlerFuncs{},
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	vpaLister := vpa_lister.NewVerticalPodAutoscalerLister(indexer)
+	go controller.Run(stopChannel)
+	if !cache.WaitForCacheSync(make(chan struct{}), controller.HasSynced) {
+		klog.Fatalf("Failed to sync VPA cache during initialization")
+	} else {
+		klog.Info("Initial VPA synced successfully")
+	}
+	return NewFilteringVpaLister(vpaLister, filter)
+}
+
+type filteringVpaLister struct {
+	lister vpa_lister.VerticalPodAutoscalerLister
+	filter *VpaObjectFilter
+}
+
+// NewFilteringVpaLister returns a VerticalPodAutoscalerLister listing only
+// the VPA objects of the given lister selected by the filter.
+func NewFilteringVpaLister(lister vpa_lister.VerticalPodAutoscalerLister, filter *VpaObjectFilter) vpa_lister.VerticalPodAutoscalerLister {
+	return &filteringVpaLister{lister: lister, filter: filter}
+}
+
+func (l *filteringVpaLister) List(selector labels.Selector) ([]*vpa_types.VerticalPodAutoscaler, error) {
+	vpas, err := l.lister.List(selector)
+	return l.filter.filter(vpas), err
+}
+
+func (l *filteringVpaLister) VerticalPodAutoscalers(namespace string) vpa_lister.VerticalPodAutoscalerNamespaceLister {
+	return &filteringVpaNamespaceLister{lister: l.lister.VerticalPodAutoscalers(namespace), filter: l.filter}
+}
+
+type filteringVpaNamespaceLister struct {
+	lister vpa_lister.VerticalPodAutoscalerNamespaceLister
+	filter *VpaObjectFilter
+}
+
+func (l *filteringVpaNamespaceLister) List(selector labels.Selector) ([]*vpa_types.VerticalPodAutoscaler, error) {
+	vpas, err := l.lister.List(selector)
+	return l.filter.filter(vpas), err
+}
+
+func (l *filteringVpaNamespaceLister) Get(name string) (*vpa_types.VerticalPodAutoscaler, error) {
+	vpa, err := l.lister.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if !l.filter.Matches(vpa) {
+		return nil, apierrors.NewNotFound(vpa_types.Resource("verticalpodautoscaler"), name)
+	}
+	return vpa, nil
+}
+
+func (f *VpaObjectFilter) filter(vpas []*vpa_types.VerticalPodAutoscaler) []*vpa_types.VerticalPodAutoscaler {
+	filtered := make([]*vpa_types.VerticalPodAutoscaler, 0, len(vpas))
+	for _, vpa := range vpas {
+		if f.Matches(vpa) {
+			filtered = append(filtered, vpa)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	vpa_lister "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/client/listers/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/test"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newLabeledVpa(namespace, name string, vpaLabels map[string]string) *vpa_types.VerticalPodAutoscaler {
+	vpa := test.VerticalPodAutoscaler().WithName(name).WithNamespace(namespace).WithContainer(containerName).Get()
+	vpa.Labels = vpaLabels
+	return vpa
+}
+
+func TestVpaObjectFilter(t *testing.T) {
+	tenantA := map[string]string{"tenant": "a"}
+	tenantB := map[string]string{"tenant": "b"}
+	testCases := []struct {
+		name              string
+		namespaces        string
+		ignoredNamespaces string
+		labelSelector     string
+		expectedNamespace string
+		vpa               *vpa_types.VerticalPodAutoscaler
+		expectedMatch     bool
+	}{{
+		name:              "all",
+		expectedNamespace: core.NamespaceAll,
+		vpa:               newLabeledVpa("ns-1", "vpa", nil),
+		expectedMatch:     true,
+	}, {
+		name:              "single namespace",
+		namespaces:        "ns-1",
+		expectedNamespace: "ns-1",
+		vpa:               newLabeledVpa("ns-1", "vpa", nil),
+		expectedMatch:     true,
+	}, {
+		name:              "namespace not in list",
+		namespaces:        "ns-1, ns-2",
+		expectedNamespace: core.NamespaceAll,
+		vpa:               newLabeledVpa("ns-3", "vpa", nil),
+		expectedMatch:     false,
+	}, {
+		name:              "namespace in list",
+		namespaces:        "ns-1, ns-2",
+		expectedNamespace: core.NamespaceAll,
+		vpa:               newLabeledVpa("ns-2", "vpa", nil),
+		expectedMatch:     true,
+	}, {
+		name:              "ignored namespace",
+		ignoredNamespaces: "kube-system,ns-1",
+		expectedNamespace: core.NamespaceAll,
+		vpa:               newLabeledVpa("ns-1", "vpa", nil),
+		expectedMatch:     false,
+	}, {
+		name:              "matching labels",
+		labelSelector:     "tenant=a",
+		expectedNamespace: core.NamespaceAll,
+		vpa:               newLabeledVpa("ns-1", "vpa", tenantA),
+		expectedMatch:     true,
+	}, {
+		name:              "labels not matching",
+		labelSelector:     "tenant=a",
+		expectedNamespace: core.NamespaceAll,
+		vpa:               newLabeledVpa("ns-1", "vpa", tenantB),
+		expectedMatch:     false,
+	}}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			filter, err := NewVpaObjectFilter(tc.namespaces, tc.ignoredNamespaces, tc.labelSelector)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedNamespace, filter.Namespace())
+			assert.Equal(t, tc.expectedMatch, filter.Matches(tc.vpa))
+		})
+	}
+}
+
+func TestVpaObjectFilterNamespaces(t *testing.T) {
+	filter, err := NewVpaObjectFilter("ns-2, ns-1,ns-3", "ns-3", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ns-1", "ns-2"}, filter.Namespaces())
+
+	filter, err = NewVpaObjectFilter("", "ns-3", "")
+	assert.NoError(t, err)
+	assert.Nil(t, filter.Namespaces())
+}
+
+func TestNewVpaObjectFilterInvalidSelector(t *testing.T) {
+	_, err := NewVpaObjectFilter("", "", "tenant in (a")
+	assert.Error(t, err)
+}
+
+func TestFilteringVpaLister(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, vpa := range []*vpa_types.VerticalPodAutoscaler{
+		newLabeledVpa("ns-1", "vpa-1", map[string]string{"tenant": "a"}),
+		newLabeledVpa("ns-1", "vpa-2", map[string]string{"tenant": "b"}),
+		newLabeledVpa("ns-2", "vpa-1", map[string]string{"tenant": "a"}),
+	} {
+		assert.NoError(t, indexer.Add(vpa))
+	}
+	filter, err := NewVpaObjectFilter("", "ns-2", "tenant=a")
+	assert.NoError(t, err)
+	lister := NewFilteringVpaLister(vpa_lister.NewVerticalPodAutoscalerLister(indexer), filter)
+
+	vpas, err := lister.List(labels.Everything())
+	assert.NoError(t, err)
+	if assert.Len(t, vpas, 1) {
+		assert.Equal(t, "ns-1", vpas[0].Namespace)
+		assert.Equal(t, "vpa-1", vpas[0].Name)
+	}
+	vpas, err = lister.VerticalPodAutoscalers("ns-2").List(labels.Everything())
+	assert.NoError(t, err)
+	assert.Empty(t, vpas)
+
+	vpa, err := lister.VerticalPodAutoscalers("ns-1").Get("vpa-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "vpa-1", vpa.Name)
+	_, err = lister.VerticalPodAutoscalers("ns-1").Get("vpa-2")
+	assert.True(t, apierrors.IsNotFound(err))
+}